@@ -0,0 +1,567 @@
+package backendbasics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"gitlab.com/efronlicht/blog/articles/backendbasics/middleware"
+)
+
+type piece byte
+
+const (
+	empty piece = iota
+	whitePawn
+	whiteKnight
+	whiteBishop
+	whiteRook
+	whiteQueen
+	whiteKing
+	_
+	_
+	blackPawn
+	blackKnight
+	blackBishop
+	blackRook
+	blackQueen
+	blackKing
+)
+
+// blackOffset turns a white piece into the black one: whitePawn+blackOffset == blackPawn.
+const blackOffset = blackPawn - whitePawn
+
+func (p piece) isWhite() bool { return whitePawn <= p && p <= whiteKing }
+func (p piece) isBlack() bool { return blackPawn <= p && p <= blackKing }
+
+// ownedBy reports whether p is one of white's pieces (if white is set) or black's.
+func (p piece) ownedBy(white bool) bool {
+	if white {
+		return p.isWhite()
+	}
+	return p.isBlack()
+}
+
+// kind is the white version of p, so pieces can be compared regardless of color: blackKnight.kind() == whiteKnight.
+func (p piece) kind() piece {
+	if p.isBlack() {
+		return p - blackOffset
+	}
+	return p
+}
+
+// colored is the white piece p, in white's color if white is set, or black's.
+func (p piece) colored(white bool) piece {
+	if white {
+		return p.kind()
+	}
+	return p.kind() + blackOffset
+}
+
+// Square is a square on the board. X is the file, from 0 (a) to 7 (h); Y is the rank, from 0 (1, white's side) to 7 (8, black's side).
+// Boards are indexed board[Y][X], so board[0][4] is e1, where the white king starts.
+type Square struct{ X, Y int8 }
+
+func (s Square) onBoard() bool { return 0 <= s.X && s.X < 8 && 0 <= s.Y && s.Y < 8 }
+
+// String is algebraic notation: Square{4, 3} is "e4".
+func (s Square) String() string { return string([]byte{'a' + byte(s.X), '1' + byte(s.Y)}) }
+
+type Move struct {
+	From, To Square
+	White    bool
+	// Promotion is the piece a pawn reaching the last rank becomes: a knight, bishop, rook, or queen, in either color. It's required then, and ignored otherwise.
+	Promotion piece
+	Previous  [8][8]piece
+}
+
+// Position is everything that decides which moves are legal: the board, whose turn it is, and what the board doesn't show.
+// The zero Position is an empty board with black to move: start with StartPosition.
+type Position struct {
+	Board       [8][8]piece
+	WhiteToMove bool
+	// Castling rights: whether each king and rook has stayed put, so far. Castling also needs the squares between them empty and safe.
+	WhiteKingside, WhiteQueenside, BlackKingside, BlackQueenside bool
+	// EnPassant is the square a pawn skipped over moving two squares last turn, so an enemy pawn can capture onto it.
+	// The zero Square, a1, means there isn't one: it can never be an en passant square, which are always on the 3rd or 6th rank.
+	EnPassant Square
+	// HalfMoves is the number of moves since the last capture or pawn move, for the fifty-move rule.
+	HalfMoves int
+	// FullMoves counts the moves, starting at 1 and going up after black's.
+	FullMoves int
+}
+
+// StartPosition is a new game, with white to move.
+func StartPosition() Position {
+	back := [8]piece{whiteRook, whiteKnight, whiteBishop, whiteQueen, whiteKing, whiteBishop, whiteKnight, whiteRook}
+	p := Position{WhiteToMove: true, WhiteKingside: true, WhiteQueenside: true, BlackKingside: true, BlackQueenside: true, FullMoves: 1}
+	for x := range back {
+		p.Board[0][x], p.Board[1][x] = back[x], whitePawn
+		p.Board[7][x], p.Board[6][x] = back[x]+blackOffset, blackPawn
+	}
+	return p
+}
+
+func (p *Position) at(s Square) piece { return p.Board[s.Y][s.X] }
+
+// Status is whether a game is still going, and if not, why.
+type Status byte
+
+const (
+	Ongoing Status = iota
+	Checkmate
+	Stalemate
+	FiftyMoveRule
+	InsufficientMaterial
+)
+
+func (s Status) String() string {
+	switch s {
+	case Ongoing:
+		return "ongoing"
+	case Checkmate:
+		return "checkmate"
+	case Stalemate:
+		return "stalemate"
+	case FiftyMoveRule:
+		return "draw by the fifty-move rule"
+	case InsufficientMaterial:
+		return "draw by insufficient material"
+	default:
+		return fmt.Sprintf("Status(%d)", byte(s))
+	}
+}
+
+// Status reports whether the game is over. It doesn't know the history, so it can't detect threefold repetition.
+func (p Position) Status() Status {
+	noMoves := len(p.LegalMoves()) == 0
+	switch {
+	case noMoves && p.InCheck():
+		return Checkmate
+	case noMoves:
+		return Stalemate
+	case p.HalfMoves >= 100: // 50 moves by each player.
+		return FiftyMoveRule
+	case p.insufficientMaterial():
+		return InsufficientMaterial
+	default:
+		return Ongoing
+	}
+}
+
+// ErrGameOver is returned by NextMove after checkmate or a draw.
+var ErrGameOver = errors.New("game is over")
+
+// NextMove checks that m is legal in p, and returns the position after it.
+// It returns an error if it's not m.White's turn, the game is over, or m is against the rules: moving a piece the wrong way,
+// through another piece, onto one of your own, or leaving your own king in check, castling out of, through, or into check,
+// or moving a pawn to the last rank without a Promotion.
+func NextMove(p Position, m Move) (Position, error) {
+	next, _, err := nextMove(p, m)
+	return next, err
+}
+
+// nextMove is NextMove, also returning the legal move m matched: the one to remember, since m's Promotion is whatever the client sent,
+// even when the move isn't a promotion at all.
+func nextMove(p Position, m Move) (Position, Move, error) {
+	if m.White != p.WhiteToMove {
+		return p, Move{}, fmt.Errorf("not %s's turn", color(m.White))
+	}
+	if status := p.Status(); status != Ongoing {
+		return p, Move{}, fmt.Errorf("%w: %s", ErrGameOver, status)
+	}
+	if !m.From.onBoard() || !m.To.onBoard() {
+		return p, Move{}, fmt.Errorf("move %s-%s is off the board", m.From, m.To)
+	}
+	if pc := p.at(m.From); !pc.ownedBy(m.White) {
+		return p, Move{}, fmt.Errorf("no %s piece on %s", color(m.White), m.From)
+	}
+	if m.Promotion != empty {
+		m.Promotion = m.Promotion.colored(m.White)
+	}
+	for _, legal := range p.LegalMoves() {
+		if legal.From != m.From || legal.To != m.To {
+			continue
+		}
+		if legal.Promotion != empty && legal.Promotion != m.Promotion {
+			if m.Promotion == empty {
+				return p, Move{}, fmt.Errorf("pawn reaching %s needs a Promotion", m.To)
+			}
+			continue
+		}
+		return p.apply(legal), legal, nil
+	}
+	return p, Move{}, fmt.Errorf("illegal move %s-%s", m.From, m.To)
+}
+
+func color(white bool) string {
+	if white {
+		return "white"
+	}
+	return "black"
+}
+
+// InCheck reports whether the side to move is in check.
+func (p Position) InCheck() bool {
+	king, ok := p.find(whiteKing.colored(p.WhiteToMove))
+	return ok && p.attacked(king, !p.WhiteToMove)
+}
+
+// find returns the square pc is on, if it's on the board.
+func (p *Position) find(pc piece) (Square, bool) {
+	for y := int8(0); y < 8; y++ {
+		for x := int8(0); x < 8; x++ {
+			if p.Board[y][x] == pc {
+				return Square{x, y}, true
+			}
+		}
+	}
+	return Square{}, false
+}
+
+var (
+	knightJumps      = [8]Square{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}}
+	kingSteps        = [8]Square{{0, 1}, {1, 1}, {1, 0}, {1, -1}, {0, -1}, {-1, -1}, {-1, 0}, {-1, 1}}
+	rookDirections   = [4]Square{{0, 1}, {1, 0}, {0, -1}, {-1, 0}}
+	bishopDirections = [4]Square{{1, 1}, {1, -1}, {-1, -1}, {-1, 1}}
+	promotions       = [4]piece{whiteQueen, whiteRook, whiteBishop, whiteKnight}
+)
+
+func (s Square) plus(d Square) Square { return Square{s.X + d.X, s.Y + d.Y} }
+
+// attacked reports whether s is attacked by white's pieces (if byWhite is set) or black's.
+func (p *Position) attacked(s Square, byWhite bool) bool {
+	// look outwards from s for each kind of piece that could be attacking it.
+	pawnDir := int8(-1) // white pawns attack upwards, so they're below s.
+	if !byWhite {
+		pawnDir = 1
+	}
+	for _, dx := range [2]int8{-1, 1} {
+		if t := (Square{s.X + dx, s.Y + pawnDir}); t.onBoard() && p.at(t) == whitePawn.colored(byWhite) {
+			return true
+		}
+	}
+	for _, d := range knightJumps {
+		if t := s.plus(d); t.onBoard() && p.at(t) == whiteKnight.colored(byWhite) {
+			return true
+		}
+	}
+	for _, d := range kingSteps {
+		if t := s.plus(d); t.onBoard() && p.at(t) == whiteKing.colored(byWhite) {
+			return true
+		}
+	}
+	slides := func(dirs [4]Square, a, b piece) bool {
+		for _, d := range dirs {
+			for t := s.plus(d); t.onBoard(); t = t.plus(d) {
+				if pc := p.at(t); pc != empty {
+					if pc == a.colored(byWhite) || pc == b.colored(byWhite) {
+						return true
+					}
+					break
+				}
+			}
+		}
+		return false
+	}
+	return slides(rookDirections, whiteRook, whiteQueen) || slides(bishopDirections, whiteBishop, whiteQueen)
+}
+
+// LegalMoves returns every legal move for the side to move.
+func (p Position) LegalMoves() []Move {
+	var legal []Move
+	for _, m := range p.pseudoLegal() {
+		next := p.apply(m)
+		next.WhiteToMove = p.WhiteToMove // look at it from the mover's side: are they in check?
+		if !next.InCheck() {
+			legal = append(legal, m)
+		}
+	}
+	return legal
+}
+
+// pseudoLegal returns the moves that follow the rules for how pieces move, without checking whether they leave the mover's king in check.
+// Castling's the exception: it's only generated if the king isn't in check and doesn't pass through an attacked square.
+func (p *Position) pseudoLegal() []Move {
+	var moves []Move
+	white := p.WhiteToMove
+	add := func(from, to Square) {
+		moves = append(moves, Move{From: from, To: to, White: white, Previous: p.Board})
+	}
+	for y := int8(0); y < 8; y++ {
+		for x := int8(0); x < 8; x++ {
+			from := Square{x, y}
+			pc := p.at(from)
+			if !pc.ownedBy(white) {
+				continue
+			}
+			switch pc.kind() {
+			case whitePawn:
+				p.pawnMoves(from, &moves)
+			case whiteKnight, whiteKing:
+				steps := knightJumps
+				if pc.kind() == whiteKing {
+					steps = kingSteps
+				}
+				for _, d := range steps {
+					if to := from.plus(d); to.onBoard() && !p.at(to).ownedBy(white) {
+						add(from, to)
+					}
+				}
+			default: // sliders.
+				var dirs []Square
+				if k := pc.kind(); k == whiteRook || k == whiteQueen {
+					dirs = append(dirs, rookDirections[:]...)
+				}
+				if k := pc.kind(); k == whiteBishop || k == whiteQueen {
+					dirs = append(dirs, bishopDirections[:]...)
+				}
+				for _, d := range dirs {
+					for to := from.plus(d); to.onBoard(); to = to.plus(d) {
+						if p.at(to).ownedBy(white) {
+							break
+						}
+						add(from, to)
+						if p.at(to) != empty {
+							break // a capture: can't go any further.
+						}
+					}
+				}
+			}
+		}
+	}
+	p.castlingMoves(&moves)
+	return moves
+}
+
+func (p *Position) pawnMoves(from Square, moves *[]Move) {
+	white := p.WhiteToMove
+	dir, start, last := int8(1), int8(1), int8(7)
+	if !white {
+		dir, start, last = -1, 6, 0
+	}
+	add := func(to Square) {
+		if to.Y != last {
+			*moves = append(*moves, Move{From: from, To: to, White: white, Previous: p.Board})
+			return
+		}
+		for _, promo := range promotions {
+			*moves = append(*moves, Move{From: from, To: to, White: white, Promotion: promo.colored(white), Previous: p.Board})
+		}
+	}
+	if one := (Square{from.X, from.Y + dir}); one.onBoard() && p.at(one) == empty {
+		add(one)
+		if two := (Square{from.X, from.Y + 2*dir}); from.Y == start && p.at(two) == empty {
+			add(two)
+		}
+	}
+	for _, dx := range [2]int8{-1, 1} {
+		to := Square{from.X + dx, from.Y + dir}
+		if !to.onBoard() {
+			continue
+		}
+		if p.at(to).ownedBy(!white) || (to == p.EnPassant && p.EnPassant != Square{}) {
+			add(to)
+		}
+	}
+}
+
+// castlingMoves adds the castling moves: the king moving two squares towards a rook. The rook's half happens in apply.
+func (p *Position) castlingMoves(moves *[]Move) {
+	white := p.WhiteToMove
+	y, kingside, queenside := int8(0), p.WhiteKingside, p.WhiteQueenside
+	if !white {
+		y, kingside, queenside = 7, p.BlackKingside, p.BlackQueenside
+	}
+	king := Square{4, y}
+	if p.at(king) != whiteKing.colored(white) || p.attacked(king, !white) {
+		return
+	}
+	clear := func(xs ...int8) bool {
+		for _, x := range xs {
+			if p.Board[y][x] != empty {
+				return false
+			}
+		}
+		return true
+	}
+	safe := func(xs ...int8) bool {
+		for _, x := range xs {
+			if p.attacked(Square{x, y}, !white) {
+				return false
+			}
+		}
+		return true
+	}
+	if kingside && p.Board[y][7] == whiteRook.colored(white) && clear(5, 6) && safe(5, 6) {
+		*moves = append(*moves, Move{From: king, To: Square{6, y}, White: white, Previous: p.Board})
+	}
+	if queenside && p.Board[y][0] == whiteRook.colored(white) && clear(1, 2, 3) && safe(2, 3) {
+		*moves = append(*moves, Move{From: king, To: Square{2, y}, White: white, Previous: p.Board})
+	}
+}
+
+// apply makes the move m, which must be pseudo-legal, and returns the resulting position.
+func (p Position) apply(m Move) Position {
+	pc := p.at(m.From)
+	captured := p.at(m.To)
+	p.Board[m.To.Y][m.To.X], p.Board[m.From.Y][m.From.X] = pc, empty
+	switch {
+	case pc.kind() == whitePawn && m.To == p.EnPassant && p.EnPassant != (Square{}) && captured == empty: // en passant: the captured pawn is behind the target.
+		captured, p.Board[m.From.Y][m.To.X] = p.Board[m.From.Y][m.To.X], empty
+	case pc.kind() == whitePawn && m.Promotion != empty:
+		p.Board[m.To.Y][m.To.X] = m.Promotion
+	case pc.kind() == whiteKing && m.To.X-m.From.X == 2: // kingside castling: the rook goes to the other side of the king.
+		p.Board[m.To.Y][5], p.Board[m.To.Y][7] = p.Board[m.To.Y][7], empty
+	case pc.kind() == whiteKing && m.From.X-m.To.X == 2: // queenside.
+		p.Board[m.To.Y][3], p.Board[m.To.Y][0] = p.Board[m.To.Y][0], empty
+	}
+
+	// moving a king or rook, or capturing a rook, loses the right to castle with it.
+	for _, s := range [2]Square{m.From, m.To} {
+		switch s {
+		case Square{4, 0}:
+			p.WhiteKingside, p.WhiteQueenside = false, false
+		case Square{7, 0}:
+			p.WhiteKingside = false
+		case Square{0, 0}:
+			p.WhiteQueenside = false
+		case Square{4, 7}:
+			p.BlackKingside, p.BlackQueenside = false, false
+		case Square{7, 7}:
+			p.BlackKingside = false
+		case Square{0, 7}:
+			p.BlackQueenside = false
+		}
+	}
+
+	p.EnPassant = Square{}
+	if pc.kind() == whitePawn && (m.To.Y-m.From.Y == 2 || m.From.Y-m.To.Y == 2) {
+		p.EnPassant = Square{m.From.X, (m.From.Y + m.To.Y) / 2}
+	}
+	p.HalfMoves++
+	if pc.kind() == whitePawn || captured != empty {
+		p.HalfMoves = 0
+	}
+	if !p.WhiteToMove {
+		p.FullMoves++
+	}
+	p.WhiteToMove = !p.WhiteToMove
+	return p
+}
+
+// insufficientMaterial reports whether neither side could possibly checkmate: king against king,
+// king and a bishop or knight against king, or kings and bishops that are all on the same color squares.
+func (p *Position) insufficientMaterial() bool {
+	var minors, knights int
+	bishopColors := [2]bool{}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			switch p.Board[y][x].kind() {
+			case empty, whiteKing:
+			case whiteBishop:
+				minors++
+				bishopColors[(x+y)%2] = true
+			case whiteKnight:
+				minors++
+				knights++
+			default: // a pawn, rook, or queen can always mate.
+				return false
+			}
+		}
+	}
+	return minors <= 1 || (knights == 0 && bishopColors[0] != bishopColors[1])
+}
+
+type Game struct {
+	ID           string
+	White, Black string   // the players' names, if known.
+	Start        Position // where the game started: usually StartPosition, but see ParseFEN.
+	Position     Position // where it is now: Start, after Moves.
+	Moves        []Move   // every move so far, in order: see Replay and PGN.
+}
+
+// clone is a deep copy of g, so a GameStore can hand it out without sharing its Moves.
+func (g *Game) clone() *Game {
+	c := *g
+	c.Moves = slices.Clone(g.Moves)
+	return &c
+}
+
+func handle(r *http.Request, s *Sessions) ([8][8]piece, error, int) {
+	if r.Method != http.MethodPost {
+		return [8][8]piece{}, fmt.Errorf("invalid method %q", r.Method), http.StatusMethodNotAllowed
+	}
+	gameID := r.URL.Query().Get("gameID")
+	if gameID == "" {
+		return [8][8]piece{}, fmt.Errorf("missing gameID query parameter"), http.StatusBadRequest
+	}
+
+	move, err := FromJSON[Move](r.Body)
+	if err != nil {
+		return [8][8]piece{}, fmt.Errorf("decoding JSON: %w", err), http.StatusBadRequest
+	}
+	if !move.From.onBoard() {
+		return [8][8]piece{}, fmt.Errorf("invalid move.From: %+v", move.From), http.StatusBadRequest
+	}
+	game, err, statusCode := s.play(r.Context(), gameID, move)
+	if err != nil {
+		return [8][8]piece{}, err, statusCode
+	}
+	return game.Position.Board, nil, http.StatusOK
+}
+
+// play makes move in the game with the given ID, then tells anyone watching it live: see LiveHandler.
+// It returns the game after the move, or an error and the status code to respond with.
+func (s *Sessions) play(ctx context.Context, gameID string, move Move) (*Game, error, int) {
+	var after *Game
+	var invalid error // why the move was rejected, as opposed to the store failing.
+	// Update locks THIS game until we're done, so no one else can move at the same time.
+	err := s.store().Update(ctx, gameID, func(game *Game) error {
+		if game.Position.Board != move.Previous {
+			invalid = fmt.Errorf("board does not match previous move")
+			return invalid
+		}
+		// now no one else can modify this game's board until we're done, and we know the board is correct
+		next, legal, err := nextMove(game.Position, move)
+		if err != nil {
+			invalid = fmt.Errorf("invalid move: %w", err)
+			return invalid
+		}
+		game.Position, game.Moves = next, append(game.Moves, legal)
+		after = game.clone()
+		return nil
+	})
+	switch {
+	case errors.Is(err, ErrNoGame):
+		return nil, fmt.Errorf("invalid gameID %q", gameID), http.StatusBadRequest
+	case invalid != nil:
+		return nil, invalid, http.StatusBadRequest
+	case err != nil:
+		return nil, err, http.StatusInternalServerError
+	}
+	s.watchers.publish(after)
+	return after, nil, http.StatusOK
+}
+
+func SomeHandler(s *Sessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		board, err, statusCode := handle(r, s)
+		if err != nil {
+			slog.InfoContext(r.Context(), "somehandler: error", "err", err, "status", statusCode, "method", r.Method, "url", r.URL)
+			w.WriteHeader(statusCode)
+			if _, err := w.Write([]byte(err.Error())); err != nil {
+				middleware.LogOrDefault(r.Context()).Error("somehandler: failed write", "err", err)
+			}
+			return
+		}
+		if err := WriteJSON(w, board); err != nil {
+			slog.ErrorContext(r.Context(), "somehandler: error writing JSON", "err", err, "method", r.Method, "url", r.URL)
+			return
+		}
+		slog.DebugContext(r.Context(), "somehandler: success", "method", r.Method, "url", r.URL)
+	}
+}
@@ -0,0 +1,190 @@
+package backendbasics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fen is ParseFEN, failing the test on an error.
+func fen(t *testing.T, s string) Position {
+	t.Helper()
+	p, err := ParseFEN(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// sq parses a square in algebraic notation, like "e4".
+func sq(s string) Square { sq, _ := parseSquare(s); return sq }
+
+func perft(p Position, depth int) int {
+	if depth == 0 {
+		return 1
+	}
+	moves := p.LegalMoves()
+	if depth == 1 {
+		return len(moves)
+	}
+	n := 0
+	for _, m := range moves {
+		n += perft(p.apply(m), depth-1)
+	}
+	return n
+}
+
+// TestPerft counts the positions reachable in a few moves from some notoriously tricky positions, and checks them against the known counts:
+// any mistake in the rules shows up as a wrong count. See https://www.chessprogramming.org/Perft_Results.
+func TestPerft(t *testing.T) {
+	if got := fen(t, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"); got != StartPosition() {
+		t.Fatalf("fen() and StartPosition() disagree: %+v", got)
+	}
+	for _, tt := range []struct {
+		name, fen string
+		counts    []int // by depth, starting at 1.
+	}{
+		{"start", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", []int{20, 400, 8902}},
+		{"kiwipete", "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", []int{48, 2039, 97862}},
+		{"endgame, en passant pins", "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", []int{14, 191, 2812, 43238}},
+		{"promotions", "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1", []int{6, 264, 9467}},
+		{"discovered checks", "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", []int{44, 1486, 62379}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p := fen(t, tt.fen)
+			for depth, want := range tt.counts {
+				if got := perft(p, depth+1); got != want {
+					t.Errorf("perft(%d) = %d, want %d", depth+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNextMove(t *testing.T) {
+	for _, tt := range []struct {
+		name, fen, from, to string
+		promotion           piece
+		wantErr             string // a substring of the error; "" for a legal move.
+		wantFEN             string // the position after, if legal.
+	}{
+		{name: "pawn double push sets en passant", fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", from: "e2", to: "e4",
+			wantFEN: "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"},
+		{name: "knight", fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", from: "g1", to: "f3",
+			wantFEN: "rnbqkbnr/pppppppp/8/8/8/5N2/PPPPPPPP/RNBQKB1R b KQkq - 1 1"},
+		{name: "wrong turn", fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR b KQkq - 0 1", from: "e2", to: "e4", wantErr: "no black piece"},
+		{name: "blocked bishop", fen: "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", from: "c1", to: "e3", wantErr: "illegal"},
+		{name: "en passant", fen: "rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", from: "e5", to: "f6",
+			wantFEN: "rnbqkbnr/ppp1p1pp/5P2/3p4/8/8/PPPP1PPP/RNBQKBNR b KQkq - 0 3"},
+		{name: "en passant only right away", fen: "rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq - 0 3", from: "e5", to: "d6", wantErr: "illegal"},
+		{name: "kingside castling", fen: "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", from: "e1", to: "g1",
+			wantFEN: "r3k2r/8/8/8/8/8/8/R4RK1 b kq - 1 1"},
+		{name: "queenside castling", fen: "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", from: "e8", to: "c8",
+			wantFEN: "2kr3r/8/8/8/8/8/8/R3K2R w KQ - 1 2"},
+		{name: "no castling through check", fen: "r3k2r/8/8/8/8/8/5r2/R3K2R w KQkq - 0 1", from: "e1", to: "g1", wantErr: "illegal"},
+		{name: "no castling out of check", fen: "r3k2r/8/8/8/8/8/4r3/R3K2R w KQkq - 0 1", from: "e1", to: "c1", wantErr: "illegal"},
+		{name: "no castling after the rook moved", fen: "r3k2r/8/8/8/8/8/8/R3K2R w Qkq - 0 1", from: "e1", to: "g1", wantErr: "illegal"},
+		{name: "pinned piece", fen: "4k3/4r3/8/8/8/8/4B3/4K3 w - - 0 1", from: "e2", to: "d3", wantErr: "illegal"},
+		{name: "must get out of check", fen: "4k3/4r3/8/8/8/8/3P4/4K3 w - - 0 1", from: "d2", to: "d3", wantErr: "illegal"},
+		{name: "promotion", fen: "8/P3k3/8/8/8/8/8/4K3 w - - 0 1", from: "a7", to: "a8", promotion: whiteKnight,
+			wantFEN: "N7/4k3/8/8/8/8/8/4K3 b - - 0 1"},
+		{name: "promotion in the wrong color is fine", fen: "8/P3k3/8/8/8/8/8/4K3 w - - 0 1", from: "a7", to: "a8", promotion: blackQueen,
+			wantFEN: "Q7/4k3/8/8/8/8/8/4K3 b - - 0 1"},
+		{name: "promotion required", fen: "8/P3k3/8/8/8/8/8/4K3 w - - 0 1", from: "a7", to: "a8", wantErr: "needs a Promotion"},
+		{name: "no promoting to a king", fen: "8/P3k3/8/8/8/8/8/4K3 w - - 0 1", from: "a7", to: "a8", promotion: whiteKing, wantErr: "illegal"},
+		{name: "capturing a rook loses castling", fen: "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", from: "a1", to: "a8",
+			wantFEN: "R3k2r/8/8/8/8/8/8/4K2R b Kk - 0 1"},
+		{name: "after checkmate", fen: "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3", from: "a2", to: "a3", wantErr: "checkmate"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p := fen(t, tt.fen)
+			got, err := NextMove(p, Move{From: sq(tt.from), To: sq(tt.to), White: p.WhiteToMove, Promotion: tt.promotion})
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("NextMove(%s-%s): unexpected error %v", tt.from, tt.to, err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("NextMove(%s-%s): got error %v, want one containing %q", tt.from, tt.to, err, tt.wantErr)
+			case tt.wantErr == "" && got != fen(t, tt.wantFEN):
+				t.Errorf("NextMove(%s-%s) = %+v, want %+v", tt.from, tt.to, got, fen(t, tt.wantFEN))
+			}
+		})
+	}
+	if _, err := NextMove(StartPosition(), Move{From: sq("e7"), To: sq("e5"), White: false}); err == nil || !strings.Contains(err.Error(), "not black's turn") {
+		t.Errorf("moving out of turn: got %v", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	for fenStr, want := range map[string]Status{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1":      Ongoing,
+		"rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3": Checkmate, // fool's mate.
+		"7k/5Q2/6K1/8/8/8/8/8 b - - 0 1":                                Stalemate,
+		"4k3/8/8/8/8/8/4R3/4K3 w - - 100 80":                            FiftyMoveRule,
+		"4k3/8/8/8/8/8/8/4K3 w - - 0 1":                                 InsufficientMaterial,
+		"4k3/8/8/8/8/8/8/2N1K3 w - - 0 1":                               InsufficientMaterial,
+		"4kb2/8/8/8/8/8/8/2B1K3 w - - 0 1":                              InsufficientMaterial, // both bishops on dark squares.
+		"4k1b1/8/8/8/8/8/8/2B1K3 w - - 0 1":                             Ongoing,              // opposite colors: a mate exists.
+		"4k3/8/8/8/8/8/8/1NN1K3 w - - 0 1":                              Ongoing,
+	} {
+		if got := fen(t, fenStr).Status(); got != want {
+			t.Errorf("%s: Status() = %v, want %v", fenStr, got, want)
+		}
+	}
+}
+
+func TestChessHandler(t *testing.T) {
+	var s Sessions
+	game, err := s.NewGame(context.Background(), "efron", "bobross")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(SomeHandler(&s))
+	defer srv.Close()
+
+	post := func(m Move) (*http.Response, [8][8]piece) {
+		t.Helper()
+		b, _ := json.Marshal(m)
+		resp, err := http.Post(srv.URL+"?gameID="+game.ID, "application/json", strings.NewReader(string(b)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var board [8][8]piece
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&board); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp, board
+	}
+	start := StartPosition().Board
+	resp, afterE4 := post(Move{From: sq("e2"), To: sq("e4"), White: true, Previous: start, Promotion: 200}) // ignored: e4 isn't a promotion.
+	if resp.StatusCode != http.StatusOK || afterE4[3][4] != whitePawn || afterE4[1][4] != empty {
+		t.Fatalf("e4: got %d %v", resp.StatusCode, afterE4)
+	}
+	if resp, _ := post(Move{From: sq("e4"), To: sq("e5"), White: true, Previous: afterE4}); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("white moving twice: got %d, want 400", resp.StatusCode)
+	}
+	if resp, _ := post(Move{From: sq("e7"), To: sq("e5"), White: false, Previous: start}); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("stale board: got %d, want 400", resp.StatusCode)
+	}
+	if resp, _ := post(Move{From: sq("e7"), To: sq("e5"), White: false, Previous: afterE4}); resp.StatusCode != http.StatusOK {
+		t.Errorf("e5: got %d, want 200", resp.StatusCode)
+	}
+	game, err = s.store().Get(context.Background(), game.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(game.Moves) != 2 || game.Moves[0].Promotion != empty {
+		t.Errorf("after 1. e4 e5, got moves %+v: want 2, without the bogus Promotion", game.Moves)
+	}
+	if pgn, err := game.PGN(); err != nil || !strings.Contains(pgn, "1. e4 e5") {
+		t.Errorf("after 1. e4 e5, got PGN %q, %v", pgn, err)
+	}
+	if _, err := NextMove(game.Position, Move{From: sq("g1"), To: sq("f3"), White: true}); err != nil {
+		t.Errorf("after 1. e4 e5, Nf3 should be legal: %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package backendbasics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Client sends Requests over plain TCP, with no net/http in sight: it dials the request's Host, writes the request
+// (as WriteTo does, but without the extra line ending after the body), and reads the response with ReadResponse.
+// Dialing is slow, so after a response it keeps the connection around for the next request to the same host, as browsers and net/http do.
+// The zero Client is ready to use, and is safe for concurrent use:
+//
+//	var c Client
+//	resp, err := c.Do(Request{Method: "GET", Path: "/", Headers: Headers{{"Host", "eblog.fly.dev"}}})
+type Client struct {
+	// MaxIdlePerHost is how many idle connections to keep per host. 0 means DefaultMaxIdlePerHost; negative means none.
+	MaxIdlePerHost int
+	// Timeout limits how long dialing can take and, separately, how long a request can take from writing it to the end of the response.
+	// 0 means no limit.
+	Timeout time.Duration
+	// Dial opens connections. If nil, it's a net.Dialer's, using Timeout.
+	Dial func(network, addr string) (net.Conn, error)
+
+	mu   sync.Mutex
+	idle map[string][]*clientConn // by host:port, most recently used last.
+}
+
+// DefaultMaxIdlePerHost is the number of idle connections a Client keeps per host, unless told otherwise: the same as net/http's default.
+const DefaultMaxIdlePerHost = 2
+
+// clientConn is a connection and its reader, which may have read ahead: they have to stay together.
+type clientConn struct {
+	net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+	addr string // the host:port we dialed, which is how the pool knows it: RemoteAddr is the IP, not the name.
+}
+
+// Do sends req to the host in its Host header (port 80, if it doesn't say) and reads the response.
+// It fills in Content-Length if req has a body and doesn't set one.
+// If a kept-alive connection turns out to have been closed by the server before it answered, Do retries once on a new one,
+// as long as req is idempotent (GET, HEAD, OPTIONS, PUT, or DELETE): it's safe to send those twice.
+func (c *Client) Do(req Request) (*Response, error) {
+	host := req.Host()
+	if host == "" {
+		return nil, errors.New("backendbasics.Client: request has no Host header")
+	}
+	addr := host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		addr = net.JoinHostPort(host, "80")
+	}
+	if req.Body != "" && req.Headers.Get("Content-Length") == "" {
+		req.Headers = slices.Clone(req.Headers) // don't add to the caller's headers.
+		req.Headers.Add("Content-Length", strconv.Itoa(len(req.Body)))
+	}
+	conn, reused, err := c.get(addr, false)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.roundTrip(conn, req)
+	if err != nil && reused && idempotent(req.Method) && errors.Is(err, errStaleConn) {
+		if conn, _, err = c.get(addr, true); err == nil { // skip the pool: the rest of its connections have probably gone stale, too.
+			resp, err = c.roundTrip(conn, req)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("backendbasics.Client: %s %s%s: %w", req.Method, host, req.Path, err)
+	}
+	return resp, nil
+}
+
+// errStaleConn is the server hanging up on a connection before it answered: probably because it was idle too long.
+var errStaleConn = errors.New("connection closed before the response started")
+
+func idempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+// roundTrip sends req on conn and reads the response, returning conn to the pool if it can be used again.
+func (c *Client) roundTrip(conn *clientConn, req Request) (*Response, error) {
+	if c.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.Timeout))
+	}
+	if err := writeMessage(conn.w, req.Method+" "+req.Path+" HTTP/1.1", req.Headers, req.Body); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %v", errStaleConn, err)
+	}
+	if _, err := conn.r.Peek(1); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %v", errStaleConn, err)
+	}
+	resp, err := readResponse(conn.r, req.Method == "HEAD")
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if reusable(req, resp) {
+		conn.SetDeadline(time.Time{})
+		c.put(conn)
+	} else {
+		conn.Close()
+	}
+	return resp, nil
+}
+
+// reusable reports whether the connection can carry another request after this one:
+// neither side asked to close it, and the response's body had a known end, rather than going until the connection closed.
+func reusable(req Request, resp *Response) bool {
+	if hasToken(req.Headers, "Connection", "close") || hasToken(resp.Headers, "Connection", "close") {
+		return false
+	}
+	return req.Method == "HEAD" || resp.StatusCode/100 == 1 || resp.StatusCode == 204 || resp.StatusCode == 304 ||
+		resp.Headers.Get("Content-Length") != "" || chunked(resp.Headers)
+}
+
+// get returns an idle connection to addr if there is one, or dials a new one. If fresh is set, it always dials.
+func (c *Client) get(addr string, fresh bool) (conn *clientConn, reused bool, err error) {
+	c.mu.Lock()
+	if conns := c.idle[addr]; len(conns) > 0 && !fresh {
+		conn = conns[len(conns)-1]
+		c.idle[addr] = conns[:len(conns)-1]
+	}
+	c.mu.Unlock()
+	if conn != nil {
+		return conn, true, nil
+	}
+	dial := c.Dial
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: c.Timeout}).Dial
+	}
+	nc, err := dial("tcp", addr)
+	if err != nil {
+		return nil, false, err
+	}
+	return &clientConn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc), addr: addr}, false, nil
+}
+
+// put returns conn to the pool, closing it instead if the pool's full.
+func (c *Client) put(conn *clientConn) {
+	max := c.MaxIdlePerHost
+	if max == 0 {
+		max = DefaultMaxIdlePerHost
+	}
+	addr := conn.addr
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.idle[addr]) >= max {
+		conn.Close()
+		return
+	}
+	if c.idle == nil {
+		c.idle = make(map[string][]*clientConn)
+	}
+	c.idle[addr] = append(c.idle[addr], conn)
+}
+
+// CloseIdleConnections closes every connection in the pool. It leaves connections in use alone: they go back in the pool when their requests finish, like net/http's.
+func (c *Client) CloseIdleConnections() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for addr, conns := range c.idle {
+		for _, conn := range conns {
+			conn.Close()
+		}
+		delete(c.idle, addr)
+	}
+}
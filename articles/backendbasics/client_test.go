@@ -0,0 +1,117 @@
+package backendbasics
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// countingListener counts the connections it accepts.
+type countingListener struct {
+	net.Listener
+	accepted atomic.Int32
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.accepted.Add(1)
+	}
+	return conn, err
+}
+
+func TestClient(t *testing.T) {
+	// a net/http server, so we know we're speaking real HTTP.
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/close":
+			w.Header().Set("Connection", "close")
+		case "/stream": // no Content-Length: net/http chunks it.
+			w.Write([]byte("chunk one, "))
+			w.(http.Flusher).Flush()
+			w.Write([]byte("chunk two"))
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		io.WriteString(w, r.Method+" "+string(b)) // for a HEAD, net/http sends the Content-Length of this, but not the body.
+	}))
+	l := &countingListener{Listener: srv.Listener}
+	srv.Listener = l
+	srv.Start()
+	defer srv.Close()
+	host := srv.Listener.Addr().String()
+
+	var c Client
+	for _, tt := range []struct {
+		method, path, body string
+		want               string
+		wantConns          int32 // total, after this request.
+	}{
+		{"GET", "/", "", "GET ", 1},
+		{"POST", "/", "hello", "POST hello", 1}, // reused.
+		{"HEAD", "/", "", "", 1},                // no body, even with a Content-Length: still reusable.
+		{"GET", "/stream", "", "chunk one, chunk two", 1},
+		{"GET", "/close", "", "GET ", 1}, // the server closes it...
+		{"GET", "/", "", "GET ", 2},      // ...so we need a new one.
+	} {
+		resp, err := c.Do(Request{Method: tt.method, Path: tt.path, Body: tt.body, Headers: Headers{{"Host", host}}})
+		if err != nil {
+			t.Fatalf("%s %s: %v", tt.method, tt.path, err)
+		}
+		if resp.StatusCode != 200 || resp.Body != tt.want {
+			t.Errorf("%s %s: got %d %q, want 200 %q", tt.method, tt.path, resp.StatusCode, resp.Body, tt.want)
+		}
+		if got := l.accepted.Load(); got != tt.wantConns {
+			t.Errorf("%s %s: server has accepted %d connections, want %d", tt.method, tt.path, got, tt.wantConns)
+		}
+	}
+
+	// if the server drops idle connections, we retry on a fresh one.
+	srv.CloseClientConnections()
+	if resp, err := c.Do(Request{Method: "GET", Path: "/", Headers: Headers{{"Host", host}}}); err != nil || resp.Body != "GET " {
+		t.Errorf("after the server closed our idle connection: got %v, %v", resp, err)
+	}
+
+	// the pool has a cap.
+	c = Client{MaxIdlePerHost: -1}
+	for i := 0; i < 2; i++ {
+		if _, err := c.Do(Request{Method: "GET", Path: "/", Headers: Headers{{"Host", host}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(c.idle[host]) != 0 {
+		t.Errorf("MaxIdlePerHost -1: got %d idle connections, want none", len(c.idle[host]))
+	}
+
+	if _, err := c.Do(Request{Method: "GET", Path: "/"}); err == nil {
+		t.Error("expected an error for a request with no Host")
+	}
+}
+
+// TestClientServe has the hand-rolled client talk to the hand-rolled server: no net/http at all.
+func TestClientServe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := &countingListener{Listener: l}
+	defer l.Close()
+	go Serve(cl, func(req Request) Response { return Response{StatusCode: 200, Body: "you said " + req.Body} })
+	var c Client
+	defer c.CloseIdleConnections()
+	for _, body := range []string{"hi", "hello again", ""} {
+		resp, err := c.Do(Request{Method: "POST", Path: "/", Body: body, Headers: Headers{{"Host", l.Addr().String()}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Body != "you said "+body {
+			t.Errorf("got %q, want %q", resp.Body, "you said "+body)
+		}
+	}
+	if got := cl.accepted.Load(); got != 1 {
+		t.Errorf("got %d connections, want 1", got)
+	}
+}
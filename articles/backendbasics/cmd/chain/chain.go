@@ -0,0 +1,79 @@
+// Package chain composes middleware declaratively, in the order it runs, rather than by hand in reverse.
+// It works for anything shaped like middleware: http.Handler middleware on the server, http.RoundTripper middleware on the client.
+//
+// Applying middleware by hand is Last-In, First-Out: the last one applied is the outermost, and runs first.
+//
+//	h = servermw.RecordResponse(h)
+//	h = servermw.Recovery(h)
+//	h = servermw.Log(h)
+//	h = servermw.Trace(h) // runs first!
+//
+// That's easy to get backwards. A Chain lists middleware in the order a request passes through it:
+//
+//	h = chain.New(
+//		chain.Func[http.Handler](servermw.Trace), // runs first
+//		chain.Func[http.Handler](servermw.Log),
+//		chain.Func[http.Handler](servermw.Recovery),
+//		chain.Func[http.Handler](servermw.RecordResponse), // runs last, just before h
+//	).Then(h)
+//
+// and can describe itself, for logging at startup: servermw.Trace -> servermw.Log -> servermw.Recovery -> servermw.RecordResponse.
+package chain
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// Middleware wraps a T, like a http.Handler or http.RoundTripper, in another T.
+type Middleware[T any] struct {
+	Name string // for String
+	Wrap func(T) T
+}
+
+// Func makes a Middleware out of a function that wraps a T, named after the function: i.e, "servermw.Trace".
+// The function may return any type that implements T, like http.HandlerFunc for http.Handler or clientmw.RoundTripFunc for http.RoundTripper;
+// otherwise, Func panics.
+func Func[T, U any](f func(T) U) Middleware[T] {
+	name := runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name() // i.e, gitlab.com/efronlicht/blog/articles/backendbasics/cmd/servermw.Trace
+	return Named(name[strings.LastIndexByte(name, '/')+1:], f)
+}
+
+// Named is Func with an explicit name, for closures and the like, whose names aren't very helpful: main.clientMiddleware.func1.
+func Named[T, U any](name string, f func(T) U) Middleware[T] {
+	t, u := reflect.TypeOf((*T)(nil)).Elem(), reflect.TypeOf((*U)(nil)).Elem()
+	if !u.AssignableTo(t) {
+		panic(fmt.Sprintf("programmer error: chain.Named(%q): %s does not implement %s", name, u, t))
+	}
+	return Middleware[T]{Name: name, Wrap: func(next T) T { return any(f(next)).(T) }}
+}
+
+// Chain is a list of middleware, in the order a request passes through them.
+type Chain[T any] struct{ mws []Middleware[T] }
+
+// New makes a chain of middleware. The first one runs first.
+func New[T any](mws ...Middleware[T]) Chain[T] { return Chain[T]{mws: mws} }
+
+// Append returns a new chain with mws added to the end: they'll run after the rest of c, right before the T it wraps.
+func (c Chain[T]) Append(mws ...Middleware[T]) Chain[T] {
+	return Chain[T]{mws: append(append(make([]Middleware[T], 0, len(c.mws)+len(mws)), c.mws...), mws...)}
+}
+
+// Then wraps t in the whole chain, so a request passes through every middleware in order before reaching t.
+func (c Chain[T]) Then(t T) T {
+	for i := len(c.mws) - 1; i >= 0; i-- { // apply Last-In, First-Out, so the first one is on the outside.
+		t = c.mws[i].Wrap(t)
+	}
+	return t
+}
+
+// String describes the order a request passes through the chain: i.e, "servermw.Trace -> servermw.Log -> ...".
+func (c Chain[T]) String() string {
+	names := make([]string, len(c.mws))
+	for i, mw := range c.mws {
+		names[i] = mw.Name
+	}
+	return strings.Join(names, " -> ")
+}
@@ -0,0 +1,40 @@
+package chain_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/chain"
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/servermw"
+)
+
+func TestChain(t *testing.T) {
+	var order []string
+	mark := func(name string) func(http.Handler) http.HandlerFunc {
+		return func(h http.Handler) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) { order = append(order, name); h.ServeHTTP(w, r) }
+		}
+	}
+	c := chain.New(chain.Named("first", mark("first")), chain.Named("second", mark("second")))
+	c = c.Append(chain.Func[http.Handler](servermw.Trace), chain.Named("last", mark("last")))
+	h := c.Then(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { order = append(order, "handler") }))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if got, want := strings.Join(order, " "), "first second last handler"; got != want {
+		t.Errorf("ran in order %q, want %q", got, want)
+	}
+	if got, want := c.String(), "first -> second -> servermw.Trace -> last"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestNamedPanicsOnMismatch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic: string doesn't implement http.Handler")
+		}
+	}()
+	chain.Named("bad", func(http.Handler) string { return "" })
+}
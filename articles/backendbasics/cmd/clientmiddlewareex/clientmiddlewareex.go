@@ -8,17 +8,22 @@ import (
 	"os"
 	"time"
 
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/chain"
 	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/clientmw"
 )
 
 func clientMiddleware() http.RoundTripper {
-	var rt clientmw.RoundTripFunc // specify the type as a RoundTripFunc, not a http.RoundTripper, so that we don't have to repeatedly wrap it in RoundTripFunc(rt)
 	const wait, tries = 10 * time.Millisecond, 3
-	// first middleware applied will be the last one to run.
-	rt = clientmw.RetryOn5xx(http.DefaultTransport, wait, tries) // retry on 5xx status codes
-	rt = clientmw.Log(rt)                                        // log request duration and status code; uses trace from next middleware
-	rt = clientmw.Trace(rt)                                      // add trace id to request header
-	return rt
+	// in the order a request passes through them: the first one runs first.
+	c := chain.New(
+		chain.Func[http.RoundTripper](clientmw.Trace), // add trace id to request header
+		chain.Func[http.RoundTripper](clientmw.Log),   // log request duration and status code; uses trace from previous middleware
+		chain.Named("clientmw.RetryOn5xx", func(rt http.RoundTripper) clientmw.RoundTripFunc { // retry on 5xx status codes
+			return clientmw.RetryOn5xx(rt, wait, tries)
+		}),
+	)
+	log.Printf("client middleware: %s", c)
+	return c.Then(http.DefaultTransport)
 }
 
 func main() {
@@ -0,0 +1,105 @@
+package clientmw
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/ctxutil"
+)
+
+// ErrCircuitOpen is returned by Breaker for a request to a host whose circuit is open.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// BreakerOpts configures Breaker.
+type BreakerOpts struct {
+	// Failures is how many failures in a row open the circuit. Must be >= 1.
+	Failures int
+	// Cooldown is how long the circuit stays open before letting a single request through to see if the host has recovered. Must be > 0.
+	Cooldown time.Duration
+	// IsFailure reports whether a request failed. If nil, errors and 5xx status codes are failures.
+	IsFailure func(resp *http.Response, err error) bool
+}
+
+// circuit states
+const (
+	circuitClosed   = "closed"    // everything's fine: requests go through.
+	circuitOpen     = "open"      // the host is down: requests fail immediately with ErrCircuitOpen.
+	circuitHalfOpen = "half-open" // the cooldown is over: one request goes through to see if the host is back.
+)
+
+// circuit is the state of the breaker for a single host.
+type circuit struct {
+	state    string
+	failures int       // failures in a row
+	openedAt time.Time // when the circuit last opened
+}
+
+// Breaker returns a RoundTripFunc that implements a circuit breaker per host: after opts.Failures failures in a row,
+// requests to that host fail immediately with ErrCircuitOpen, without being sent, for opts.Cooldown.
+// Then a single request is let through: if it succeeds, the circuit closes and things go back to normal; if not, it opens again.
+//
+// This keeps a flapping or overloaded host from being buried in retries. Put it _inside_ Retry, so that each try counts:
+//
+//	rt = Retry(Breaker(http.DefaultTransport, BreakerOpts{Failures: 5, Cooldown: 10 * time.Second}), policy)
+//
+// State changes are logged to the context logger, if any: see Log.
+func Breaker(rt http.RoundTripper, opts BreakerOpts) RoundTripFunc {
+	// validate arguments OUTSIDE of the closure, so that it only happens once
+	if opts.Failures < 1 {
+		panic("opts.Failures must be >= 1")
+	}
+	if opts.Cooldown <= 0 {
+		panic("opts.Cooldown must be > 0")
+	}
+	if opts.IsFailure == nil {
+		opts.IsFailure = func(resp *http.Response, err error) bool { return err != nil || resp.StatusCode >= 500 }
+	}
+	var mu sync.Mutex
+	circuits := make(map[string]*circuit) // by host
+	return func(r *http.Request) (*http.Response, error) {
+		host := r.URL.Host
+		logf := func(format string, args ...any) {
+			if logger, ok := ctxutil.Value[*log.Logger](r.Context()); ok {
+				logger.Printf("breaker: %s: "+format, append([]any{host}, args...)...)
+			}
+		}
+
+		mu.Lock()
+		c, ok := circuits[host]
+		if !ok {
+			c = &circuit{state: circuitClosed}
+			circuits[host] = c
+		}
+		switch {
+		case c.state == circuitOpen && time.Since(c.openedAt) >= opts.Cooldown:
+			c.state = circuitHalfOpen // we're the probe.
+			logf("%s -> %s: cooldown over, trying a request", circuitOpen, circuitHalfOpen)
+		case c.state != circuitClosed: // still cooling down, or someone else is probing.
+			mu.Unlock()
+			return nil, fmt.Errorf("%s %s: %s: %w", r.Method, r.URL, host, ErrCircuitOpen)
+		}
+		mu.Unlock()
+
+		resp, err := rt.RoundTrip(r) // call next middleware, or http.DefaultTransport.RoundTrip if this is the last middleware
+
+		mu.Lock()
+		defer mu.Unlock()
+		if !opts.IsFailure(resp, err) {
+			if c.state != circuitClosed {
+				logf("%s -> %s: host recovered", c.state, circuitClosed)
+			}
+			c.state, c.failures = circuitClosed, 0
+			return resp, err
+		}
+		c.failures++
+		if c.state == circuitHalfOpen || (c.state == circuitClosed && c.failures >= opts.Failures) { // if it's already open, a request from before it opened failed.
+			logf("%s -> %s: %d failures in a row; waiting %s", c.state, circuitOpen, c.failures, opts.Cooldown)
+			c.state, c.openedAt = circuitOpen, time.Now()
+		}
+		return resp, err
+	}
+}
@@ -35,6 +35,7 @@ var _ http.RoundTripper = RoundTripFunc(nil) // assert that RoundTripFunc implem
 
 // RetryOn5xx returns a RoundTripFunc that retries the request up to n times if the server returns a 5xx status code.
 // It will use exponential backoff: first retry will be after wait, second after 2*wait, third after 4*wait, etc.
+// See Retry for jitter, budgets, and Retry-After.
 func RetryOn5xx(rt http.RoundTripper, wait time.Duration, tries int) RoundTripFunc {
 	// validate arguments OUTSIDE of the closure, so that it only happens once
 	if tries <= 1 {
@@ -0,0 +1,283 @@
+package clientmw
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/ctxutil"
+)
+
+func TestRetry(t *testing.T) {
+	var calls atomic.Int32
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		switch n := calls.Add(1); {
+		case r.URL.Path == "/always-fails":
+			w.WriteHeader(http.StatusBadGateway)
+		case r.URL.Path == "/retry-after" && n == 1:
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case n < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer srv.Close()
+	policy := RetryPolicy{Tries: 3, Base: time.Millisecond, Max: 5 * time.Millisecond}
+	client := new(http.Client)
+
+	for _, tt := range []struct {
+		name, method, path string
+		body               io.Reader
+		policy             RetryPolicy
+		wantCalls          int32
+		wantStatus         int
+	}{
+		{name: "GET succeeds on the third try", method: "GET", path: "/", policy: policy, wantCalls: 3, wantStatus: 200},
+		{name: "rewindable POST is retried", method: "POST", path: "/", body: strings.NewReader("hello"), policy: policy, wantCalls: 3, wantStatus: 200},
+		{name: "unrewindable POST isn't", method: "POST", path: "/", body: io.NopCloser(strings.NewReader("hello")), policy: policy, wantCalls: 1, wantStatus: 503},
+		{name: "out of tries", method: "GET", path: "/always-fails", policy: policy, wantCalls: 3, wantStatus: 502},
+		{name: "Retry-After within budget", method: "GET", path: "/retry-after", policy: RetryPolicy{Tries: 2, Base: time.Millisecond, Budget: 2 * time.Second}, wantCalls: 2, wantStatus: 503},
+		{name: "Retry-After over budget", method: "GET", path: "/retry-after", policy: RetryPolicy{Tries: 2, Base: time.Millisecond, Budget: 500 * time.Millisecond}, wantCalls: 1, wantStatus: 429},
+	} {
+		calls.Store(0)
+		bodies = nil
+		client.Transport = Retry(http.DefaultTransport, tt.policy)
+		req, err := http.NewRequest(tt.method, srv.URL+tt.path, tt.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		resp.Body.Close()
+		if calls.Load() != tt.wantCalls || resp.StatusCode != tt.wantStatus {
+			t.Errorf("%s: got %d calls ending in %d, want %d calls ending in %d", tt.name, calls.Load(), resp.StatusCode, tt.wantCalls, tt.wantStatus)
+		}
+		if tt.body != nil && tt.wantCalls > 1 {
+			for i, b := range bodies {
+				if b != "hello" {
+					t.Errorf("%s: try %d got body %q, want %q", tt.name, i+1, b, "hello")
+				}
+			}
+		}
+		if tt.name == "Retry-After within budget" && time.Since(start) < time.Second {
+			t.Errorf("%s: retried after %s, before Retry-After", tt.name, time.Since(start))
+		}
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	p := RetryPolicy{Tries: 10, Base: 10 * time.Millisecond, Max: 50 * time.Millisecond}
+	for try := 0; try < 10; try++ {
+		ceil := min(p.Base<<try, p.Max)
+		for i := 0; i < 100; i++ {
+			if d := p.wait(try, nil); d < 0 || d >= ceil {
+				t.Fatalf("try %d: waited %s, want [0, %s)", try, d, ceil)
+			}
+		}
+	}
+	resp := &http.Response{StatusCode: 503, Header: http.Header{"Retry-After": {time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}}}
+	if d := p.wait(0, resp); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("Retry-After as an HTTP date: waited %s, want about an hour", d)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	var healthy atomic.Bool
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+	logs := new(strings.Builder)
+	logger := log.New(logs, "", 0)
+	const cooldown = 20 * time.Millisecond
+	client := &http.Client{Transport: Breaker(http.DefaultTransport, BreakerOpts{Failures: 3, Cooldown: cooldown})}
+	get := func() error {
+		req, _ := http.NewRequestWithContext(ctxutil.WithValue(context.Background(), logger), "GET", srv.URL, nil)
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	for i := 0; i < 3; i++ { // three strikes...
+		if err := get(); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if err := get(); !errors.Is(err, ErrCircuitOpen) || calls.Load() != 3 { // ...and you're out.
+		t.Fatalf("after 3 failures: got %v after %d calls, want ErrCircuitOpen after 3", err, calls.Load())
+	}
+	time.Sleep(cooldown)
+	if err := get(); err != nil || calls.Load() != 4 { // the probe is let through, but fails...
+		t.Fatalf("after cooldown: got %v after %d calls, want a probe", err, calls.Load())
+	}
+	if err := get(); !errors.Is(err, ErrCircuitOpen) { // ...so it's open again.
+		t.Fatalf("after a failed probe: got %v, want ErrCircuitOpen", err)
+	}
+	healthy.Store(true)
+	time.Sleep(cooldown)
+	for i := 0; i < 3; i++ {
+		if err := get(); err != nil {
+			t.Fatalf("after recovery, request %d: %v", i, err)
+		}
+	}
+	for _, want := range []string{"closed -> open", "open -> half-open", "half-open -> open", "half-open -> closed"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs: missing transition %q:\n%s", want, logs)
+		}
+	}
+}
+
+func TestDump(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "hunter2"})
+		w.Header().Set("X-Echo-Len", strconv.Itoa(len(b)))
+		w.Write(bytes.Repeat([]byte("ab"), 50)) // 100 bytes
+	}))
+	defer srv.Close()
+	sink := new(strings.Builder)
+	client := &http.Client{Transport: Dump(http.DefaultTransport, 10, sink, "X-Api-Key")}
+	withPassword := strings.Replace(srv.URL, "http://", "http://efron:hunter2@", 1)
+	req, _ := http.NewRequest("POST", withPassword+"/greet", strings.NewReader(`{"first": "efron", "last": "licht"}`))
+	req.Header.Set("Authorization", "Bearer hunter2")
+	req.Header.Set("X-Api-Key", "hunter2")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if len(body) != 100 || resp.Header.Get("X-Echo-Len") != "35" {
+		t.Fatalf("the dump got in the way: server saw %s bytes of the request, client saw %d bytes of the response", resp.Header.Get("X-Echo-Len"), len(body))
+	}
+	got := sink.String()
+	for _, want := range []string{
+		"> POST " + strings.Replace(srv.URL, "http://", "http://efron:xxxxx@", 1) + "/greet HTTP/1.1\n",
+		"> Authorization: REDACTED\n",
+		"> X-Api-Key: REDACTED\n",
+		"> Content-Type: application/json\n",
+		">\n> {\"first\": \n> ... (truncated)\n",
+		"< HTTP/1.1 200 OK\n",
+		"< Set-Cookie: REDACTED\n",
+		"<\n< ababababab\n< ... (90 more bytes)\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("dump: missing %q in:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "hunter2") {
+		t.Errorf("dump: leaked a secret:\n%s", got)
+	}
+}
+
+func TestTraceConn(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }))
+	defer srv.Close()
+	var got []ConnTimings
+	client := srv.Client()
+	client.Transport = TraceConn(client.Transport, func(_ *http.Request, t ConnTimings) { got = append(got, t) })
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d timings, want 2", len(got))
+	}
+	first, second := got[0], got[1]
+	if first.Reused || first.Connect <= 0 || first.TLS <= 0 || first.TTFB < first.Connect+first.TLS || first.RemoteAddr != srv.Listener.Addr().String() {
+		t.Errorf("first request: got %+v, want a new connection with a TLS handshake", first)
+	}
+	if !second.Reused || second.Connect != 0 || second.TLS != 0 || second.TTFB <= 0 {
+		t.Errorf("second request: got %+v, want a reused connection", second)
+	}
+}
+
+func TestHedge(t *testing.T) {
+	var calls atomic.Int32
+	canceled := make(chan struct{}, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if r.URL.Path == "/slow-first" && n == 1 { // the first try hangs until it's canceled.
+			<-r.Context().Done()
+			canceled <- struct{}{}
+			return
+		}
+		fmt.Fprintf(w, "try %d", n)
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: Hedge(http.DefaultTransport, 20*time.Millisecond, 2)}
+	for _, tt := range []struct {
+		method, path string
+		body         io.Reader
+		wantCalls    int32
+		wantBody     string
+	}{
+		{"GET", "/fast", nil, 1, "try 1"},                     // no need to hedge.
+		{"GET", "/slow-first", nil, 2, "try 2"},               // the hedge wins.
+		{"POST", "/fast", strings.NewReader("x"), 1, "try 1"}, // not idempotent: never hedged.
+	} {
+		calls.Store(0)
+		req, _ := http.NewRequest(tt.method, srv.URL+tt.path, tt.body)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tt.method, tt.path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != tt.wantBody || calls.Load() != tt.wantCalls {
+			t.Errorf("%s %s: got %q after %d calls, want %q after %d", tt.method, tt.path, body, calls.Load(), tt.wantBody, tt.wantCalls)
+		}
+	}
+	select {
+	case <-canceled: // the loser was canceled.
+	case <-time.After(time.Second):
+		t.Error("GET /slow-first: the losing request was never canceled")
+	}
+
+	// a try that fails outright is hedged immediately, without waiting.
+	var tries atomic.Int32
+	failFirst := RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if tries.Add(1) == 1 {
+			return nil, syscall.ECONNRESET
+		}
+		return http.DefaultTransport.RoundTrip(r)
+	})
+	start := time.Now()
+	resp, err := (&http.Client{Transport: Hedge(failFirst, time.Hour, 1)}).Get(srv.URL + "/fast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if time.Since(start) > time.Second {
+		t.Errorf("a failed try waited %s to hedge", time.Since(start))
+	}
+}
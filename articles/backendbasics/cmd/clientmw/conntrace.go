@@ -0,0 +1,80 @@
+package clientmw
+
+import (
+	"crypto/tls"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/ctxutil"
+)
+
+// ConnTimings break down where a request's time went before the response started coming back.
+// A phase that didn't happen, like DNS for an IP address or everything but TTFB for a reused connection, is zero.
+type ConnTimings struct {
+	Host       string        // the request's host, i.e, "eblog.fly.dev" or "localhost:8080"
+	Reused     bool          // whether the request got an existing connection from the pool
+	DNS        time.Duration // resolving the host's address
+	Connect    time.Duration // opening the TCP connection, including any attempts at other addresses
+	TLS        time.Duration // the TLS handshake
+	TTFB       time.Duration // "time to first byte": from the start of the request to the first byte of the response, including all of the above.
+	RemoteAddr string        // the address actually connected to
+}
+
+// TraceConn returns a RoundTripFunc that uses net/http/httptrace to time each request's DNS lookup, connection, TLS handshake, and time to first byte.
+// The timings are logged to the context logger, if any (see Log), and passed to onTimings, if it's non-nil: i.e, to record metrics per host.
+// onTimings is called once per request, after the response headers arrive, from the goroutine that made the request.
+func TraceConn(rt http.RoundTripper, onTimings func(r *http.Request, t ConnTimings)) RoundTripFunc {
+	return func(r *http.Request) (*http.Response, error) {
+		var (
+			mu                               sync.Mutex // the dialer may call the hooks from other goroutines.
+			t                                = ConnTimings{Host: r.URL.Host}
+			dnsStart, connectStart, tlsStart time.Time
+			start                            = time.Now()
+		)
+		since := func(start time.Time) time.Duration {
+			if start.IsZero() {
+				return 0
+			}
+			return time.Since(start)
+		}
+		ct := &httptrace.ClientTrace{
+			DNSStart: func(httptrace.DNSStartInfo) { mu.Lock(); dnsStart = time.Now(); mu.Unlock() },
+			DNSDone:  func(httptrace.DNSDoneInfo) { mu.Lock(); t.DNS = since(dnsStart); mu.Unlock() },
+			ConnectStart: func(_, _ string) {
+				mu.Lock()
+				if connectStart.IsZero() { // with several addresses, the dialer may try a few: time them all.
+					connectStart = time.Now()
+				}
+				mu.Unlock()
+			},
+			ConnectDone:       func(_, _ string, _ error) { mu.Lock(); t.Connect = since(connectStart); mu.Unlock() },
+			TLSHandshakeStart: func() { mu.Lock(); tlsStart = time.Now(); mu.Unlock() },
+			TLSHandshakeDone:  func(tls.ConnectionState, error) { mu.Lock(); t.TLS = since(tlsStart); mu.Unlock() },
+			GotConn: func(info httptrace.GotConnInfo) {
+				mu.Lock()
+				t.Reused = info.Reused
+				if addr := info.Conn.RemoteAddr(); addr != nil {
+					t.RemoteAddr = addr.String()
+				}
+				mu.Unlock()
+			},
+			GotFirstResponseByte: func() { mu.Lock(); t.TTFB = time.Since(start); mu.Unlock() },
+		}
+		r = r.WithContext(httptrace.WithClientTrace(r.Context(), ct))
+		resp, err := rt.RoundTrip(r) // call next middleware, or http.DefaultTransport.RoundTrip if this is the last middleware
+
+		mu.Lock()
+		timings := t
+		mu.Unlock()
+		if logger, ok := ctxutil.Value[*log.Logger](r.Context()); ok {
+			logger.Printf("conn %s (reused: %v): dns %s, connect %s, tls %s, ttfb %s", timings.RemoteAddr, timings.Reused, timings.DNS, timings.Connect, timings.TLS, timings.TTFB)
+		}
+		if onTimings != nil {
+			onTimings(r, timings)
+		}
+		return resp, err
+	}
+}
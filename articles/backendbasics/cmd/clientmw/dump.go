@@ -0,0 +1,163 @@
+package clientmw
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/ctxutil"
+)
+
+// alwaysRedact are the headers Dump never shows: they're credentials.
+var alwaysRedact = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// Dump returns a RoundTripFunc that writes each request and response to sink, headers and all, for debugging:
+//
+//	> POST http://localhost:8080/greet/json HTTP/1.1
+//	> Content-Type: application/json
+//	>
+//	> {"first": "efron", "last": "licht"}
+//	< HTTP/1.1 200 OK
+//	< Content-Type: application/json
+//	<
+//	< {"greeting":"Hello, efron licht!"}
+//
+// Only the first limit bytes of each body are shown. The request and response still get the whole body, as usual:
+// the response is shown once its body has been read to the end or closed, so one that's never closed never shows up.
+// The values of the Authorization, Proxy-Authorization, Cookie, and Set-Cookie headers, as well as any in redact, are replaced with REDACTED,
+// and so is the password in the URL, if there is one (see url.URL.Redacted).
+// If sink is nil, it writes to the context logger, if any (see Log), or the standard logger.
+func Dump(rt http.RoundTripper, limit int, sink io.Writer, redact ...string) RoundTripFunc {
+	// validate arguments OUTSIDE of the closure, so that it only happens once
+	if limit < 0 {
+		panic("limit must be >= 0")
+	}
+	redact = append(append([]string(nil), redact...), alwaysRedact...) // don't scribble on the caller's slice.
+	for i := range redact {
+		redact[i] = http.CanonicalHeaderKey(redact[i])
+	}
+	var mu sync.Mutex // keep concurrent dumps from interleaving.
+	write := func(r *http.Request, b []byte) {
+		if sink != nil {
+			mu.Lock()
+			defer mu.Unlock()
+			_, _ = sink.Write(b)
+			return
+		}
+		if logger, ok := ctxutil.Value[*log.Logger](r.Context()); ok {
+			logger.Printf("dump:\n%s", b)
+		} else {
+			log.Printf("dump:\n%s", b)
+		}
+	}
+	return func(r *http.Request) (*http.Response, error) {
+		buf := new(bytes.Buffer)
+		fmt.Fprintf(buf, "> %s %s %s\n", r.Method, r.URL.Redacted(), r.Proto) // a password in the URL is a credential, too.
+		writeHeaders(buf, "> ", r.Header, redact)
+		if r.Body != nil && r.Body != http.NoBody {
+			// read the start of the body for ourselves, then put it back in front of the rest.
+			// one byte more than we show tells us whether there's more.
+			head, err := io.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+			if err != nil {
+				return nil, fmt.Errorf("dump: reading request body: %w", err)
+			}
+			if len(head) > limit {
+				writeBody(buf, "> ", head[:limit], "... (truncated)")
+			} else {
+				writeBody(buf, "> ", head, "")
+			}
+			body := r.Body
+			r = r.Clone(r.Context()) // don't modify the caller's request.
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(head), body), body}
+		}
+		write(r, buf.Bytes())
+
+		resp, err := rt.RoundTrip(r) // call next middleware, or http.DefaultTransport.RoundTrip if this is the last middleware
+		if err != nil {
+			write(r, []byte(fmt.Sprintf("< error: %v\n", err)))
+			return nil, err
+		}
+		buf = new(bytes.Buffer)
+		fmt.Fprintf(buf, "< %s %s\n", resp.Proto, resp.Status)
+		writeHeaders(buf, "< ", resp.Header, redact)
+		resp.Body = &dumpBody{ReadCloser: resp.Body, buf: buf, limit: limit, done: func(b []byte) { write(r, b) }}
+		return resp, nil
+	}
+}
+
+func writeHeaders(buf *bytes.Buffer, prefix string, h http.Header, redact []string) {
+	h = h.Clone()
+	for _, k := range redact {
+		if _, ok := h[k]; ok {
+			h[k] = []string{"REDACTED"}
+		}
+	}
+	var hbuf strings.Builder
+	_ = h.Write(&hbuf) // sorted, one per line.
+	for _, line := range strings.Split(strings.TrimSuffix(hbuf.String(), "\r\n"), "\r\n") {
+		if line != "" {
+			buf.WriteString(prefix + line + "\n")
+		}
+	}
+}
+
+// writeBody writes the part of a body that's shown, followed by a note about the rest, if any.
+func writeBody(buf *bytes.Buffer, prefix string, body []byte, note string) {
+	if len(body) == 0 && note == "" {
+		return
+	}
+	buf.WriteString(strings.TrimSpace(prefix) + "\n") // a blank line between the headers and the body, like on the wire.
+	if len(body) > 0 {
+		for _, line := range strings.Split(strings.TrimSuffix(string(body), "\n"), "\n") {
+			buf.WriteString(prefix + line + "\n")
+		}
+	}
+	if note != "" {
+		buf.WriteString(prefix + note + "\n")
+	}
+}
+
+// dumpBody keeps the first limit bytes of a response body as it's read, dumping the response once it's read to the end or closed.
+type dumpBody struct {
+	io.ReadCloser
+	buf      *bytes.Buffer // the dump so far: status line & headers.
+	head     []byte
+	limit, n int
+	done     func([]byte)
+	once     sync.Once
+}
+
+func (b *dumpBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if room := b.limit - len(b.head); room > 0 {
+		b.head = append(b.head, p[:min(n, room)]...)
+	}
+	b.n += n
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *dumpBody) Close() error {
+	b.finish()
+	return b.ReadCloser.Close()
+}
+
+func (b *dumpBody) finish() {
+	b.once.Do(func() {
+		note := ""
+		if skipped := b.n - len(b.head); skipped > 0 {
+			note = fmt.Sprintf("... (%d more bytes)", skipped)
+		}
+		writeBody(b.buf, "< ", b.head, note)
+		b.done(b.buf.Bytes())
+	})
+}
@@ -0,0 +1,128 @@
+package clientmw
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Hedge returns a RoundTripFunc that sends "hedged" requests: if a request hasn't come back after delay, it sends an identical one,
+// up to maxHedges extra, and returns whichever response comes back first, canceling the rest.
+// This trades a little extra load for a lot less tail latency: one slow server or dropped packet doesn't hold up the whole request.
+// Pick a delay around the 95th percentile latency, so only the slowest few requests get hedged.
+// See "The Tail at Scale", Dean & Barroso, 2013: https://research.google/pubs/pub40801/.
+//
+// Since the server may see the same request several times, only requests with an idempotent method (GET, HEAD, OPTIONS, or TRACE)
+// and either no body or a rewindable one (r.GetBody is set) are hedged. Everything else goes through once.
+// A request that fails outright doesn't wait for the delay: the next hedge goes out immediately.
+func Hedge(rt http.RoundTripper, delay time.Duration, maxHedges int) RoundTripFunc {
+	// validate arguments OUTSIDE of the closure, so that it only happens once
+	if delay <= 0 {
+		panic("delay must be > 0")
+	}
+	if maxHedges < 1 {
+		panic("maxHedges must be >= 1")
+	}
+	type result struct {
+		resp *http.Response
+		err  error
+		i    int // which try this was; its context is cancels[i].
+	}
+	return func(r *http.Request) (*http.Response, error) {
+		if !idempotent(r) {
+			return rt.RoundTrip(r)
+		}
+		results := make(chan result, maxHedges+1) // buffered, so the losers never block.
+		var cancels []context.CancelFunc
+		send := func() {
+			i := len(cancels)
+			ctx, cancel := context.WithCancel(r.Context())
+			cancels = append(cancels, cancel)
+			req := r.Clone(ctx)
+			if r.GetBody != nil {
+				body, err := r.GetBody()
+				if err != nil {
+					results <- result{err: err, i: i}
+					return
+				}
+				req.Body = body
+			}
+			go func() {
+				resp, err := rt.RoundTrip(req) // call next middleware, or http.DefaultTransport.RoundTrip if this is the last middleware
+				results <- result{resp, err, i}
+			}()
+		}
+		send()
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		var lastErr error
+		for pending := 1; pending > 0; {
+			select {
+			case <-timer.C:
+				if len(cancels) <= maxHedges {
+					send()
+					pending++
+					timer.Reset(delay)
+				}
+			case res := <-results:
+				pending--
+				if res.err != nil {
+					cancels[res.i]()
+					lastErr = res.err
+					if len(cancels) <= maxHedges && r.Context().Err() == nil { // don't wait: try again now.
+						send()
+						pending++
+						if !timer.Stop() { // drain it, or we'd hedge twice.
+							select {
+							case <-timer.C:
+							default:
+							}
+						}
+						timer.Reset(delay)
+					}
+					continue
+				}
+				// a winner! cancel everyone else, and clean up after them.
+				for i, cancel := range cancels {
+					if i != res.i {
+						cancel()
+					}
+				}
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						if loser := <-results; loser.resp != nil {
+							loser.resp.Body.Close()
+						}
+					}
+				}(pending)
+				// the winner's context has to live as long as its body does.
+				res.resp.Body = &cancelOnClose{ReadCloser: res.resp.Body, cancel: cancels[res.i]}
+				return res.resp, nil
+			}
+		}
+		return nil, lastErr
+	}
+}
+
+// idempotent reports whether r can be sent more than once without changing its meaning.
+func idempotent(r *http.Request) bool {
+	switch r.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace: // "" means GET.
+		return r.Body == nil || r.Body == http.NoBody || r.GetBody != nil
+	default:
+		return false
+	}
+}
+
+// cancelOnClose cancels a request's context once its response body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
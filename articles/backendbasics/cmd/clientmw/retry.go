@@ -0,0 +1,155 @@
+package clientmw
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/ctxutil"
+)
+
+// RetryPolicy configures Retry.
+type RetryPolicy struct {
+	// Tries is the most times to send a request, counting the first. Must be >= 1.
+	Tries int
+	// Base and Max bound the wait before each retry: before retry n, Retry waits a random duration in [0, min(Max, Base * 2^n)).
+	// This is "full jitter": spreading the retries out keeps a crowd of clients from all retrying in lockstep.
+	// See https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/.
+	// Base must be > 0; if Max is zero, there's no cap.
+	Base, Max time.Duration
+	// Budget, if nonzero, is the most time to spend waiting between tries of a single request, in total.
+	// A retry that would go over budget isn't made; the last response or error is returned instead.
+	Budget time.Duration
+	// RetryOn reports whether a try should be retried. If nil, DefaultRetryOn is used.
+	RetryOn func(resp *http.Response, err error) bool
+}
+
+// DefaultRetryOn retries refused or reset connections, 429 Too Many Requests, and 5xx status codes other than 501 Not Implemented,
+// which won't get any more implemented by trying again.
+func DefaultRetryOn(resp *http.Response, err error) bool {
+	if err != nil {
+		return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || (resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented)
+}
+
+// Retry returns a RoundTripFunc that retries requests according to p.
+//
+// Only requests that are safe to send twice are retried: those with an idempotent method (GET, HEAD, OPTIONS, or TRACE) and no body,
+// or those with a body that can be rewound, i.e, r.GetBody is set, as http.NewRequest does for *bytes.Reader, *bytes.Buffer, and *strings.Reader.
+// Everything else goes through once.
+//
+// If the server sends a Retry-After header with a 429 or 503, Retry waits that long instead, so long as it's within budget.
+// When it runs out of tries, it returns the last response or error as-is.
+// Each retry is logged to the context logger, if any: see Log.
+func Retry(rt http.RoundTripper, p RetryPolicy) RoundTripFunc {
+	// validate arguments OUTSIDE of the closure, so that it only happens once
+	if p.Tries < 1 {
+		panic("p.Tries must be >= 1")
+	}
+	if p.Base <= 0 {
+		panic("p.Base must be > 0")
+	}
+	if p.RetryOn == nil {
+		p.RetryOn = DefaultRetryOn
+	}
+	return func(r *http.Request) (*http.Response, error) {
+		tries := p.Tries
+		if !rewindable(r) {
+			tries = 1
+		}
+		var waited time.Duration
+		for try := 0; ; try++ {
+			req := r
+			if try > 0 && r.GetBody != nil {
+				body, err := r.GetBody()
+				if err != nil {
+					return nil, fmt.Errorf("retry %d: rewinding body: %w", try, err)
+				}
+				req = r.Clone(r.Context())
+				req.Body = body
+			}
+			resp, err := rt.RoundTrip(req) // call next middleware, or http.DefaultTransport.RoundTrip if this is the last middleware
+			if try+1 >= tries || !p.RetryOn(resp, err) {
+				return resp, err
+			}
+			wait := p.wait(try, resp)
+			if p.Budget > 0 && waited+wait > p.Budget {
+				return resp, err // out of budget: better to fail now than later.
+			}
+			waited += wait
+			if logger, ok := ctxutil.Value[*log.Logger](r.Context()); ok {
+				logger.Printf("try %d failed (%s): retrying in %s", try+1, describe(resp, err), wait)
+			}
+			if resp != nil { // we're not going to use it: drain the body so the connection can be reused.
+				_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+				resp.Body.Close()
+			}
+			select {
+			case <-r.Context().Done():
+				return nil, fmt.Errorf("retry %d: %w", try+1, r.Context().Err())
+			case <-time.After(wait):
+			}
+		}
+	}
+}
+
+// wait returns how long to wait after try failed with resp.
+func (p RetryPolicy) wait(try int, resp *http.Response) time.Duration {
+	if resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		if d, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			return d
+		}
+	}
+	ceil := p.Base << try
+	if ceil <= 0 || (p.Max > 0 && ceil > p.Max) { // <= 0: we overflowed.
+		ceil = p.Max
+	}
+	if ceil <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceil)))
+}
+
+// retryAfter parses a Retry-After header: either a number of seconds or an HTTP date.
+func retryAfter(s string) (time.Duration, bool) {
+	if s == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(s); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// rewindable reports whether r can safely be sent more than once.
+func rewindable(r *http.Request) bool {
+	if r.GetBody != nil {
+		return true
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		return false // we'd have nothing to send the second time.
+	}
+	switch r.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace: // "" means GET.
+		return true
+	default:
+		return false
+	}
+}
+
+func describe(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return resp.Status
+}
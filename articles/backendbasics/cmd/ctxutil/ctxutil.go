@@ -1,14 +1,75 @@
 package ctxutil
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
 
 type key[T any] struct{}
 
+// valueCtx is a context holding one value, keyed by its type.
+// Unlike context.WithValue's contexts, each one links to the last one below it, so Dump can find them all.
+type valueCtx struct {
+	context.Context
+	key, val any
+	typ      reflect.Type
+	prev     *valueCtx // the next ctxutil value down the chain, if any.
+}
+
+// chainKey finds the topmost valueCtx in a context.
+type chainKey struct{}
+
+func (c *valueCtx) Value(k any) any {
+	switch k {
+	case c.key:
+		return c.val
+	case chainKey{}:
+		return c
+	default:
+		return c.Context.Value(k)
+	}
+}
+
+func (c *valueCtx) String() string { return fmt.Sprintf("%v.WithValue(%v)", c.Context, c.typ) }
+
 func WithValue[T any](ctx context.Context, t T) context.Context {
-	return context.WithValue(ctx, key[T]{}, t)
+	prev, _ := ctx.Value(chainKey{}).(*valueCtx)
+	return &valueCtx{Context: ctx, key: key[T]{}, val: t, typ: reflect.TypeOf((*T)(nil)).Elem(), prev: prev}
 }
 
 func Value[T any](ctx context.Context) (T, bool) {
 	t, ok := ctx.Value(key[T]{}).(T)
 	return t, ok
 }
+
+// Dump lists the values stored in ctx by WithValue, one per line, newest first, for debugging:
+//
+//	trace.Trace: 6f4d...:9a1c...
+//	*log.Logger: &{...}
+//
+// Values that implement fmt.Stringer are shown with their String method; everything else with %+v.
+// A value that's been replaced by a newer one of the same type is skipped, since Value can't see it either.
+func Dump(ctx context.Context) string {
+	var b strings.Builder
+	seen := make(map[reflect.Type]bool)
+	for c, _ := ctx.Value(chainKey{}).(*valueCtx); c != nil; c = c.prev {
+		if seen[c.typ] {
+			continue
+		}
+		seen[c.typ] = true
+		if s, ok := c.val.(fmt.Stringer); ok {
+			fmt.Fprintf(&b, "%v: %s\n", c.typ, s)
+		} else {
+			fmt.Fprintf(&b, "%v: %+v\n", c.typ, c.val)
+		}
+	}
+	return b.String()
+}
+
+// Detach returns a context with all of ctx's values, but none of its deadline or cancellation:
+// for work that should outlive the request that started it, like sending an email after the response goes out,
+// but that still wants the request's logger and trace.
+// Give it its own timeout: nothing else will stop it.
+func Detach(ctx context.Context) context.Context { return context.WithoutCancel(ctx) }
@@ -0,0 +1,58 @@
+package ctxutil
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+type requestID string
+
+func (id requestID) String() string { return "req-" + string(id) }
+
+type user struct{ Name string }
+
+func TestDump(t *testing.T) {
+	ctx := WithValue(context.Background(), requestID("1"))
+	ctx = context.WithValue(ctx, "not ours", "skipped") // other values in between don't break the chain.
+	ctx = WithValue(ctx, &user{Name: "efron"})
+	ctx = WithValue(ctx, 3)
+	ctx = WithValue(ctx, requestID("2")) // shadows the first.
+
+	if got, _ := Value[requestID](ctx); got != "2" {
+		t.Fatalf("Value: got %q, want the newest, %q", got, "2")
+	}
+	want := strings.Join([]string{
+		"ctxutil.requestID: req-2",
+		"int: 3",
+		"*ctxutil.user: &{Name:efron}",
+	}, "\n") + "\n"
+	if got := Dump(ctx); got != want {
+		t.Errorf("Dump: got\n%s\nwant\n%s", got, want)
+	}
+	if got := Dump(context.Background()); got != "" {
+		t.Errorf("Dump of an empty context: got %q, want \"\"", got)
+	}
+}
+
+func TestDetach(t *testing.T) {
+	ctx, cancel := context.WithTimeout(WithValue(context.Background(), requestID("1")), time.Hour)
+	detached := Detach(ctx)
+	cancel()
+	if ctx.Err() == nil {
+		t.Fatal("parent should be canceled")
+	}
+	if detached.Err() != nil || detached.Done() != nil {
+		t.Errorf("detached context was canceled along with its parent: %v", detached.Err())
+	}
+	if _, ok := detached.Deadline(); ok {
+		t.Error("detached context kept its parent's deadline")
+	}
+	if got, ok := Value[requestID](detached); !ok || got != "1" {
+		t.Errorf("detached context lost its values: got %q, %v", got, ok)
+	}
+	if got := Dump(detached); got != "ctxutil.requestID: req-1\n" {
+		t.Errorf("Dump(detached): got %q", got)
+	}
+}
@@ -2,41 +2,59 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	_ "time/tzdata"
 
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/chain"
 	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/ctxutil"
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/router"
 	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/servermw"
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/trace"
 )
 
+// eventInterval is how often GET /events sends the time.
+var eventInterval = time.Second
+
 func main() {
 	port := flag.Int("port", 8080, "port to listen on")
 	flag.Parse()
+	// slog.InfoContext(r.Context(), ...) picks up the trace from servermw.Trace: see servermw.TraceHandler.
+	slog.SetDefault(slog.New(servermw.NewTraceHandler(slog.NewTextHandler(os.Stderr, nil))))
 
 	h, err := buildBaseRouter()
 	if err != nil {
 		log.Fatal(err)
 	}
 	h = applyMiddleware(h)
+	log.Printf("middleware: %s", middleware)
 
 	// build and start the server.
 	// remember, you should always apply at least the Read and Write timeouts to your server.
 	server := http.Server{
-		Addr:         fmt.Sprintf(":%d", *port),
-		Handler:      h,
-		ReadTimeout:  1 * time.Second,
-		WriteTimeout: 1 * time.Second,
+		Addr:              fmt.Sprintf(":%d", *port),
+		Handler:           h,
+		ReadTimeout:       1 * time.Second,
+		ReadHeaderTimeout: 500 * time.Millisecond,
+		WriteTimeout:      1 * time.Second,
+	}
+	l, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		log.Fatal(err)
 	}
 	log.Printf("listening on %s", server.Addr)
-	go server.ListenAndServe()
+	// a client that's too slow with its headers gets told why it's being hung up on: see servermw.HeaderTimeout.
+	go server.Serve(servermw.HeaderTimeout(l, server.ReadHeaderTimeout))
 	time.Sleep(20 * time.Millisecond)
 	demo(*port)
 }
@@ -44,7 +62,9 @@ func main() {
 // buildBaseRouter builds the base router by mapping patterns and methods to handlers.
 func buildBaseRouter() (http.Handler, error) {
 	// register routes.
-	r := new(Router) // we'll add routes to this router.
+	r := new(router.Router) // we'll add routes to this router.
+	// let a browser frontend on any origin call the API. POST /greet/json sends JSON, so it needs to set Content-Type.
+	r.CORS = &router.CORS{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"Content-Type"}, MaxAge: 10 * time.Minute}
 	for _, route := range []struct {
 		pattern, method string
 		handler         http.HandlerFunc
@@ -85,22 +105,22 @@ func buildBaseRouter() (http.Handler, error) {
 			// it 'puts everything together' and demonstrates how to use the router and middleware together.
 			// ---- */
 			func(w http.ResponseWriter, r *http.Request) {
-				var req struct {
+				req, err := router.ReadJSON[struct {
 					First, Last string
 					Age         int
-				}
-				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-					WriteError(w, err, http.StatusBadRequest) // remember to return after writing an error!
+				}](r.Body, router.ReadJSONOpts{DisallowUnknownFields: true, MaxBytes: 1 << 10})
+				if err != nil {
+					router.WriteError(w, err, http.StatusBadRequest) // remember to return after writing an error!
 					return
 				}
 				if req.Age < 0 {
-					WriteError(w, errors.New("age must be >= 0"), http.StatusBadRequest)
+					router.WriteError(w, errors.New("age must be >= 0"), http.StatusBadRequest)
 					return
 				}
 				var category string
 				switch {
 				case req.Age < 13:
-					WriteError(w, errors.New("forbidden: come back when you're older"), http.StatusForbidden)
+					router.WriteError(w, errors.New("forbidden: come back when you're older"), http.StatusForbidden)
 					return
 				case req.Age < 21:
 					category = "teenager"
@@ -109,7 +129,7 @@ func buildBaseRouter() (http.Handler, error) {
 				default:
 					category = "adult"
 				}
-				_ = WriteJSON(w, struct {
+				_ = router.WriteJSON(w, struct {
 					Greeting string `json:"greeting"`
 					Category string `json:"category"`
 				}{
@@ -135,15 +155,59 @@ func buildBaseRouter() (http.Handler, error) {
 					var err error
 					loc, err = time.LoadLocation(tz)
 					if err != nil {
-						WriteError(w, fmt.Errorf("invalid timezone %q: %w", tz, err), http.StatusBadRequest)
+						router.WriteError(w, fmt.Errorf("invalid timezone %q: %w", tz, err), http.StatusBadRequest)
 						return
 					}
 				}
-				_ = WriteJSON(w, struct {
+				_ = router.WriteJSON(w, struct {
 					Time string `json:"time"`
 				}{time.Now().In(loc).Format(format)})
 			},
 		},
+		// GET /events streams the request's trace, then the server time once every second, as server-sent events.
+		// the query parameter "n" stops the stream after n time events; otherwise it goes until the client hangs up.
+		{
+			pattern: "/events",
+			method:  "GET",
+			/* ----- design note: ----
+			this route demonstrates a long-lived response. Streaming lifts the server's WriteTimeout for this route only,
+			and SSE makes sure every event is flushed to the client as soon as it's sent.
+			---- */
+			handler: router.Streaming(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var n int
+				if s := r.URL.Query().Get("n"); s != "" {
+					var err error
+					if n, err = strconv.Atoi(s); err != nil || n < 0 {
+						router.WriteError(w, fmt.Errorf("invalid n %q: must be a non-negative integer", s), http.StatusBadRequest)
+						return
+					}
+				}
+				stream, err := router.SSE(w, r)
+				if err != nil {
+					router.WriteError(w, err, http.StatusInternalServerError)
+					return
+				}
+				t, _ := ctxutil.Value[trace.Trace](r.Context())
+				if err := stream.SendJSON("trace", t); err != nil {
+					return // client's gone.
+				}
+				tick := time.NewTicker(eventInterval)
+				defer tick.Stop()
+				for i := 0; n == 0 || i < n; i++ {
+					select {
+					case <-r.Context().Done():
+						slog.InfoContext(r.Context(), "events: client hung up", "sent", i)
+						return
+					case now := <-tick.C:
+						if err := stream.SendJSON("time", struct {
+							Time string `json:"time"`
+						}{now.Format(time.RFC3339)}); err != nil {
+							return
+						}
+					}
+				}
+			})),
+		},
 		// GET /echo/{a}/{b}/{c} returns the path parameters as a JSON object in the form {"a": "value of a", "b": "value of b", "c": "value of c"}
 		// the query parameter "case" can be "upper" or "lower" to convert the values to uppercase or lowercase.
 		{
@@ -155,7 +219,7 @@ func buildBaseRouter() (http.Handler, error) {
 			it 'puts everything together' and demonstrates how to use the router and middleware together.
 			---- */
 			handler: func(w http.ResponseWriter, r *http.Request) {
-				vars, _ := ctxutil.Value[PathVars](r.Context())
+				vars, _ := ctxutil.Value[router.PathVars](r.Context())
 				switch strings.ToLower(r.URL.Query().Get("case")) {
 				case "upper":
 					for k, v := range vars {
@@ -166,7 +230,7 @@ func buildBaseRouter() (http.Handler, error) {
 						vars[k] = strings.ToLower(v)
 					}
 				}
-				_ = WriteJSON(w, vars)
+				_ = router.WriteJSON(w, vars)
 			},
 		},
 	} {
@@ -178,12 +242,17 @@ func buildBaseRouter() (http.Handler, error) {
 	return r, nil
 }
 
+// middleware is the server's middleware, in the order a request passes through it.
+var middleware = chain.New(
+	chain.Func[http.Handler](servermw.Trace), // first, so everything after can use the trace.
+	chain.Func[http.Handler](servermw.Log),
+	chain.Func[http.Handler](servermw.Recovery),
+	chain.Func[http.Handler](servermw.RecordResponse),
+	chain.Named("servermw.LimitBody", func(h http.Handler) http.HandlerFunc { return servermw.LimitBody(h, maxBodyBytes) }),
+)
+
+// maxBodyBytes is the largest request body the server accepts. Nothing here needs more than a little JSON.
+const maxBodyBytes = 1 << 20
+
 // apply middleware to the router.
-// remember, middleware is applied in First In, Last Out order.
-func applyMiddleware(h http.Handler) http.Handler {
-	h = servermw.RecordResponse(h)
-	h = servermw.Recovery(h)
-	h = servermw.Log(h)
-	h = servermw.Trace(h)
-	return h
-}
+func applyMiddleware(h http.Handler) http.Handler { return middleware.Then(h) }
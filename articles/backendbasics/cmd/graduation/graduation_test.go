@@ -1,4 +1,3 @@
-// 100% statement coverage of the router.
 package main
 
 import (
@@ -12,12 +11,12 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
-	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/clientmw"
-	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/ctxutil"
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/router"
 )
 
 // initialized during TestMain.
@@ -29,14 +28,14 @@ var (
 // The TestMain function is a special function that runs before any tests are run; think of it as init()
 // that only runs when you run tests.
 func TestMain(m *testing.M) {
-	router, err := buildBaseRouter()
+	h, err := buildBaseRouter()
 	if err != nil {
 		log.Fatal(err)
 	}
-	router = applyMiddleware(router) // apply middleware
+	h = applyMiddleware(h) // apply middleware
 	// httptest.NewServer starts an http server that listens on a random port.
 	// you can use the URL field of the returned httptest.Server to make requests to the server.
-	server = httptest.NewServer(router) // create a test server with the router
+	server = httptest.NewServer(h) // create a test server with the router
 
 	// httptest.Server.Client() returns an http.Client that uses the test server and always accepts it's auth certificate.
 	client = server.Client()
@@ -59,7 +58,6 @@ func TestNotFound(t *testing.T) {
 	for _, tt := range []struct {
 		method, path string
 	}{
-		{"DELETE", "/"},
 		{"GET", "/notfound"},
 		{"GET", "/chess/replay/efronlicht/bobross/1234"},
 	} {
@@ -74,6 +72,19 @@ func TestNotFound(t *testing.T) {
 	}
 }
 
+// TestMethodNotAllowed tests that the router returns a 405 status code and an Allow header for requests that match a route's path, but not its method.
+func TestMethodNotAllowed(t *testing.T) {
+	req, _ := http.NewRequest("DELETE", server.URL+"/", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("client.Do(DELETE, /) returned error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != "GET" {
+		t.Errorf("client.Do(DELETE, /) returned status %d with Allow %q, want %d with Allow %q", resp.StatusCode, resp.Header.Get("Allow"), http.StatusMethodNotAllowed, "GET")
+	}
+}
+
 // TestGraduation tests that the server works as expected.
 // This is meant to demonstrate how to write tests for a server in a way that doesn't have too many dependencies
 // or use any external libraries.
@@ -125,6 +136,22 @@ func TestGraduation(t *testing.T) {
 			wantStatus:       http.StatusOK,
 			wantBodyContains: []string{"Efron", "Licht", "adult"},
 		},
+		// POST /greet/json decodes strictly: a misspelled field is an error, not a zero age.
+		{
+			method:           "POST",
+			path:             "/greet/json",
+			body:             map[string]any{"first": "Efron", "last": "Licht", "agee": 32},
+			wantStatus:       http.StatusBadRequest,
+			wantBodyContains: []string{`{"error":`, `unknown field \"agee\"`},
+		},
+		// ... and it won't read a body of more than 1KiB.
+		{
+			method:           "POST",
+			path:             "/greet/json",
+			body:             map[string]any{"first": strings.Repeat("Efron", 1000), "last": "Licht", "age": 32},
+			wantStatus:       http.StatusRequestEntityTooLarge,
+			wantBodyContains: []string{`{"error":"request body too large: limit is 1024 bytes"}`},
+		},
 		// GET /time returns the current time in UTC, or in the timezone specified by the tz query parameter.
 		{
 			method:     "GET",
@@ -192,117 +219,51 @@ func TestGraduation(t *testing.T) {
 	}
 }
 
-func TestRouterError(t *testing.T) {
-	var r Router
-	if err := r.AddRoute("", nil, ""); err == nil {
-		t.Errorf("AddRoute(%q, %v, %q) returned nil, want error", "", nil, "")
-	}
-	if err := r.AddRoute("/{a:.+}/{a:.+}", nil, ""); err == nil {
-		t.Errorf("AddRoute(%q, %v, %q) returned nil, want error", "/{a:.+}/{a:.+}", nil, "")
+func TestEvents(t *testing.T) {
+	h, err := buildBaseRouter()
+	if err != nil {
+		t.Fatal(err)
 	}
-}
+	// the stream has to outlive the server's WriteTimeout, and still make it through all of the middleware.
+	srv := httptest.NewUnstartedServer(applyMiddleware(h))
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+	defer func(old time.Duration) { eventInterval = old }(eventInterval)
+	eventInterval = 30 * time.Millisecond
 
-func TestRouter(t *testing.T) {
-	var r Router
-	for _, route := range []struct {
-		pattern, method string
-		handler         http.HandlerFunc
-	}{
-		{"/", "GET", func(w http.ResponseWriter, r *http.Request) {
-			fmt.Fprint(w, "Hello, world!\r\n")
-		}},
-		{
-			"/echo/{a:.+}/{b:.+}/{c:.+}", "GET",
-			func(w http.ResponseWriter, r *http.Request) {
-				vars, _ := ctxutil.Value[PathVars](r.Context())
-				_ = json.NewEncoder(w).Encode(vars)
-			},
-		},
-		{
-			"/hello/{name:[a-zA-Z]+}", "GET", func(w http.ResponseWriter, r *http.Request) {
-				vars, _ := ctxutil.Value[PathVars](r.Context())
-				fmt.Fprintf(w, "Hello, %s!\r\n", vars["name"])
-			},
-		},
-	} {
-		if err := r.AddRoute(route.pattern, route.handler, route.method); err != nil {
-			t.Fatalf("AddRoute(%q, %v, %q) returned error: %v", route.pattern, route.handler, route.method, err)
-		}
+	resp, err := srv.Client().Get(srv.URL + "/events?n=3")
+	if err != nil {
+		t.Fatal(err)
 	}
-	for _, tt := range []struct {
-		path, method, want string
-	}{
-		{"/", "GET", "Hello, world!\r\n"},
-		{"/hello/efron", "GET", "Hello, efron!\r\n"},
-		{"/hello/efron", "POST", "404 page not found\n"},
-		{"/hello/efron", "PUT", "404 page not found\n"},
-		{"/echo/first/second/third", "GET", `{"a":"first","b":"second","c":"third"}` + "\n"},
-	} {
-		rec := httptest.NewRecorder()
-		req := httptest.NewRequest(tt.method, tt.path, nil)
-		r.ServeHTTP(rec, req)
-		if got := rec.Body.String(); !strings.Contains(got, tt.want) {
-			t.Errorf("r.ServeHTTP(%q, %q) returned %q, want %q", tt.method, tt.path, got, tt.want)
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type: got %q, want text/event-stream", ct)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading stream: %v", err)
+	}
+	events := strings.Split(strings.TrimSuffix(string(body), "\n\n"), "\n\n")
+	if len(events) != 4 {
+		t.Fatalf("got %d events, want 4 (a trace, then 3 times): %q", len(events), body)
+	}
+	for i, ev := range events {
+		wantName := "time"
+		if i == 0 {
+			wantName = "trace"
+		}
+		name, data, _ := strings.Cut(ev, "\n")
+		if name != "event: "+wantName || !strings.HasPrefix(data, "data: {") {
+			t.Errorf("event %d: got %q, want a %s event with JSON data", i, ev, wantName)
 		}
-
 	}
-}
-
-func TestRouteVars(t *testing.T) {
-	for name, tt := range map[string]struct {
-		pattern string
-		path    string
-		want    PathVars
-		wantErr bool
-	}{
-		"no path params, no regexp": {
-			pattern: "/chess/replay",
-			path:    "/chess/replay",
-		},
-		"regexp, no path params": {
-			pattern: "/rng/seed/{[0-9]+}",
-			path:    "/rng/seed/1234",
-		},
-		"regexp w/ path params": {
-			pattern: "/chess/replay/{white:[a-zA-Z]+}/{black:[a-zA-Z]+}/{id:[0-9]+}",
-			path:    "/chess/replay/efronlicht/bobross/1234",
-			want:    PathVars{"white": "efronlicht", "black": "bobross", "id": "1234"},
-		},
-		"bad regexp": {
-			pattern: "/badregexp/{[-}",
-			path:    "/badregexp/1234",
-			wantErr: true,
-		},
-	} {
-		t.Run(name, func(t *testing.T) {
-			re, names, err := buildRoute(tt.pattern)
-			if err != nil && tt.wantErr {
-				return
-			} else if err != nil {
-				t.Fatalf("buildRoute(%q) returned error: %v", tt.pattern, err)
-			}
-			vars := pathVars(re, names, tt.path)
-			if tt.want == nil {
-				tt.want = make(PathVars)
-			}
-			if !reflect.DeepEqual(vars, tt.want) {
-				t.Errorf("pathVars(%q, %q) returned %v, want %v", tt.pattern, tt.path, vars, tt.want)
-			}
-		})
-		t.Run("no match", func(t *testing.T) {
-			pattern := "/chess/replay/{white:[a-zA-Z]+}/{black:[a-zA-Z]+}/{id:[0-9]+}"
-			path := "/chess/replay/efronlicht/bobross/aaa"
-			re, names, err := buildRoute(pattern)
-			if err != nil {
-				t.Fatalf("buildRoute(%q) returned error: %v", pattern, err)
-			}
-			defer func() {
-				if r := recover(); r == nil {
-					t.Errorf("pathVars(%q, %q) did not panic, want panic", pattern, path)
-				}
-			}()
-			_ = pathVars(re, names, path)
-		})
+	if !strings.Contains(events[0], `"trace_id"`) {
+		t.Errorf("trace event: got %q, want a trace_id", events[0])
+	}
 
+	// a writer that can't flush can't stream.
+	if _, err := router.SSE(struct{ http.ResponseWriter }{httptest.NewRecorder()}, httptest.NewRequest("GET", "/events", nil)); err == nil {
+		t.Error("SSE: expected an error for a ResponseWriter that can't flush")
 	}
 }
@@ -0,0 +1,271 @@
+// pokerserver serves games of poker over HTTP, using the poker engine from ../../poker and the router from ../router.
+//
+//	POST /games                    {"seats": 3, "small_blind": 10, "variant": "omaha"} creates a game, returning its id.
+//	                               The variant is one of poker.Variants: holdem, the default, omaha, or shortdeck.
+//	POST /games/{id}/players       {"name": "efron"} takes a seat, returning a token. The game starts when every seat is taken.
+//	POST /games/{id}/actions       {"kind": "raise", "amount": 40} acts, with the header "Authorization: Bearer <token>".
+//	GET  /games/{id}               the game, as the token's player sees it: with no token, as a spectator.
+//	GET  /games/{id}/events        the same, as server-sent events: one every time the game changes, named "turn" when it's your turn.
+//
+// A token can also go in the query string, as ?token=, for the browser's EventSource, which can't set headers.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/chain"
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/router"
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/servermw"
+	"gitlab.com/efronlicht/blog/articles/backendbasics/poker"
+)
+
+func main() {
+	port := flag.Int("port", 8080, "port to listen on")
+	flag.Parse()
+	h, err := new(server).routes()
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv := http.Server{
+		Addr:              fmt.Sprintf(":%d", *port),
+		Handler:           middleware.Then(h),
+		ReadTimeout:       1 * time.Second,
+		ReadHeaderTimeout: 500 * time.Millisecond,
+		WriteTimeout:      5 * time.Second, // the event stream lifts this for itself: see router.Streaming.
+	}
+	log.Printf("listening on %s", srv.Addr)
+	log.Fatal(srv.ListenAndServe())
+}
+
+// middleware is the server's middleware, in the order a request passes through it.
+var middleware = chain.New(
+	chain.Func[http.Handler](servermw.Trace),
+	chain.Func[http.Handler](servermw.Log),
+	chain.Func[http.Handler](servermw.Recovery),
+	chain.Func[http.Handler](servermw.RecordResponse),
+	chain.Named("servermw.LimitBody", func(h http.Handler) http.HandlerFunc { return servermw.LimitBody(h, 1<<10) }),
+)
+
+// server holds every game, by id.
+type server struct {
+	mux    sync.Mutex
+	tables map[string]*table
+}
+
+// maxWait is as long as POST /games/{id}/actions waits for the game to move on before answering anyways.
+const maxWait = 5 * time.Second
+
+// routes builds the router.
+func (s *server) routes() (*router.Router, error) {
+	r := new(router.Router)
+	const game = "/games/{id:[0-9a-f-]+}"
+	for _, route := range []struct {
+		pattern, method string
+		handler         http.HandlerFunc
+	}{
+		{"/games", "POST", s.create},
+		{game + "/players", "POST", s.join},
+		{game + "/actions", "POST", s.act},
+		{game, "GET", s.state},
+		{game + "/events", "GET", router.Streaming(http.HandlerFunc(s.events))},
+	} {
+		if err := r.AddRoute(route.pattern, route.handler, route.method); err != nil {
+			return nil, fmt.Errorf("AddRoute(%q, %q): %w", route.pattern, route.method, err)
+		}
+	}
+	return r, nil
+}
+
+// table returns the table for the request's {id}, or writes a 404 and returns nil.
+func (s *server) table(w http.ResponseWriter, r *http.Request) *table {
+	id := router.Vars(r.Context())["id"]
+	s.mux.Lock()
+	t := s.tables[id]
+	s.mux.Unlock()
+	if t == nil {
+		router.WriteError(w, fmt.Errorf("no game %q", id), http.StatusNotFound)
+	}
+	return t
+}
+
+// POST /games
+func (s *server) create(w http.ResponseWriter, r *http.Request) {
+	req, err := router.ReadJSON[struct {
+		Seats      int    `json:"seats"`
+		SmallBlind int    `json:"small_blind"`
+		Variant    string `json:"variant"`
+	}](r.Body, router.ReadJSONOpts{DisallowUnknownFields: true})
+	if err != nil {
+		router.WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+	if req.Seats < 2 || req.Seats > 8 {
+		router.WriteError(w, fmt.Errorf("seats must be between 2 and 8, not %d", req.Seats), http.StatusBadRequest)
+		return
+	}
+	if req.SmallBlind == 0 {
+		req.SmallBlind = 10
+	}
+	if req.SmallBlind < 0 {
+		router.WriteError(w, fmt.Errorf("small_blind must be positive, not %d", req.SmallBlind), http.StatusBadRequest)
+		return
+	}
+	if req.Variant == "" {
+		req.Variant = "holdem"
+	}
+	variant, ok := poker.Variants[req.Variant]
+	if !ok {
+		router.WriteError(w, fmt.Errorf("invalid variant %q: must be holdem, omaha, or shortdeck", req.Variant), http.StatusBadRequest)
+		return
+	}
+	t := newTable(req.Seats, req.SmallBlind, variant)
+	s.mux.Lock()
+	if s.tables == nil {
+		s.tables = make(map[string]*table)
+	}
+	s.tables[t.id] = t
+	s.mux.Unlock()
+	created(w, struct {
+		ID string `json:"id"`
+	}{t.id})
+}
+
+// POST /games/{id}/players
+func (s *server) join(w http.ResponseWriter, r *http.Request) {
+	t := s.table(w, r)
+	if t == nil {
+		return
+	}
+	req, err := router.ReadJSON[struct {
+		Name string `json:"name"`
+	}](r.Body, router.ReadJSONOpts{DisallowUnknownFields: true})
+	if err != nil {
+		router.WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+	token, err := t.join(req.Name)
+	if err != nil {
+		router.WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+	created(w, struct {
+		Name  string `json:"name"`
+		Token string `json:"token"`
+	}{req.Name, token})
+}
+
+// created writes v as JSON, with a 201 Created.
+func created(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json") // before WriteHeader, or it's too late.
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// actionKinds are the kinds of action a player can POST.
+var actionKinds = map[string]poker.ActionKind{
+	"fold":  poker.FOLD,
+	"check": poker.CHECK_CALL,
+	"call":  poker.CHECK_CALL,
+	"raise": poker.RAISE,
+	"allin": poker.ALLIN,
+}
+
+// POST /games/{id}/actions
+func (s *server) act(w http.ResponseWriter, r *http.Request) {
+	t := s.table(w, r)
+	if t == nil {
+		return
+	}
+	req, err := router.ReadJSON[struct {
+		Kind   string `json:"kind"`
+		Amount int    `json:"amount"`
+	}](r.Body, router.ReadJSONOpts{DisallowUnknownFields: true})
+	if err != nil {
+		router.WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+	kind, ok := actionKinds[req.Kind]
+	if !ok {
+		router.WriteError(w, fmt.Errorf("invalid kind %q: must be fold, check, call, raise, or allin", req.Kind), http.StatusBadRequest)
+		return
+	}
+	token := bearer(r)
+	changed, err := t.act(token, kind, req.Amount)
+	if err != nil {
+		router.WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+	// answer with the game as it is once it's moved on: i.e, whose turn it is now.
+	ctx, cancel := context.WithTimeout(r.Context(), maxWait)
+	defer cancel()
+	select {
+	case <-changed:
+	case <-ctx.Done():
+	}
+	v, _ := t.view(token, since(r))
+	_ = router.WriteJSON(w, v)
+}
+
+// GET /games/{id}
+func (s *server) state(w http.ResponseWriter, r *http.Request) {
+	if t := s.table(w, r); t != nil {
+		v, _ := t.view(bearer(r), since(r))
+		_ = router.WriteJSON(w, v)
+	}
+}
+
+// GET /games/{id}/events
+func (s *server) events(w http.ResponseWriter, r *http.Request) {
+	t := s.table(w, r)
+	if t == nil {
+		return
+	}
+	stream, err := router.SSE(w, r)
+	if err != nil {
+		router.WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+	token, from := bearer(r), since(r)
+	for {
+		v, changed := t.view(token, from)
+		from += len(v.Events) // each event only goes out once.
+		event := "state"
+		if v.You != nil && v.Turn == v.You.Name {
+			event = "turn"
+		}
+		if err := stream.SendJSON(event, v); err != nil || v.over() {
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// bearer returns the request's token, from the Authorization header or the ?token= query parameter: or "", if there isn't one.
+func bearer(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+	return r.URL.Query().Get("token")
+}
+
+// since is the ?since= query parameter: the first event to send. It's zero if it's missing or invalid.
+func since(r *http.Request) int {
+	n, err := strconv.Atoi(r.URL.Query().Get("since"))
+	if err != nil {
+		return 0
+	}
+	return max(n, 0)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/efronlicht/blog/articles/backendbasics/poker"
+)
+
+func TestPokerServer(t *testing.T) {
+	h, err := new(server).routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(middleware.Then(h))
+	defer srv.Close()
+
+	// do sends a request with a JSON body (if body isn't empty) and the token (if it isn't empty), checks the status, and decodes the response into out, if it isn't nil.
+	do := func(method, path, token, body string, wantStatus int, out any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != wantStatus {
+			var e struct{ Error string }
+			json.NewDecoder(resp.Body).Decode(&e)
+			t.Fatalf("%s %s %s: got %d (%q), want %d", method, path, body, resp.StatusCode, e.Error, wantStatus)
+		}
+		if out != nil {
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				t.Fatalf("%s %s: decoding response: %v", method, path, err)
+			}
+		}
+	}
+
+	do("POST", "/games", "", `{"seats": 1}`, http.StatusBadRequest, nil)
+	do("POST", "/games", "", `{"seats": 2, "tables": 3}`, http.StatusBadRequest, nil)
+	do("POST", "/games", "", `{"seats": 2, "variant": "stud"}`, http.StatusBadRequest, nil)
+	do("GET", "/games/0123-abcd", "", "", http.StatusNotFound, nil)
+	var game struct{ ID string }
+	do("POST", "/games", "", `{"seats": 2, "variant": "omaha"}`, http.StatusCreated, &game)
+	path := "/games/" + game.ID
+
+	var v tableView
+	do("GET", path, "", "", http.StatusOK, &v)
+	if v.Started || v.Seats != 2 || len(v.Joined) != 0 || v.Variant != poker.Omaha.Name {
+		t.Fatalf("before anyone joins: got %+v", v)
+	}
+	tokens := make(map[string]string)
+	for _, name := range []string{"alice", "bob"} {
+		var joined struct{ Name, Token string }
+		do("POST", path+"/players", "", `{"name": "`+name+`"}`, http.StatusCreated, &joined)
+		tokens[name] = joined.Token
+		if name == "alice" {
+			do("POST", path+"/players", "", `{"name": "alice"}`, http.StatusConflict, nil)
+			do("POST", path+"/players", "", `{"name": ""}`, http.StatusBadRequest, nil)
+		}
+	}
+	do("POST", path+"/players", "", `{"name": "carol"}`, http.StatusConflict, nil) // the table's full.
+	if tokens["alice"] == tokens["bob"] || tokens["alice"] == "" {
+		t.Fatalf("got tokens %v, want two different ones", tokens)
+	}
+
+	// wait for the game to ask someone to act.
+	turn := func() tableView {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			var v tableView
+			do("GET", path, "", "", http.StatusOK, &v)
+			if v.Turn != "" || v.over() {
+				return v
+			}
+		}
+		t.Fatal("nobody's turn")
+		return tableView{}
+	}
+	v = turn()
+	other := map[string]string{"alice": "bob", "bob": "alice"}[v.Turn]
+
+	// the event stream says it's your turn.
+	resp, err := http.Get(srv.URL + path + "/events?token=" + tokens[v.Turn])
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := bufio.NewReader(resp.Body).ReadString('\n')
+	resp.Body.Close()
+	if err != nil || first != "event: turn\n" {
+		t.Fatalf("event stream: got %q, %v, want a turn event", first, err)
+	}
+
+	do("POST", path+"/actions", "", `{"kind": "fold"}`, http.StatusUnauthorized, nil)
+	do("POST", path+"/actions", tokens[other], `{"kind": "fold"}`, http.StatusConflict, nil)
+	do("POST", path+"/actions", tokens[v.Turn], `{"kind": "raise", "amount": 1}`, http.StatusUnprocessableEntity, nil)
+	do("POST", path+"/actions", tokens[v.Turn], `{"kind": "bluff"}`, http.StatusBadRequest, nil)
+
+	// alice shoves every hand; bob calls. someone's out of money soon enough.
+	for i := 0; !v.over(); i++ {
+		if i > 1000 {
+			t.Fatal("the game never ended")
+		}
+		kind := map[string]string{"alice": "allin", "bob": "call"}[v.Turn]
+		do("POST", path+"/actions", tokens[v.Turn], `{"kind": "`+kind+`"}`, http.StatusOK, &v)
+		if !v.over() && v.Turn == "" {
+			v = turn()
+		}
+	}
+	if v.Winner != "alice" && v.Winner != "bob" {
+		t.Fatalf("got winner %q, error %q", v.Winner, v.Error)
+	}
+
+	// you see your own cards in the log, but nobody else's.
+	v = tableView{} // decoding into the old one would keep cards from the last response.
+	do("GET", path, tokens["alice"], "", http.StatusOK, &v)
+	var deals int
+	for _, e := range v.Events {
+		if e.Kind == poker.EventDeal {
+			deals++
+			if (e.Player == "alice") != (len(e.Cards) == 4) {
+				t.Fatalf("alice sees %+v", e)
+			}
+		}
+	}
+	if deals == 0 || v.Events[len(v.Events)-1].Kind != poker.EventWinner || v.You == nil || v.You.Name != "alice" {
+		t.Fatalf("after the game: got %d deals, and %+v", deals, v)
+	}
+	var since tableView
+	do("GET", path+"?since=3", "", "", http.StatusOK, &since)
+	if len(since.Events) != len(v.Events)-3 || since.Events[0].Seq != 3 {
+		t.Errorf("?since=3: got %d events, starting from %+v; want %d", len(since.Events), since.Events[0], len(v.Events)-3)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/google/uuid"
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/router"
+	"gitlab.com/efronlicht/blog/articles/backendbasics/poker"
+)
+
+// table is one game of poker: a lobby until every seat is taken, then a poker.Game playing on its own goroutine.
+// The game only ever talks to the table through its OnTurn hook and its actions channel, so the table keeps a copy of everything the handlers need,
+// taken on the game's goroutine, behind mux.
+type table struct {
+	id         string
+	seats      int
+	smallBlind int
+	variant    poker.Variant
+
+	mux     sync.Mutex
+	tokens  map[string]string // auth token -> player name.
+	names   []string          // in the order they joined.
+	actions chan poker.Action // nil until the game starts.
+	turn    *poker.GameView   // what the player whose turn it is can see; nil if we're not waiting on anyone.
+	snap    poker.Snapshot
+	events  []poker.Event
+	winner  string
+	err     error // why the game stopped early, if it did.
+	version int   // bumped on every change.
+	changed chan struct{}
+}
+
+func newTable(seats, smallBlind int, variant poker.Variant) *table {
+	return &table{id: uuid.NewString(), seats: seats, smallBlind: smallBlind, variant: variant, tokens: make(map[string]string), changed: make(chan struct{})}
+}
+
+// update changes the table with f, then wakes up everyone waiting on a change.
+// The caller must hold t.mux.
+func (t *table) update(f func()) {
+	f()
+	t.version++
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// join seats a new player, returning their token. The game starts as soon as the last seat is taken.
+func (t *table) join(name string) (token string, err error) {
+	if name == "" {
+		return "", &router.HTTPError{Code: http.StatusBadRequest, Err: errors.New("join: name is required")}
+	}
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("join: generating token: %w", err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	switch {
+	case len(t.names) == t.seats:
+		return "", &router.HTTPError{Code: http.StatusConflict, Err: fmt.Errorf("join: all %d seats are taken", t.seats)}
+	case slices.Contains(t.names, name):
+		return "", &router.HTTPError{Code: http.StatusConflict, Err: fmt.Errorf("join: there's already a player named %q", name)}
+	}
+	t.update(func() {
+		t.tokens[token] = name
+		t.names = append(t.names, name)
+	})
+	if len(t.names) == t.seats {
+		t.start()
+	}
+	return token, nil
+}
+
+// start starts the game. The caller must hold t.mux.
+func (t *table) start() {
+	g := poker.NewGame(t.names, t.smallBlind, poker.GameOpts{Variant: t.variant})
+	t.actions = make(chan poker.Action, 1) // room for one action: act only sends when the game's waiting for it.
+	g.OnTurn(func(g *poker.Game, v poker.GameView) {
+		t.mux.Lock()
+		defer t.mux.Unlock()
+		t.update(func() { t.turn, t.snap, t.events = &v, g.Snapshot(), g.Events() })
+	})
+	go func() {
+		winner, err := g.Play(t.actions)
+		t.mux.Lock()
+		defer t.mux.Unlock()
+		t.update(func() { t.turn, t.snap, t.events, t.winner, t.err = nil, g.Snapshot(), g.Events(), winner, err })
+	}()
+}
+
+// act takes an action for the player with the given token, if it's their turn and the action's allowed,
+// returning a channel that's closed when the game's moved on.
+func (t *table) act(token string, kind poker.ActionKind, amount int) (<-chan struct{}, error) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	name, ok := t.tokens[token]
+	if !ok {
+		return nil, &router.HTTPError{Code: http.StatusUnauthorized, Err: errors.New("act: missing or invalid token")}
+	}
+	if t.turn == nil || t.turn.Name != name {
+		return nil, &router.HTTPError{Code: http.StatusConflict, Err: fmt.Errorf("act: it's not %s's turn", name)}
+	}
+	// the game would ignore an action it can't take and ask again: catch them here, so we can say why.
+	v := t.turn
+	switch kind {
+	case poker.RAISE:
+		bet := t.snap.CurrentBet - v.ToCall // what they've already bet this round.
+		if amount < v.MinRaise && amount-bet < v.Cash {
+			return nil, &router.HTTPError{Code: http.StatusUnprocessableEntity, Err: fmt.Errorf("act: can't raise to %d: the least you can raise to is %d, unless you go all-in", amount, v.MinRaise)}
+		}
+	case poker.FOLD, poker.CHECK_CALL, poker.ALLIN:
+	default:
+		return nil, &router.HTTPError{Code: http.StatusBadRequest, Err: fmt.Errorf("act: invalid action kind %d", kind)}
+	}
+	changed := t.changed
+	t.turn = nil // nobody else gets to act until the game asks again.
+	t.actions <- poker.Action{Kind: kind, Amount: amount, Player: name}
+	return changed, nil
+}
+
+// view is the table as the player with the given token sees it, with events starting from since; token can be empty for a spectator.
+// changed is closed when the table next changes.
+func (t *table) view(token string, since int) (v tableView, changed <-chan struct{}) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	name := t.tokens[token]
+	v = tableView{
+		ID: t.id, Variant: t.variant.String(), Seats: t.seats, Joined: slices.Clone(t.names), Started: t.actions != nil,
+		Hand: t.snap.Hand, Round: t.snap.Round, Pot: t.snap.Pot, CurrentBet: t.snap.CurrentBet, Community: t.snap.Community,
+		Winner: t.winner, Version: t.version,
+	}
+	if t.err != nil {
+		v.Error = t.err.Error()
+	}
+	if t.turn != nil {
+		v.Turn = t.turn.Name
+	}
+	if name != "" {
+		v.You = &you{Name: name} // even once you've busted out.
+		if t.turn != nil && t.turn.Name == name {
+			v.You.ToCall, v.You.MinRaise = t.turn.ToCall, t.turn.MinRaise
+		}
+	}
+	for _, p := range t.snap.Players {
+		v.Players = append(v.Players, playerView{Name: p.Name, Cash: p.Cash, BetThisRound: p.BetThisRound, Folded: p.Folded, AllIn: p.AllIn})
+		if p.Name == name {
+			v.You.Hole = slices.Clone(p.Cards)
+		}
+	}
+	for _, e := range t.events[min(since, len(t.events)):] {
+		if e.Kind == poker.EventDeal && e.Player != name {
+			e.Cards = nil // everyone sees who got dealt in, but only you see your own cards.
+		}
+		v.Events = append(v.Events, e)
+	}
+	return v, t.changed
+}
+
+// tableView is a table as one player sees it: see table.view.
+type tableView struct {
+	ID         string        `json:"id"`
+	Variant    string        `json:"variant"`
+	Seats      int           `json:"seats"`
+	Joined     []string      `json:"joined"`
+	Started    bool          `json:"started"`
+	Hand       int           `json:"hand"`
+	Round      poker.Round   `json:"round"`
+	Pot        int           `json:"pot"`
+	CurrentBet int           `json:"current_bet"`
+	Community  []poker.Card  `json:"community"`
+	Players    []playerView  `json:"players"`
+	Turn       string        `json:"turn,omitempty"` // whose turn it is.
+	You        *you          `json:"you,omitempty"`  // nil for spectators.
+	Winner     string        `json:"winner,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Version    int           `json:"version"` // goes up by one with every change.
+	Events     []poker.Event `json:"events"`  // the game's event log, from ?since=, with everyone else's hole cards left out.
+}
+
+type playerView struct {
+	Name         string `json:"name"`
+	Cash         int    `json:"cash"`
+	BetThisRound int    `json:"bet_this_round"`
+	Folded       bool   `json:"folded"`
+	AllIn        bool   `json:"all_in"`
+}
+
+// you is what only you can see: your cards, and, on your turn, what you can do.
+type you struct {
+	Name     string       `json:"name"`
+	Hole     []poker.Card `json:"hole"`
+	ToCall   int          `json:"to_call,omitempty"`
+	MinRaise int          `json:"min_raise,omitempty"`
+}
+
+// over reports whether the game's finished: it has a winner, or it stopped early.
+func (v tableView) over() bool { return v.Winner != "" || v.Error != "" }
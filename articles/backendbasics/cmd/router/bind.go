@@ -0,0 +1,197 @@
+package router
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// typed accessors for path parameters. each returns an error if the parameter is missing or malformed;
+// the error is meant to be returned to the client as-is, with a 400 Bad Request.
+
+// Int returns the path parameter name as an int.
+func (pv PathVars) Int(name string) (int, error) {
+	s, err := pv.get(name)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("path parameter %s: %q is not an integer", name, s)
+	}
+	return n, nil
+}
+
+// UUID returns the path parameter name as a UUID.
+func (pv PathVars) UUID(name string) (uuid.UUID, error) {
+	s, err := pv.get(name)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("path parameter %s: %q is not a uuid", name, s)
+	}
+	return id, nil
+}
+
+// Date returns the path parameter name as a date in the form 2006-01-02, in UTC.
+func (pv PathVars) Date(name string) (time.Time, error) {
+	s, err := pv.get(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("path parameter %s: %q is not a date in the form YYYY-MM-DD", name, s)
+	}
+	return t, nil
+}
+
+func (pv PathVars) get(name string) (string, error) {
+	s, ok := pv[name]
+	if !ok {
+		return "", fmt.Errorf("missing path parameter %s", name)
+	}
+	return s, nil
+}
+
+// BindError is returned by Bind when part of the request doesn't fit the struct. It's the client's fault: respond with a 400.
+type BindError struct {
+	Source string // "path", "query", or "body"
+	Field  string // the struct field, or "" for a malformed body
+	Value  string // the offending value, if any
+	Err    error
+}
+
+func (e *BindError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("invalid request %s: %v", e.Source, e.Err)
+	}
+	return fmt.Sprintf("invalid %s parameter for %s: %q: %v", e.Source, e.Field, e.Value, e.Err)
+}
+
+func (e *BindError) Unwrap() error { return e.Err }
+
+// Bind builds a T from the request in one go:
+//   - first, a JSON body, if there is one, is decoded into it as usual, using `json` tags.
+//   - then, fields tagged `query:"name"` are set from the query parameter name, if present.
+//   - finally, fields tagged `path:"name"` are set from the path parameter name, which must be present.
+//
+// So the path takes precedence over the query, which takes precedence over the body.
+// Tagged fields may be strings, bools, integers, floats, time.Time (RFC3339, or a YYYY-MM-DD date), uuid.UUIDs,
+// or anything implementing encoding.TextUnmarshaler. Any mismatch is a *BindError.
+//
+//	type annotateReq struct {
+//		Game  int    `path:"id"`
+//		Moves int    `query:"moves"`
+//		Note  string `json:"note"`
+//	}
+//	req, err := Bind[annotateReq](r)
+//	if err != nil {
+//		WriteError(w, err, http.StatusBadRequest)
+//		return
+//	}
+func Bind[T any](r *http.Request) (T, error) {
+	var v T
+	rv := reflect.ValueOf(&v).Elem()
+	if rv.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("programmer error: Bind[%T]: type parameter must be a struct", v))
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		err := json.NewDecoder(r.Body).Decode(&v)
+		r.Body.Close()
+		if err != nil && !errors.Is(err, io.EOF) { // an empty body is fine.
+			return v, &BindError{Source: "body", Err: err}
+		}
+	}
+	query, vars := r.URL.Query(), Vars(r.Context())
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if name, ok := field.Tag.Lookup("query"); ok && query.Has(name) {
+			if err := setField(rv.Field(i), query.Get(name)); err != nil {
+				return v, &BindError{Source: "query", Field: field.Name, Value: query.Get(name), Err: err}
+			}
+		}
+		if name, ok := field.Tag.Lookup("path"); ok {
+			s, ok := vars[name]
+			if !ok {
+				return v, &BindError{Source: "path", Field: field.Name, Err: fmt.Errorf("missing path parameter %s", name)}
+			}
+			if err := setField(rv.Field(i), s); err != nil {
+				return v, &BindError{Source: "path", Field: field.Name, Value: s, Err: err}
+			}
+		}
+	}
+	return v, nil
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	uuidType = reflect.TypeOf(uuid.UUID{})
+)
+
+// setField parses s into the struct field f.
+func setField(f reflect.Value, s string) error {
+	switch f.Type() {
+	case timeType: // time.Time is a TextUnmarshaler, but only for RFC3339; we also want to accept plain dates.
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			if t, err = time.Parse(time.DateOnly, s); err != nil {
+				return errors.New("expected a RFC3339 timestamp or YYYY-MM-DD date")
+			}
+		}
+		f.Set(reflect.ValueOf(t))
+		return nil
+	case uuidType:
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return errors.New("expected a uuid")
+		}
+		f.Set(reflect.ValueOf(id))
+		return nil
+	}
+	if tu, ok := f.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return tu.UnmarshalText([]byte(s))
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.New("expected true or false")
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected an integer that fits in %s", f.Type())
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected a non-negative integer that fits in %s", f.Type())
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		x, err := strconv.ParseFloat(s, f.Type().Bits())
+		if err != nil {
+			return errors.New("expected a number")
+		}
+		f.SetFloat(x)
+	default:
+		panic(fmt.Sprintf("programmer error: Bind: unsupported field type %s", f.Type()))
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package router
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+)
+
+// --- design note: ---
+// two routes conflict if some request could match both: then which one wins comes down to the sort order in AddRoute,
+// which is just the length of the raw pattern. that's fine when it's on purpose - /static/favicon.ico beats /static/{*} -
+// but it's a bug waiting to happen when, say, /users/{id:[0-9]+} and /users/{name:\w+} both claim /users/1234.
+// wildcard routes are _meant_ to overlap with more specific routes, so we only compare routes that are both exact or both wildcards of the same depth.
+//
+// deciding whether two regexps can match the same string is expensive in general, so we cheat:
+// we generate a few small examples of what each path parameter's regexp matches and see if the other one matches them too.
+// that can miss a conflict, but it never reports one that isn't real: every conflict comes with an example path that matches both routes.
+
+// ConflictError is returned by AddRoute when a new route could match the same requests as an existing one.
+type ConflictError struct {
+	Method, Pattern               string // the new route
+	ExistingMethod, ExistingRoute string // the route it conflicts with
+	Path                          string // a path that matches both
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("route %s %s conflicts with %s %s: both match %s", methodOrAny(e.Method), e.Pattern, methodOrAny(e.ExistingMethod), e.ExistingRoute, e.Path)
+}
+
+func methodOrAny(method string) string {
+	if method == "" {
+		return "(any method)"
+	}
+	return method
+}
+
+// conflict reports whether routes a and b could both match the same request, returning an example path if so.
+func conflict(a, b *route) (path string, ok bool) {
+	if a.method != "" && b.method != "" && a.method != b.method {
+		return "", false
+	}
+	if a.wildcard != b.wildcard || len(a.segments) != len(b.segments) {
+		return "", false
+	}
+	var buf strings.Builder
+	for i := range a.segments {
+		example, ok := overlap(a.segments[i], b.segments[i])
+		if !ok {
+			return "", false
+		}
+		buf.WriteByte('/')
+		buf.WriteString(example)
+	}
+	// the examples were for each segment on its own; make sure the whole path works, too.
+	path = buf.String()
+	return path, a.pattern.MatchString(path) && b.pattern.MatchString(path)
+}
+
+// overlap reports whether two segments could match the same text, returning an example if so.
+func overlap(a, b segment) (example string, ok bool) {
+	switch {
+	case a.wildcard || b.wildcard: // only ever the last segment; anything goes.
+		return "...", true
+	case a.re == nil && b.re == nil:
+		return a.literal, a.literal == b.literal
+	case a.re == nil:
+		return a.literal, b.re.MatchString(a.literal)
+	case b.re == nil:
+		return b.literal, a.re.MatchString(b.literal)
+	}
+	for _, pair := range [2][2]segment{{a, b}, {b, a}} {
+		for _, ex := range examples(pair[0]) {
+			if pair[1].re.MatchString(ex) {
+				return ex, true
+			}
+		}
+	}
+	return "", false
+}
+
+// examples returns a few of the strings a path parameter's regexp matches, shortest-first-ish.
+func examples(seg segment) []string {
+	re, err := syntax.Parse(seg.re.String(), syntax.Perl)
+	if err != nil {
+		return nil // can't happen: it already compiled.
+	}
+	return generate(re.Simplify())
+}
+
+const maxExamples = 16
+
+// generate returns up to maxExamples strings matched by re.
+func generate(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		return nil
+	case syntax.OpLiteral:
+		return []string{string(re.Rune)}
+	case syntax.OpCharClass: // pairs of [lo, hi]; try both ends of each range.
+		var out []string
+		for i := 0; i+1 < len(re.Rune) && len(out) < maxExamples; i += 2 {
+			out = append(out, string(re.Rune[i]))
+			if re.Rune[i+1] != re.Rune[i] {
+				out = append(out, string(re.Rune[i+1]))
+			}
+		}
+		return out
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return []string{"a", "0", "-"}
+	case syntax.OpCapture, syntax.OpPlus:
+		return generate(re.Sub[0])
+	case syntax.OpStar, syntax.OpQuest:
+		return append([]string{""}, generate(re.Sub[0])...)
+	case syntax.OpRepeat:
+		sub := generate(re.Sub[0])
+		out := make([]string, 0, len(sub))
+		for _, s := range sub {
+			out = append(out, strings.Repeat(s, re.Min))
+		}
+		return out
+	case syntax.OpConcat:
+		out := []string{""}
+		for _, sub := range re.Sub {
+			var next []string
+			for _, prefix := range out {
+				for _, s := range generate(sub) {
+					if len(next) < maxExamples {
+						next = append(next, prefix+s)
+					}
+				}
+			}
+			out = next
+		}
+		return out
+	case syntax.OpAlternate:
+		var out []string
+		for _, sub := range re.Sub {
+			out = append(out, generate(sub)...)
+		}
+		if len(out) > maxExamples {
+			out = out[:maxExamples]
+		}
+		return out
+	default: // empty matches and anchors: ^, $, \b, etc.
+		return []string{""}
+	}
+}
@@ -0,0 +1,82 @@
+package router
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS configures Cross-Origin Resource Sharing for a route or a whole Router, so a browser frontend on another origin can call it.
+// Browsers ask permission before most cross-origin requests with a "preflight" OPTIONS request:
+// the router answers those itself, and marks the real responses as shareable with the origin.
+// See https://developer.mozilla.org/en-US/docs/Web/HTTP/CORS.
+//
+// A request from a disallowed origin is still served: it just doesn't get any CORS headers, so the browser won't let the page read it.
+// CORS is not access control.
+type CORS struct {
+	// AllowedOrigins are the origins allowed to make requests, like "https://eblog.fly.dev". "*" allows any origin.
+	AllowedOrigins []string
+	// AllowedMethods are the methods allowed in cross-origin requests. If empty, any method with a route is allowed.
+	AllowedMethods []string
+	// AllowedHeaders are the request headers, beyond the few that are always allowed, that a cross-origin request may set: i.e, "Content-Type" for JSON.
+	// "*" allows any header. Header names are case-insensitive.
+	AllowedHeaders []string
+	// MaxAge is how long the browser may cache a preflight response. If zero, the browser's default applies; usually 5 seconds.
+	MaxAge time.Duration
+}
+
+// allowOrigin reports whether origin can make requests.
+func (c *CORS) allowOrigin(origin string) bool {
+	return origin != "" && (slices.Contains(c.AllowedOrigins, "*") || slices.Contains(c.AllowedOrigins, origin))
+}
+
+// allowMethod reports whether method can be used in a cross-origin request.
+func (c *CORS) allowMethod(method string) bool {
+	return len(c.AllowedMethods) == 0 || slices.ContainsFunc(c.AllowedMethods, func(m string) bool { return strings.EqualFold(m, method) })
+}
+
+// allowHeaders reports whether every header in the comma-separated list headers may be set.
+func (c *CORS) allowHeaders(headers string) bool {
+	if slices.Contains(c.AllowedHeaders, "*") {
+		return true
+	}
+	for _, h := range strings.Split(headers, ",") {
+		h = strings.TrimSpace(h)
+		if h != "" && !slices.ContainsFunc(c.AllowedHeaders, func(allowed string) bool { return strings.EqualFold(allowed, h) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// setOrigin marks a response as shareable with the request's origin, if it's allowed.
+func (c *CORS) setOrigin(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	w.Header().Add("Vary", "Origin") // the response depends on the origin, so caches have to keep them apart.
+	if !c.allowOrigin(origin) {
+		return false
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	return true
+}
+
+// preflight answers a preflight request for a route with the requested method: 204 No Content,
+// along with permission for the method and headers, if they're allowed.
+func (c *CORS) preflight(w http.ResponseWriter, r *http.Request) {
+	defer w.WriteHeader(http.StatusNoContent)
+	w.Header().Add("Vary", "Access-Control-Request-Method")
+	w.Header().Add("Vary", "Access-Control-Request-Headers")
+	method, headers := r.Header.Get("Access-Control-Request-Method"), r.Header.Get("Access-Control-Request-Headers")
+	if !c.allowMethod(method) || !c.allowHeaders(headers) || !c.setOrigin(w, r) {
+		return // no permission: the browser won't make the real request.
+	}
+	w.Header().Set("Access-Control-Allow-Methods", method)
+	if headers != "" {
+		w.Header().Set("Access-Control-Allow-Headers", headers)
+	}
+	if c.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+	}
+}
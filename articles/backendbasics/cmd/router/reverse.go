@@ -0,0 +1,123 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// namedRoute is what Router.URL needs to build a path back out of a pattern.
+type namedRoute struct {
+	raw      string
+	segments []segment
+}
+
+// segment is one '/'-separated piece of a pattern.
+type segment struct {
+	literal  string         // for static segments: the segment itself.
+	name     string         // for path parameters: the parameter's name, or "" if it's not captured.
+	re       *regexp.Regexp // for path parameters: the parameter's regexp, anchored to match the whole value. nil for wildcards.
+	wildcard bool
+}
+
+// parseSegments splits an already-validated pattern into segments. See buildRoute for the syntax.
+func parseSegments(pattern string) ([]segment, error) {
+	var segments []segment
+	for _, f := range strings.Split(pattern, "/")[1:] {
+		if !(len(f) >= 2 && f[0] == '{' && f[len(f)-1] == '}') {
+			segments = append(segments, segment{literal: f})
+			continue
+		}
+		trimmed := f[1 : len(f)-1]
+		if name, ok := wildcardName(trimmed); ok {
+			segments = append(segments, segment{name: name, wildcard: true})
+			continue
+		}
+		name, expr, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			name, expr = "", trimmed
+		}
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp %s: %w", expr, err)
+		}
+		segments = append(segments, segment{name: name, re: re})
+	}
+	return segments, nil
+}
+
+// AddNamedRoute is AddRoute, also registering the pattern under name so Router.URL can build paths for it.
+// The same name may be registered for several methods, so long as the pattern is the same.
+func (r *Router) AddNamedRoute(name, pattern string, h http.Handler, method string) error {
+	if prev, ok := r.named[name]; ok && prev.raw != pattern {
+		return fmt.Errorf("route name %q already in use for %s", name, prev.raw)
+	}
+	if err := r.AddRoute(pattern, h, method); err != nil {
+		return err
+	}
+	segments, err := parseSegments(pattern)
+	if err != nil {
+		return err // can't happen: AddRoute already compiled the pattern.
+	}
+	if r.named == nil {
+		r.named = make(map[string]namedRoute)
+	}
+	r.named[name] = namedRoute{raw: pattern, segments: segments}
+	return nil
+}
+
+// URL builds the path for the route registered as name, filling in its path parameters from vars.
+// Every parameter in the pattern must be in vars and match its regexp, and vars can't have anything else;
+// so a path built by URL is always routed back to the same route, with the same vars.
+// Values are escaped as needed, except that a wildcard's slashes are kept as-is.
+//
+//	r.AddNamedRoute("replay", "/chess/replay/{white:[a-zA-Z]+}/{black:[a-zA-Z]+}/{id:[0-9]+}", replayHandler, "GET")
+//	r.URL("replay", map[string]string{"white": "efronlicht", "black": "bobross", "id": "1234"}) // "/chess/replay/efronlicht/bobross/1234"
+func (r *Router) URL(name string, vars map[string]string) (string, error) {
+	route, ok := r.named[name]
+	if !ok {
+		return "", fmt.Errorf("no route named %q", name)
+	}
+	var buf strings.Builder
+	used := 0
+	for _, seg := range route.segments {
+		buf.WriteByte('/')
+		switch {
+		case seg.name == "" && seg.wildcard:
+			// an unnamed wildcard can match anything, including nothing: leave it empty.
+		case seg.name == "" && seg.re == nil:
+			buf.WriteString(url.PathEscape(seg.literal))
+		case seg.name == "":
+			return "", fmt.Errorf("route %q (%s): can't fill in an unnamed path parameter", name, route.raw)
+		default:
+			v, ok := vars[seg.name]
+			if !ok {
+				return "", fmt.Errorf("route %q (%s): missing path parameter %s", name, route.raw, seg.name)
+			}
+			used++
+			if seg.wildcard {
+				parts := strings.Split(v, "/")
+				for i := range parts {
+					parts[i] = url.PathEscape(parts[i])
+				}
+				buf.WriteString(strings.Join(parts, "/"))
+				continue
+			}
+			if !seg.re.MatchString(v) {
+				return "", fmt.Errorf("route %q (%s): path parameter %s: %q does not match %s", name, route.raw, seg.name, v, seg.re)
+			}
+			buf.WriteString(url.PathEscape(v))
+		}
+	}
+	if used != len(vars) {
+		for k := range vars {
+			if !slices.ContainsFunc(route.segments, func(s segment) bool { return s.name == k }) {
+				return "", fmt.Errorf("route %q (%s): no path parameter %s", name, route.raw, k)
+			}
+		}
+	}
+	return buf.String(), nil
+}
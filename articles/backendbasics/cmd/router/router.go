@@ -0,0 +1,386 @@
+// Package router is the HTTP router from the graduation server in backendbasics3, split out so other servers can use it: see Router.
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/ctxutil"
+)
+
+// Router allows you to match HTTP requests to handlers based on the request path.
+// It use a syntax similar to gorilla/mux:
+// /path/{regexp}/{name:captured-regexp}
+// The last segment may also be a wildcard, {*} or {name:*}, which matches the entire rest of the path, slashes and all:
+// /static/{path:*} matches /static/, /static/s.css, and /static/fonts/OpenSans-Regular.woff2.
+// AddPrefixRoute is shorthand for a route ending in an unnamed wildcard; Mount is the same, but strips the prefix.
+// Routes added with AddNamedRoute can be turned back into paths with URL, so nothing else has to hardcode them.
+// Routes without a wildcard always take precedence over routes with one.
+// Otherwise, two routes that could match the same request are a mistake, and AddRoute returns a *ConflictError: see AllowConflicts.
+// AddRoute adds a route to the router.
+// Vars returns the path parameters for the current request, or nil if there are none.
+//
+//		var r Router
+//		func echoHandler(w http.ResponseWriter, r *http.Request) {
+//			vars := Vars(r.Context())
+//			_ = json.NewEncoder(w).Encode(vars)
+//		}
+//		r.AddRoute("/chess/replay/{white:[a-zA-Z]+}/{black:[a-zA-Z]+}/{id:[0-9]+}", myHandler, "GET")
+//		rec := httptest.NewRecorder()
+//	 ...
+//
+// A request whose path matches a route, but not its method, gets a 405 Method Not Allowed with an Allow header listing the methods that would have matched.
+type Router struct {
+	routes []route
+	trie   *node                 // built from routes by AddRoute: see trie.go
+	named  map[string]namedRoute // see AddNamedRoute and URL
+	// AutoOptions, if true, answers OPTIONS requests for any path with a route (but no OPTIONS route of its own)
+	// with a 204 No Content and an Allow header, rather than a 405.
+	AutoOptions bool
+	// CORS, if non-nil, applies to every route that doesn't have its own: see AddCORSRoute.
+	// Preflight requests for those routes are answered automatically.
+	CORS *CORS
+	// AllowConflicts, if true, lets AddRoute add a route that could match the same requests as an existing one, rather than returning a *ConflictError.
+	// The longer pattern wins. See conflict.go.
+	AllowConflicts bool
+}
+
+type route struct {
+	pattern  *regexp.Regexp
+	names    []string
+	raw      string // the raw pattern string
+	method   string // the HTTP method to match; if empty, all methods match.
+	handler  http.Handler
+	wildcard bool  // the last segment is {*} or {name:*}
+	cors     *CORS // if nil, use the Router's.
+	segments []segment
+}
+
+// Vars is a map of path parameters to their values. It is a unique type so that ctxutil.Value can be used to retrieve it.
+type PathVars map[string]string
+
+// Vars returns the path parameters for the current request, or nil if there are none.
+func Vars(ctx context.Context) PathVars { v, _ := ctxutil.Value[PathVars](ctx); return v }
+
+// suppose our input is /chess/replay/{white:[a-zA-Z]+}/{black:[a-zA-Z]+}/{id:[0-9]+}
+// i.e, we choose the white and black players' names, and the game id.
+// we'd like to match /chess/replay/efronlicht/bobross/1234
+// where white=efronlicht, black=bobross, and id=1234
+// we will eventually compile this into a regexp that looks like:
+//
+//	"^/chess/replay/([a-zA-Z]+)/([a-zA-Z]+)/([0-9]+)$"
+//
+// and a names slice that looks like:
+//
+//	[]string{"white", "black", "id"}
+func buildRoute(pattern string) (re *regexp.Regexp, names []string, err error) {
+	if pattern == "" || pattern[0] != '/' {
+		return nil, nil, fmt.Errorf("invalid pattern %s: must begin with '/'", pattern)
+	}
+	var buf strings.Builder
+	buf.WriteByte('^') // match the beginning of the string
+
+	// we gradually build up the regexp, and keep track of the path parameters we encounter.
+	// e.g, on successive iterations, we'll have:
+	// FOR {
+	// 0: /chess, nil
+	// 1: /chess/replay, nil
+	// 2: /chess/replay/([a-zA-Z]+), [white]
+	// 3: /chess/replay/([a-zA-Z]+)/([a-zA-Z]+), [white, black]
+	// 4: /chess/replay/([a-zA-Z]+)/([a-zA-Z]+)/([0-9]+), [white, black, id]
+	// }
+	segments := strings.Split(pattern, "/")[1:]
+	for i, f := range segments {
+		buf.WriteByte('/')                                    // add the '/' back
+		if len(f) >= 2 && f[0] == '{' && f[len(f)-1] == '}' { // path parameter
+			trimmed := f[1 : len(f)-1] // strip off the '{' and '}'
+			// wildcards match the rest of the path, so they only make sense at the end.
+			// - {*} -> .*
+			// - {path:*} -> (.*)
+			if name, ok := wildcardName(trimmed); ok {
+				if i != len(segments)-1 {
+					return nil, nil, fmt.Errorf("invalid pattern %s: wildcard %s must be the last segment", pattern, f)
+				}
+				if name == "" {
+					buf.WriteString(".*")
+				} else {
+					names = append(names, name)
+					buf.WriteString("(.*)")
+				}
+				continue
+			}
+			// - {white:[a-zA-Z]+} -> [a-zA-Z]+
+			if before, after, ok := strings.Cut(trimmed, ":"); ok { // its a regexp-capture group
+				names = append(names, before)
+
+				// replace with a capture group: i.e, if we have {id:[0-9]+}, we want to replace it with ([0-9]+)
+				buf.WriteByte('(') //
+				buf.WriteString(after)
+				buf.WriteByte(')')
+				// white:[a-zA-Z]+ -> ([a-zA-Z]+)
+			} else {
+				buf.WriteString(trimmed) // a regular expression, but not a captured one
+			}
+		} else {
+			buf.WriteString(regexp.QuoteMeta(f)) // escape any special characters
+		}
+
+	}
+	// check for duplicate path parameters
+	for i := range names {
+		for j := i + 1; j < len(names); j++ {
+			if names[i] == names[j] {
+				return nil, nil, fmt.Errorf("duplicate path parameter %s in %q", names[i], pattern)
+			}
+		}
+	}
+	buf.WriteByte('$') // match the end of the string
+	re, err = regexp.Compile(buf.String())
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid regexp %s: %w", buf.String(), err)
+	}
+	return re, names, nil
+}
+
+// wildcardName reports whether the inside of a {segment} is a wildcard: "*" or "name:*".
+func wildcardName(segment string) (name string, ok bool) {
+	if segment == "*" {
+		return "", true
+	}
+	if name, ok := strings.CutSuffix(segment, ":*"); ok && name != "" {
+		return name, true
+	}
+	return "", false
+}
+
+// AddRoute adds a route to the router. Method is the HTTP method to match; if empty, all methods match.
+// Method will be converted to uppercase; "get", "gEt", and "GET" are all equivalent.
+func (r *Router) AddRoute(pattern string, h http.Handler, method string) error {
+	return r.AddCORSRoute(pattern, h, method, nil)
+}
+
+// AddCORSRoute is AddRoute, with its own CORS configuration overriding the Router's. If cors is nil, it's just AddRoute.
+func (r *Router) AddCORSRoute(pattern string, h http.Handler, method string, cors *CORS) error {
+	re, names, err := buildRoute(pattern)
+	if err != nil {
+		return err
+	}
+	segments, err := parseSegments(pattern)
+	if err != nil {
+		return err
+	}
+	r.routes = append(r.routes, route{
+		raw:      pattern,
+		pattern:  re,
+		names:    names,
+		method:   strings.ToUpper(strings.TrimSpace(method)),
+		handler:  h,
+		wildcard: strings.HasSuffix(pattern, "{*}") || strings.HasSuffix(pattern, ":*}"), // buildRoute already made sure it's the last segment.
+		cors:     cors,
+		segments: segments,
+	})
+	if added := &r.routes[len(r.routes)-1]; !r.AllowConflicts {
+		for i := range r.routes[:len(r.routes)-1] {
+			if path, ok := conflict(added, &r.routes[i]); ok {
+				r.routes = r.routes[:len(r.routes)-1]
+				return &ConflictError{Method: added.method, Pattern: added.raw, ExistingMethod: r.routes[i].method, ExistingRoute: r.routes[i].raw, Path: path}
+			}
+		}
+	}
+
+	// sort the routes so that exact routes come before wildcards, then by length, so that the longest routes are matched first.
+	// i.e, /static/favicon.ico beats /static/{path:*}, which beats /{path:*}.
+	sort.Slice(r.routes, func(i, j int) bool {
+		a, b := r.routes[i], r.routes[j]
+		if a.wildcard != b.wildcard {
+			return !a.wildcard
+		}
+		return len(a.raw) > len(b.raw) || (len(a.raw) == len(b.raw) && a.raw < b.raw) // sort by length, then lexicographically
+	})
+	r.trie = buildTrie(r.routes)
+	return nil
+}
+
+// AddPrefixRoute adds a route matching prefix and everything beneath it: AddPrefixRoute("/static/", h, "GET") is AddRoute("/static/{*}", h, "GET").
+// It's meant for fronting another handler, like a http.FileServer; h sees the full, unmodified path.
+func (r *Router) AddPrefixRoute(prefix string, h http.Handler, method string) error {
+	return r.AddRoute(strings.TrimSuffix(prefix, "/")+"/{*}", h, method)
+}
+
+// Mount hands everything at or beneath prefix to h, for every method, with the prefix stripped from the path:
+// after Mount("/debug/pprof", mux), mux sees GET /debug/pprof/heap as GET /heap, and GET /debug/pprof as GET /.
+// It's meant for hosting another router or a third-party handler under a subtree; compare AddPrefixRoute, which doesn't strip anything.
+// The prefix must be static: it can't have path parameters.
+func (r *Router) Mount(prefix string, h http.Handler) error {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if strings.ContainsAny(prefix, "{}") {
+		return fmt.Errorf("invalid mount prefix %s: can't have path parameters", prefix)
+	}
+	strip := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// like http.StripPrefix, but the prefix itself becomes "/" rather than "".
+		u := *req.URL
+		u.Path = strings.TrimPrefix(req.URL.Path, prefix)
+		if u.Path == "" {
+			u.Path = "/"
+		}
+		if rawPath, ok := strings.CutPrefix(req.URL.RawPath, prefix); ok && rawPath != "" {
+			u.RawPath = rawPath
+		} else {
+			u.RawPath = "" // let url.URL work it out from Path.
+		}
+		req2 := new(http.Request)
+		*req2 = *req
+		req2.URL = &u
+		h.ServeHTTP(w, req2)
+	})
+	if prefix != "" {
+		if err := r.AddRoute(prefix, strip, ""); err != nil {
+			return err
+		}
+	}
+	return r.AddRoute(prefix+"/{*}", strip, "")
+}
+
+// pathVars extracts the path parameters from the path and into a map.
+// --- performance design note: ---
+// this is pretty inefficient, since we're re-matching the regexp.
+// we could instead store the regexp and the names in the route struct, just iterate through & check for matches.
+// since most paths will have very few path parameters, this will perform better and avoid extra allocs.
+// additionally, we could store a small amount of storage for names directly in the route struct so as to avoid
+// allocating a slice for each request.
+// even better, we could make a new API for *regexp.FindStringSubmatch that _appends_ to an existing slice rather than allocating a new one,
+// using a sync.Pool or something to avoid allocations entirely.
+// Still, the goal here is to match gorilla/mux's API w/ as simple of an implementation as possible, so we'll leave it as-is.
+func pathVars(re *regexp.Regexp, names []string, path string) PathVars {
+	matches := re.FindStringSubmatch(path)
+	if len(matches) != len(names)+1 { // +1 because the first match is the entire string
+		panic(fmt.Errorf("programmer error: expected regexp %q to match %q", path, re.String()))
+	}
+	vars := make(PathVars, len(names))
+	for i, match := range matches[1:] { // again, skip the first match, which is the entire string
+		vars[names[i]] = match
+	}
+	return vars
+}
+
+// ServeHTTP implements http.Handler, dispatching requests to the appropriate handler.
+// If no route matches the path, it serves a 404; if some do, but not for this method, it serves a 405.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// a CORS preflight asks about the method the browser _wants_ to use, not OPTIONS.
+	if method := r.Header.Get("Access-Control-Request-Method"); r.Method == "OPTIONS" && method != "" && r.Header.Get("Origin") != "" {
+		if route, _ := rt.match(r.URL.Path, method); route != nil && rt.corsFor(route) != nil {
+			rt.corsFor(route).preflight(w, r)
+			return
+		}
+	}
+	route, allowed := rt.match(r.URL.Path, r.Method) // allowed: methods of routes whose pattern matched, but whose method didn't
+	if route != nil {
+		if cors := rt.corsFor(route); cors != nil {
+			cors.setOrigin(w, r)
+		}
+		vars := pathVars(route.pattern, route.names, r.URL.Path)
+		ctx := ctxutil.WithValue(r.Context(), vars)
+		route.handler.ServeHTTP(w, r.WithContext(ctx))
+		return
+	}
+	if len(allowed) == 0 {
+		http.NotFound(w, r) // no route matched; serve a 404
+		return
+	}
+	if rt.AutoOptions {
+		allowed = append(allowed, "OPTIONS")
+	}
+	// several routes can share a method: i.e, GET /static/favicon.ico and GET /static/{*}.
+	sort.Strings(allowed)
+	allowed = slices.Compact(allowed)
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	if rt.AutoOptions && r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+}
+
+// corsFor returns the CORS configuration for route, if any.
+func (rt *Router) corsFor(route *route) *CORS {
+	if route.cors != nil {
+		return route.cors
+	}
+	return rt.CORS
+}
+
+// HTTPError is an error that knows what status code it should be reported with. WriteError uses its Code.
+type HTTPError struct {
+	Code int // i.e, http.StatusBadRequest.
+	Err  error
+}
+
+func (e *HTTPError) Error() string { return e.Err.Error() }
+func (e *HTTPError) Unwrap() error { return e.Err }
+
+// ReadJSONOpts makes ReadJSON stricter. The zero value decodes the way json.Decoder does by default.
+type ReadJSONOpts struct {
+	// DisallowUnknownFields rejects objects with fields T doesn't have, rather than ignoring them: a typo in a field name is an error, not a silently missing field.
+	DisallowUnknownFields bool
+	// MaxBytes, if nonzero, is the most bytes to read. A bigger body is a 413 Request Entity Too Large.
+	MaxBytes int64
+}
+
+// ReadJSON reads a JSON object from an io.ReadCloser, closing the reader when it's done. It's primarily useful for reading JSON from *http.Request.Body.
+// opts is optional: only the first one is used.
+// Errors are *HTTPError: a 413 if the body's over opts.MaxBytes, and a 400 otherwise. Pass them straight to WriteError.
+func ReadJSON[T any](r io.ReadCloser, opts ...ReadJSONOpts) (T, error) {
+	var o ReadJSONOpts
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	var v T // declare a variable of type T
+	var body io.Reader = r
+	if o.MaxBytes > 0 {
+		body = http.MaxBytesReader(nil, r, o.MaxBytes)
+	}
+	dec := json.NewDecoder(body)
+	if o.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	err := errors.Join(dec.Decode(&v), r.Close()) // decode the JSON into v, then close the reader.
+	var tooBig *http.MaxBytesError
+	switch {
+	case err == nil:
+		return v, nil
+	case errors.As(err, &tooBig):
+		return v, &HTTPError{Code: http.StatusRequestEntityTooLarge, Err: fmt.Errorf("request body too large: limit is %d bytes", tooBig.Limit)}
+	default:
+		return v, &HTTPError{Code: http.StatusBadRequest, Err: fmt.Errorf("decoding JSON: %w", err)}
+	}
+}
+
+// WriteJSON writes a JSON object to a http.ResponseWriter, setting the Content-Type header to application/json.
+func WriteJSON(w http.ResponseWriter, v any) error {
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(v)
+}
+
+// WriteError logs an error, then writes it as a JSON object in the form {"error": <error>}, setting the Content-Type header to application/json.
+// If err is or wraps an *HTTPError, its Code is used instead of code.
+func WriteError(w http.ResponseWriter, err error, code int) {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		code = httpErr.Code
+	}
+	log.Printf("%d %v: %v", code, http.StatusText(code), err) // log the error; http.StatusText gets "Not Found" from 404, etc.
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{Error: err.Error()})
+}
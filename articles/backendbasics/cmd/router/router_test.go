@@ -0,0 +1,645 @@
+// 100% statement coverage of the router.
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/ctxutil"
+)
+
+// TestMethodNotAllowed tests that requests matching a route's path, but not its method, get a 405 with an Allow header listing every method that would have matched.
+func TestMethodNotAllowed(t *testing.T) {
+	r := Router{AutoOptions: true}
+	ok := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	for _, route := range []struct{ pattern, method string }{
+		{"/item/{id:[0-9]+}", "GET"},
+		{"/item/{id:[0-9]+}", "delete"},
+		{"/item/{*}", "GET"},
+		{"/item/{*}", "PUT"},
+	} {
+		if err := r.AddRoute(route.pattern, ok, route.method); err != nil {
+			t.Fatalf("AddRoute(%q, %q) returned error: %v", route.pattern, route.method, err)
+		}
+	}
+	for _, tt := range []struct {
+		method, path string
+		wantStatus   int
+		wantAllow    string
+	}{
+		{"POST", "/item/1", http.StatusMethodNotAllowed, "DELETE, GET, OPTIONS, PUT"}, // every matching route counts, and duplicates are removed.
+		{"POST", "/item/abc", http.StatusMethodNotAllowed, "GET, OPTIONS, PUT"},
+		{"OPTIONS", "/item/1", http.StatusNoContent, "DELETE, GET, OPTIONS, PUT"},
+		{"PUT", "/item/1", http.StatusOK, ""}, // falls through to the wildcard route, which allows PUT.
+		{"OPTIONS", "/other", http.StatusNotFound, ""},
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.wantStatus || rec.Header().Get("Allow") != tt.wantAllow {
+			t.Errorf("%s %s: got status %d with Allow %q, want %d with Allow %q", tt.method, tt.path, rec.Code, rec.Header().Get("Allow"), tt.wantStatus, tt.wantAllow)
+		}
+	}
+}
+
+func TestRouterError(t *testing.T) {
+	var r Router
+	if err := r.AddRoute("", nil, ""); err == nil {
+		t.Errorf("AddRoute(%q, %v, %q) returned nil, want error", "", nil, "")
+	}
+	if err := r.AddRoute("/{a:.+}/{a:.+}", nil, ""); err == nil {
+		t.Errorf("AddRoute(%q, %v, %q) returned nil, want error", "/{a:.+}/{a:.+}", nil, "")
+	}
+}
+
+func TestRouter(t *testing.T) {
+	var r Router
+	for _, route := range []struct {
+		pattern, method string
+		handler         http.HandlerFunc
+	}{
+		{"/", "GET", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "Hello, world!\r\n")
+		}},
+		{
+			"/echo/{a:.+}/{b:.+}/{c:.+}", "GET",
+			func(w http.ResponseWriter, r *http.Request) {
+				vars, _ := ctxutil.Value[PathVars](r.Context())
+				_ = json.NewEncoder(w).Encode(vars)
+			},
+		},
+		{
+			"/hello/{name:[a-zA-Z]+}", "GET", func(w http.ResponseWriter, r *http.Request) {
+				vars, _ := ctxutil.Value[PathVars](r.Context())
+				fmt.Fprintf(w, "Hello, %s!\r\n", vars["name"])
+			},
+		},
+	} {
+		if err := r.AddRoute(route.pattern, route.handler, route.method); err != nil {
+			t.Fatalf("AddRoute(%q, %v, %q) returned error: %v", route.pattern, route.handler, route.method, err)
+		}
+	}
+	for _, tt := range []struct {
+		path, method, want string
+	}{
+		{"/", "GET", "Hello, world!\r\n"},
+		{"/hello/efron", "GET", "Hello, efron!\r\n"},
+		{"/hello/efron", "POST", "405 method not allowed\n"},
+		{"/hello/efron", "PUT", "405 method not allowed\n"},
+		{"/echo/first/second/third", "GET", `{"a":"first","b":"second","c":"third"}` + "\n"},
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		r.ServeHTTP(rec, req)
+		if got := rec.Body.String(); !strings.Contains(got, tt.want) {
+			t.Errorf("r.ServeHTTP(%q, %q) returned %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+
+	}
+}
+
+func TestRouteVars(t *testing.T) {
+	for name, tt := range map[string]struct {
+		pattern string
+		path    string
+		want    PathVars
+		wantErr bool
+	}{
+		"no path params, no regexp": {
+			pattern: "/chess/replay",
+			path:    "/chess/replay",
+		},
+		"regexp, no path params": {
+			pattern: "/rng/seed/{[0-9]+}",
+			path:    "/rng/seed/1234",
+		},
+		"regexp w/ path params": {
+			pattern: "/chess/replay/{white:[a-zA-Z]+}/{black:[a-zA-Z]+}/{id:[0-9]+}",
+			path:    "/chess/replay/efronlicht/bobross/1234",
+			want:    PathVars{"white": "efronlicht", "black": "bobross", "id": "1234"},
+		},
+		"bad regexp": {
+			pattern: "/badregexp/{[-}",
+			path:    "/badregexp/1234",
+			wantErr: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			re, names, err := buildRoute(tt.pattern)
+			if err != nil && tt.wantErr {
+				return
+			} else if err != nil {
+				t.Fatalf("buildRoute(%q) returned error: %v", tt.pattern, err)
+			}
+			vars := pathVars(re, names, tt.path)
+			if tt.want == nil {
+				tt.want = make(PathVars)
+			}
+			if !reflect.DeepEqual(vars, tt.want) {
+				t.Errorf("pathVars(%q, %q) returned %v, want %v", tt.pattern, tt.path, vars, tt.want)
+			}
+		})
+		t.Run("no match", func(t *testing.T) {
+			pattern := "/chess/replay/{white:[a-zA-Z]+}/{black:[a-zA-Z]+}/{id:[0-9]+}"
+			path := "/chess/replay/efronlicht/bobross/aaa"
+			re, names, err := buildRoute(pattern)
+			if err != nil {
+				t.Fatalf("buildRoute(%q) returned error: %v", pattern, err)
+			}
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("pathVars(%q, %q) did not panic, want panic", pattern, path)
+				}
+			}()
+			_ = pathVars(re, names, path)
+		})
+
+	}
+}
+
+func TestWildcardRoutes(t *testing.T) {
+	var r Router
+	for _, pattern := range []string{"/static/{path:*}", "/static/favicon.ico", `/static/{name:[a-z]+\.css}`, "/{*}"} {
+		pattern := pattern
+		if err := r.AddRoute(pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewEncoder(w).Encode(map[string]any{"pattern": pattern, "vars": Vars(r.Context())})
+		}), "GET"); err != nil {
+			t.Fatalf("AddRoute(%q) returned error: %v", pattern, err)
+		}
+	}
+	if err := r.AddPrefixRoute("/files/", http.FileServer(http.Dir(".")), "GET"); err != nil {
+		t.Fatalf("AddPrefixRoute returned error: %v", err)
+	}
+	for _, tt := range []struct {
+		path, wantPattern string
+		wantVars          PathVars
+	}{
+		{"/static/favicon.ico", "/static/favicon.ico", PathVars{}},                       // exact beats wildcard...
+		{"/static/dark.css", `/static/{name:[a-z]+\.css}`, PathVars{"name": "dark.css"}}, // ...and so does a regexp.
+		{"/static/fonts/a.woff2", "/static/{path:*}", PathVars{"path": "fonts/a.woff2"}}, // the wildcard captures slashes, too.
+		{"/static/", "/static/{path:*}", PathVars{"path": ""}},
+		{"/anything/else", "/{*}", PathVars{}}, // longer wildcards beat shorter ones.
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+		var got struct {
+			Pattern string
+			Vars    PathVars
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+			t.Fatalf("GET %s: decoding response: %v", tt.path, err)
+		}
+		if got.Pattern != tt.wantPattern || !reflect.DeepEqual(got.Vars, tt.wantVars) {
+			t.Errorf("GET %s: matched %q with %v, want %q with %v", tt.path, got.Pattern, got.Vars, tt.wantPattern, tt.wantVars)
+		}
+	}
+	// the prefix route fronts a file server, which sees the whole path.
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/files/graduation.txt", nil))
+	if rec.Code != http.StatusNotFound { // http.Dir(".") has no files/ directory...
+		t.Errorf("GET /files/graduation.txt: expected the file server's 404, got %d", rec.Code)
+	}
+	if err := r.AddRoute("/static/{path:*}/more", nil, ""); err == nil {
+		t.Error("expected an error for a wildcard that isn't the last segment")
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	for _, tt := range []struct {
+		err      error
+		code     int
+		wantCode int
+	}{
+		{errors.New("plain"), http.StatusBadRequest, http.StatusBadRequest},
+		{&HTTPError{Code: http.StatusConflict, Err: errors.New("taken")}, http.StatusBadRequest, http.StatusConflict},
+		{fmt.Errorf("wrapped: %w", &HTTPError{Code: http.StatusNotFound, Err: errors.New("gone")}), http.StatusInternalServerError, http.StatusNotFound},
+	} {
+		rec := httptest.NewRecorder()
+		WriteError(rec, tt.err, tt.code)
+		var got struct{ Error string }
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.Error != tt.err.Error() {
+			t.Errorf("WriteError(%v): got body %q, want {\"error\": %q}", tt.err, rec.Body, tt.err.Error())
+		}
+		if rec.Code != tt.wantCode || rec.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("WriteError(%v, %d): got %d %q, want %d application/json", tt.err, tt.code, rec.Code, rec.Header().Get("Content-Type"), tt.wantCode)
+		}
+	}
+}
+
+func TestBind(t *testing.T) {
+	type annotateReq struct {
+		Game    uuid.UUID `path:"game"`
+		Day     time.Time `path:"day"`
+		Moves   int       `query:"moves"`
+		Verbose bool      `query:"verbose"`
+		Note    string    `json:"note"`
+		Rating  uint16    `json:"rating" query:"rating"` // the query overrides the body.
+	}
+	var r Router
+	if err := r.AddRoute("/games/{game:[0-9a-f-]+}/{day:[0-9-]+}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := Bind[annotateReq](r)
+		if err != nil {
+			WriteError(w, err, http.StatusBadRequest)
+			return
+		}
+		WriteJSON(w, req)
+	}), "POST"); err != nil {
+		t.Fatal(err)
+	}
+	const game = "d7a3e3b2-8f5b-4c38-9f0e-0d6c2a1f5b77"
+	for _, tt := range []struct {
+		name, path, body string
+		wantCode         int
+		want             annotateReq
+	}{
+		{
+			name: "all sources", path: "/games/" + game + "/2023-10-01?moves=12&verbose=true&rating=1800", body: `{"note": "sicilian", "rating": 1200}`,
+			wantCode: 200,
+			want:     annotateReq{Game: uuid.MustParse(game), Day: time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC), Moves: 12, Verbose: true, Note: "sicilian", Rating: 1800},
+		},
+		{
+			name: "no body, no query", path: "/games/" + game + "/2023-10-01",
+			wantCode: 200,
+			want:     annotateReq{Game: uuid.MustParse(game), Day: time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{name: "bad uuid", path: "/games/abc/2023-10-01", wantCode: 400},
+		{name: "bad date", path: "/games/" + game + "/2023-13-01", wantCode: 400},
+		{name: "bad query", path: "/games/" + game + "/2023-10-01?moves=twelve", wantCode: 400},
+		{name: "overflow", path: "/games/" + game + "/2023-10-01?rating=70000", wantCode: 400},
+		{name: "bad body", path: "/games/" + game + "/2023-10-01", body: `{"note": 12}`, wantCode: 400},
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body)))
+		if rec.Code != tt.wantCode {
+			t.Errorf("%s: got status %d, want %d: %s", tt.name, rec.Code, tt.wantCode, rec.Body)
+			continue
+		}
+		if tt.wantCode != 200 {
+			continue
+		}
+		var got annotateReq
+		if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+			t.Fatalf("%s: decoding response: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPathVarsAccessors(t *testing.T) {
+	pv := PathVars{"id": "12", "game": "d7a3e3b2-8f5b-4c38-9f0e-0d6c2a1f5b77", "day": "2023-10-01", "bad": "x"}
+	if n, err := pv.Int("id"); err != nil || n != 12 {
+		t.Errorf("Int(id) = %d, %v, want 12", n, err)
+	}
+	if id, err := pv.UUID("game"); err != nil || id.String() != pv["game"] {
+		t.Errorf("UUID(game) = %s, %v, want %s", id, err, pv["game"])
+	}
+	if d, err := pv.Date("day"); err != nil || !d.Equal(time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Date(day) = %s, %v, want 2023-10-01", d, err)
+	}
+	for _, name := range []string{"bad", "missing"} {
+		if _, err := pv.Int(name); err == nil {
+			t.Errorf("Int(%s): expected an error", name)
+		}
+		if _, err := pv.UUID(name); err == nil {
+			t.Errorf("UUID(%s): expected an error", name)
+		}
+		if _, err := pv.Date(name); err == nil {
+			t.Errorf("Date(%s): expected an error", name)
+		}
+	}
+}
+
+// linearMatch is the router's original matching algorithm: check every route's regexp, in order.
+// it's the reference the trie has to agree with, and the baseline for BenchmarkRouter.
+func linearMatch(rt *Router, path, method string) (best *route, allowed []string) {
+	for i := range rt.routes {
+		route := &rt.routes[i]
+		if !route.pattern.MatchString(path) {
+			continue
+		}
+		if route.method == "" || route.method == method {
+			return route, nil
+		}
+		allowed = append(allowed, route.method)
+	}
+	return nil, allowed
+}
+
+// benchRoutes is a plausible-looking API: mostly static prefixes, with a few path parameters and wildcards.
+var benchRoutes = []struct{ pattern, method string }{
+	{"/", "GET"},
+	{"/favicon.ico", "GET"},
+	{"/articles", "GET"},
+	{"/articles/{name:[a-z0-9-]+}.html", "GET"},
+	{"/static/{path:*}", "GET"},
+	{"/static/s.css", "GET"},
+	{"/debug/pprof/{*}", ""},
+	{"/api/v1/users", "GET"},
+	{"/api/v1/users", "POST"},
+	{"/api/v1/users/{id:[0-9]+}", "GET"},
+	{"/api/v1/users/{id:[0-9]+}", "PUT"},
+	{"/api/v1/users/{id:[0-9]+}", "DELETE"},
+	{"/api/v1/users/{id:[0-9]+}/games", "GET"},
+	{"/api/v1/games/{id:[0-9a-f-]+}", "GET"},
+	{"/api/v1/games/{id:[0-9a-f-]+}/moves", "GET"},
+	{"/api/v1/games/{id:[0-9a-f-]+}/moves", "POST"},
+	{"/chess/replay/{white:[a-zA-Z]+}/{black:[a-zA-Z]+}/{id:[0-9]+}", "GET"},
+	{"/chess/openings", "GET"},
+	{"/chess/openings/{eco:[A-E][0-9]{2}}", "GET"},
+	{"/poker/tables", "GET"},
+	{"/poker/tables/{id:[0-9]+}", "GET"},
+	{"/poker/tables/{id:[0-9]+}/join", "POST"},
+	{"/healthz", "GET"},
+	{"/readyz", "GET"},
+	{"/metrics", "GET"},
+}
+
+var benchPaths = []struct{ method, path string }{
+	{"GET", "/"},
+	{"GET", "/static/s.css"},
+	{"GET", "/static/fonts/OpenSans-Regular.woff2"},
+	{"GET", "/articles/backendbasics.html"},
+	{"PUT", "/api/v1/users/1234"},
+	{"POST", "/api/v1/games/d7a3e3b2-8f5b-4c38-9f0e-0d6c2a1f5b77/moves"},
+	{"GET", "/chess/replay/efronlicht/bobross/1234"},
+	{"GET", "/healthz"},
+	{"GET", "/nothing/here"},
+}
+
+func benchRouter(tb testing.TB) *Router {
+	var r Router
+	for _, br := range benchRoutes {
+		if err := r.AddRoute(br.pattern, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), br.method); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return &r
+}
+
+// TestTrieMatch checks the trie picks the same route as the linear scan, for every route's method and some that match nothing.
+func TestTrieMatch(t *testing.T) {
+	r := benchRouter(t)
+	for _, tt := range benchPaths {
+		for _, method := range []string{tt.method, "GET", "PATCH"} {
+			want, wantAllowed := linearMatch(r, tt.path, method)
+			got, gotAllowed := r.match(tt.path, method)
+			if got != want {
+				t.Errorf("%s %s: trie matched %v, linear scan matched %v", method, tt.path, got, want)
+			}
+			sort.Strings(wantAllowed)
+			sort.Strings(gotAllowed)
+			if !slices.Equal(wantAllowed, gotAllowed) {
+				t.Errorf("%s %s: trie allowed %v, linear scan allowed %v", method, tt.path, gotAllowed, wantAllowed)
+			}
+		}
+	}
+	if got, _ := r.match("*", "OPTIONS"); got != nil {
+		t.Errorf("OPTIONS *: expected no match, got %s", got.raw)
+	}
+}
+
+// BenchmarkRouter compares the trie against the linear scan it replaced, and against gorilla/mux, which ours imitates.
+// Each iteration routes every request in benchPaths once.
+func BenchmarkRouter(b *testing.B) {
+	r := benchRouter(b)
+	b.Run("trie", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, p := range benchPaths {
+				r.match(p.path, p.method)
+			}
+		}
+	})
+	b.Run("linear", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, p := range benchPaths {
+				linearMatch(r, p.path, p.method)
+			}
+		}
+	})
+	b.Run("gorilla", func(b *testing.B) {
+		m := mux.NewRouter()
+		for _, br := range benchRoutes {
+			// gorilla has no {*}: a wildcard is just a regexp that matches slashes.
+			pattern := strings.Replace(strings.Replace(br.pattern, "{*}", "{rest:.*}", 1), ":*}", ":.*}", 1)
+			route := m.Handle(pattern, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+			if br.method != "" {
+				route.Methods(br.method)
+			}
+		}
+		reqs := make([]*http.Request, len(benchPaths))
+		for i, p := range benchPaths {
+			reqs[i] = httptest.NewRequest(p.method, p.path, nil)
+		}
+		b.ResetTimer()
+		var match mux.RouteMatch
+		for i := 0; i < b.N; i++ {
+			for _, req := range reqs {
+				m.Match(req, &match)
+			}
+		}
+	})
+}
+
+func TestReverseURL(t *testing.T) {
+	var r Router
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _ = json.NewEncoder(w).Encode(Vars(r.Context())) })
+	for _, nr := range []struct{ name, pattern, method string }{
+		{"replay", "/chess/replay/{white:[a-zA-Z]+}/{black:[a-zA-Z]+}/{id:[0-9]+}", "GET"},
+		{"replay", "/chess/replay/{white:[a-zA-Z]+}/{black:[a-zA-Z]+}/{id:[0-9]+}", "DELETE"}, // same name, same pattern: fine.
+		{"static", "/static/{path:*}", "GET"},
+		{"echo", "/echo/{a:.+}/{b:.+}", "GET"},
+		{"seed", "/rng/seed/{[0-9]+}", "GET"},
+	} {
+		if err := r.AddNamedRoute(nr.name, nr.pattern, echo, nr.method); err != nil {
+			t.Fatalf("AddNamedRoute(%q, %q): %v", nr.name, nr.pattern, err)
+		}
+	}
+	if err := r.AddNamedRoute("replay", "/replay/{id:[0-9]+}", echo, "GET"); err == nil {
+		t.Error("expected an error reusing a name for a different pattern")
+	}
+	for _, tt := range []struct {
+		name    string
+		vars    PathVars
+		want    string
+		wantErr bool
+	}{
+		{name: "replay", vars: PathVars{"white": "efronlicht", "black": "bobross", "id": "1234"}, want: "/chess/replay/efronlicht/bobross/1234"},
+		{name: "static", vars: PathVars{"path": "fonts/Open Sans.woff2"}, want: "/static/fonts/Open%20Sans.woff2"},
+		{name: "echo", vars: PathVars{"a": "x/y", "b": "?"}, want: "/echo/x%2Fy/%3F"},
+		{name: "replay", vars: PathVars{"white": "efronlicht", "black": "bobross", "id": "abc"}, wantErr: true}, // doesn't match [0-9]+
+		{name: "replay", vars: PathVars{"white": "efronlicht", "black": "bobross"}, wantErr: true},              // missing id
+		{name: "replay", vars: PathVars{"white": "a", "black": "b", "id": "1", "extra": "x"}, wantErr: true},    // no such parameter
+		{name: "seed", vars: nil, wantErr: true}, // can't fill an unnamed parameter
+		{name: "nope", wantErr: true},
+	} {
+		got, err := r.URL(tt.name, tt.vars)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("URL(%q, %v): expected an error, got %q", tt.name, tt.vars, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("URL(%q, %v) = %q, %v; want %q", tt.name, tt.vars, got, err, tt.want)
+			continue
+		}
+		// and the round trip: the path routes back to the same vars.
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", got, nil))
+		var vars PathVars
+		if err := json.NewDecoder(rec.Body).Decode(&vars); err != nil || !reflect.DeepEqual(vars, tt.vars) {
+			t.Errorf("GET %s: got vars %v (%v), want %v", got, vars, err, tt.vars)
+		}
+	}
+}
+
+func TestMount(t *testing.T) {
+	var r Router
+	sub := http.NewServeMux() // i.e, net/http/pprof's.
+	sub.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { fmt.Fprintf(w, "index %s", r.URL.Path) })
+	sub.HandleFunc("/heap", func(w http.ResponseWriter, r *http.Request) { fmt.Fprintf(w, "heap %s %s", r.Method, r.URL.RawQuery) })
+	if err := r.Mount("/debug/pprof/", sub); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddRoute("/debug/pprof/cmdline", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { fmt.Fprint(w, "cmdline") }), "GET"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Mount("/debug/{name}", sub); err == nil {
+		t.Error("expected an error for a prefix with a path parameter")
+	}
+	for _, tt := range []struct{ method, path, want string }{
+		{"GET", "/debug/pprof", "index /"},
+		{"GET", "/debug/pprof/", "index /"},
+		{"GET", "/debug/pprof/goroutine", "index /goroutine"},
+		{"POST", "/debug/pprof/heap?gc=1", "heap POST gc=1"}, // every method, and the query string survives.
+		{"GET", "/debug/pprof/cmdline", "cmdline"},           // an exact route still beats the mount.
+		{"GET", "/debug/pprofile", "404 page not found\n"},   // a prefix is whole segments only.
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if got := rec.Body.String(); got != tt.want {
+			t.Errorf("%s %s: got %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	var r Router
+	r.CORS = &CORS{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"Content-Type"}, MaxAge: time.Hour}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { fmt.Fprint(w, "ok") })
+	for _, method := range []string{"GET", "POST"} {
+		if err := r.AddRoute("/greet", ok, method); err != nil {
+			t.Fatal(err)
+		}
+	}
+	strict := &CORS{AllowedOrigins: []string{"https://eblog.fly.dev"}, AllowedMethods: []string{"PUT"}}
+	if err := r.AddCORSRoute("/admin", ok, "PUT", strict); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddCORSRoute("/admin", ok, "DELETE", strict); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name, method, path, origin, reqMethod, reqHeaders string
+		wantCode                                          int
+		wantOrigin, wantMethods, wantHeaders, wantMaxAge  string
+	}{
+		{name: "preflight", method: "OPTIONS", path: "/greet", origin: "https://example.com", reqMethod: "POST", reqHeaders: "content-type",
+			wantCode: 204, wantOrigin: "https://example.com", wantMethods: "POST", wantHeaders: "content-type", wantMaxAge: "3600"},
+		{name: "preflight, disallowed header", method: "OPTIONS", path: "/greet", origin: "https://example.com", reqMethod: "POST", reqHeaders: "X-Secret",
+			wantCode: 204},
+		{name: "preflight, no route for method", method: "OPTIONS", path: "/greet", origin: "https://example.com", reqMethod: "DELETE",
+			wantCode: 405}, // not a route: the router's usual answer.
+		{name: "simple request", method: "GET", path: "/greet", origin: "https://example.com",
+			wantCode: 200, wantOrigin: "https://example.com"},
+		{name: "same-origin request", method: "GET", path: "/greet",
+			wantCode: 200},
+		{name: "per-route config", method: "OPTIONS", path: "/admin", origin: "https://eblog.fly.dev", reqMethod: "PUT",
+			wantCode: 204, wantOrigin: "https://eblog.fly.dev", wantMethods: "PUT"},
+		{name: "per-route, disallowed origin", method: "OPTIONS", path: "/admin", origin: "https://example.com", reqMethod: "PUT",
+			wantCode: 204},
+		{name: "per-route, disallowed method", method: "OPTIONS", path: "/admin", origin: "https://eblog.fly.dev", reqMethod: "DELETE",
+			wantCode: 204},
+		{name: "per-route, disallowed origin, actual request", method: "PUT", path: "/admin", origin: "https://example.com",
+			wantCode: 200}, // still served, but the browser won't show it to the page.
+	} {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		for k, v := range map[string]string{"Origin": tt.origin, "Access-Control-Request-Method": tt.reqMethod, "Access-Control-Request-Headers": tt.reqHeaders} {
+			if v != "" {
+				req.Header.Set(k, v)
+			}
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != tt.wantCode {
+			t.Errorf("%s: got status %d, want %d", tt.name, rec.Code, tt.wantCode)
+		}
+		for header, want := range map[string]string{
+			"Access-Control-Allow-Origin":  tt.wantOrigin,
+			"Access-Control-Allow-Methods": tt.wantMethods,
+			"Access-Control-Allow-Headers": tt.wantHeaders,
+			"Access-Control-Max-Age":       tt.wantMaxAge,
+		} {
+			if got := rec.Header().Get(header); got != want {
+				t.Errorf("%s: %s: got %q, want %q", tt.name, header, got, want)
+			}
+		}
+	}
+}
+
+func TestRouteConflicts(t *testing.T) {
+	nop := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	for _, tt := range []struct {
+		existing, added [2]string // pattern, method
+		wantConflict    bool
+		wantPath        string
+	}{
+		{[2]string{"/users/{id:[0-9]+}", "GET"}, [2]string{`/users/{name:\w+}`, "GET"}, true, "/users/0"},
+		{[2]string{"/users/{id:[0-9]+}", "GET"}, [2]string{`/users/{name:[a-z]+}`, "GET"}, false, ""},
+		{[2]string{"/users/{id:[0-9]+}", "GET"}, [2]string{`/users/{name:\w+}`, "PUT"}, false, ""},           // different methods
+		{[2]string{"/users/{id:[0-9]+}", ""}, [2]string{`/users/{name:[5-9]+}`, "PUT"}, true, "/users/5"},    // any method
+		{[2]string{"/users/me", "GET"}, [2]string{"/users/{id:[a-z]+}", "GET"}, true, "/users/me"},           // static vs. regexp
+		{[2]string{"/users/me", "GET"}, [2]string{"/users/{id:[0-9]+}", "GET"}, false, ""},                   //
+		{[2]string{"/users/me", "GET"}, [2]string{"/users/me", "GET"}, true, "/users/me"},                    // a plain duplicate
+		{[2]string{"/static/favicon.ico", "GET"}, [2]string{"/static/{*}", "GET"}, false, ""},                // exact vs. wildcard is on purpose
+		{[2]string{"/{*}", "GET"}, [2]string{"/static/{*}", "GET"}, false, ""},                               // and so is a longer prefix
+		{[2]string{"/{a:(foo|bar)}/{*}", "GET"}, [2]string{"/{b:ba[rz]}/{path:*}", "GET"}, true, "/bar/..."}, // but two the same depth aren't.
+		{[2]string{"/games/{id:[a-f]{4}}", "GET"}, [2]string{"/games/{id:[0-9a-f]{4,}}", "GET"}, true, "/games/aaaa"},
+	} {
+		var r Router
+		if err := r.AddRoute(tt.existing[0], nop, tt.existing[1]); err != nil {
+			t.Fatal(err)
+		}
+		err := r.AddRoute(tt.added[0], nop, tt.added[1])
+		var ce *ConflictError
+		if errors.As(err, &ce) != tt.wantConflict {
+			t.Errorf("%v then %v: got error %v, want conflict: %v", tt.existing, tt.added, err, tt.wantConflict)
+			continue
+		}
+		if tt.wantConflict {
+			if ce.Path != tt.wantPath {
+				t.Errorf("%v then %v: example path %q, want %q", tt.existing, tt.added, ce.Path, tt.wantPath)
+			}
+			if len(r.routes) != 1 {
+				t.Errorf("%v then %v: the conflicting route was added anyway", tt.existing, tt.added)
+			}
+			// and the opt-out.
+			r.AllowConflicts = true
+			if err := r.AddRoute(tt.added[0], nop, tt.added[1]); err != nil {
+				t.Errorf("%v then %v, with AllowConflicts: got error %v", tt.existing, tt.added, err)
+			}
+		}
+	}
+}
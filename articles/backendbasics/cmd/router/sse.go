@@ -0,0 +1,91 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// EventStream writes Server-Sent Events: a long-lived text/event-stream response the browser reads with EventSource,
+// one event at a time, as the server sends them.
+// See https://html.spec.whatwg.org/multipage/server-sent-events.html.
+type EventStream struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// SSE starts an event stream on w, writing the headers immediately.
+// It returns an error if w can't flush: then events would sit in a buffer rather than going out as they happen.
+// Remember to wrap the handler in Streaming, or the server's WriteTimeout will cut the stream off.
+//
+//	stream, err := SSE(w, r)
+//	if err != nil {
+//		WriteError(w, err, http.StatusInternalServerError)
+//		return
+//	}
+//	for event := range events {
+//		if err := stream.SendJSON("update", event); err != nil {
+//			return // client's gone.
+//		}
+//	}
+func SSE(w http.ResponseWriter, r *http.Request) (*EventStream, error) {
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	if r.ProtoMajor == 1 {
+		h.Set("Connection", "keep-alive") // forbidden in HTTP/2, where it's the default anyways.
+	}
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		h.Del("Content-Type")
+		h.Del("Cache-Control")
+		h.Del("Connection")
+		if errors.Is(err, http.ErrNotSupported) {
+			return nil, fmt.Errorf("server-sent events: %T can't flush: is a middleware hiding it?", w)
+		}
+		return nil, fmt.Errorf("server-sent events: flushing headers: %w", err)
+	}
+	return &EventStream{w: w, rc: rc}, nil
+}
+
+// Send sends an event with the given name and data, flushing it immediately. If event is empty, it's a plain "message" event.
+// Data can span multiple lines.
+func (s *EventStream) Send(event, data string) error {
+	var buf strings.Builder
+	if event != "" {
+		fmt.Fprintf(&buf, "event: %s\n", event)
+	}
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&buf, "data: %s\n", line)
+	}
+	buf.WriteByte('\n') // a blank line ends the event.
+	if _, err := s.w.Write([]byte(buf.String())); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// SendJSON sends an event whose data is v, encoded as JSON.
+func (s *EventStream) SendJSON(event string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.Send(event, string(b))
+}
+
+// Streaming returns a middleware for long-lived responses, like event streams: it lifts the server's write deadline for this request only,
+// so that the server's WriteTimeout still protects every other route.
+func Streaming(h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// the zero time means no deadline. ErrNotSupported just means there wasn't a deadline to begin with: i.e, an httptest.ResponseRecorder.
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			WriteError(w, err, http.StatusInternalServerError)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}
+}
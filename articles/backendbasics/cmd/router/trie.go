@@ -0,0 +1,90 @@
+package router
+
+import "strings"
+
+// --- performance design note: ---
+// checking every route's regexp against every request is O(routes * path), and regexps are slow to begin with.
+// but most of most patterns is static: /chess/replay/{white:[a-zA-Z]+}/... only needs a regexp once we get past /chess/replay/.
+// so we compile the routes into a trie keyed by static segments. a request walks down the trie one segment at a time with
+// plain string comparisons, and only the routes that branch off into a path parameter somewhere along the way (the "dynamic" routes)
+// get their full regexp checked. the trie only narrows down the candidates; precedence is still decided by Router's sort order,
+// so it picks exactly the same route the linear scan did.
+
+// node is a node in the routing trie: the routes reachable by following the static segments from the root to here.
+type node struct {
+	children map[string]*node
+	exact    []int // indices of routes that are entirely static and end at this node; they match without a regexp.
+	dynamic  []int // indices of routes whose first path parameter (or wildcard) follows this node; check their regexp.
+}
+
+// buildTrie compiles the routes into a trie. Routes are referred to by their index, which is their precedence.
+func buildTrie(routes []route) *node {
+	root := new(node)
+	for i, rt := range routes {
+		n := root
+		segments := strings.Split(rt.raw, "/")[1:]
+		static := true
+		for _, seg := range segments {
+			if len(seg) >= 2 && seg[0] == '{' && seg[len(seg)-1] == '}' {
+				n.dynamic = append(n.dynamic, i)
+				static = false
+				break
+			}
+			child, ok := n.children[seg]
+			if !ok {
+				if n.children == nil {
+					n.children = make(map[string]*node)
+				}
+				child = new(node)
+				n.children[seg] = child
+			}
+			n = child
+		}
+		if static {
+			n.exact = append(n.exact, i)
+		}
+	}
+	return root
+}
+
+// match finds the highest-precedence route matching path and method.
+// If no route matches, it returns nil, along with the methods of the routes that would have matched the path, if any.
+func (rt *Router) match(path, method string) (best *route, allowed []string) {
+	bestIdx := -1
+	consider := func(i int) {
+		if bestIdx != -1 && i > bestIdx { // we already have something better.
+			return
+		}
+		r := &rt.routes[i]
+		if r.method == "" || r.method == method {
+			bestIdx = i
+		} else {
+			allowed = append(allowed, r.method)
+		}
+	}
+	if !strings.HasPrefix(path, "/") { // i.e, OPTIONS *; no pattern can match.
+		return nil, nil
+	}
+	n, rest := rt.trie, path[1:]
+	for n != nil {
+		for _, i := range n.dynamic {
+			if (bestIdx == -1 || i < bestIdx) && rt.routes[i].pattern.MatchString(path) {
+				consider(i)
+			}
+		}
+		seg, after, more := strings.Cut(rest, "/")
+		if !more { // last segment
+			if leaf := n.children[seg]; leaf != nil {
+				for _, i := range leaf.exact {
+					consider(i)
+				}
+			}
+			break
+		}
+		n, rest = n.children[seg], after
+	}
+	if bestIdx == -1 {
+		return nil, allowed
+	}
+	return &rt.routes[bestIdx], nil
+}
@@ -0,0 +1,273 @@
+package servermw
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// writeJSONError writes a JSON object in the form {"error": msg}.
+func writeJSONError(w io.Writer, msg string) {
+	_ = json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{msg})
+}
+
+// LimitBody returns a middleware that limits request bodies to maxBytes, answering anything bigger with a 413 Request Entity Too Large
+// in the form {"error": "request body too large: limit is N bytes"}.
+// A request that declares a bigger Content-Length is turned away before the handler ever sees it.
+// Otherwise, the handler gets an error (a *http.MaxBytesError) from reading past the limit, by which point the 413 has already been written:
+// anything the handler writes afterwards is discarded.
+func LimitBody(h http.Handler, maxBytes int64) http.HandlerFunc {
+	// validate arguments OUTSIDE of the closure, so that it only happens once
+	if maxBytes < 0 {
+		panic("maxBytes must be >= 0")
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > maxBytes {
+			w.Header().Set("Connection", "close") // we're not going to read the body, so the connection's unusable.
+			writeTooLarge(w, maxBytes)
+			return
+		}
+		if r.Body == nil || r.Body == http.NoBody {
+			h.ServeHTTP(w, r)
+			return
+		}
+		lw := &limitWriter{ResponseWriter: w, maxBytes: maxBytes}
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.Body = &limitBody{ReadCloser: http.MaxBytesReader(w, r.Body, maxBytes), w: lw}
+		h.ServeHTTP(lw, r2)
+	}
+}
+
+func writeTooLarge(w http.ResponseWriter, maxBytes int64) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	writeJSONError(w, fmt.Sprintf("request body too large: limit is %d bytes", maxBytes))
+}
+
+// limitBody writes the 413 as soon as a read goes over the limit.
+type limitBody struct {
+	io.ReadCloser
+	w *limitWriter
+}
+
+func (b *limitBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var tooBig *http.MaxBytesError
+	if errors.As(err, &tooBig) {
+		b.w.reject()
+	}
+	return n, err
+}
+
+// limitWriter discards the handler's writes once the body's been rejected.
+type limitWriter struct {
+	http.ResponseWriter
+	maxBytes              int64
+	wroteHeader, rejected bool
+}
+
+func (w *limitWriter) reject() {
+	if w.rejected {
+		return
+	}
+	w.rejected = true
+	if !w.wroteHeader { // too late otherwise: the handler would've had to be writing while still reading the body.
+		w.wroteHeader = true
+		writeTooLarge(w.ResponseWriter, w.maxBytes)
+	}
+}
+
+func (w *limitWriter) WriteHeader(statusCode int) {
+	if w.rejected || w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *limitWriter) Write(b []byte) (int, error) {
+	if w.rejected {
+		return len(b), nil // pretend: the handler doesn't need to know.
+	}
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying response writer, for http.ResponseController.
+func (w *limitWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// HeaderTimeout wraps a listener so that a client that doesn't finish sending a request's headers within d of starting them
+// gets a 408 Request Timeout in the form {"error": "timed out reading request headers"}, and is disconnected.
+// This protects the server from "slow loris" attacks, where a client opens many connections and trickles each request's headers in
+// a byte at a time, tying up the server's resources indefinitely.
+//
+// http.Server's ReadHeaderTimeout does the same, but hangs up without a word, which leaves a legitimate-but-slow client guessing.
+// HeaderTimeout is meant to be used alongside it, with the same or a shorter d: it only adds the 408.
+//
+// It only understands plaintext HTTP/1.x: put it under any TLS listener (i.e, behind a proxy that terminates TLS, like fly.io's),
+// not over one. A connection that switches to anything else (HTTP/2, a chunked request body, a websocket) is left alone from then on.
+func HeaderTimeout(l net.Listener, d time.Duration) net.Listener {
+	if d <= 0 {
+		panic("d must be > 0")
+	}
+	return &headerTimeoutListener{Listener: l, d: d}
+}
+
+type headerTimeoutListener struct {
+	net.Listener
+	d time.Duration
+}
+
+func (l *headerTimeoutListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &headerTimeoutConn{Conn: c, d: l.d}, nil
+}
+
+// phases of a headerTimeoutConn
+const (
+	phaseIdle    = iota // between requests
+	phaseHeaders        // reading a request's headers: they have to arrive within d.
+	phaseBody           // reading a request's body, of known length.
+	phaseOpaque         // something we don't understand: stop watching.
+)
+
+// headerTimeoutConn watches the bytes going by, to know whether it's in the middle of a request's headers.
+// The http.Server sets its own read deadlines on the conn; while reading headers, the earlier of the server's deadline and ours applies.
+type headerTimeoutConn struct {
+	net.Conn
+	d time.Duration
+
+	mu             sync.Mutex
+	phase          int
+	header         []byte    // the headers so far, to find the end and the Content-Length.
+	bodyLeft       int64     // in phaseBody: bytes of body still to come.
+	headerDeadline time.Time // in phaseHeaders: when the headers are due.
+	serverDeadline time.Time // the read deadline the http.Server asked for.
+}
+
+// maxHeaderBytes is how much of the headers the conn keeps around looking for the end. Anything longer, http.Server rejects anyways.
+const maxHeaderBytes = http.DefaultMaxHeaderBytes + 4096
+
+func (c *headerTimeoutConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.observe(p[:n])
+	if err != nil && c.phase == phaseHeaders && errors.Is(err, os.ErrDeadlineExceeded) {
+		// too slow. tell them why we're hanging up; the server sees the timeout and closes the connection.
+		var buf bytes.Buffer
+		writeJSONError(&buf, "timed out reading request headers")
+		_ = c.Conn.SetWriteDeadline(time.Now().Add(time.Second))
+		fmt.Fprintf(c.Conn, "HTTP/1.1 408 Request Timeout\r\nContent-Type: application/json\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s", buf.Len(), buf.Bytes())
+		c.phase = phaseOpaque // once is enough.
+	}
+	return n, err
+}
+
+// SetReadDeadline records the server's deadline, applying it unless the headers are due sooner.
+func (c *headerTimeoutConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.serverDeadline = t
+	return c.applyDeadline()
+}
+
+// SetDeadline is SetReadDeadline and SetWriteDeadline.
+func (c *headerTimeoutConn) SetDeadline(t time.Time) error {
+	return errors.Join(c.SetReadDeadline(t), c.Conn.SetWriteDeadline(t))
+}
+
+// applyDeadline sets the conn's read deadline to the earlier of the server's and the header deadline, if we're reading headers.
+func (c *headerTimeoutConn) applyDeadline() error {
+	t := c.serverDeadline
+	if c.phase == phaseHeaders && (t.IsZero() || c.headerDeadline.Before(t)) {
+		t = c.headerDeadline
+	}
+	return c.Conn.SetReadDeadline(t)
+}
+
+// observe advances the conn's phase according to the bytes just read.
+func (c *headerTimeoutConn) observe(b []byte) {
+	for len(b) > 0 {
+		switch c.phase {
+		case phaseOpaque:
+			return
+		case phaseIdle:
+			for len(b) > 0 && (b[0] == '\r' || b[0] == '\n') { // stray newlines between requests are allowed.
+				b = b[1:]
+			}
+			if len(b) == 0 {
+				return
+			}
+			c.phase, c.header, c.headerDeadline = phaseHeaders, c.header[:0], time.Now().Add(c.d)
+			_ = c.applyDeadline()
+		case phaseHeaders:
+			start := max(len(c.header)-3, 0) // the end might straddle two reads.
+			c.header = append(c.header, b...)
+			end := bytes.Index(c.header[start:], []byte("\r\n\r\n"))
+			if end == -1 {
+				if len(c.header) > maxHeaderBytes {
+					c.phase = phaseOpaque // the server will reject it.
+					_ = c.applyDeadline()
+				}
+				return
+			}
+			end += start + 4
+			b = append([]byte(nil), c.header[end:]...) // whatever's left is the body, or the next request.
+			c.enterBody(c.header[:end])
+			c.header = c.header[:0]
+			_ = c.applyDeadline() // the headers made it: back to the server's deadline.
+		case phaseBody:
+			k := min(int64(len(b)), c.bodyLeft)
+			c.bodyLeft -= k
+			b = b[k:]
+			if c.bodyLeft == 0 {
+				c.phase = phaseIdle
+			}
+		}
+	}
+}
+
+// enterBody picks the phase after a complete set of headers, based on their framing.
+func (c *headerTimeoutConn) enterBody(header []byte) {
+	if bytes.HasPrefix(header, []byte("PRI * HTTP/2.0")) {
+		c.phase = phaseOpaque
+		return
+	}
+	c.phase, c.bodyLeft = phaseIdle, 0
+	for _, line := range bytes.Split(header, []byte("\r\n"))[1:] {
+		k, v, ok := bytes.Cut(line, []byte(":"))
+		if !ok {
+			continue
+		}
+		k, v = bytes.TrimSpace(k), bytes.TrimSpace(v)
+		switch {
+		case bytes.EqualFold(k, []byte("Content-Length")):
+			n, err := strconv.ParseInt(string(v), 10, 64)
+			if err != nil || n < 0 {
+				c.phase = phaseOpaque // malformed: the server will reject it.
+				return
+			}
+			if n > 0 {
+				c.phase, c.bodyLeft = phaseBody, n
+			}
+		case bytes.EqualFold(k, []byte("Transfer-Encoding")), bytes.EqualFold(k, []byte("Upgrade")):
+			c.phase = phaseOpaque // chunked bodies and protocol switches are more than we want to parse.
+			return
+		}
+	}
+}
@@ -1,11 +1,15 @@
 package servermw
 
 import (
+	"bufio"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"runtime/debug"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,28 +22,77 @@ func Default(h http.Handler) http.Handler { return Recovery(RecordResponse(Log(T
 
 // Recovery returns a middleware that recovers from panics, writing a 500 status code and "internal server error" message to the response,
 // and logging the panic and associated stack trace.
-func Recovery(h http.Handler) http.HandlerFunc {
+// See RecoveryWithConfig to hook into panics or customize the response.
+func Recovery(h http.Handler) http.HandlerFunc { return RecoveryWithConfig(h, RecoveryConfig{}) }
+
+// RecoveryConfig configures RecoveryWithConfig.
+type RecoveryConfig struct {
+	// OnPanic, if non-nil, is called after a panic is logged and before the response is written: i.e, to count panics or page someone.
+	OnPanic func(r *http.Request, err *PanicError)
+}
+
+// PanicError is a recovered panic: the value passed to panic() and the stack trace of the goroutine that panicked.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string { return fmt.Sprintf("panic: %v", e.Value) }
+
+// Unwrap returns the panic value, if it was an error.
+func (e *PanicError) Unwrap() error { err, _ := e.Value.(error); return err }
+
+// RecoveryWithConfig is Recovery, configured by cfg.
+// The 500 is rendered according to the request's Accept header: a JSON object in the form {"error": "internal server error"} for application/json,
+// a small page for text/html, or plain text otherwise.
+// A panic with http.ErrAbortHandler is how a handler deliberately aborts a response: it isn't logged or answered, but panics again
+// so the http.Server can close the connection.
+func RecoveryWithConfig(h http.Handler, cfg RecoveryConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer func() { // recover from panic
-			err := recover()
-			if err == nil {
+			p := recover()
+			if p == nil {
 				return // no panic; nothing to do
 			}
+			if p == http.ErrAbortHandler {
+				panic(p) // not a bug: let the http.Server do its thing
+			}
+			err := &PanicError{Value: p, Stack: debug.Stack()}
 			// log the panic and stack trace
-
 			if logger, ok := ctxutil.Value[*log.Logger](r.Context()); ok {
-				logger.Printf("%s %s: panic: %v\n%s", r.Method, r.URL, err, debug.Stack())
+				logger.Printf("%s %s: panic: %v\n%s", r.Method, redact(r.URL), p, err.Stack)
 			} else { // use default logger
-				log.Printf("panic: %v\n%s", err, debug.Stack())
+				log.Printf("panic: %v\n%s", p, err.Stack)
+			}
+			if cfg.OnPanic != nil {
+				cfg.OnPanic(r, err)
 			}
 			// write 500 status code and "internal server error" message to response so it doesn't hang
-			w.WriteHeader(http.StatusInternalServerError)
-			_, _ = w.Write([]byte("500 Internal Server Error"))
+			writeInternalServerError(w, r)
 		}()
 		h.ServeHTTP(w, r)
 	}
 }
 
+// writeInternalServerError writes a 500 in whatever format the client prefers, out of JSON, HTML, and plain text.
+func writeInternalServerError(w http.ResponseWriter, r *http.Request) {
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "application/json"):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"error":"internal server error"}`))
+	case strings.Contains(accept, "text/html"):
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`<!DOCTYPE html><html><head><title>500 Internal Server Error</title></head><body><h1>500 Internal Server Error</h1><p>Something went wrong on our end.</p></body></html>`))
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("500 Internal Server Error"))
+	}
+}
+
 // Trace returns a middleware that injects a trace into the request context,
 // picking up the trace id from the request header if it exists, or generating a new one if it doesn't.
 // This should fire BEFORE the Log middleware, if you're using it.
@@ -67,6 +120,27 @@ func Trace(h http.Handler) http.HandlerFunc {
 	}
 }
 
+// secretParams are query parameters too sensitive to log: i.e, a bearer token from a client that can't set headers, like the browser's EventSource.
+var secretParams = []string{"token", "access_token"}
+
+// redact is u as it's safe to log: without a password (see url.URL.Redacted), and with any secretParams' values replaced by "REDACTED".
+func redact(u *url.URL) string {
+	q := u.Query()
+	changed := false
+	for _, k := range secretParams {
+		if q.Has(k) {
+			q.Set(k, "REDACTED")
+			changed = true
+		}
+	}
+	if !changed {
+		return u.Redacted()
+	}
+	v := *u
+	v.RawQuery = q.Encode()
+	return v.Redacted()
+}
+
 // Log returns a middleware that injects a logger into the request context. It uses the trace from the context as a prefix, if it exists.
 // See clientmw.Log for the client-side implementation.
 func Log(h http.Handler) http.HandlerFunc {
@@ -75,10 +149,10 @@ func Log(h http.Handler) http.HandlerFunc {
 		var prefix string
 		if ok {
 			// like GET /articles: [trace-id request-id]:
-			prefix = fmt.Sprintf("server: %s %s: [%s %s]: ", r.Method, r.URL, trace.TraceID, trace.RequestID)
+			prefix = fmt.Sprintf("server: %s %s: [%s %s]: ", r.Method, redact(r.URL), trace.TraceID, trace.RequestID)
 		} else {
 			// like GET /articles:
-			prefix = fmt.Sprintf("server: %s %s: ", r.Method, r.URL)
+			prefix = fmt.Sprintf("server: %s %s: ", r.Method, redact(r.URL))
 		}
 		logger := log.New(os.Stderr, prefix, log.LstdFlags)
 		ctx := ctxutil.WithValue(r.Context(), logger)
@@ -99,7 +173,7 @@ func RecordResponse(h http.Handler) http.HandlerFunc {
 		logger, ok := ctxutil.Value[*log.Logger](r.Context())
 		if !ok {
 			// fall back to the default logger
-			log.Printf("%s %s: %d %s: %d bytes in %s", r.Method, r.URL, rrw.StatusCode, http.StatusText(rrw.StatusCode), rrw.Bytes, elapsed)
+			log.Printf("%s %s: %d %s: %d bytes in %s", r.Method, redact(r.URL), rrw.StatusCode, http.StatusText(rrw.StatusCode), rrw.Bytes, elapsed)
 			return
 		}
 		logger.Printf("%d %s: %d bytes in %s", rrw.StatusCode, http.StatusText(rrw.StatusCode), rrw.Bytes, elapsed)
@@ -123,6 +197,38 @@ func (w *RecordingResponseWriter) WriteHeader(statusCode int) {
 	w.RW.WriteHeader(statusCode) // write to underlying response writer
 }
 
+// Unwrap returns the underlying response writer, so http.ResponseController can still find its Flush, SetWriteDeadline, etc.
+func (w *RecordingResponseWriter) Unwrap() http.ResponseWriter { return w.RW }
+
+// Flush sends any buffered data to the client, if the underlying response writer can: see http.Flusher.
+// Flushing sends the headers, so the status code is 200 if it hasn't been set already.
+func (w *RecordingResponseWriter) Flush() {
+	if w.StatusCode == 0 {
+		w.StatusCode = http.StatusOK
+	}
+	_ = http.NewResponseController(w.RW).Flush()
+}
+
+// Hijack takes over the connection, if the underlying response writer allows it: see http.Hijacker.
+// The status code is 101 Switching Protocols if it hasn't been set already, since that's what a websocket sends next.
+// Bytes written to the hijacked connection aren't counted.
+func (w *RecordingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.RW).Hijack()
+	if err == nil && w.StatusCode == 0 {
+		w.StatusCode = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Push initiates an HTTP/2 server push, if the underlying response writer supports it: see http.Pusher.
+// http.ResponseController doesn't know about pushes, so this is the only way a handler behind RecordResponse can make one.
+func (w *RecordingResponseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.RW.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
 // Header just returns the underlying response writer's header.
 func (w *RecordingResponseWriter) Header() http.Header { return w.RW.Header() }
 
@@ -0,0 +1,318 @@
+package servermw_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/servermw"
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/trace"
+)
+
+func TestLogRedactsSecrets(t *testing.T) {
+	buf, stderr := new(bytes.Buffer), log.Writer()
+	log.SetOutput(buf)
+	defer log.SetOutput(stderr)
+	h := servermw.RecordResponse(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/games/1/events?token=hunter2&since=3", nil))
+	if got := buf.String(); strings.Contains(got, "hunter2") || !strings.Contains(got, "/games/1/events?since=3&token=REDACTED") {
+		t.Errorf("expected the token redacted from the log, got %q", got)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	var panics []*servermw.PanicError
+	h := servermw.RecoveryWithConfig(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/abort" {
+			panic(http.ErrAbortHandler)
+		}
+		panic(io.ErrUnexpectedEOF)
+	}), servermw.RecoveryConfig{OnPanic: func(_ *http.Request, err *servermw.PanicError) { panics = append(panics, err) }})
+
+	for _, tt := range []struct{ accept, wantContentType, wantBody string }{
+		{"", "text/plain; charset=utf-8", "500 Internal Server Error"},
+		{"application/json", "application/json", `{"error":"internal server error"}`},
+		{"text/html,application/xhtml+xml,*/*;q=0.8", "text/html; charset=utf-8", "<h1>500 Internal Server Error</h1>"},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", tt.accept)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != 500 || rec.Header().Get("Content-Type") != tt.wantContentType || !strings.Contains(rec.Body.String(), tt.wantBody) {
+			t.Errorf("Accept %q: got %d %q %q, want 500 %q containing %q", tt.accept, rec.Code, rec.Header().Get("Content-Type"), rec.Body, tt.wantContentType, tt.wantBody)
+		}
+	}
+	if len(panics) != 3 || !errors.Is(panics[0], io.ErrUnexpectedEOF) || len(panics[0].Stack) == 0 {
+		t.Fatalf("OnPanic: got %v, want 3 panics wrapping io.ErrUnexpectedEOF, with stacks", panics)
+	}
+
+	// http.ErrAbortHandler goes straight through to the server, which knows to hang up quietly.
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("got panic %v, want http.ErrAbortHandler", p)
+		}
+		if len(panics) != 3 {
+			t.Errorf("OnPanic was called for http.ErrAbortHandler")
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/abort", nil))
+}
+
+func TestTraceHandler(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := slog.New(servermw.NewTraceHandler(slog.NewJSONHandler(buf, nil))).With("app", "graduation")
+	h := servermw.Trace(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		logger.InfoContext(r.Context(), "hello")
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	want := trace.Trace{TraceID: uuid.New(), RequestID: uuid.New()}
+	want.SaveToHeader(req.Header)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	logger.Info("no trace here")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2: %q", len(lines), buf)
+	}
+	for i, line := range lines {
+		var got map[string]any
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got["app"] != "graduation" {
+			t.Errorf("line %d: lost the logger's attributes: %s", i, line)
+		}
+		if i == 0 && (got["trace_id"] != want.TraceID.String() || got["request_id"] != want.RequestID.String()) {
+			t.Errorf("line %d: got %s, want trace_id %s and request_id %s", i, line, want.TraceID, want.RequestID)
+		}
+		if i == 1 && (got["trace_id"] != nil || got["request_id"] != nil) {
+			t.Errorf("line %d: got %s, want no trace", i, line)
+		}
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	h := servermw.LimitBody(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(400) // should be discarded: the 413 beat us to it.
+			fmt.Fprintf(w, "read body: %v", err)
+			return
+		}
+		fmt.Fprintf(w, "got %d bytes", len(b))
+	}), 8)
+	for _, tt := range []struct {
+		name     string
+		body     io.Reader
+		wantCode int
+		wantBody string
+	}{
+		{"small", strings.NewReader("hello"), 200, "got 5 bytes"},
+		{"exactly the limit", strings.NewReader("12345678"), 200, "got 8 bytes"},
+		{"too big, Content-Length", strings.NewReader("123456789"), 413, `{"error":"request body too large: limit is 8 bytes"}`},
+		{"too big, unknown length", io.MultiReader(strings.NewReader("12345"), strings.NewReader("6789")), 413, `{"error":"request body too large: limit is 8 bytes"}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", tt.body)
+			if _, ok := tt.body.(*strings.Reader); !ok {
+				req.ContentLength = -1 // chunked, as far as the handler knows.
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode || strings.TrimSpace(rec.Body.String()) != tt.wantBody {
+				t.Errorf("got %d %q, want %d %q", rec.Code, rec.Body, tt.wantCode, tt.wantBody)
+			}
+			if tt.wantCode == 413 && rec.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("got Content-Type %q, want application/json", rec.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestHeaderTimeout(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: servermw.LimitBody(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s", r.Method, r.URL.Path, b)
+	}), 1<<10)}
+	go srv.Serve(servermw.HeaderTimeout(l, timeout))
+	defer srv.Close()
+
+	dial := func(t *testing.T) (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn, bufio.NewReader(conn)
+	}
+
+	t.Run("slow loris", func(t *testing.T) {
+		conn, br := dial(t)
+		go func() { // trickle the headers in, a byte at a time: they'll never finish in time.
+			for _, b := range []byte("GET / HTTP/1.1\r\nHost: localhost\r\nX-Slow: yes\r\n\r\n") {
+				if _, err := conn.Write([]byte{b}); err != nil {
+					return
+				}
+				time.Sleep(timeout / 10)
+			}
+		}()
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusRequestTimeout || resp.Header.Get("Content-Type") != "application/json" || strings.TrimSpace(string(body)) != `{"error":"timed out reading request headers"}` {
+			t.Errorf("got %s %q %q, want 408 application/json with an error", resp.Status, resp.Header.Get("Content-Type"), body)
+		}
+	})
+
+	t.Run("keep-alive", func(t *testing.T) {
+		// requests that send their headers promptly are fine, no matter how long the connection's idle between them, or how slow the body is.
+		conn, br := dial(t)
+		for i, req := range []string{
+			"POST /a HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhello",
+			"GET /b HTTP/1.1\r\nHost: localhost\r\n\r\n",
+			"POST /c HTTP/1.1\r\nHost: localhost\r\nContent-Length: 3\r\n\r\n",
+		} {
+			time.Sleep(timeout * 2) // idle: doesn't count.
+			if _, err := io.WriteString(conn, req); err != nil {
+				t.Fatal(err)
+			}
+			want := []string{"POST /a hello", "GET /b ", "POST /c abc"}[i]
+			if i == 2 {
+				time.Sleep(timeout * 2) // a slow body isn't a slow header.
+				io.WriteString(conn, "abc")
+			}
+			resp, err := http.ReadResponse(br, nil)
+			if err != nil {
+				t.Fatalf("request %d: %v", i, err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != 200 || string(body) != want {
+				t.Errorf("request %d: got %s %q, want 200 %q", i, resp.Status, body, want)
+			}
+		}
+	})
+
+	t.Run("too big", func(t *testing.T) {
+		conn, br := dial(t)
+		io.WriteString(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 2048\r\n\r\n")
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusRequestEntityTooLarge || !strings.Contains(string(body), "limit is 1024 bytes") {
+			t.Errorf("got %s %q, want 413", resp.Status, body)
+		}
+	})
+}
+
+// pushRecorder is a ResponseRecorder that supports HTTP/2 server push, like net/http's HTTP/2 writer.
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+	pushed []string
+}
+
+func (p *pushRecorder) Push(target string, _ *http.PushOptions) error {
+	p.pushed = append(p.pushed, target)
+	return nil
+}
+
+func TestRecordingResponseWriterPassThrough(t *testing.T) {
+	next := make(chan struct{})
+	statuses := make(chan int, 1)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/events": // server-sent events: each event should reach the client as soon as it's flushed.
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: first\n\n")
+			w.(http.Flusher).Flush()
+			<-next
+			io.WriteString(w, "data: second\n\n")
+		case "/socket": // like a websocket: take over the connection and echo a line.
+			conn, rw, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf("Hijack: %v", err)
+				return
+			}
+			defer conn.Close()
+			rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n")
+			rw.Flush()
+			line, _ := rw.ReadString('\n')
+			rw.WriteString(line)
+			rw.Flush()
+		}
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rrw := &servermw.RecordingResponseWriter{RW: w}
+		servermw.RecordResponse(h).ServeHTTP(rrw, r) // also through the middleware, so its writer has to pass everything along, too.
+		statuses <- rrw.StatusCode
+	}))
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := make([]byte, len("data: first\n\n"))
+	if _, err := io.ReadFull(resp.Body, first); err != nil || string(first) != "data: first\n\n" {
+		t.Fatalf("expected the first event before the handler finished, got %q, %v", first, err)
+	}
+	close(next)
+	rest, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(rest) != "data: second\n\n" {
+		t.Errorf("got %q, want the second event", rest)
+	}
+	if got := <-statuses; got != 200 {
+		t.Errorf("recorded status %d for the stream, want 200", got)
+	}
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET /socket HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\nhello\n")
+	br := bufio.NewReader(conn)
+	if resp, err := http.ReadResponse(br, nil); err != nil || resp.StatusCode != 101 {
+		t.Fatalf("expected 101 Switching Protocols, got %v, %v", resp, err)
+	}
+	if line, _ := br.ReadString('\n'); line != "hello\n" {
+		t.Errorf("got echo %q, want \"hello\\n\"", line)
+	}
+	if got := <-statuses; got != 101 {
+		t.Errorf("recorded status %d for the hijacked connection, want 101", got)
+	}
+
+	// push goes through if the underlying writer can push, and fails cleanly if it can't.
+	pr := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	if err := (&servermw.RecordingResponseWriter{RW: pr}).Push("/style.css", nil); err != nil || !slices.Equal(pr.pushed, []string{"/style.css"}) {
+		t.Errorf("Push: got %v, pushed %v, want /style.css pushed", err, pr.pushed)
+	}
+	if err := (&servermw.RecordingResponseWriter{RW: httptest.NewRecorder()}).Push("/style.css", nil); !errors.Is(err, http.ErrNotSupported) {
+		t.Errorf("Push without a Pusher: got %v, want http.ErrNotSupported", err)
+	}
+}
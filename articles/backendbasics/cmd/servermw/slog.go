@@ -0,0 +1,41 @@
+package servermw
+
+import (
+	"context"
+	"log/slog"
+
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/ctxutil"
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/trace"
+)
+
+// TraceHandler is a slog.Handler that adds the trace_id and request_id from the context, if any, to every record,
+// then passes it on to the wrapped Handler.
+// With the Trace middleware in place, a handler can log with slog.InfoContext(r.Context(), ...) and get the trace for free,
+// rather than building a prefix by hand like Log does.
+//
+//	slog.SetDefault(slog.New(servermw.NewTraceHandler(slog.NewTextHandler(os.Stderr, nil))))
+//	// later, in a handler:
+//	slog.InfoContext(r.Context(), "found user", "user", u.ID) // time=... level=INFO msg="found user" user=1234 trace_id=... request_id=...
+type TraceHandler struct{ slog.Handler }
+
+// NewTraceHandler wraps h with a TraceHandler.
+func NewTraceHandler(h slog.Handler) *TraceHandler { return &TraceHandler{h} }
+
+// Handle adds the trace from ctx, if there is one, to the record.
+func (h *TraceHandler) Handle(ctx context.Context, r slog.Record) error {
+	if t, ok := ctxutil.Value[trace.Trace](ctx); ok {
+		r = r.Clone() // the record may be shared with other handlers; don't add to their attributes.
+		r.AddAttrs(slog.String("trace_id", t.TraceID.String()), slog.String("request_id", t.RequestID.String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler, keeping the TraceHandler on top.
+func (h *TraceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &TraceHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup implements slog.Handler, keeping the TraceHandler on top. Note that the trace ends up inside the group.
+func (h *TraceHandler) WithGroup(name string) slog.Handler {
+	return &TraceHandler{h.Handler.WithGroup(name)}
+}
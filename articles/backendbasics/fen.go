@@ -0,0 +1,142 @@
+package backendbasics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// fenPieces are the FEN letters for each piece, in the same order as the piece constants: uppercase for white, lowercase for black.
+const fenPieces = ".PNBRQK..pnbrqk"
+
+// ParseFEN parses a position in Forsyth-Edwards Notation, i.e, "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1":
+// the board from black's side, rank 8 first; whose turn it is; castling rights; the en passant square; and the half and full move counters.
+// See https://www.chessprogramming.org/Forsyth-Edwards_Notation.
+func ParseFEN(s string) (Position, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 6 {
+		return Position{}, fmt.Errorf("parse fen %q: expected 6 space-separated fields, got %d", s, len(fields))
+	}
+	var p Position
+	ranks := strings.Split(fields[0], "/")
+	if len(ranks) != 8 {
+		return Position{}, fmt.Errorf("parse fen %q: expected 8 ranks, got %d", s, len(ranks))
+	}
+	for i, rank := range ranks {
+		x := 0
+		for _, c := range rank {
+			if x >= 8 {
+				return Position{}, fmt.Errorf("parse fen %q: rank %d has more than 8 squares", s, 8-i)
+			}
+			if '1' <= c && c <= '8' {
+				x += int(c - '0')
+				continue
+			}
+			pc := strings.IndexRune(fenPieces, c)
+			if pc <= 0 || c == '.' {
+				return Position{}, fmt.Errorf("parse fen %q: unknown piece %q", s, c)
+			}
+			p.Board[7-i][x] = piece(pc)
+			x++
+		}
+		if x != 8 {
+			return Position{}, fmt.Errorf("parse fen %q: rank %d has %d squares, not 8", s, 8-i, x)
+		}
+	}
+	switch fields[1] {
+	case "w":
+		p.WhiteToMove = true
+	case "b":
+	default:
+		return Position{}, fmt.Errorf("parse fen %q: side to move should be w or b, not %q", s, fields[1])
+	}
+	if fields[2] != "-" {
+		for _, c := range fields[2] {
+			switch c {
+			case 'K':
+				p.WhiteKingside = true
+			case 'Q':
+				p.WhiteQueenside = true
+			case 'k':
+				p.BlackKingside = true
+			case 'q':
+				p.BlackQueenside = true
+			default:
+				return Position{}, fmt.Errorf("parse fen %q: invalid castling rights %q", s, fields[2])
+			}
+		}
+	}
+	if fields[3] != "-" {
+		ep, err := parseSquare(fields[3])
+		if err != nil || (ep.Y != 2 && ep.Y != 5) {
+			return Position{}, fmt.Errorf("parse fen %q: invalid en passant square %q", s, fields[3])
+		}
+		p.EnPassant = ep
+	}
+	var err error
+	if p.HalfMoves, err = strconv.Atoi(fields[4]); err != nil || p.HalfMoves < 0 {
+		return Position{}, fmt.Errorf("parse fen %q: invalid halfmove clock %q", s, fields[4])
+	}
+	if p.FullMoves, err = strconv.Atoi(fields[5]); err != nil || p.FullMoves < 1 {
+		return Position{}, fmt.Errorf("parse fen %q: invalid fullmove number %q", s, fields[5])
+	}
+	return p, nil
+}
+
+// FEN returns the position in Forsyth-Edwards Notation: see ParseFEN.
+func (p Position) FEN() string {
+	var b strings.Builder
+	for y := 7; y >= 0; y-- {
+		run := 0 // empty squares in a row.
+		for x := 0; x < 8; x++ {
+			if p.Board[y][x] == empty {
+				run++
+				continue
+			}
+			if run > 0 {
+				b.WriteByte('0' + byte(run))
+				run = 0
+			}
+			b.WriteByte(fenPieces[p.Board[y][x]])
+		}
+		if run > 0 {
+			b.WriteByte('0' + byte(run))
+		}
+		if y > 0 {
+			b.WriteByte('/')
+		}
+	}
+	if p.WhiteToMove {
+		b.WriteString(" w ")
+	} else {
+		b.WriteString(" b ")
+	}
+	castling := ""
+	for _, c := range []struct {
+		ok     bool
+		letter string
+	}{{p.WhiteKingside, "K"}, {p.WhiteQueenside, "Q"}, {p.BlackKingside, "k"}, {p.BlackQueenside, "q"}} {
+		if c.ok {
+			castling += c.letter
+		}
+	}
+	if castling == "" {
+		castling = "-"
+	}
+	b.WriteString(castling)
+	if p.EnPassant == (Square{}) {
+		b.WriteString(" -")
+	} else {
+		b.WriteString(" " + p.EnPassant.String())
+	}
+	fmt.Fprintf(&b, " %d %d", p.HalfMoves, p.FullMoves)
+	return b.String()
+}
+
+// parseSquare parses a square in algebraic notation, like "e4".
+func parseSquare(s string) (Square, error) {
+	if len(s) != 2 || s[0] < 'a' || s[0] > 'h' || s[1] < '1' || s[1] > '8' {
+		return Square{}, fmt.Errorf("invalid square %q", s)
+	}
+	return Square{int8(s[0] - 'a'), int8(s[1] - '1')}, nil
+}
@@ -0,0 +1,132 @@
+package backendbasics
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"os"
+	"strings"
+)
+
+// An HTML <form> sends its fields as the request body, in one of two encodings, named by the Content-Type:
+//   - application/x-www-form-urlencoded: a query string, i.e, "name=efron&lang=go". See ParseForm.
+//   - multipart/form-data: each field in its own part, with its own headers, separated by a boundary the client picks.
+//     It's the only way to upload a file. See ParseMultipart.
+
+// limits on what ParseMultipart will accept, on top of ReadRequest's maxBodyBytes.
+const (
+	maxFormValueBytes = 1 << 20 // for all the non-file fields, together: they're kept in memory.
+	maxFormFiles      = 16      // per request.
+	maxFormFileBytes  = 8 << 20 // per file.
+)
+
+// ParseForm decodes an application/x-www-form-urlencoded body: "a=1&b=two+words" is {"a": ["1"], "b": ["two words"]}.
+// It returns an error if the request has some other Content-Type.
+func ParseForm(req Request) (Values, error) {
+	mediaType, _, err := mime.ParseMediaType(req.Headers.Get("Content-Type"))
+	if err != nil || mediaType != "application/x-www-form-urlencoded" {
+		return nil, fmt.Errorf("parse form: Content-Type %q is not application/x-www-form-urlencoded", req.Headers.Get("Content-Type"))
+	}
+	return parseQuery(req.Body)
+}
+
+// Form is a parsed multipart/form-data body.
+type Form struct {
+	Values Values                 // the ordinary fields.
+	Files  map[string][]*FormFile // the uploaded files, by field name.
+}
+
+// FormFile is an uploaded file, saved to disk by ParseMultipart.
+type FormFile struct {
+	Filename    string // as the client named it. Don't trust it: it could be "../../etc/passwd".
+	ContentType string // as the client said: ditto.
+	Size        int64
+	Path        string // where ParseMultipart saved it. It's the caller's job to remove it: see Form.RemoveAll.
+}
+
+// ParseMultipart decodes a multipart/form-data body. Ordinary fields go in the Form's Values; file fields
+// (the parts with a filename) are streamed to temporary files in dir, or os.TempDir if dir is "".
+// It returns an error if any file is over maxFormFileBytes, there are more than maxFormFiles files,
+// or the ordinary fields add up to more than maxFormValueBytes. On error, it removes any files it saved.
+func ParseMultipart(req Request, dir string) (form *Form, err error) {
+	mediaType, params, err := mime.ParseMediaType(req.Headers.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return nil, fmt.Errorf("parse multipart: Content-Type %q is not multipart/form-data with a boundary", req.Headers.Get("Content-Type"))
+	}
+	form = &Form{Values: make(Values), Files: make(map[string][]*FormFile)}
+	defer func() {
+		if err != nil {
+			form.RemoveAll()
+			form = nil
+		}
+	}()
+	r := multipart.NewReader(strings.NewReader(req.Body), params["boundary"])
+	var valueBytes, files int64
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			return form, nil
+		}
+		if err != nil {
+			return form, fmt.Errorf("parse multipart: %w", err)
+		}
+		name := part.FormName()
+		if name == "" {
+			continue // not a form field: nothing to do with it.
+		}
+		if part.FileName() == "" { // an ordinary field.
+			b, err := io.ReadAll(io.LimitReader(part, maxFormValueBytes-valueBytes+1))
+			if err != nil {
+				return form, fmt.Errorf("parse multipart: field %q: %w", name, err)
+			}
+			if valueBytes += int64(len(b)); valueBytes > maxFormValueBytes {
+				return form, fmt.Errorf("parse multipart: fields are over %d bytes", maxFormValueBytes)
+			}
+			form.Values[name] = append(form.Values[name], string(b))
+			continue
+		}
+		if files++; files > maxFormFiles {
+			return form, fmt.Errorf("parse multipart: more than %d files", maxFormFiles)
+		}
+		f, err := saveFile(dir, part)
+		if f != nil {
+			form.Files[name] = append(form.Files[name], f) // even on error, so RemoveAll gets it.
+		}
+		if err != nil {
+			return form, fmt.Errorf("parse multipart: file %q: %w", part.FileName(), err)
+		}
+	}
+}
+
+// saveFile streams part to a new temporary file in dir, stopping at maxFormFileBytes.
+// If it made a file, it returns it, even if there's also an error.
+func saveFile(dir string, part *multipart.Part) (*FormFile, error) {
+	dst, err := os.CreateTemp(dir, "upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer dst.Close()
+	f := &FormFile{Filename: part.FileName(), ContentType: part.Header.Get("Content-Type"), Path: dst.Name()}
+	if f.Size, err = io.Copy(dst, io.LimitReader(part, maxFormFileBytes+1)); err != nil {
+		return f, err
+	}
+	if f.Size > maxFormFileBytes {
+		return f, fmt.Errorf("over %d bytes", maxFormFileBytes)
+	}
+	return f, dst.Close()
+}
+
+// RemoveAll removes the form's saved files.
+func (form *Form) RemoveAll() error {
+	var errs []error
+	for _, files := range form.Files {
+		for _, f := range files {
+			if err := os.Remove(f.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
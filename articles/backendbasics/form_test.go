@@ -0,0 +1,112 @@
+package backendbasics
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseForm(t *testing.T) {
+	req := Request{Headers: Headers{{"Content-Type", "application/x-www-form-urlencoded; charset=utf-8"}}, Body: "name=efron&lang=go&lang=c%2B%2B&bio=two+words"}
+	got, err := ParseForm(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Values{"name": {"efron"}, "lang": {"go", "c++"}, "bio": {"two words"}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseForm() = %q, want %q", got, want)
+	}
+	if _, err := ParseForm(Request{Headers: Headers{{"Content-Type", "application/json"}}, Body: "{}"}); err == nil {
+		t.Error("ParseForm() should reject a JSON body")
+	}
+}
+
+// multipartRequest builds a multipart/form-data request with the given fields and files (by filename).
+func multipartRequest(t *testing.T, fields, files map[string]string) Request {
+	t.Helper()
+	body := new(bytes.Buffer)
+	w := multipart.NewWriter(body)
+	for k, v := range fields {
+		w.WriteField(k, v)
+	}
+	for name, content := range files {
+		fw, err := w.CreateFormFile("upload", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, content)
+	}
+	w.Close()
+	return Request{Headers: Headers{{"Content-Type", w.FormDataContentType()}}, Body: body.String()}
+}
+
+func TestParseMultipart(t *testing.T) {
+	dir := t.TempDir()
+	form, err := ParseMultipart(multipartRequest(t, map[string]string{"title": "my upload"}, map[string]string{"a.txt": "hello, world"}), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := form.Values.Get("title"); got != "my upload" {
+		t.Errorf("title = %q, want %q", got, "my upload")
+	}
+	if len(form.Files["upload"]) != 1 {
+		t.Fatalf("expected one file, got %+v", form.Files)
+	}
+	f := form.Files["upload"][0]
+	if b, err := os.ReadFile(f.Path); err != nil || string(b) != "hello, world" || f.Size != 12 || f.Filename != "a.txt" {
+		t.Errorf("file %+v has content %q, %v", f, b, err)
+	}
+	if err := form.RemoveAll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(f.Path); !os.IsNotExist(err) {
+		t.Errorf("RemoveAll should have removed %s", f.Path)
+	}
+
+	// on error, nothing should be left behind: not the file that was too big, nor the ones before it.
+	big := strings.Repeat("x", maxFormFileBytes+1)
+	if _, err := ParseMultipart(multipartRequest(t, nil, map[string]string{"small.txt": "ok", "big.txt": big}), dir); err == nil {
+		t.Error("ParseMultipart() should reject a file over maxFormFileBytes")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("ParseMultipart() left %d files behind after an error", len(entries))
+	}
+
+	if _, err := ParseMultipart(Request{Headers: Headers{{"Content-Type", "multipart/form-data"}}}, dir); err == nil {
+		t.Error("ParseMultipart() should reject a Content-Type without a boundary")
+	}
+}
+
+func TestServeUpload(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	dir := t.TempDir()
+	go Serve(l, func(req Request) Response {
+		form, err := ParseMultipart(req, dir)
+		if err != nil {
+			return Response{StatusCode: http.StatusBadRequest, Body: err.Error()}
+		}
+		defer form.RemoveAll()
+		f := form.Files["upload"][0]
+		b, _ := os.ReadFile(f.Path)
+		return Response{StatusCode: http.StatusOK, Body: form.Values.Get("title") + ": " + f.Filename + ": " + string(b)}
+	})
+	req := multipartRequest(t, map[string]string{"title": "notes"}, map[string]string{"notes.md": "# hi"})
+	resp, err := http.Post("http://"+l.Addr().String()+"/upload", req.Headers.Get("Content-Type"), strings.NewReader(req.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if want := "notes: notes.md: # hi"; resp.StatusCode != 200 || string(body) != want {
+		t.Errorf("got %d %q, want 200 %q", resp.StatusCode, body, want)
+	}
+}
@@ -1,20 +1,64 @@
 package backendbasics
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log/slog"
 	"net/http"
-	"sync"
+	"time"
 
-	"gitlab.com/efronlicht/blog/articles/backendbasics/middleware"
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/clientmw"
 )
 
+// JSONOpts configures GetJSON, PostJSON, PutJSON, and DeleteJSON. The zero value is fine: no extra headers, no timeout, no retries, no limit.
+type JSONOpts struct {
+	// Header is added to the request's headers. Accept is application/json unless Header says otherwise.
+	Header http.Header
+	// Timeout, if nonzero, limits the whole call, from sending the request to decoding the response, on top of any deadline ctx already has.
+	Timeout time.Duration
+	// Retry, if set, retries failed tries with clientmw.Retry. The body is rewindable, so PostJSON retries too:
+	// only ask it to if the server can take the same POST twice.
+	Retry *clientmw.RetryPolicy
+	// DecodeLimit, if nonzero, is the most bytes of response body to read. A bigger response is an error wrapping *http.MaxBytesError.
+	DecodeLimit int64
+}
+
 // GetJSON makes a GET request to the given URL, and decodes the response body as JSON into t.
-func GetJSON[T any](ctx context.Context, c *http.Client, url string) (t T, err error) {
+// opts is optional: only the first one is used.
+func GetJSON[T any](ctx context.Context, c *http.Client, url string, opts ...JSONOpts) (t T, err error) {
+	return doJSON[T](ctx, c, http.MethodGet, url, nil, opts)
+}
+
+// PostJSON makes a POST request to the given URL with body encoded as JSON, and decodes the response body as JSON into a Resp.
+// opts is optional: only the first one is used.
+func PostJSON[Req, Resp any](ctx context.Context, c *http.Client, url string, body Req, opts ...JSONOpts) (Resp, error) {
+	return sendJSON[Req, Resp](ctx, c, http.MethodPost, url, body, opts)
+}
+
+// PutJSON is PostJSON, but a PUT.
+func PutJSON[Req, Resp any](ctx context.Context, c *http.Client, url string, body Req, opts ...JSONOpts) (Resp, error) {
+	return sendJSON[Req, Resp](ctx, c, http.MethodPut, url, body, opts)
+}
+
+// DeleteJSON makes a DELETE request to the given URL, and decodes the response body, if any, as JSON into a Resp.
+// A 204 No Content, or a 2xx with an empty body, gets you the zero Resp.
+func DeleteJSON[Resp any](ctx context.Context, c *http.Client, url string, opts ...JSONOpts) (Resp, error) {
+	return doJSON[Resp](ctx, c, http.MethodDelete, url, nil, opts)
+}
+
+func sendJSON[Req, Resp any](ctx context.Context, c *http.Client, method, url string, body Req, opts []JSONOpts) (resp Resp, err error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return resp, fmt.Errorf("%s %v: encoding %T as JSON: %w", method, url, body, err)
+	}
+	return doJSON[Resp](ctx, c, method, url, b, opts)
+}
+
+// doJSON sends the request, with body as the JSON request body if it's not nil, and decodes the response as JSON into t.
+func doJSON[T any](ctx context.Context, c *http.Client, method, url string, body []byte, opts []JSONOpts) (t T, err error) {
 	if ctx == nil {
 		return t, errors.New("nil context")
 	}
@@ -24,21 +68,62 @@ func GetJSON[T any](ctx context.Context, c *http.Client, url string) (t T, err e
 	if err := ctx.Err(); err != nil {
 		return t, ctx.Err()
 	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	var o JSONOpts
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.Timeout)
+		defer cancel()
+	}
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body) // a *bytes.Reader, so http.NewRequest sets GetBody and Retry can rewind it.
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, r)
 	if err != nil {
-		return t, fmt.Errorf("GET %v: invalid request: %w", url, err)
+		return t, fmt.Errorf("%s %v: invalid request: %w", method, url, err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, vs := range o.Header {
+		req.Header.Del(k)
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	if o.Retry != nil {
+		retrying := *c // a shallow copy: same cookies, timeout, and so on, but the retrying transport.
+		transport := c.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		retrying.Transport = clientmw.Retry(transport, *o.Retry)
+		c = &retrying
 	}
-	req.Header.Add("Accept", "application/json")
 	resp, err := c.Do(req)
 	if err != nil {
-		return t, fmt.Errorf("GET %v: %w", url, err)
+		return t, fmt.Errorf("%s %v: %w", method, url, err)
 	}
 	defer resp.Body.Close()
 	if status := resp.StatusCode; status < 200 || status >= 300 {
-		return t, fmt.Errorf("GET %v: expected 2xx status code, got %v", url, status)
+		return t, fmt.Errorf("%s %v: expected 2xx status code, got %v", method, url, status)
+	}
+	if resp.StatusCode == http.StatusNoContent {
+		return t, nil
+	}
+	var rb io.Reader = resp.Body
+	if o.DecodeLimit > 0 {
+		rb = http.MaxBytesReader(nil, resp.Body, o.DecodeLimit)
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
-		return t, fmt.Errorf("GET %v: decoding JSON as %T: %w", url, t, err)
+	if err := json.NewDecoder(rb).Decode(&t); err != nil {
+		if errors.Is(err, io.EOF) && method == http.MethodDelete { // plenty of servers answer a DELETE with a bare 200.
+			return t, nil
+		}
+		return t, fmt.Errorf("%s %v: decoding JSON as %T: %w", method, url, t, err)
 	}
 	return t, nil
 }
@@ -50,36 +135,6 @@ func WriteJSON(w http.ResponseWriter, t any) error {
 	return json.NewEncoder(w).Encode(t)
 }
 
-type piece byte
-
-const (
-	empty piece = iota
-	whitePawn
-	whiteKnight
-	whiteBishop
-	whiteRook
-	whiteQueen
-	whiteKing
-	_
-	_
-	blackPawn
-	blackKnight
-	blackBishop
-	blackRook
-	blackQueen
-	blackKing
-)
-
-type Move struct {
-	From, To struct{ X, Y int8 }
-	White    bool
-	Previous [8][8]piece
-}
-
-func NextMove(board [8][8]piece, m Move) ([8][8]piece, error) {
-	panic("TODO")
-}
-
 func FromJSON[T any](r io.Reader) (t T, err error) {
 	if r == nil {
 		return t, errors.New("nil reader")
@@ -92,70 +147,3 @@ func FromJSON[T any](r io.Reader) (t T, err error) {
 	}
 	return t, nil
 }
-
-type Sessions struct {
-	mux sync.RWMutex
-	m   map[string]*Game
-}
-type Game struct {
-	ID    string
-	Board [8][8]piece
-	mux   sync.Mutex
-}
-
-func handle(r *http.Request, s *Sessions) ([8][8]piece, error, int) {
-	if r.Method != http.MethodPost {
-		return [8][8]piece{}, fmt.Errorf("invalid method %q", r.Method), http.StatusMethodNotAllowed
-	}
-	gameID := r.URL.Query().Get("gameID")
-	if gameID == "" {
-		return [8][8]piece{}, fmt.Errorf("missing gameID query parameter"), http.StatusBadRequest
-	}
-
-	move, err := FromJSON[Move](r.Body)
-	if err != nil {
-		return [8][8]piece{}, fmt.Errorf("decoding JSON: %w", err), http.StatusBadRequest
-	}
-	if move.From.X < 0 || move.From.X >= 8 || move.From.Y < 0 || move.From.Y >= 8 {
-		return [8][8]piece{}, fmt.Errorf("invalid move.From: %+v", move.From), http.StatusBadRequest
-	}
-	s.mux.RLock() // read lock; check for this gameID
-	game, ok := s.m[gameID]
-	s.mux.RUnlock() // regardless of whether we found it, we need to unlock the map
-	if !ok {
-		return [8][8]piece{}, fmt.Errorf("invalid gameID %q", gameID), http.StatusBadRequest
-	}
-	game.mux.Lock()         // obtain a write lock on THIS game
-	defer game.mux.Unlock() // unlock THIS game when we're done
-
-	if game.Board != move.Previous {
-		return [8][8]piece{}, fmt.Errorf("board does not match previous move"), http.StatusBadRequest
-	}
-	// now no one else can modify this game's board until we're done, and we know the board is correct
-
-	board, err := NextMove([8][8]piece{}, move)
-	if err != nil {
-		return [8][8]piece{}, fmt.Errorf("invalid move: %w", err), http.StatusBadRequest
-	}
-	game.Board = board
-	return board, nil, http.StatusOK
-}
-
-func SomeHandler(s *Sessions) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		board, err, statusCode := handle(r, s)
-		if err != nil {
-			slog.InfoContext(r.Context(), "somehandler: error", "err", err, "status", statusCode, "method", r.Method, "url", r.URL)
-			w.WriteHeader(statusCode)
-			if _, err := w.Write([]byte(err.Error())); err != nil {
-				middleware.LogOrDefault(r.Context()).Error("somehandler: failed write", "err", err)
-			}
-			return
-		}
-		if err := WriteJSON(w, board); err != nil {
-			slog.ErrorContext(r.Context(), "somehandler: error writing JSON", "err", err, "method", r.Method, "url", r.URL)
-			return
-		}
-		slog.DebugContext(r.Context(), "somehandler: success", "method", r.Method, "url", r.URL)
-	}
-}
@@ -0,0 +1,96 @@
+package backendbasics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/clientmw"
+)
+
+func TestJSONHelpers(t *testing.T) {
+	type item struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+	var flaky atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/item":
+			if r.Method == http.MethodDelete {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			var it item
+			if r.Method != http.MethodGet {
+				if r.Header.Get("Content-Type") != "application/json" {
+					http.Error(w, "want JSON", http.StatusUnsupportedMediaType)
+					return
+				}
+				json.NewDecoder(r.Body).Decode(&it)
+				it.Count++
+			}
+			it.Name += r.Method + r.Header.Get("X-Who")
+			WriteJSON(w, it)
+		case "/empty": // a 200, but no body.
+		case "/flaky":
+			if flaky.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			WriteJSON(w, item{Name: "finally"})
+		case "/slow":
+			time.Sleep(100 * time.Millisecond)
+			WriteJSON(w, item{})
+		case "/big":
+			WriteJSON(w, item{Name: strings.Repeat("x", 1000)})
+		}
+	}))
+	defer srv.Close()
+	ctx, c := context.Background(), srv.Client()
+
+	if got, err := GetJSON[item](ctx, c, srv.URL+"/item", JSONOpts{Header: http.Header{"X-Who": {"efron"}}}); err != nil || got.Name != "GETefron" {
+		t.Errorf("GetJSON() = %+v, %v", got, err)
+	}
+	if got, err := PostJSON[item, item](ctx, c, srv.URL+"/item", item{Name: "a", Count: 1}); err != nil || got != (item{"aPOST", 2}) {
+		t.Errorf("PostJSON() = %+v, %v", got, err)
+	}
+	if got, err := PutJSON[item, item](ctx, c, srv.URL+"/item", item{Name: "b"}); err != nil || got != (item{"bPUT", 1}) {
+		t.Errorf("PutJSON() = %+v, %v", got, err)
+	}
+	if got, err := DeleteJSON[item](ctx, c, srv.URL+"/item"); err != nil || got != (item{}) {
+		t.Errorf("DeleteJSON() = %+v, %v", got, err)
+	}
+	if got, err := DeleteJSON[item](ctx, c, srv.URL+"/empty"); err != nil || got != (item{}) {
+		t.Errorf("DeleteJSON() with an empty 200 = %+v, %v", got, err)
+	}
+	if _, err := GetJSON[item](ctx, c, srv.URL+"/empty"); err == nil {
+		t.Error("GetJSON() with an empty 200: expected an error decoding it")
+	}
+
+	if _, err := GetJSON[item](ctx, c, srv.URL+"/flaky"); err == nil {
+		t.Error("GetJSON() without Retry should fail on a 503")
+	}
+	retry := &clientmw.RetryPolicy{Tries: 3, Base: time.Millisecond}
+	if got, err := GetJSON[item](ctx, c, srv.URL+"/flaky", JSONOpts{Retry: retry}); err != nil || got.Name != "finally" {
+		t.Errorf("GetJSON() with Retry = %+v, %v", got, err)
+	}
+
+	if _, err := GetJSON[item](ctx, c, srv.URL+"/slow", JSONOpts{Timeout: 10 * time.Millisecond}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetJSON() with Timeout: expected a context.DeadlineExceeded, got %v", err)
+	}
+
+	var tooBig *http.MaxBytesError
+	if _, err := GetJSON[item](ctx, c, srv.URL+"/big", JSONOpts{DecodeLimit: 100}); !errors.As(err, &tooBig) {
+		t.Errorf("GetJSON() with DecodeLimit: expected a *http.MaxBytesError, got %v", err)
+	}
+	if _, err := GetJSON[item](ctx, c, srv.URL+"/big", JSONOpts{DecodeLimit: 2000}); err != nil {
+		t.Errorf("GetJSON() under the DecodeLimit: %v", err)
+	}
+}
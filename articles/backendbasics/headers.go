@@ -0,0 +1,126 @@
+package backendbasics
+
+import "strings"
+
+// Headers are a message's headers, in the order they were sent. Keys are stored in title case: see AsTitle.
+// A key can appear more than once, as in
+//
+//	Accept: text/html
+//	Accept: application/json;q=0.9
+//
+// which means the same thing as "Accept: text/html, application/json;q=0.9": see RFC 9110, section 5.3.
+// Headers keeps them as they came, so writing a message back out doesn't change it, but Get and Values see them as one list.
+type Headers []Header
+
+// Get returns the value of the header with the given key, or "" if there isn't one.
+// Repeated headers are joined with ", ", as RFC 9110 says they're equivalent to.
+// The exception is Set-Cookie, which can't be joined since cookies can have commas in them: you get the first. Use Values for the rest.
+func (h Headers) Get(key string) string {
+	key = canonical(key)
+	var joined string
+	found := false
+	for _, hdr := range h {
+		if hdr.Key != key {
+			continue
+		}
+		if !found {
+			joined, found = hdr.Value, true
+			if key == "Set-Cookie" {
+				return joined
+			}
+			continue
+		}
+		joined += ", " + hdr.Value
+	}
+	return joined
+}
+
+// Values returns every value of the header with the given key, splitting comma-separated lists:
+// "Accept: text/html, application/json" and two Accept headers both have the values ["text/html", "application/json"].
+// Commas inside quoted strings don't split: `W/"a,b"` is one value.
+// Set-Cookie isn't split, since cookies can have commas in them: each Set-Cookie header is one value.
+func (h Headers) Values(key string) []string {
+	key = canonical(key)
+	var values []string
+	for _, hdr := range h {
+		if hdr.Key != key {
+			continue
+		}
+		if key == "Set-Cookie" {
+			values = append(values, hdr.Value)
+			continue
+		}
+		values = append(values, splitList(hdr.Value)...)
+	}
+	return values
+}
+
+// Add adds a header, after any others with the same key.
+func (h *Headers) Add(key, value string) { *h = append(*h, Header{AsTitle(key), value}) }
+
+// Set replaces every header with the given key with one header with this value, where the first of them was; or adds it at the end, if there weren't any.
+func (h *Headers) Set(key, value string) {
+	key = AsTitle(key)
+	out := (*h)[:0]
+	set := false
+	for _, hdr := range *h {
+		switch {
+		case hdr.Key != key:
+			out = append(out, hdr)
+		case !set:
+			out, set = append(out, Header{key, value}), true
+		}
+	}
+	if !set {
+		out = append(out, Header{key, value})
+	}
+	*h = out
+}
+
+// Del removes every header with the given key.
+func (h *Headers) Del(key string) {
+	key = canonical(key)
+	out := (*h)[:0]
+	for _, hdr := range *h {
+		if hdr.Key != key {
+			out = append(out, hdr)
+		}
+	}
+	*h = out
+}
+
+// canonical is AsTitle, except an empty key stays empty rather than panicking: there's just no header with that key.
+func canonical(key string) string {
+	if key == "" {
+		return ""
+	}
+	return AsTitle(key)
+}
+
+// splitList splits a comma-separated header value into its elements, trimming whitespace and skipping empty ones.
+// Commas inside double-quoted strings don't count.
+func splitList(s string) []string {
+	var elems []string
+	start, quoted := 0, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && quoted:
+			i++ // skip the escaped character.
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			if e := strings.TrimSpace(s[start:i]); e != "" {
+				elems = append(elems, e)
+			}
+			start = i + 1
+		}
+	}
+	if e := strings.TrimSpace(s[start:]); e != "" {
+		elems = append(elems, e)
+	}
+	return elems
+}
+
+// isObsFold reports whether a header line is a continuation of the one before it, by starting with whitespace:
+// "obsolete line folding", which RFC 9112 section 5.2 says to reject, since different parsers disagree about what it means.
+func isObsFold(line string) bool { return line != "" && (line[0] == ' ' || line[0] == '\t') }
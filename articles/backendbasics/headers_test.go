@@ -0,0 +1,73 @@
+package backendbasics
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHeaders(t *testing.T) {
+	raw := "HTTP/1.1 200 OK\r\n" +
+		"Accept: text/html\r\n" +
+		"accept: application/json;q=0.9, */*;q=0.1\r\n" +
+		"Etag: \"a,b\", W/\"c\"\r\n" +
+		"Set-Cookie: a=1; Expires=Wed, 21 Oct 2015 07:28:00 GMT\r\n" +
+		"Set-Cookie: b=2\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	resp, err := ReadResponse(bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := resp.Headers
+	for key, want := range map[string]string{
+		"Accept":     "text/html, application/json;q=0.9, */*;q=0.1",
+		"set-cookie": "a=1; Expires=Wed, 21 Oct 2015 07:28:00 GMT", // just the first.
+		"Missing":    "",
+		"":           "",
+	} {
+		if got := h.Get(key); got != want {
+			t.Errorf("Get(%q) = %q, want %q", key, got, want)
+		}
+	}
+	for key, want := range map[string][]string{
+		"ACCEPT":     {"text/html", "application/json;q=0.9", "*/*;q=0.1"},
+		"Etag":       {`"a,b"`, `W/"c"`},
+		"Set-Cookie": {"a=1; Expires=Wed, 21 Oct 2015 07:28:00 GMT", "b=2"},
+		"Missing":    nil,
+	} {
+		if got := h.Values(key); !reflect.DeepEqual(got, want) {
+			t.Errorf("Values(%q) = %q, want %q", key, got, want)
+		}
+	}
+
+	// the headers are written back out as they came, but in title case.
+	if got, want := resp.String(), strings.Replace(raw, "accept:", "Accept:", 1)+"\r\n"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	h.Set("accept", "*/*") // replaces both, where the first one was.
+	h.Add("x-new", "1")
+	h.Del("set-cookie")
+	want := Headers{{"Accept", "*/*"}, {"Etag", `"a,b", W/"c"`}, {"Content-Length", "0"}, {"X-New", "1"}}
+	if !reflect.DeepEqual(h, want) {
+		t.Errorf("after Set, Add, and Del: got %q, want %q", h, want)
+	}
+	h.Set("X-Other", "2")
+	if got := h[len(h)-1]; got != (Header{"X-Other", "2"}) {
+		t.Errorf("Set of a new key: got %q at the end, want X-Other: 2", got)
+	}
+}
+
+func TestObsFold(t *testing.T) {
+	fold := "X-Long: first part\r\n\tsecond part\r\n"
+	if _, err := ParseRequest("GET / HTTP/1.1\r\nHost: localhost\r\n" + fold + "\r\n"); err == nil || !strings.Contains(err.Error(), "folding") {
+		t.Errorf("ParseRequest: got %v, want an obsolete line folding error", err)
+	}
+	if _, err := ParseResponse("HTTP/1.1 200 OK\r\n" + fold + "\r\n"); err == nil || !strings.Contains(err.Error(), "folding") {
+		t.Errorf("ParseResponse: got %v, want an obsolete line folding error", err)
+	}
+	if _, err := ReadRequest(bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost\r\n" + fold + "\r\n"))); err == nil || !strings.Contains(err.Error(), "folding") {
+		t.Errorf("ReadRequest: got %v, want an obsolete line folding error", err)
+	}
+}
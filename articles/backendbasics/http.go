@@ -16,7 +16,7 @@ type Header struct{ Key, Value string }
 // Request is a http 1.1 request.
 type Request struct {
 	Method, Path, Body string
-	Headers            []Header
+	Headers            Headers
 }
 
 var ( // assert interfaces are implemented at compile time.
@@ -27,14 +27,7 @@ var ( // assert interfaces are implemented at compile time.
 )
 
 // Host returns the value of the Host header, or "" if no Host header is present.
-func (r *Request) Host() string {
-	for _, h := range r.Headers {
-		if h.Key == "Host" {
-			return h.Value
-		}
-	}
-	return ""
-}
+func (r *Request) Host() string { return r.Headers.Get("Host") }
 
 var _ io.WriterTo = &Request{}
 
@@ -140,6 +133,9 @@ func ParseRequest(raw string) (r Request, err error) {
 			bodyStart = i + 1
 			break
 		}
+		if isObsFold(lines[i]) {
+			return Request{}, fmt.Errorf("malformed request: header line %q starts with whitespace (obsolete line folding)", lines[i])
+		}
 		key, val, ok := strings.Cut(lines[i], ": ")
 		if !ok {
 			return Request{}, fmt.Errorf("malformed request: header %q should be of form 'key: value'", lines[i])
@@ -163,7 +159,7 @@ func ParseRequest(raw string) (r Request, err error) {
 type Response struct {
 	StatusCode int
 	Body       string
-	Headers    []Header
+	Headers    Headers
 }
 
 // ParseResponse parses the given HTTP/1.1 response string into the Response. It returns an error if the Response is invalid,
@@ -201,6 +197,9 @@ func ParseResponse(raw string) (resp *Response, err error) {
 			bodyStart = i + 1
 			break
 		}
+		if isObsFold(lines[i]) {
+			return nil, fmt.Errorf("malformed response: header line %q starts with whitespace (obsolete line folding)", lines[i])
+		}
 		key, val, ok := strings.Cut(lines[i], ": ")
 		if !ok {
 			return nil, fmt.Errorf("malformed response: header %q should be of form 'key: value'", lines[i])
@@ -213,12 +212,12 @@ func ParseResponse(raw string) (resp *Response, err error) {
 }
 
 func (resp *Response) WithHeader(key, value string) *Response {
-	resp.Headers = append(resp.Headers, Header{AsTitle(key), value})
+	resp.Headers.Add(key, value)
 	return resp
 }
 
 func (r *Request) WithHeader(key, value string) *Request {
-	r.Headers = append(r.Headers, Header{AsTitle(key), value})
+	r.Headers.Add(key, value)
 	return r
 }
 
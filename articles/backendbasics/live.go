@@ -0,0 +1,240 @@
+package backendbasics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/efronlicht/blog/articles/backendbasics/middleware"
+	"gitlab.com/efronlicht/blog/observability/http/tracemw"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+)
+
+// liveUpdate is what LiveHandler sends: the whole game after every move, not just the move, so a client that misses one doesn't fall behind.
+type liveUpdate struct {
+	ID     string      `json:"id"`
+	White  string      `json:"white"`
+	Black  string      `json:"black"`
+	Ply    int         `json:"ply"` // how many moves have been made.
+	FEN    string      `json:"fen"`
+	Board  [8][8]piece `json:"board"`
+	Moves  []string    `json:"moves"` // in SAN: see Position.SAN.
+	Status string      `json:"status"`
+	Result string      `json:"result"` // as in PGN: see Position.Result.
+}
+
+func newLiveUpdate(g *Game) liveUpdate {
+	positions, _ := Replay(g.Start, g.Moves) // a stored game always replays: we checked every move on the way in.
+	san := make([]string, len(positions)-1)
+	for i := range san {
+		san[i] = positions[i].SAN(g.Moves[i])
+	}
+	return liveUpdate{
+		ID: g.ID, White: g.White, Black: g.Black,
+		Ply: len(g.Moves), FEN: g.Position.FEN(), Board: g.Position.Board, Moves: san,
+		Status: g.Position.Status().String(), Result: g.Position.Result(),
+	}
+}
+
+// watchers are the connections watching each game live, by game ID.
+// Each gets its updates on its own channel, buffered by one: see publish.
+type watchers struct {
+	mux sync.Mutex
+	m   map[string]map[chan liveUpdate]bool
+}
+
+// watch starts sending updates for the game with the given ID. Call stop when you're done.
+// The channel is closed if the game is deleted.
+func (w *watchers) watch(id string) (updates <-chan liveUpdate, stop func()) {
+	ch := make(chan liveUpdate, 1)
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.m == nil {
+		w.m = make(map[string]map[chan liveUpdate]bool)
+	}
+	if w.m[id] == nil {
+		w.m[id] = make(map[chan liveUpdate]bool)
+	}
+	w.m[id][ch] = true
+	return ch, func() {
+		w.mux.Lock()
+		defer w.mux.Unlock()
+		delete(w.m[id], ch)
+		if len(w.m[id]) == 0 {
+			delete(w.m, id)
+		}
+	}
+}
+
+// publish sends g to everyone watching it, without waiting on anyone: a slow connection that hasn't read its last update
+// gets this one instead, since each update is the whole game. Updates can be published out of order, so the newer one wins.
+func (w *watchers) publish(g *Game) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if len(w.m[g.ID]) == 0 {
+		return // don't bother replaying the game for no one.
+	}
+	u := newLiveUpdate(g)
+	for ch := range w.m[g.ID] {
+		select {
+		case old := <-ch:
+			if old.Ply > u.Ply {
+				ch <- old // put it back: it's newer.
+				continue
+			}
+		default:
+		}
+		ch <- u // can't block: we hold the lock, so no one else can fill the buffer we just emptied.
+	}
+}
+
+// closeGame closes the channel of everyone watching the game with the given ID, i.e, because it was deleted.
+func (w *watchers) closeGame(id string) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	for ch := range w.m[id] {
+		close(ch)
+	}
+	delete(w.m, id)
+}
+
+// LiveHandler serves a game over a WebSocket at /chess/live/{id}: the game's ID is the last element of the path.
+// Everyone connected gets the game as JSON (a liveUpdate) when they connect, then again after every move, however it's made: here, or through SomeHandler.
+// Connecting with ?as=white or ?as=black lets you play, too: send a Move as JSON. If it's rejected, you'll get an {"error": "..."} back.
+// Anyone else is a spectator. There's no authentication: this is a demo.
+//
+// Connections are logged by tracemw.Server like any other request: when they close, as a 101 Switching Protocols.
+func LiveHandler(s *Sessions, logger *zap.Logger) http.Handler {
+	ws := websocket.Server{
+		// websocket.Handler refuses connections without an Origin header: i.e, anything that's not a browser.
+		// We'll take them: the game's ID is all you need to watch it anyways.
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler:   s.serveLive,
+	}
+	return tracemw.Server(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			w.Header().Set("Upgrade", "websocket")
+			http.Error(w, "this endpoint only speaks websocket", http.StatusUpgradeRequired)
+			return
+		}
+		switch as := r.URL.Query().Get("as"); as {
+		case "", "white", "black":
+		default:
+			http.Error(w, fmt.Sprintf(`?as should be "white", "black", or empty to spectate, not %q`, as), http.StatusBadRequest)
+			return
+		}
+		// check for the game before we upgrade, so a bad ID gets a plain 404 rather than a websocket that immediately hangs up.
+		switch _, err := s.store().Get(r.Context(), path.Base(r.URL.Path)); {
+		case errors.Is(err, ErrNoGame):
+			http.Error(w, "no such game", http.StatusNotFound)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		default:
+			ws.ServeHTTP(w, r)
+		}
+	}), logger)
+}
+
+// liveWriteTimeout is how long we'll wait on a connection to take an update before giving up on it.
+const liveWriteTimeout = 10 * time.Second
+
+// serveLive serves one connection to LiveHandler, writing updates and rejected moves until the client hangs up or the game is deleted.
+// Moves are read on another goroutine: see readMoves.
+func (s *Sessions) serveLive(conn *websocket.Conn) {
+	r := conn.Request()
+	ctx := r.Context()
+	id, as := path.Base(r.URL.Path), r.URL.Query().Get("as")
+	log := middleware.LogOrDefault(ctx).With("game", id, "as", as)
+
+	// watch BEFORE we get the game, so there's no gap where a move could happen without us hearing about it.
+	updates, stop := s.watchers.watch(id)
+	defer stop()
+	game, err := s.store().Get(ctx, id)
+	if err != nil {
+		s.sendLive(conn, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := s.sendLive(conn, newLiveUpdate(game)); err != nil {
+		return
+	}
+	ply := len(game.Moves) // how far along the client is.
+
+	done := make(chan struct{}) // closed when we stop writing, so readMoves doesn't wait on us.
+	defer close(done)
+	rejected, hungUp := make(chan error), make(chan struct{})
+	go func() {
+		defer close(hungUp)
+		s.readMoves(ctx, conn, id, as, rejected, done)
+	}()
+	log.InfoContext(ctx, "live: connected")
+	for {
+		select {
+		case u, ok := <-updates:
+			if !ok {
+				log.InfoContext(ctx, "live: game deleted: hanging up")
+				return
+			}
+			if u.Ply <= ply {
+				continue // old news: we already sent this one, or a newer one.
+			}
+			if err := s.sendLive(conn, u); err != nil {
+				log.InfoContext(ctx, "live: write failed: hanging up", "err", err)
+				return
+			}
+			ply = u.Ply
+		case err := <-rejected:
+			if err := s.sendLive(conn, map[string]string{"error": err.Error()}); err != nil {
+				return
+			}
+		case <-hungUp:
+			log.InfoContext(ctx, "live: disconnected")
+			return
+		}
+	}
+}
+
+// sendLive writes v to conn as JSON, giving up after liveWriteTimeout.
+func (s *Sessions) sendLive(conn *websocket.Conn, v any) error {
+	conn.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+	return websocket.JSON.Send(conn, v)
+}
+
+// readMoves reads moves from conn, playing them in the game with the given ID as the side `as`, until conn is closed.
+// Rejected moves go to rejected, for the writer to send back. Accepted ones don't need to: everyone, including this connection, hears about them from play.
+func (s *Sessions) readMoves(ctx context.Context, conn *websocket.Conn, id, as string, rejected chan<- error, done <-chan struct{}) {
+	for {
+		var msg []byte
+		if err := websocket.Message.Receive(conn, &msg); err != nil {
+			return // they hung up, or we did.
+		}
+		var move Move
+		err := json.Unmarshal(msg, &move)
+		switch {
+		case err != nil:
+			err = fmt.Errorf("decoding JSON: %w", err)
+		case as == "":
+			err = errors.New("spectators can't move: connect with ?as=white or ?as=black to play")
+		case move.White != (as == "white"):
+			err = fmt.Errorf("you're playing %s", as)
+		case !move.From.onBoard():
+			err = fmt.Errorf("invalid move.From: %+v", move.From)
+		default:
+			_, err, _ = s.play(ctx, id, move)
+		}
+		if err == nil {
+			continue
+		}
+		select {
+		case rejected <- err:
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package backendbasics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+)
+
+func TestLiveHandler(t *testing.T) {
+	var s Sessions
+	game, err := s.NewGame(context.Background(), "efron", "bobross")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/chess/live/", LiveHandler(&s, zap.NewNop()))
+	mux.Handle("/chess/move", SomeHandler(&s))
+	mux.Handle("/chess/games", DeleteGameHandler(&s))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	live := "ws" + strings.TrimPrefix(srv.URL, "http") + "/chess/live/"
+
+	dial := func(query string) *websocket.Conn {
+		t.Helper()
+		conn, err := websocket.Dial(live+game.ID+query, "", srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	// receive the next message, which should be a liveUpdate unless wantErr is set.
+	receive := func(conn *websocket.Conn, wantErr string) liveUpdate {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var msg struct {
+			liveUpdate
+			Error string `json:"error"`
+		}
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Error != "" && wantErr == "" {
+			t.Fatalf("got error %q, want an update", msg.Error)
+		}
+		if !strings.Contains(msg.Error, wantErr) {
+			t.Fatalf("got error %q, want one containing %q", msg.Error, wantErr)
+		}
+		return msg.liveUpdate
+	}
+
+	white, spectator := dial("?as=white"), dial("")
+	for _, conn := range []*websocket.Conn{white, spectator} {
+		if u := receive(conn, ""); u.Ply != 0 || u.FEN != StartPosition().FEN() || u.White != "efron" {
+			t.Fatalf("on connect: got %+v", u)
+		}
+	}
+
+	// a move over the websocket goes to everyone...
+	start := StartPosition().Board
+	websocket.JSON.Send(white, Move{From: sq("e2"), To: sq("e4"), White: true, Previous: start})
+	var afterE4 [8][8]piece
+	for _, conn := range []*websocket.Conn{white, spectator} {
+		u := receive(conn, "")
+		if u.Ply != 1 || len(u.Moves) != 1 || u.Moves[0] != "e4" {
+			t.Fatalf("after e4: got %+v", u)
+		}
+		afterE4 = u.Board
+	}
+	// ...but a rejected one only goes back to whoever sent it.
+	websocket.JSON.Send(spectator, Move{From: sq("e7"), To: sq("e5"), Previous: afterE4})
+	receive(spectator, "spectators can't move")
+	websocket.JSON.Send(white, Move{From: sq("e7"), To: sq("e5"), Previous: afterE4})
+	receive(white, "you're playing white")
+	websocket.JSON.Send(white, Move{From: sq("e4"), To: sq("e5"), White: true, Previous: afterE4})
+	receive(white, "not white's turn")
+	white.Write([]byte("not json"))
+	receive(white, "decoding JSON")
+
+	// so does a move made the old way, over plain HTTP.
+	b, _ := json.Marshal(Move{From: sq("e7"), To: sq("e5"), Previous: afterE4})
+	resp, err := http.Post(srv.URL+"/chess/move?gameID="+game.ID, "application/json", strings.NewReader(string(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST e5: got %d", resp.StatusCode)
+	}
+	for _, conn := range []*websocket.Conn{white, spectator} {
+		if u := receive(conn, ""); u.Ply != 2 || strings.Join(u.Moves, " ") != "e4 e5" {
+			t.Fatalf("after e5: got %+v", u)
+		}
+	}
+
+	// a late spectator catches up.
+	if u := receive(dial(""), ""); u.Ply != 2 {
+		t.Errorf("late spectator: got %+v", u)
+	}
+
+	// deleting the game hangs up on everyone.
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/chess/games?gameID="+game.ID, nil)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete: got %v, %v", resp, err)
+	}
+	for _, conn := range []*websocket.Conn{white, spectator} {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var u liveUpdate
+		if err := websocket.JSON.Receive(conn, &u); err == nil {
+			t.Errorf("after delete: got %+v, want the connection closed", u)
+		}
+	}
+
+	if resp, err := http.Get(srv.URL + "/chess/live/" + game.ID); err != nil || resp.StatusCode != http.StatusUpgradeRequired {
+		t.Errorf("plain GET: got %v, %v, want 426", resp, err)
+	}
+	for _, url := range []string{live + game.ID, live + "nope", live + game.ID + "?as=referee"} {
+		if _, err := websocket.Dial(url, "", srv.URL); err == nil {
+			t.Errorf("dial %s: want an error", url)
+		}
+	}
+}
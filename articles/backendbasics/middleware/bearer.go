@@ -0,0 +1,219 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/ctxutil"
+)
+
+// Claims are the registered claims of a JSON Web Token: see RFC 7519, section 4.1.
+// A zero time means the claim was absent.
+type Claims struct {
+	Issuer    string    // "iss": who issued the token.
+	Subject   string    // "sub": who the token is about; usually a user ID.
+	Audience  []string  // "aud": who the token is meant for. A single string in the token is a one-element slice here.
+	ExpiresAt time.Time // "exp": the token is no good at or after this time.
+	NotBefore time.Time // "nbf": the token is no good before this time.
+	IssuedAt  time.Time // "iat": when the token was issued.
+	ID        string    // "jti": a unique ID for the token.
+	Scope     []string  // "scope": what the token allows, space-separated in the token. See RFC 8693, section 4.2.
+
+	Raw json.RawMessage // the whole payload, to unmarshal any private claims from.
+}
+
+// UnmarshalJSON implements json.Unmarshaler, converting NumericDates (seconds since the epoch) to time.Time
+// and "aud" and "scope" to slices.
+func (c *Claims) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Iss, Sub, Jti, Scope string
+		Aud                  json.RawMessage
+		Exp, Nbf, Iat        *float64
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	date := func(f *float64) time.Time {
+		if f == nil {
+			return time.Time{}
+		}
+		return time.Unix(0, int64(*f*float64(time.Second)))
+	}
+	*c = Claims{
+		Issuer: raw.Iss, Subject: raw.Sub, ID: raw.Jti, Scope: strings.Fields(raw.Scope),
+		ExpiresAt: date(raw.Exp), NotBefore: date(raw.Nbf), IssuedAt: date(raw.Iat),
+		Raw: append(json.RawMessage(nil), b...),
+	}
+	switch {
+	case len(raw.Aud) == 0 || string(raw.Aud) == "null":
+	case raw.Aud[0] == '"':
+		c.Audience = make([]string, 1)
+		return json.Unmarshal(raw.Aud, &c.Audience[0])
+	default:
+		return json.Unmarshal(raw.Aud, &c.Audience)
+	}
+	return nil
+}
+
+// BearerAuthOpts configures BearerAuthMiddleware and ValidateJWT.
+// At least one of HS256Key or RS256Key must be set: a token signed with an algorithm that has no key is rejected,
+// so there's no way to trick the server into checking an RS256 public key as an HS256 secret, or accepting "alg": "none".
+type BearerAuthOpts struct {
+	Realm    string         // sent to the client in the WWW-Authenticate header. Defaults to "Restricted".
+	HS256Key []byte         // the shared secret for HMAC-SHA256 ("HS256") signatures.
+	RS256Key *rsa.PublicKey // the public key for RSASSA-PKCS1-v1_5 SHA-256 ("RS256") signatures.
+
+	Issuer   string   // if not empty, the token's "iss" must match.
+	Audience string   // if not empty, the token's "aud" must contain it.
+	Scopes   []string // the token's "scope" must contain all of these, or the request is forbidden.
+
+	// Leeway is how much clock skew to allow between us and the issuer when checking "exp" and "nbf". A minute or so is typical.
+	Leeway time.Duration
+	// Now returns the current time. Defaults to time.Now: override it for testing.
+	Now func() time.Time
+}
+
+var (
+	errMissingBearer = errors.New("missing or improperly formed 'Authorization' header: expected 'Bearer <token>': see RFC 6750")
+	errMalformedJWT  = errors.New("malformed token: expected three base64url-encoded parts separated by '.'")
+	errBadSignature  = errors.New("token signature is invalid")
+	errExpired       = errors.New("token is expired")
+	errNotYetValid   = errors.New("token is not valid yet")
+	errBadIssuer     = errors.New("token has the wrong issuer")
+	errBadAudience   = errors.New("token has the wrong audience")
+)
+
+// ValidateJWT parses a compact-serialized JWT and checks its signature and registered claims according to opts.
+// It doesn't check opts.Scopes: a token lacking a scope is still a valid token.
+func ValidateJWT(token string, opts BearerAuthOpts) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errMalformedJWT
+	}
+	var header struct{ Alg string }
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errMalformedJWT
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	switch {
+	case header.Alg == "HS256" && opts.HS256Key != nil:
+		mac := hmac.New(sha256.New, opts.HS256Key)
+		mac.Write(signed)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return nil, errBadSignature
+		}
+	case header.Alg == "RS256" && opts.RS256Key != nil:
+		digest := sha256.Sum256(signed)
+		if rsa.VerifyPKCS1v15(opts.RS256Key, crypto.SHA256, digest[:], sig) != nil {
+			return nil, errBadSignature
+		}
+	default:
+		return nil, fmt.Errorf("unsupported token algorithm %q", header.Alg)
+	}
+
+	// the signature's good: we can trust the payload.
+	claims := new(Claims)
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, err
+	}
+	now := time.Now
+	if opts.Now != nil {
+		now = opts.Now
+	}
+	t := now()
+	switch {
+	case !claims.ExpiresAt.IsZero() && !t.Before(claims.ExpiresAt.Add(opts.Leeway)):
+		return nil, errExpired
+	case !claims.NotBefore.IsZero() && t.Before(claims.NotBefore.Add(-opts.Leeway)):
+		return nil, errNotYetValid
+	case opts.Issuer != "" && claims.Issuer != opts.Issuer:
+		return nil, errBadIssuer
+	case opts.Audience != "" && !slices.Contains(claims.Audience, opts.Audience):
+		return nil, errBadAudience
+	}
+	return claims, nil
+}
+
+// decodeSegment decodes a base64url-encoded JSON segment of a JWT into dst.
+func decodeSegment(s string, dst any) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return errMalformedJWT
+	}
+	if err := json.Unmarshal(b, dst); err != nil {
+		return fmt.Errorf("malformed token: %w", err)
+	}
+	return nil
+}
+
+// BearerAuthMiddleware returns a middleware that authenticates requests by a JWT in the 'Authorization: Bearer <token>' header,
+// validated by ValidateJWT. The complement of BasicAuthMiddleware, for APIs.
+// The token's claims are saved in the request's context as a *Claims: retrieve them with ctxutil.Value[*Claims].
+//
+// Failures return a JSON error and a WWW-Authenticate header as described in RFC 6750, section 3:
+//   - no token: 401, with just the realm, so the client knows a token is needed.
+//   - a bad, expired, or otherwise invalid token: 401, with error="invalid_token".
+//   - more than one way of sending a token, or some other garbled header: 400, with error="invalid_request".
+//   - a valid token that's missing one of opts.Scopes: 403, with error="insufficient_scope".
+func BearerAuthMiddleware(h http.Handler, opts BearerAuthOpts) http.Handler {
+	// validate arguments OUTSIDE of the closure, so that it only happens once
+	if opts.HS256Key == nil && opts.RS256Key == nil {
+		panic("BearerAuthMiddleware: one of opts.HS256Key or opts.RS256Key must be set")
+	}
+	if opts.Realm == "" {
+		opts.Realm = "Restricted"
+	}
+	scope := strings.Join(opts.Scopes, " ")
+	challenge := func(w http.ResponseWriter, statusCode int, code string, err error) {
+		v := fmt.Sprintf("Bearer realm=%q", opts.Realm)
+		if code != "" {
+			// the description can't contain quotes or backslashes, escaped or not: RFC 6750, section 3.
+			desc := strings.NewReplacer(`"`, "'", `\`, "/").Replace(err.Error())
+			v += fmt.Sprintf(`, error="%s", error_description="%s"`, code, desc)
+		}
+		if code == "insufficient_scope" {
+			v += fmt.Sprintf(", scope=%q", scope)
+		}
+		w.Header().Add("WWW-Authenticate", v)
+		writeErr(w, err, statusCode)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Values("Authorization")
+		if len(auth) == 0 {
+			challenge(w, http.StatusUnauthorized, "", errMissingBearer)
+			return
+		}
+		scheme, token, ok := strings.Cut(auth[0], " ")
+		if len(auth) > 1 || !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			challenge(w, http.StatusBadRequest, "invalid_request", errMissingBearer)
+			return
+		}
+		claims, err := ValidateJWT(strings.TrimSpace(token), opts)
+		if err != nil {
+			LogOrDefault(r.Context()).InfoContext(r.Context(), "bearer auth: invalid token", "err", err)
+			challenge(w, http.StatusUnauthorized, "invalid_token", err)
+			return
+		}
+		for _, s := range opts.Scopes {
+			if !slices.Contains(claims.Scope, s) {
+				challenge(w, http.StatusForbidden, "insufficient_scope", fmt.Errorf("token lacks scope %q", s))
+				return
+			}
+		}
+		h.ServeHTTP(w, r.WithContext(ctxutil.WithValue(r.Context(), claims)))
+	})
+}
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/ctxutil"
+)
+
+// sign builds a compact JWT with the given algorithm; key is a []byte for HS256 or an *rsa.PrivateKey for RS256.
+func sign(t *testing.T, alg string, key any, claims map[string]any) string {
+	t.Helper()
+	enc := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := enc(map[string]string{"alg": alg, "typ": "JWT"}) + "." + enc(claims)
+	var sig []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestBearerAuthMiddleware(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("hunter2")
+	now := time.Unix(1_700_000_000, 0)
+	opts := BearerAuthOpts{
+		Realm:    "api",
+		HS256Key: secret,
+		RS256Key: &rsaKey.PublicKey,
+		Issuer:   "eblog.fly.dev",
+		Audience: "api",
+		Scopes:   []string{"read"},
+		Leeway:   time.Minute,
+		Now:      func() time.Time { return now },
+	}
+	h := BearerAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ctxutil.Value[*Claims](r.Context())
+		if !ok {
+			t.Error("no claims in context")
+			return
+		}
+		w.Write([]byte(claims.Subject))
+	}), opts)
+
+	claims := func(edit func(map[string]any)) map[string]any {
+		c := map[string]any{"iss": "eblog.fly.dev", "sub": "efron", "aud": "api", "scope": "read write", "exp": now.Add(time.Hour).Unix(), "nbf": now.Unix()}
+		if edit != nil {
+			edit(c)
+		}
+		return c
+	}
+	for _, tt := range []struct {
+		name       string
+		auth       []string
+		wantCode   int
+		wantHeader string // expected WWW-Authenticate, or "" for none.
+	}{
+		{"HS256", []string{"Bearer " + sign(t, "HS256", secret, claims(nil))}, 200, ""},
+		{"RS256", []string{"Bearer " + sign(t, "RS256", rsaKey, claims(nil))}, 200, ""},
+		{"lowercase scheme", []string{"bearer " + sign(t, "HS256", secret, claims(nil))}, 200, ""},
+		{"audience list", []string{"Bearer " + sign(t, "HS256", secret, claims(func(c map[string]any) { c["aud"] = []string{"web", "api"} }))}, 200, ""},
+		{"expired, but within leeway", []string{"Bearer " + sign(t, "HS256", secret, claims(func(c map[string]any) { c["exp"] = now.Add(-30 * time.Second).Unix() }))}, 200, ""},
+		{"not yet valid, but within leeway", []string{"Bearer " + sign(t, "HS256", secret, claims(func(c map[string]any) { c["nbf"] = now.Add(30 * time.Second).Unix() }))}, 200, ""},
+
+		{"missing", nil, 401, `Bearer realm="api"`},
+		{"basic auth", []string{"Basic ZWZyb246aHVudGVyMg=="}, 400, `Bearer realm="api", error="invalid_request"`},
+		{"two tokens", []string{"Bearer a.b.c", "Bearer d.e.f"}, 400, `Bearer realm="api", error="invalid_request"`},
+		{"garbage", []string{"Bearer garbage"}, 401, `Bearer realm="api", error="invalid_token", error_description="malformed token`},
+		{"wrong secret", []string{"Bearer " + sign(t, "HS256", []byte("hunter3"), claims(nil))}, 401, `error="invalid_token", error_description="token signature is invalid"`},
+		{"alg none", []string{"Bearer " + strings.TrimSuffix(sign(t, "none", nil, claims(nil)), ".")}, 401, `error="invalid_token", error_description="malformed token`},
+		{"alg none, empty signature", []string{"Bearer " + sign(t, "none", nil, claims(nil))}, 401, `error_description="unsupported token algorithm 'none'"`},
+		{"expired", []string{"Bearer " + sign(t, "HS256", secret, claims(func(c map[string]any) { c["exp"] = now.Add(-2 * time.Minute).Unix() }))}, 401, `error_description="token is expired"`},
+		{"not yet valid", []string{"Bearer " + sign(t, "HS256", secret, claims(func(c map[string]any) { c["nbf"] = now.Add(2 * time.Minute).Unix() }))}, 401, `error_description="token is not valid yet"`},
+		{"wrong issuer", []string{"Bearer " + sign(t, "HS256", secret, claims(func(c map[string]any) { c["iss"] = "evil.example" }))}, 401, `error_description="token has the wrong issuer"`},
+		{"wrong audience", []string{"Bearer " + sign(t, "HS256", secret, claims(func(c map[string]any) { c["aud"] = "web" }))}, 401, `error_description="token has the wrong audience"`},
+		{"missing scope", []string{"Bearer " + sign(t, "HS256", secret, claims(func(c map[string]any) { c["scope"] = "write" }))}, 403, `error="insufficient_scope", error_description="token lacks scope 'read'", scope="read"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			for _, v := range tt.auth {
+				req.Header.Add("Authorization", v)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Errorf("got status %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			got := rec.Header().Get("WWW-Authenticate")
+			if tt.wantHeader == "" && got != "" || !strings.Contains(got, tt.wantHeader) {
+				t.Errorf("got WWW-Authenticate %q, want it to contain %q", got, tt.wantHeader)
+			}
+			if tt.wantCode == 200 && rec.Body.String() != "efron" {
+				t.Errorf("got body %q, want the subject, efron", rec.Body)
+			}
+			if tt.wantCode != 200 && rec.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("got Content-Type %q, want application/json", rec.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestValidateJWTKeyConfusion(t *testing.T) {
+	// an attacker who knows the server's RSA public key might sign an HS256 token with it, hoping it gets used as the HMAC secret.
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := json.Marshal(rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := sign(t, "HS256", pub, map[string]any{"sub": "admin"})
+	if _, err := ValidateJWT(token, BearerAuthOpts{RS256Key: &rsaKey.PublicKey}); err == nil {
+		t.Fatal("accepted an HS256 token when only an RS256 key was configured")
+	}
+}
@@ -0,0 +1,277 @@
+// Package sessions stores sessions in signed, and optionally encrypted, cookies.
+// There's no server-side state: the whole session travels with every request, so keep it small.
+package sessions
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gitlab.com/efronlicht/blog/articles/backendbasics/cmd/ctxutil"
+	"gitlab.com/efronlicht/blog/articles/backendbasics/middleware"
+)
+
+var (
+	ErrInvalidCookie = errors.New("sessions: invalid or tampered session cookie") // the cookie wasn't made by this Store, or with its keys.
+	ErrExpired       = errors.New("sessions: session cookie expired")             // the session was last saved more than Store.MaxAge ago.
+	ErrTooLarge      = errors.New("sessions: session too large for a cookie")     // store less in the session.
+)
+
+// maxCookieBytes is the most browsers reliably store for a single cookie, name and attributes included.
+const maxCookieBytes = 4096
+
+// Session is a set of string key-value pairs that persists across requests, plus flash messages that last until they're read.
+// A Session is not safe for concurrent use.
+type Session struct {
+	values  map[string]string
+	flashes []string
+	changed bool
+}
+
+// Get returns the value for key, or "" if there is none.
+func (s *Session) Get(key string) string { return s.values[key] }
+
+// Set sets the value for key.
+func (s *Session) Set(key, value string) {
+	if s.values == nil {
+		s.values = make(map[string]string)
+	}
+	s.values[key] = value
+	s.changed = true
+}
+
+// Delete removes key.
+func (s *Session) Delete(key string) {
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.changed = true
+	}
+}
+
+// Clear removes everything from the session, flash messages included: i.e, on logout.
+func (s *Session) Clear() {
+	if len(s.values) > 0 || len(s.flashes) > 0 {
+		s.values, s.flashes, s.changed = nil, nil, true
+	}
+}
+
+// AddFlash adds a message to show on the next page the user sees: i.e, "your changes were saved" after a redirect.
+func (s *Session) AddFlash(msg string) {
+	s.flashes = append(s.flashes, msg)
+	s.changed = true
+}
+
+// Flashes returns and removes the session's flash messages, so each is seen only once.
+func (s *Session) Flashes() []string {
+	f := s.flashes
+	if len(f) > 0 {
+		s.flashes, s.changed = nil, true
+	}
+	return f
+}
+
+// payload is the wire format of a session, before signing and encryption.
+type payload struct {
+	Values  map[string]string `json:"v,omitempty"`
+	Flashes []string          `json:"f,omitempty"`
+}
+
+// Store loads and saves sessions in a cookie. Create one with NewStore.
+// The exported fields set the cookie's attributes; change them before using the Store.
+type Store struct {
+	Name     string        // the cookie's name.
+	MaxAge   time.Duration // how long a session lasts after it was last saved. Enforced by the server, not just the browser.
+	Path     string        // defaults to "/".
+	Domain   string
+	Secure   bool // only send the cookie over HTTPS. Leave it on outside of local development.
+	SameSite http.SameSite
+
+	hashKey []byte
+	aead    cipher.AEAD // nil if the session is only signed.
+}
+
+// NewStore returns a Store that signs its cookies with hashKey using HMAC-SHA256, and, if encKey is non-nil,
+// encrypts them with AES-GCM, so the client can't read them either.
+// hashKey should be at least 32 random bytes; encKey must be 16, 24, or 32 random bytes, for AES-128, -192, or -256.
+// Anyone with hashKey can forge sessions: keep it secret, and keep it the same across restarts and servers, or everyone gets logged out.
+func NewStore(name string, hashKey, encKey []byte) (*Store, error) {
+	if name == "" || len(hashKey) == 0 {
+		return nil, errors.New("sessions: NewStore: name and hashKey are required")
+	}
+	s := &Store{Name: name, MaxAge: 30 * 24 * time.Hour, Path: "/", Secure: true, SameSite: http.SameSiteLaxMode, hashKey: hashKey}
+	if encKey != nil {
+		block, err := aes.NewCipher(encKey)
+		if err != nil {
+			return nil, fmt.Errorf("sessions: NewStore: encKey: %w", err)
+		}
+		if s.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, fmt.Errorf("sessions: NewStore: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// mac signs the cookie's name and value together, so a valid value can't be moved to another cookie.
+func (s *Store) mac(value string) []byte {
+	m := hmac.New(sha256.New, s.hashKey)
+	m.Write([]byte(s.Name + "|" + value))
+	return m.Sum(nil)
+}
+
+// encode turns a session into a cookie value: base64(timestamp || body) + "." + base64(signature),
+// where body is the JSON of the session, encrypted if the store has an encryption key.
+func (s *Store) encode(sess *Session, now time.Time) (string, error) {
+	body, err := json.Marshal(payload{Values: sess.values, Flashes: sess.flashes})
+	if err != nil {
+		return "", err
+	}
+	if s.aead != nil {
+		nonce := make([]byte, s.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+		body = s.aead.Seal(nonce, nonce, body, []byte(s.Name))
+	}
+	b := binary.BigEndian.AppendUint64(nil, uint64(now.Unix()))
+	value := base64.RawURLEncoding.EncodeToString(append(b, body...))
+	return value + "." + base64.RawURLEncoding.EncodeToString(s.mac(value)), nil
+}
+
+// decode is the inverse of encode, checking the signature and age.
+func (s *Store) decode(cookie string, now time.Time) (*Session, error) {
+	value, sig, ok := strings.Cut(cookie, ".")
+	if !ok {
+		return nil, ErrInvalidCookie
+	}
+	gotMAC, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(gotMAC, s.mac(value)) {
+		return nil, ErrInvalidCookie
+	}
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(b) < 8 {
+		return nil, ErrInvalidCookie
+	}
+	if saved := time.Unix(int64(binary.BigEndian.Uint64(b)), 0); s.MaxAge > 0 && now.Sub(saved) > s.MaxAge {
+		return nil, ErrExpired
+	}
+	body := b[8:]
+	if s.aead != nil {
+		n := s.aead.NonceSize()
+		if len(body) < n {
+			return nil, ErrInvalidCookie
+		}
+		if body, err = s.aead.Open(nil, body[:n], body[n:], []byte(s.Name)); err != nil {
+			return nil, ErrInvalidCookie
+		}
+	}
+	var p payload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, ErrInvalidCookie
+	}
+	return &Session{values: p.Values, flashes: p.Flashes}, nil
+}
+
+// Load returns the request's session. A request without a session cookie gets a new, empty session.
+// So does a request with an invalid or expired one, along with ErrInvalidCookie or ErrExpired.
+func (s *Store) Load(r *http.Request) (*Session, error) {
+	c, err := r.Cookie(s.Name)
+	if err != nil {
+		return new(Session), nil
+	}
+	sess, err := s.decode(c.Value, time.Now())
+	if err != nil {
+		return &Session{changed: true}, err // changed, so that saving it replaces the bad cookie.
+	}
+	return sess, nil
+}
+
+// Save writes sess to w as a Set-Cookie header. An empty session deletes the cookie.
+// Like any header, it has to be set before the response's status code is written.
+func (s *Store) Save(w http.ResponseWriter, sess *Session) error {
+	c := &http.Cookie{Name: s.Name, Path: s.Path, Domain: s.Domain, Secure: s.Secure, HttpOnly: true, SameSite: s.SameSite}
+	if len(sess.values) == 0 && len(sess.flashes) == 0 {
+		c.MaxAge = -1
+	} else {
+		value, err := s.encode(sess, time.Now())
+		if err != nil {
+			return fmt.Errorf("sessions: encoding session: %w", err)
+		}
+		c.Value, c.MaxAge = value, int(s.MaxAge/time.Second)
+	}
+	switch v := c.String(); {
+	case v == "":
+		return fmt.Errorf("sessions: invalid cookie name %q", s.Name)
+	case len(v) > maxCookieBytes:
+		return fmt.Errorf("%w: %d bytes", ErrTooLarge, len(v))
+	}
+	http.SetCookie(w, c)
+	sess.changed = false
+	return nil
+}
+
+// FromContext returns the session that Middleware loaded for the request, or nil if there isn't one.
+func FromContext(r *http.Request) *Session {
+	sess, _ := ctxutil.Value[*Session](r.Context())
+	return sess
+}
+
+// Middleware returns a middleware that loads each request's session into its context, for FromContext,
+// and saves it again, if it changed, just before the response's headers are written.
+// Changes after that are lost: i.e, read the flashes before writing the page that shows them.
+// A bad or expired cookie is logged and replaced with a fresh session, rather than failing the request.
+func (s *Store) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, err := s.Load(r)
+		if err != nil {
+			middleware.LogOrDefault(r.Context()).InfoContext(r.Context(), "sessions: discarding session cookie", "err", err)
+		}
+		sw := &saveWriter{ResponseWriter: w, store: s, sess: sess, r: r}
+		h.ServeHTTP(sw, r.WithContext(ctxutil.WithValue(r.Context(), sess)))
+		sw.save() // if the handler never wrote anything.
+	})
+}
+
+// saveWriter saves the session the first time the response is written to.
+type saveWriter struct {
+	http.ResponseWriter
+	store *Store
+	sess  *Session
+	r     *http.Request
+	saved bool
+}
+
+func (w *saveWriter) save() {
+	if w.saved {
+		return
+	}
+	w.saved = true
+	if !w.sess.changed {
+		return
+	}
+	if err := w.store.Save(w.ResponseWriter, w.sess); err != nil {
+		middleware.LogOrDefault(w.r.Context()).ErrorContext(w.r.Context(), "sessions: saving session", "err", err)
+	}
+}
+
+func (w *saveWriter) WriteHeader(statusCode int) {
+	w.save()
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *saveWriter) Write(b []byte) (int, error) {
+	w.save()
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying response writer, for http.ResponseController.
+func (w *saveWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
@@ -0,0 +1,148 @@
+package sessions
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSession(t *testing.T) {
+	hashKey := []byte("0123456789abcdef0123456789abcdef")
+	for _, encKey := range [][]byte{nil, []byte("fedcba9876543210")} {
+		t.Run(fmt.Sprintf("encrypted=%v", encKey != nil), func(t *testing.T) {
+			store, err := NewStore("session", hashKey, encKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := store.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sess := FromContext(r)
+				switch r.URL.Path {
+				case "/login":
+					sess.Set("user", "efron")
+					sess.AddFlash("welcome back!")
+				case "/logout":
+					sess.Clear()
+				}
+				fmt.Fprintf(w, "user=%s flashes=%v", sess.Get("user"), sess.Flashes())
+			}))
+			var cookies []*http.Cookie
+			get := func(path string) string {
+				req := httptest.NewRequest("GET", path, nil)
+				for _, c := range cookies {
+					req.AddCookie(c)
+				}
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, req)
+				if got := rec.Result().Cookies(); len(got) > 0 {
+					cookies = got
+					if got[0].MaxAge < 0 {
+						cookies = nil
+					}
+				}
+				return rec.Body.String()
+			}
+			for _, tt := range []struct{ path, want string }{
+				{"/", "user= flashes=[]"},
+				{"/login", "user=efron flashes=[welcome back!]"},
+				{"/", "user=efron flashes=[]"}, // the flash was already shown.
+				{"/logout", "user= flashes=[]"},
+				{"/", "user= flashes=[]"},
+			} {
+				if got := get(tt.path); got != tt.want {
+					t.Errorf("GET %s: got %q, want %q", tt.path, got, tt.want)
+				}
+			}
+			// login sets a cookie; the next request reads the flash, so the cookie's saved again; logout deletes it.
+			if cookies != nil {
+				t.Errorf("got cookies %v after logout, want none", cookies)
+			}
+
+			// the client can read a signed session, but not an encrypted one.
+			rec := httptest.NewRecorder()
+			sess := new(Session)
+			sess.Set("user", "efron")
+			if err := store.Save(rec, sess); err != nil {
+				t.Fatal(err)
+			}
+			c := rec.Result().Cookies()[0]
+			if visible := strings.Contains(decodeForTest(t, c.Value), "efron"); visible != (encKey == nil) {
+				t.Errorf("session visible to client: %v, want %v", visible, encKey == nil)
+			}
+			if !c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteLaxMode || c.Path != "/" {
+				t.Errorf("got cookie attributes %v, want HttpOnly, Secure, SameSite=Lax, Path=/", c)
+			}
+		})
+	}
+}
+
+func TestSessionTampering(t *testing.T) {
+	store, err := NewStore("session", []byte("0123456789abcdef0123456789abcdef"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewStore("session", []byte("a different key, a different key"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	sess := new(Session)
+	sess.Set("user", "efron")
+	good, err := store.encode(sess, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := other.encode(sess, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := store.encode(sess, now.Add(-store.MaxAge-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, sig, _ := strings.Cut(good, ".")
+	edited := []byte(value)
+	edited[len(edited)-1] ^= 1 // flip a bit.
+	for _, tt := range []struct {
+		name, cookie string
+		want         error
+	}{
+		{"good", good, nil},
+		{"forged", forged, ErrInvalidCookie},
+		{"edited", string(edited) + "." + sig, ErrInvalidCookie},
+		{"no signature", value, ErrInvalidCookie},
+		{"garbage", "not.a.cookie", ErrInvalidCookie},
+		{"expired", old, ErrExpired},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(&http.Cookie{Name: "session", Value: tt.cookie})
+		got, err := store.Load(req)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.want)
+		}
+		if wantUser := map[bool]string{true: "efron"}[tt.want == nil]; got.Get("user") != wantUser {
+			t.Errorf("%s: got user %q, want %q", tt.name, got.Get("user"), wantUser)
+		}
+	}
+
+	// too big for a cookie.
+	sess.Set("big", strings.Repeat("x", maxCookieBytes))
+	if err := store.Save(httptest.NewRecorder(), sess); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("got %v, want ErrTooLarge", err)
+	}
+}
+
+// decodeForTest returns the base64-decoded value part of a cookie, signature removed.
+func decodeForTest(t *testing.T, cookie string) string {
+	t.Helper()
+	value, _, _ := strings.Cut(cookie, ".")
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
@@ -1,20 +1,23 @@
 package backendbasics
 
 import (
+	"fmt"
 	"strings"
 )
 
+// Escape escapes everything but the unreserved characters, so the result is safe anywhere in a URL. If s already looks escaped, it's returned as-is.
+// That's more than you usually need: a '/' in a path or a '?' in a query string doesn't have to be escaped. See EscapePath, EscapeQuery, and EscapeFragment.
 func Escape(s string) string {
 	// check if s is already url-escaped
 	for i := range s {
 		switch {
-		case s[i] == '%' && i > len(s)-2: // not enough characters left to be a valid escape sequence
+		case s[i] == '%' && i > len(s)-3: // not enough characters left to be a valid escape sequence
 			return newEscaped(s)
 		case 'a' <= s[i] && s[i] <= 'z', // lowercase ascii letters
 			'A' <= s[i] && s[i] <= 'Z',                         // uppercase ascii letters
 			'0' <= s[i] && s[i] <= '9',                         // digits
 			s[i] == '-', s[i] == '.', s[i] == '_', s[i] == '~', // unreserved characters
-			s[i] == '%' && percentToByte[s[i+1:i+3]] != 0: // valid escape sequence
+			s[i] == '%' && isEscape(s[i:i+3]): // valid escape sequence
 		default:
 			return newEscaped(s)
 		}
@@ -22,29 +25,39 @@ func Escape(s string) string {
 	return s // s is already url-escaped
 }
 
-func Unescape(s string) string {
+// Unescape decodes escape sequences like "%2F". Anything that isn't a valid escape sequence, like a lone '%', is left as-is.
+func Unescape(s string) string { return unescape(s, false) }
+
+// UnescapeForm is Unescape, but a '+' is a space, as in HTML form data and query strings: "a+b%2Bc" is "a b+c".
+func UnescapeForm(s string) string { return unescape(s, true) }
+
+func unescape(s string, plusAsSpace bool) string {
 	// check if s actually needs to be unescaped
 	for i := range s {
 		// if we find a %, and there are at least two characters left, and the next two characters are valid hex digits, then s needs to be unescaped
-		if s[i] == '%' && i < len(s)-2 {
-			return newUnescaped(s)
+		if s[i] == '%' && i < len(s)-2 || s[i] == '+' && plusAsSpace {
+			return newUnescaped(s, plusAsSpace)
 		}
 	}
 	return s // s is already url-unescaped
 }
 
-func newUnescaped(s string) string {
+func newUnescaped(s string, plusAsSpace bool) string {
 	buf := new(strings.Builder)
 	buf.Grow(len(s))
 	for i := 0; i < len(s); {
 		if s[i] == '%' && i < len(s)-2 {
-			if b, ok := percentToByte[s[i+1:i+3]]; ok {
+			if b, ok := unescapeByte(s[i : i+3]); ok {
 				buf.WriteByte(b)
 				i += 3
 				continue
 			}
 		}
-		buf.WriteByte(s[i])
+		if s[i] == '+' && plusAsSpace {
+			buf.WriteByte(' ')
+		} else {
+			buf.WriteByte(s[i])
+		}
 		i++
 	}
 	return buf.String()
@@ -69,3 +82,224 @@ func newEscaped(s string) string {
 	}
 	return buf.String()
 }
+
+// EscapePath, EscapeQuery, and EscapeFragment escape an unescaped string for one part of a URL, per RFC 3986, section 3:
+// they escape whatever would be taken as a delimiter in that part, and nothing else. A '%' is always escaped, since their input isn't escaped yet.
+
+// EscapePath escapes a path, keeping its '/'s: "/a b/c?" is "/a%20b/c%3F". To put a '/' inside a segment, escape the segment with Escape first.
+func EscapePath(s string) string { return escape(s, componentPath) }
+
+// EscapeQuery escapes a key or value in a query string: '&', '=', '+', and ';' are escaped, so "a=b&c" is "a%3Db%26c".
+// Spaces become "%20" rather than '+': UnescapeForm and Unescape both decode that right.
+func EscapeQuery(s string) string { return escape(s, componentQuery) }
+
+// EscapeFragment escapes a fragment, the part after the '#'.
+func EscapeFragment(s string) string { return escape(s, componentFragment) }
+
+// component is a part of a URL with its own idea of which characters need escaping.
+type component int
+
+const (
+	componentPath component = iota
+	componentQuery
+	componentFragment
+)
+
+// allowed reports whether c can appear unescaped in the component.
+func (comp component) allowed(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '.', c == '_', c == '~': // unreserved: allowed everywhere.
+		return true
+	case c == ':', c == '@', c == '!', c == '$', c == '\'', c == '(', c == ')', c == '*', c == ',': // the rest of pchar, less the sub-delims that mean something in a query.
+		return true
+	case c == '/':
+		return true
+	case c == '&', c == '=', c == '+', c == ';': // sub-delims: data in a path or fragment, but separators in a query.
+		return comp != componentQuery
+	case c == '?':
+		return comp != componentPath
+	}
+	return false
+}
+
+func escape(s string, comp component) string {
+	for i := 0; i < len(s); i++ {
+		if !comp.allowed(s[i]) {
+			buf := new(strings.Builder)
+			buf.Grow(len(s) + 8)
+			buf.WriteString(s[:i])
+			for ; i < len(s); i++ {
+				if comp.allowed(s[i]) {
+					buf.WriteByte(s[i])
+				} else {
+					buf.WriteString(byteToPercent[s[i]])
+				}
+			}
+			return buf.String()
+		}
+	}
+	return s // nothing to escape.
+}
+
+// unescapeByte decodes a three-byte escape sequence like "%2F" or "%2f", returning false if it isn't one.
+func unescapeByte(seq string) (byte, bool) {
+	if b, ok := percentToByte[seq]; ok {
+		return b, true
+	}
+	b, ok := percentToByte[strings.ToUpper(seq)] // lowercase hex is just as valid: RFC 3986, section 2.1.
+	return b, ok
+}
+
+// isEscape reports whether seq is a three-byte escape sequence like "%2F".
+func isEscape(seq string) bool { _, ok := unescapeByte(seq); return ok }
+
+// URL is a URL broken into its parts, as in
+//
+//	scheme://user@host:port/path/to/thing?key=value&key=other#fragment
+//
+// See RFC 3986. The Raw fields are the escaped forms, exactly as they appeared; the others are unescaped.
+type URL struct {
+	Scheme      string // "https", lowercased. Empty for a relative URL like "/path?q=1".
+	User        string // the userinfo before the '@', if any: "user" or "user:password".
+	RawUser     string
+	Host        string // the host and the port, if any: "eblog.fly.dev", "localhost:8080", or "[::1]:8080". Left as-is: hosts aren't escaped.
+	Path        string // "/path/to/thing".
+	RawPath     string
+	Query       Values // {"key": ["value", "other"]}.
+	RawQuery    string // "key=value&key=other", without the '?'.
+	Fragment    string
+	RawFragment string
+}
+
+// Values are the parsed key-value pairs of a query string, like url.Values. A key can have more than one value.
+type Values map[string][]string
+
+// Get returns the first value for key, or "" if there isn't one.
+func (v Values) Get(key string) string {
+	if vs := v[key]; len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+// ParseURL breaks s into its parts. It splits first and unescapes second, so an escaped delimiter like "%2F" or "%3F" doesn't split anything:
+// it's part of whatever it's in. It returns an error for a malformed escape sequence, a scheme with characters a scheme can't have,
+// or a query with a ';' in it (some servers split on them and some don't, so net/url rejects them too).
+func ParseURL(s string) (*URL, error) {
+	if err := checkEscapes(s); err != nil {
+		return nil, err
+	}
+	u, orig := new(URL), s
+	// the order matters: '#' ends everything, then '?' ends the path. See RFC 3986, appendix B.
+	s, u.RawFragment, _ = strings.Cut(s, "#")
+	s, u.RawQuery, _ = strings.Cut(s, "?")
+	if i := strings.IndexAny(s, ":/"); i > 0 && s[i] == ':' { // a ':' before the first '/' ends the scheme.
+		if !validScheme(s[:i]) {
+			return nil, fmt.Errorf("parse url %q: invalid scheme %q", orig, s[:i])
+		}
+		u.Scheme, s = strings.ToLower(s[:i]), s[i+1:]
+	}
+	if rest, ok := strings.CutPrefix(s, "//"); ok { // authority: [user@]host[:port]
+		authority := rest
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			authority, rest = rest[:i], rest[i:]
+		} else {
+			rest = ""
+		}
+		if i := strings.LastIndexByte(authority, '@'); i >= 0 {
+			u.RawUser, authority = authority[:i], authority[i+1:]
+			u.User = Unescape(u.RawUser)
+		}
+		u.Host, s = authority, rest
+	}
+	u.RawPath, u.Path = s, Unescape(s)
+	u.Fragment = Unescape(u.RawFragment)
+	var err error
+	if u.Query, err = parseQuery(u.RawQuery); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Segments returns the path's segments, unescaped: "/a/b%2Fc/" has the segments ["a", "b/c", ""].
+// They're split before they're unescaped, so an escaped slash stays inside its segment.
+func (u *URL) Segments() []string {
+	raw := strings.TrimPrefix(u.RawPath, "/")
+	if raw == "" {
+		return nil
+	}
+	segments := strings.Split(raw, "/")
+	for i := range segments {
+		segments[i] = Unescape(segments[i])
+	}
+	return segments
+}
+
+// String puts the URL back together from its Raw fields; ParseURL(u.String()) gets the same URL back.
+func (u *URL) String() string {
+	var b strings.Builder
+	if u.Scheme != "" {
+		b.WriteString(u.Scheme)
+		b.WriteByte(':')
+	}
+	if u.Host != "" || u.RawUser != "" {
+		b.WriteString("//")
+		if u.RawUser != "" {
+			b.WriteString(u.RawUser)
+			b.WriteByte('@')
+		}
+		b.WriteString(u.Host)
+	}
+	b.WriteString(u.RawPath)
+	if u.RawQuery != "" {
+		b.WriteByte('?')
+		b.WriteString(u.RawQuery)
+	}
+	if u.RawFragment != "" {
+		b.WriteByte('#')
+		b.WriteString(u.RawFragment)
+	}
+	return b.String()
+}
+
+// parseQuery parses a query string like "a=1&b=2&a=3" into Values. A '+' is a space, as in HTML forms.
+func parseQuery(raw string) (Values, error) {
+	q := make(Values)
+	for raw != "" {
+		var pair string
+		pair, raw, _ = strings.Cut(raw, "&")
+		if strings.Contains(pair, ";") {
+			return nil, fmt.Errorf("parse query: invalid semicolon separator in %q", pair)
+		}
+		if pair == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(pair, "=")
+		k, v = UnescapeForm(k), UnescapeForm(v)
+		q[k] = append(q[k], v)
+	}
+	return q, nil
+}
+
+// checkEscapes returns an error if s has a '%' that isn't followed by two hex digits.
+func checkEscapes(s string) error {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && (i > len(s)-3 || !isEscape(s[i:i+3])) {
+			return fmt.Errorf("parse url %q: invalid escape sequence %q", s, s[i:min(i+3, len(s))])
+		}
+	}
+	return nil
+}
+
+// validScheme reports whether s is a scheme: a letter, then letters, digits, '+', '-', or '.'. See RFC 3986, section 3.1.
+func validScheme(s string) bool {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case i > 0 && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
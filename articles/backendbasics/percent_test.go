@@ -1 +1,178 @@
 package backendbasics
+
+import (
+	"math/rand"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnescape(t *testing.T) {
+	for input, want := range map[string]string{
+		"":              "",
+		"plain":         "plain",
+		"a%20b":         "a b",
+		"a%2fb%2Fc":     "a/b/c",
+		"100%":          "100%",
+		"%zz":           "%zz",
+		"%E2%98%83":     "☃",
+		"trailing%2":    "trailing%2",
+		"%2520":         "%20",
+		"a+b":           "a+b",
+		"%41%42%43%44x": "ABCDx",
+	} {
+		if got := Unescape(input); got != want {
+			t.Errorf("Unescape(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestUnescapeForm(t *testing.T) {
+	for input, want := range map[string]string{
+		"a+b":      "a b",
+		"a%2Bb":    "a+b",
+		"a+b%2Bc+": "a b+c ",
+		"%zz+":     "%zz ",
+		"plain":    "plain",
+	} {
+		if got := UnescapeForm(input); got != want {
+			t.Errorf("UnescapeForm(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestEscapeComponents(t *testing.T) {
+	for _, tt := range []struct {
+		escape      func(string) string
+		name        string
+		input, want string
+	}{
+		{EscapePath, "EscapePath", "/a b/c?d#e", "/a%20b/c%3Fd%23e"},
+		{EscapePath, "EscapePath", "/x=1&y+z;@:", "/x=1&y+z;@:"},
+		{EscapePath, "EscapePath", "/100%", "/100%25"},
+		{EscapeQuery, "EscapeQuery", "a=b&c+d;e", "a%3Db%26c%2Bd%3Be"},
+		{EscapeQuery, "EscapeQuery", "/path?q:@", "/path?q:@"},
+		{EscapeQuery, "EscapeQuery", "a b", "a%20b"},
+		{EscapeFragment, "EscapeFragment", "sec/1?x=y&z#2", "sec/1?x=y&z%232"},
+		{EscapeFragment, "EscapeFragment", "☃", "%E2%98%83"},
+	} {
+		if got := tt.escape(tt.input); got != tt.want {
+			t.Errorf("%s(%q) = %q, want %q", tt.name, tt.input, got, tt.want)
+		}
+	}
+
+	// whatever we escape, net/url and ParseURL should both decode back to what we started with.
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 2000; i++ {
+		path, key, val, frag := "/"+randString(rng, urlChars, 12), randString(rng, urlChars, 8), randString(rng, urlChars, 8), randString(rng, urlChars, 8)
+		s := "http://x" + EscapePath(path) + "?" + EscapeQuery(key) + "=" + EscapeQuery(val) + "#" + EscapeFragment(frag)
+		want, err := url.Parse(s)
+		if err != nil {
+			t.Fatalf("net/url can't parse %q: %v", s, err)
+		}
+		if want.Path != path || want.Fragment != frag || !reflect.DeepEqual(want.Query(), url.Values{key: {val}}) {
+			t.Fatalf("net/url parsed %q as %#+v", s, want)
+		}
+		got, err := ParseURL(s)
+		if err != nil {
+			t.Fatalf("ParseURL(%q) returned error: %v", s, err)
+		}
+		if got.Path != path || got.Fragment != frag || !reflect.DeepEqual(got.Query, Values{key: {val}}) {
+			t.Fatalf("ParseURL(%q) = %#+v", s, got)
+		}
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	for input, want := range map[string]*URL{
+		"https://user:pw@eblog.fly.dev:8080/a/b%2Fc?q=x+y&q=%2B#top%20": {
+			Scheme: "https", User: "user:pw", RawUser: "user:pw", Host: "eblog.fly.dev:8080",
+			Path: "/a/b/c", RawPath: "/a/b%2Fc",
+			Query: Values{"q": {"x y", "+"}}, RawQuery: "q=x+y&q=%2B",
+			Fragment: "top ", RawFragment: "top%20",
+		},
+		"/just/a/path":    {Path: "/just/a/path", RawPath: "/just/a/path", Query: Values{}},
+		"HTTP://[::1]:80": {Scheme: "http", Host: "[::1]:80", Query: Values{}},
+		"mailto:efron@example.com": {
+			Scheme: "mailto", Path: "efron@example.com", RawPath: "efron@example.com", Query: Values{},
+		},
+		"?a&b=&=c": {Query: Values{"a": {""}, "b": {""}, "": {"c"}}, RawQuery: "a&b=&=c"},
+	} {
+		got, err := ParseURL(input)
+		if err != nil {
+			t.Errorf("ParseURL(%q) returned error: %v", input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseURL(%q) = %#+v, want %#+v", input, got, want)
+		}
+	}
+
+	for _, input := range []string{"http://x/%zz", "http://x/%2", "1http://x/", "/?a=1;b=2"} {
+		if _, err := ParseURL(input); err == nil {
+			t.Errorf("ParseURL(%q) should have returned an error", input)
+		}
+	}
+
+	u, _ := ParseURL("/a/b%2Fc/")
+	if got, want := u.Segments(), []string{"a", "b/c", ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Segments() = %q, want %q", got, want)
+	}
+}
+
+// TestParseURLMatchesNetURL builds random URLs with net/url and checks that ParseURL takes them apart the same way it does.
+func TestParseURLMatchesNetURL(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randString := func(alphabet string, n int) string { return randString(rng, alphabet, n) }
+	for i := 0; i < 2000; i++ {
+		query := url.Values{}
+		for j := rng.Intn(4); j > 0; j-- {
+			query.Add(randString(urlChars, 6), randString(urlChars, 6))
+		}
+		want := &url.URL{
+			Scheme:   randString("abc", 1) + "x" + randString("abc019+-.", 4),
+			Host:     randString("abcdefghijklmnopqrstuvwxyz0123456789.-", 12) + "z",
+			Path:     "/" + randString(urlChars, 12),
+			RawQuery: query.Encode(),
+			Fragment: randString(urlChars, 8),
+		}
+		if rng.Intn(2) == 0 {
+			want.User = url.User(randString(urlChars, 6))
+		}
+		if rng.Intn(2) == 0 {
+			want.Host += ":8080"
+		}
+		s := want.String()
+		if _, err := url.Parse(s); err != nil {
+			t.Fatalf("test is broken: net/url can't parse its own %q: %v", s, err)
+		}
+		got, err := ParseURL(s)
+		if err != nil {
+			t.Fatalf("ParseURL(%q) returned error: %v", s, err)
+		}
+		if got.Scheme != want.Scheme || got.User != want.User.Username() || got.Host != want.Host ||
+			got.Path != want.Path || got.Fragment != want.Fragment || got.RawQuery != want.RawQuery {
+			t.Fatalf("ParseURL(%q) = %#+v, but net/url has %#+v", s, got, want)
+		}
+		if !reflect.DeepEqual(map[string][]string(got.Query), map[string][]string(query)) {
+			t.Fatalf("ParseURL(%q).Query = %q, but net/url has %q", s, got.Query, query)
+		}
+		if again, err := ParseURL(got.String()); err != nil || !reflect.DeepEqual(again, got) {
+			t.Fatalf("ParseURL(%q) = %#+v, but ParseURL(%q) = %#+v, %v", s, got, got.String(), again, err)
+		}
+	}
+}
+
+// urlChars has a bit of everything that means something in a URL, plus some non-ASCII.
+const urlChars = "abcXYZ019 -._~!$&'()*+,;=:@/?#[]%\"<>\\^`{|}☃é"
+
+// randString returns up to n runes from alphabet.
+func randString(rng *rand.Rand, alphabet string, n int) string {
+	runes := []rune(alphabet)
+	var b strings.Builder
+	for i := rng.Intn(n + 1); i > 0; i-- {
+		b.WriteRune(runes[rng.Intn(len(runes))])
+	}
+	return b.String()
+}
@@ -0,0 +1,301 @@
+package backendbasics
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// SAN returns m in Standard Algebraic Notation, as used in PGN: "e4", "Nbd7", "exd5", "O-O", "e8=Q+", "Qh4#".
+// m must be legal in p.
+func (p Position) SAN(m Move) string {
+	pc := p.at(m.From)
+	var b strings.Builder
+	switch {
+	case pc.kind() == whiteKing && m.To.X-m.From.X == 2:
+		b.WriteString("O-O")
+	case pc.kind() == whiteKing && m.From.X-m.To.X == 2:
+		b.WriteString("O-O-O")
+	default:
+		capture := p.at(m.To) != empty || (pc.kind() == whitePawn && m.From.X != m.To.X)
+		if pc.kind() == whitePawn {
+			if capture {
+				b.WriteByte('a' + byte(m.From.X))
+			}
+		} else {
+			b.WriteByte(letter(pc))
+			b.WriteString(p.disambiguate(m))
+		}
+		if capture {
+			b.WriteByte('x')
+		}
+		b.WriteString(m.To.String())
+		if m.Promotion != empty {
+			b.WriteByte('=')
+			b.WriteByte(letter(m.Promotion))
+		}
+	}
+	switch next := p.apply(m); {
+	case next.InCheck() && len(next.LegalMoves()) == 0:
+		b.WriteByte('#')
+	case next.InCheck():
+		b.WriteByte('+')
+	}
+	return b.String()
+}
+
+// disambiguate returns what SAN needs to tell m apart from any other legal move of the same kind of piece to the same square:
+// the file if that's enough, then the rank, then both.
+func (p Position) disambiguate(m Move) string {
+	var sameFile, sameRank, ambiguous bool
+	for _, other := range p.LegalMoves() {
+		if other.To != m.To || other.From == m.From || p.at(other.From) != p.at(m.From) {
+			continue
+		}
+		ambiguous = true
+		sameFile = sameFile || other.From.X == m.From.X
+		sameRank = sameRank || other.From.Y == m.From.Y
+	}
+	switch {
+	case !ambiguous:
+		return ""
+	case !sameFile:
+		return m.From.String()[:1]
+	case !sameRank:
+		return m.From.String()[1:]
+	default:
+		return m.From.String()
+	}
+}
+
+// letter is pc's uppercase FEN letter, or '?' if it isn't a piece at all: i.e, a Promotion straight off the wire.
+func letter(pc piece) byte {
+	if k := pc.kind(); int(k) < len(fenPieces) {
+		return fenPieces[k]
+	}
+	return '?'
+}
+
+// ParseSAN finds the legal move in p that san describes. Check and annotation marks, like "+", "#", "!", or "?!", are optional.
+func (p Position) ParseSAN(san string) (Move, error) {
+	want := strings.TrimRight(san, "+#!?")
+	want = strings.ReplaceAll(want, "0", "O") // some programs castle with zeroes.
+	for _, m := range p.LegalMoves() {
+		if strings.TrimRight(p.SAN(m), "+#") == want {
+			return m, nil
+		}
+	}
+	return Move{}, fmt.Errorf("no legal move %q in %s", san, p.FEN())
+}
+
+// Replay plays moves from start, returning every position along the way: positions[0] is start, and positions[i] is after the i'th move.
+func Replay(start Position, moves []Move) (positions []Position, err error) {
+	positions = append(positions, start)
+	for i, m := range moves {
+		next, err := NextMove(positions[i], m)
+		if err != nil {
+			return positions, fmt.Errorf("replay: move %d: %w", i+1, err)
+		}
+		positions = append(positions, next)
+	}
+	return positions, nil
+}
+
+// Result is the game's result as PGN writes it: "1-0" if white won, "0-1" if black did, "1/2-1/2" for a draw, or "*" if it's still going.
+func (p Position) Result() string {
+	switch p.Status() {
+	case Ongoing:
+		return "*"
+	case Checkmate:
+		if p.WhiteToMove {
+			return "0-1"
+		}
+		return "1-0"
+	default:
+		return "1/2-1/2"
+	}
+}
+
+// PGN returns the game in Portable Game Notation: its players and result, then its moves in SAN, i.e,
+//
+//	[White "efron"]
+//	[Black "bobross"]
+//	[Result "*"]
+//
+//	1. e4 e5 2. Nf3 *
+//
+// A game that didn't start from StartPosition gets a FEN tag, too. See ParsePGN and https://www.saremba.de/chessgml/standards/pgn/pgn-complete.htm.
+// It returns an error if g.Moves can't be replayed from g.Start.
+func (g *Game) PGN() (string, error) {
+	positions, err := Replay(g.Start, g.Moves)
+	if err != nil {
+		return "", err
+	}
+	end := positions[len(positions)-1]
+	var b strings.Builder
+	for _, tag := range [][2]string{{"White", g.White}, {"Black", g.Black}, {"Result", end.Result()}} {
+		if tag[1] == "" {
+			tag[1] = "?" // PGN's "unknown".
+		}
+		fmt.Fprintf(&b, "[%s %q]\n", tag[0], tag[1])
+	}
+	if g.Start != StartPosition() {
+		fmt.Fprintf(&b, "[SetUp \"1\"]\n[FEN %q]\n", g.Start.FEN())
+	}
+	b.WriteByte('\n')
+	for i, m := range g.Moves {
+		p := positions[i]
+		switch {
+		case p.WhiteToMove:
+			fmt.Fprintf(&b, "%d. ", p.FullMoves)
+		case i == 0: // black moves first: mark white's move as skipped.
+			fmt.Fprintf(&b, "%d... ", p.FullMoves)
+		}
+		b.WriteString(p.SAN(m))
+		b.WriteByte(' ')
+	}
+	b.WriteString(end.Result())
+	b.WriteByte('\n')
+	return b.String(), nil
+}
+
+// ParsePGN parses a game in Portable Game Notation, as written by Game.PGN or most chess programs: see https://www.saremba.de/chessgml/standards/pgn/pgn-complete.htm.
+// It reads the White, Black, and FEN tags and ignores the rest, along with comments, variations, and annotations.
+// Only the first game is parsed. The Game's ID is left empty.
+func ParsePGN(s string) (*Game, error) {
+	g := &Game{Start: StartPosition()}
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	i := 0
+	for ; i < len(lines); i++ { // tags: [Name "value"]
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "[") {
+			break
+		}
+		name, value, ok := strings.Cut(strings.Trim(line, "[]"), " ")
+		if !ok {
+			return nil, fmt.Errorf("parse pgn: malformed tag %q", line)
+		}
+		value, err := strconv.Unquote(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("parse pgn: malformed tag %q: %w", line, err)
+		}
+		switch name {
+		case "White":
+			g.White = value
+		case "Black":
+			g.Black = value
+		case "FEN":
+			if g.Start, err = ParseFEN(value); err != nil {
+				return nil, fmt.Errorf("parse pgn: %w", err)
+			}
+		}
+	}
+	g.Position = g.Start
+	for _, tok := range pgnTokens(strings.Join(lines[i:], "\n")) {
+		switch {
+		case tok == "1-0", tok == "0-1", tok == "1/2-1/2", tok == "*": // the result: the game's over.
+			return g, nil
+		case tok[0] == '$': // a numeric annotation, like $1 for "good move".
+			continue
+		case '0' <= tok[0] && tok[0] <= '9' && strings.Trim(tok, "0123456789.") == "": // a move number, like "12." or "12...".
+			continue
+		}
+		tok = strings.TrimLeft(tok, "0123456789.") // a move number stuck to a move, like "1.e4".
+		m, err := g.Position.ParseSAN(tok)
+		if err != nil {
+			return nil, fmt.Errorf("parse pgn: move %d: %w", len(g.Moves)+1, err)
+		}
+		g.Moves = append(g.Moves, m)
+		g.Position = g.Position.apply(m)
+	}
+	return g, nil
+}
+
+// pgnTokens splits PGN movetext into tokens, dropping {comments}, ; comments, and (variations).
+func pgnTokens(movetext string) []string {
+	var tokens []string
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			tokens = append(tokens, cur.String())
+			cur.Reset()
+		}
+	}
+	depth := 0 // how many variations deep we are.
+	for i := 0; i < len(movetext); i++ {
+		switch c := movetext[i]; {
+		case c == '{':
+			flush()
+			if end := strings.IndexByte(movetext[i:], '}'); end >= 0 {
+				i += end
+			} else {
+				i = len(movetext)
+			}
+		case c == ';':
+			flush()
+			if end := strings.IndexByte(movetext[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(movetext)
+			}
+		case c == '(':
+			flush()
+			depth++
+		case c == ')':
+			flush()
+			depth = max(depth-1, 0)
+		case depth > 0:
+		case c == ' ', c == '\t', c == '\n', c == '\r':
+			flush()
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// ReplayHandler serves a game's history as JSON: GET ?gameID=...&ply=N gets the position after N moves,
+// along with the whole game's PGN and the moves in SAN, so a frontend can step through it.
+// Without ply, it's the current position.
+func ReplayHandler(s *Sessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		game, err := s.store().Get(r.Context(), r.URL.Query().Get("gameID"))
+		if errors.Is(err, ErrNoGame) {
+			http.Error(w, "no such game", http.StatusNotFound)
+			return
+		}
+		var positions []Position
+		if err == nil {
+			positions, err = Replay(game.Start, game.Moves)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		pgn, _ := game.PGN() // can't fail: we just replayed it.
+		ply := len(positions) - 1
+		if q := r.URL.Query().Get("ply"); q != "" {
+			if ply, err = strconv.Atoi(q); err != nil || ply < 0 || ply >= len(positions) {
+				http.Error(w, fmt.Sprintf("ply should be a number from 0 to %d", len(positions)-1), http.StatusBadRequest)
+				return
+			}
+		}
+		san := make([]string, len(positions)-1)
+		for i := range san {
+			san[i] = positions[i].SAN(game.Moves[i])
+		}
+		WriteJSON(w, struct {
+			Ply   int         `json:"ply"`
+			FEN   string      `json:"fen"`
+			Board [8][8]piece `json:"board"`
+			Moves []string    `json:"moves"`
+			PGN   string      `json:"pgn"`
+		}{ply, positions[ply].FEN(), positions[ply].Board, san, pgn})
+	}
+}
@@ -0,0 +1,150 @@
+package backendbasics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// the Opera Game: Paul Morphy against the Duke of Brunswick and Count Isouard, Paris, 1858.
+const operaGame = `[White "Morphy"]
+[Black "Duke Karl / Count Isouard"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 d6 3. d4 Bg4 4. dxe5 Bxf3 5. Qxf3 dxe5 6. Bc4 Nf6 7. Qb3 Qe7 8. Nc3 c6 9. Bg5 b5 10. Nxb5 cxb5 11. Bxb5+ Nbd7 12. O-O-O Rd8 13. Rxd7 Rxd7 14. Rd1 Qe6 15. Bxd7+ Nxd7 16. Qb8+ Nxb8 17. Rd8# 1-0
+`
+
+func TestSAN(t *testing.T) {
+	for _, tt := range []struct {
+		fen, from, to string
+		promotion     piece
+		want          string
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "e2", "e4", empty, "e4"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "g1", "f3", empty, "Nf3"},
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 2", "e4", "d5", empty, "exd5"},
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", "e5", "f6", empty, "exf6"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1", "g1", empty, "O-O"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1", "c1", empty, "O-O-O"},
+		{"4k3/8/8/8/8/8/8/R3K2R w KQ - 0 1", "h1", "h8", empty, "Rh8+"},
+		{"4k3/8/8/8/8/8/4K3/R6R w - - 0 1", "a1", "d1", empty, "Rad1"},    // the h-rook can get there too: say which file.
+		{"4k3/8/8/R7/8/8/8/R3K3 w - - 0 1", "a1", "a3", empty, "R1a3"},    // same file: say which rank.
+		{"4k3/8/8/8/8/8/Q1Q5/Q3K3 w - - 0 1", "a2", "b1", empty, "Qa2b1"}, // neither's enough: say both.
+		{"8/P3k3/8/8/8/8/8/4K3 w - - 0 1", "a7", "a8", whiteQueen, "a8=Q"},
+		{"6k1/P4ppp/8/8/8/8/8/4K3 w - - 0 1", "a7", "a8", whiteRook, "a8=R#"},                        // back-rank mate.
+		{"rnbqkbnr/pppp1ppp/8/4p3/6P1/5P2/PPPPP2P/RNBQKBNR b KQkq - 0 2", "d8", "h4", empty, "Qh4#"}, // fool's mate.
+	} {
+		p := fen(t, tt.fen)
+		m := Move{From: sq(tt.from), To: sq(tt.to), White: p.WhiteToMove, Promotion: tt.promotion.colored(p.WhiteToMove)}
+		if tt.promotion == empty {
+			m.Promotion = empty
+		}
+		if got := p.SAN(m); got != tt.want {
+			t.Errorf("%s: SAN(%s-%s) = %q, want %q", tt.fen, tt.from, tt.to, got, tt.want)
+		}
+		if got, err := p.ParseSAN(tt.want); err != nil || got.From != m.From || got.To != m.To || got.Promotion != m.Promotion {
+			t.Errorf("%s: ParseSAN(%q) = %+v, %v, want %s-%s", tt.fen, tt.want, got, err, tt.from, tt.to)
+		}
+	}
+	// m "must be legal", but a bad Promotion still shouldn't panic.
+	if got := StartPosition().SAN(Move{From: sq("e2"), To: sq("e4"), White: true, Promotion: 200}); got != "e4=?" {
+		t.Errorf("SAN with a bogus Promotion = %q, want %q", got, "e4=?")
+	}
+}
+
+func TestPGN(t *testing.T) {
+	g, err := ParsePGN(operaGame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.White != "Morphy" || len(g.Moves) != 33 || g.Position.Status() != Checkmate || g.Position.Result() != "1-0" {
+		t.Fatalf("ParsePGN: got %s with %d moves, ending in %v", g.White, len(g.Moves), g.Position.Status())
+	}
+	got, err := g.PGN()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != operaGame {
+		t.Errorf("PGN() = %s, want %s", got, operaGame)
+	}
+
+	// other programs' PGN has comments, variations, annotations, and extra tags: skip them.
+	messy := `[Event "casual game"]
+[Site "Paris FRA"]
+[White "Morphy"]
+
+1.e4 e5 {the open game} 2. Nf3 d6 (2... Nc6 3. Bb5) 3. d4 Bg4?! $6 ; pinning the knight
+4. dxe5 *`
+	if g, err := ParsePGN(messy); err != nil || len(g.Moves) != 7 || g.Position.SAN(Move{From: sq("g4"), To: sq("f3")}) != "Bxf3" {
+		t.Errorf("ParsePGN(messy) = %+v, %v", g, err)
+	}
+
+	// a game from a custom position keeps it, so it can be replayed.
+	g = &Game{Start: fen(t, "4k3/8/8/8/8/8/8/R3K3 b Q - 0 30")}
+	g.Moves = []Move{{From: sq("e8"), To: sq("d8")}, {From: sq("a1"), To: sq("a8"), White: true}}
+	pgn, err := g.PGN()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[SetUp \"1\"]\n[FEN \"4k3/8/8/8/8/8/8/R3K3 b Q - 0 30\"]\n\n30... Kd8 31. Ra8+ *\n"; !strings.HasSuffix(pgn, want) {
+		t.Errorf("PGN() = %q, want it to end with %q", pgn, want)
+	}
+	back, err := ParsePGN(pgn)
+	if err != nil || back.Start != g.Start || len(back.Moves) != 2 {
+		t.Errorf("ParsePGN(%q) = %+v, %v", pgn, back, err)
+	}
+
+	for _, bad := range []string{"1. e4 e4 *", "1. Ke2 Ke7 2. Kf4 *", "[White Morphy]\n\n1. e4 *"} {
+		if _, err := ParsePGN(bad); err == nil {
+			t.Errorf("ParsePGN(%q) should have returned an error", bad)
+		}
+	}
+}
+
+func TestReplayHandler(t *testing.T) {
+	var s Sessions
+	g, err := ParsePGN(operaGame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.ID = "opera"
+	if err := s.store().Create(context.Background(), g); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(ReplayHandler(&s))
+	defer srv.Close()
+
+	type replay struct {
+		Ply   int      `json:"ply"`
+		FEN   string   `json:"fen"`
+		Moves []string `json:"moves"`
+		PGN   string   `json:"pgn"`
+	}
+	get := func(query string) (int, replay) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var r replay
+		if resp.StatusCode == http.StatusOK {
+			json.NewDecoder(resp.Body).Decode(&r)
+		}
+		return resp.StatusCode, r
+	}
+	if code, r := get("gameID=opera&ply=2"); code != 200 || r.FEN != "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2" || r.Ply != 2 {
+		t.Errorf("ply 2: got %d %+v", code, r)
+	}
+	if code, r := get("gameID=opera"); code != 200 || r.Ply != 33 || r.Moves[32] != "Rd8#" || r.PGN != operaGame {
+		t.Errorf("end: got %d %+v", code, r)
+	}
+	for _, query := range []string{"gameID=opera&ply=34", "gameID=opera&ply=-1", "gameID=nope"} {
+		if code, _ := get(query); code == 200 {
+			t.Errorf("%s: got 200, want an error", query)
+		}
+	}
+}
@@ -4,15 +4,17 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
+	"slices"
 	"time"
 )
 
 type Player struct {
 	Name         string
 	Cash         int
-	Cards        [2]Card
+	Cards        []Card // their hole cards: as many as the game's Variant deals.
 	Folded       bool
 	BetThisRound int  // amount bet this round
+	BetThisHand  int  // amount bet this hand, across every round: how much of the pot is theirs to win. See sidePots.
 	AllIn        bool // true if the player has gone all-in
 }
 type Round byte
@@ -24,6 +26,17 @@ const (
 	River
 )
 
+func (r Round) MarshalText() ([]byte, error) { return []byte(r.String()), nil }
+func (r *Round) UnmarshalText(b []byte) error {
+	for _, round := range [...]Round{PreFlop, Flop, Turn, River} {
+		if string(b) == round.String() {
+			*r = round
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid round %q", b)
+}
+
 func (r Round) String() string {
 	switch r {
 	case PreFlop:
@@ -46,13 +59,21 @@ type Game struct {
 	round     Round
 
 	position byte // index of the player whose turn it is; < len(players)
-	blind    byte // index of the player who is the big blind;  < len(players)
+	blind    byte // index of the player who is the small blind; the big blind is the next one. < len(players)
 
 	currentBet int // current amount to call; 0 if no bet
 	pot        int // total amount of money in the pot
 	smallBlind int // current blind rate.
 
-	deck Deck
+	deck    Deck
+	seed    int64   // what rng was seeded with, if we know: see Seed.
+	variant Variant // how many cards to deal, and how to rank the hands they make.
+
+	hand   int     // how many hands have been played.
+	events []Event // everything that's happened so far: see Events.
+
+	// onTurn, if set, is called on the game's goroutine before each action is read: Tournament uses it to ask the bots, and tests to play by script.
+	onTurn func(g *Game)
 
 	// buf holds intermediate state for resolving hands,
 	// so we don't have to allocate between hands.
@@ -75,7 +96,7 @@ type ActionKind byte
 const (
 	FOLD       ActionKind = iota // fold and forfeit the pot.
 	CHECK_CALL                   // check or call the current bet.
-	RAISE                        // raise by the amount in Action.Amount (which must be at least the current bet)
+	RAISE                        // raise to the amount in Action.Amount (which must be at least twice the current bet, and at least the big blind)
 	ALLIN                        // go all-in with the rest of your money
 )
 
@@ -89,11 +110,8 @@ func TakeAction(g *Game, player string, action ActionKind, amount int) error {
 	// you can always fold
 	case ALLIN:
 		log.Printf("player %q goes all-in for %d", player, g.players[g.position].Cash)
-		amount = g.players[g.position].Cash
-		g.players[g.position].Cash = 0
-		g.pot += amount
-		g.players[g.position].BetThisRound += amount
-		g.currentBet = max(g.currentBet, amount)
+		g.bet(int(g.position), g.players[g.position].Cash)
+		g.currentBet = max(g.currentBet, g.players[g.position].BetThisRound)
 		g.players[g.position].AllIn = true
 		return nil
 
@@ -102,7 +120,7 @@ func TakeAction(g *Game, player string, action ActionKind, amount int) error {
 		return nil
 	case CHECK_CALL:
 		needToBet = g.currentBet - g.players[g.position].BetThisRound
-		if needToBet > g.players[g.position].Cash { // go all-in if you don't have enough money to call
+		if needToBet > 0 && needToBet >= g.players[g.position].Cash { // go all-in if you don't have enough money to call
 			return TakeAction(g, player, ALLIN, 0)
 		}
 
@@ -113,44 +131,85 @@ func TakeAction(g *Game, player string, action ActionKind, amount int) error {
 			log.Printf("player %q calls for %d", player, g.currentBet)
 		}
 
-		g.players[g.position].Cash -= needToBet
-		g.players[g.position].BetThisRound = g.currentBet
+		g.bet(int(g.position), needToBet)
 		return nil
 	case RAISE:
 		// if you don't have enough money to raise, you can use all of your money to raise by going all-in
-		if g.currentBet >= g.players[g.position].Cash {
+		if amount-g.players[g.position].BetThisRound >= g.players[g.position].Cash {
 			return TakeAction(g, player, ALLIN, 0)
 		}
-		if amount < g.currentBet*2 {
-			return fmt.Errorf("amount %d is less than twice the current bet: cannot raise without going all-in", amount)
+		if minRaise := max(g.currentBet*2, g.smallBlind*2); amount < minRaise {
+			return fmt.Errorf("amount %d is less than twice the current bet (or the big blind): cannot raise to less than %d without going all-in", amount, minRaise)
 		}
 		// otherwise, raise by the given amount
 		g.currentBet = amount
 		log.Printf("player %q raises to %d", player, amount)
-		g.players[g.position].Cash -= (amount - g.players[g.position].BetThisRound)
+		g.bet(int(g.position), amount-g.players[g.position].BetThisRound)
 		return nil
 	default:
 		return fmt.Errorf("invalid action kind %#+v", action)
 	}
 }
 
-// removeBustedPlayers removes players who don't have enough money to pay the big blind.
+// bet moves amount from player i's cash to the pot.
+func (g *Game) bet(i, amount int) {
+	g.players[i].Cash -= amount
+	g.players[i].BetThisRound += amount
+	g.players[i].BetThisHand += amount
+	g.pot += amount
+}
+
+// removeBustedPlayers removes players who don't have enough money to pay the big blind. Everyone else keeps their seat, in order.
 func removeBustedPlayers(p []Player, smallBlind int) (stayed, left []Player) {
 	bigBlind := smallBlind * 2
-	startingLen := len(p)
-	for i := len(p) - 1; i >= 0; i-- {
+	for i := range p {
 		if p[i].Cash < bigBlind {
-			log.Printf("player %q busted out", p[i].Name)
-			p[i], p[len(p)-1] = p[len(p)-1], p[i]
-			p = p[:len(p)-1]
+			left = append(left, p[i])
+		} else {
+			stayed = append(stayed, p[i])
 		}
 	}
-	return p, p[len(p):startingLen]
+	return stayed, left
+}
+
+// GameOpts are optional settings for NewGame and NewSeededGame.
+type GameOpts struct {
+	Variant Variant // the kind of poker to play. The zero Variant is Holdem.
+}
+
+// NewGame returns a new game with the given players and small blind, seated and shuffled by a random seed: see Seed.
+// Only the first opts matter, if there are any.
+func NewGame(playerNames []string, smallBlind int, opts ...GameOpts) *Game {
+	return NewSeededGame(playerNames, smallBlind, time.Now().UnixNano(), opts...)
+}
+
+// NewSeededGame is NewGame, seating the players and shuffling every hand with a *rand.Rand seeded by seed:
+// the same seed, players, options, and actions play the same game every time.
+func NewSeededGame(playerNames []string, smallBlind int, seed int64, opts ...GameOpts) *Game {
+	g := newGame(playerNames, smallBlind, rand.New(rand.NewSource(seed)))
+	g.seed = seed
+	if len(opts) > 0 {
+		g.setVariant(opts[0].Variant)
+	}
+	return g
+}
+
+// Variant is the kind of poker g is playing.
+func (g *Game) Variant() Variant { return g.variant }
+
+// setVariant switches g to v, with a fresh deck to match. The zero Variant is Holdem.
+func (g *Game) setVariant(v Variant) {
+	if v == (Variant{}) {
+		v = Holdem
+	}
+	g.variant, g.deck = v, v.Deck()
 }
 
-// NewGame returns a new game with the given players and small blind.
-func NewGame(playerNames []string, smallBlind int) *Game {
-	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+// Seed is the seed the game shuffles with, to play it again with NewSeededGame: or zero, if it came from Tournament, which brings its own *rand.Rand.
+func (g *Game) Seed() int64 { return g.seed }
+
+// newGame is NewGame, shuffling with rng: tests use a seeded one, so every hand is the same every time.
+func newGame(playerNames []string, smallBlind int, rng *rand.Rand) *Game {
 	players := make([]Player, len(playerNames))
 	for i := range players {
 		players[i] = Player{
@@ -160,12 +219,13 @@ func NewGame(playerNames []string, smallBlind int) *Game {
 	}
 	rng.Shuffle(len(players), func(i, j int) { players[i], players[j] = players[j], players[i] })
 
-	return &Game{
+	g := &Game{
 		rng:        rng,
 		players:    players,
 		smallBlind: smallBlind,
-		deck:       NewDeck(),
 	}
+	g.setVariant(Holdem)
+	return g
 }
 
 type Action struct {
@@ -174,60 +234,238 @@ type Action struct {
 	Player string
 }
 
+// Run plays a game of Texas hold'em between the given players until only one has any money left, returning their name.
+// Every decision comes from actions: an action for the wrong player, or one that isn't allowed, is logged and ignored, and we wait for the next one.
+// It returns an error if actions is closed before the game is over.
 func Run(players []string, actions <-chan Action) (winner string, err error) {
-	g := NewGame(players, startingSmallBlind)
+	return NewGame(players, startingSmallBlind).Play(actions)
+}
+
+// Play is Run, for a game you already have: i.e, so you can look at its Events afterwards.
+func (g *Game) Play(actions <-chan Action) (winner string, err error) { return g.run(actions) }
 
-	for hand := 0; ; hand++ {
+func (g *Game) run(actions <-chan Action) (winner string, err error) {
+	for ; ; g.hand++ {
 		// ----- housekeeping ----
+		if richest := slices.MaxFunc(g.players, func(a, b Player) int { return a.Cash - b.Cash }); richest.Cash < 2*g.smallBlind {
+			g.emit(Event{Kind: EventWinner, Player: richest.Name}) // the blinds outgrew everyone at once: the richest player wins.
+			return richest.Name, nil
+		}
 		var removed []Player
 		g.players, removed = removeBustedPlayers(g.players, g.smallBlind)
 		for _, p := range removed {
 			log.Printf("player %q busted out. better luck next time!", p.Name)
+			g.emit(Event{Kind: EventBust, Player: p.Name, Amount: p.Cash})
 		}
 		if len(g.players) == 1 { // only one player left; they win
+			g.emit(Event{Kind: EventWinner, Player: g.players[0].Name})
 			return g.players[0].Name, nil
 		}
-		if hand%blindIncreasesEvery == 0 { // increase the blinds every N hands
+		if g.hand%blindIncreasesEvery == 0 { // increase the blinds every N hands
 			g.smallBlind += blindIncreasesBy
 			log.Printf("blinds increased to %d", g.smallBlind)
 		}
+		if err := g.playHand(actions); err != nil {
+			return "", fmt.Errorf("hand %d: %w", g.hand, err)
+		}
+	}
+}
 
-		// cleanup the state from the previous hand
-		g.pot, g.currentBet = 0, 0
-		g.round = PreFlop
-		g.rng.Shuffle(g.deck.Len(), func(i, j int) { g.deck.Swap(i, j) })
+// playHand plays one hand: the blinds, the deal, up to four rounds of betting, and the showdown.
+func (g *Game) playHand(actions <-chan Action) error {
+	// cleanup the state from the previous hand
+	for i := range g.players {
+		g.players[i].Cards, g.players[i].Folded, g.players[i].AllIn = nil, false, false
+		g.players[i].BetThisRound, g.players[i].BetThisHand = 0, 0
+	}
+	g.pot, g.currentBet = 0, 0
+	g.community = [5]Card{}
+	g.deck.Shuffle(g.rng)
+	k := g.variant.holeCards()
+	if need := k*len(g.players) + 3 + 5; need > g.deck.Remaining() { // the hole cards, three burns, and the board.
+		return fmt.Errorf("%d players need %d cards, but the deck only has %d", len(g.players), need, g.deck.Remaining())
+	}
+	seats := make([]Seat, len(g.players))
+	for i, p := range g.players {
+		seats[i] = Seat{p.Name, p.Cash}
+	}
+	g.emit(Event{Kind: EventHand, Seats: seats, SmallBlind: g.smallBlind})
+
+	n := len(g.players)
+	g.blind = (g.blind + 1) % byte(n)               // small blind moves forward
+	g.postBlind(int(g.blind), g.smallBlind)         // small blind must pay
+	g.postBlind((int(g.blind)+1)%n, g.smallBlind*2) // big blind must pay
+	g.currentBet = 2 * g.smallBlind                 // the big blind is the first bet of the hand
+
+	// deal everyone their hole cards, one at a time, starting with the small blind.
+	for c := 0; c < k; c++ {
+		for i := 0; i < n; i++ {
+			p := &g.players[(int(g.blind)+i)%n]
+			p.Cards = append(p.Cards, g.deal())
+		}
+	}
+	for i := 0; i < n; i++ {
+		p := g.players[(int(g.blind)+i)%n]
+		g.emit(Event{Kind: EventDeal, Player: p.Name, Cards: slices.Clone(p.Cards)})
+	}
 
-		g.blind = (g.blind + 1) % byte(len(g.players)) // small blind moves forward
+	for g.round = PreFlop; g.round <= River; g.round++ {
+		first := int(g.blind) // after the flop, the small blind goes first...
+		if n == 2 {
+			first++ // ...unless it's heads-up, where the small blind is the dealer and acts last.
+		}
+		switch g.round {
+		case PreFlop:
+			first = int(g.blind) + 2 // before the flop, the player after the big blind goes first: heads-up, that's the small blind.
+		case Flop:
+			g.burn()
+			g.community[0], g.community[1], g.community[2] = g.deal(), g.deal(), g.deal()
+			g.emit(Event{Kind: EventCommunity, Round: g.round, Cards: slices.Clone(g.community[:3])})
+		case Turn:
+			g.burn()
+			g.community[3] = g.deal()
+			g.emit(Event{Kind: EventCommunity, Round: g.round, Cards: slices.Clone(g.community[3:4])})
+		case River:
+			g.burn()
+			g.community[4] = g.deal()
+			g.emit(Event{Kind: EventCommunity, Round: g.round, Cards: slices.Clone(g.community[4:])})
+		}
+		if g.round != PreFlop { // new round, new bets. the blinds count as bets in the first round.
+			g.currentBet = 0
+			for i := range g.players {
+				g.players[i].BetThisRound = 0
+			}
+		}
+		log.Printf("%s: %d in the pot", g.round, g.pot)
+		if err := g.bettingRound(actions, first%n); err != nil {
+			return err
+		}
+		if g.inHand() == 1 { // everyone else folded: no need to deal the rest.
+			break
+		}
+	}
+	g.round = min(g.round, River)
+	g.resolveHand()
+	return nil
+}
 
-		g.currentBet = 2 * g.smallBlind // the big blind is the first bet of the hand
+// postBlind makes player i pay a blind, going all-in if they can't cover it.
+func (g *Game) postBlind(i, amount int) {
+	if amount >= g.players[i].Cash {
+		amount, g.players[i].AllIn = g.players[i].Cash, true
+	}
+	g.bet(i, amount)
+	g.emit(Event{Kind: EventBlind, Player: g.players[i].Name, Amount: amount})
+}
+
+// deal deals the next card from the deck. playHand makes sure there are enough to go around before it starts.
+func (g *Game) deal() Card {
+	c, err := g.deck.Deal(1)
+	if err != nil {
+		panic(fmt.Sprintf("poker: %v: this should never happen", err))
+	}
+	return c[0]
+}
 
-		g.players[g.blind].Cash -= g.smallBlind // small blind must pay
-		g.players[g.blind].BetThisRound = g.smallBlind
+// burn burns the next card from the deck, before the flop, the turn, and the river.
+func (g *Game) burn() {
+	if err := g.deck.Burn(); err != nil {
+		panic(fmt.Sprintf("poker: %v: this should never happen", err))
+	}
+}
 
-		g.players[(g.blind+1)%byte(len(g.players))].Cash -= g.smallBlind * 2 // big blind must pay
-		g.players[(g.blind+1)%byte(len(g.players))].BetThisRound = g.smallBlind * 2
+// inHand is how many players haven't folded.
+func (g *Game) inHand() int {
+	n := 0
+	for i := range g.players {
+		if !g.players[i].Folded {
+			n++
+		}
+	}
+	return n
+}
 
-		for {
-			// find the next player who hasn't folded
-			for i := range g.players {
-				if g.players[i].Folded || g.players[i].AllIn {
-					continue
-				}
-				if g.players[i].BetThisRound < g.currentBet {
-					action := <-actions
-					if err := TakeAction(g, action.Player, action.Kind, action.Amount); err != nil {
-						log.Printf("error taking action: %v", err)
-					}
+// canAct reports whether player i still has decisions to make this hand: they haven't folded, and they have money left to bet.
+func (g *Game) canAct(i int) bool { return !g.players[i].Folded && !g.players[i].AllIn }
 
+// bettingRound takes actions, starting with player first, until every player who can act has answered the last bet or raise:
+// i.e, everyone has checked, or called, folded, or gone all-in. A raise means everyone else has to answer it, even if they already acted this round.
+// If everyone else has folded, or no one has anyone left to bet against, the round is over.
+func (g *Game) bettingRound(actions <-chan Action, first int) error {
+	n := len(g.players)
+	toAct := make([]bool, n) // players who have to act before the round is over.
+	waiting := 0
+	for i := range g.players {
+		if g.canAct(i) {
+			toAct[i] = true
+			waiting++
+		}
+	}
+	if waiting == 1 { // a lone player who's already covered the bet has no one to bet against.
+		for i := range g.players {
+			if toAct[i] && g.players[i].BetThisRound >= g.currentBet {
+				return nil
+			}
+		}
+	}
+	for i := first; waiting > 0 && g.inHand() > 1; i = (i + 1) % n {
+		if !toAct[i] {
+			continue
+		}
+		g.position = byte(i)
+		bet := g.currentBet
+		if err := g.nextAction(actions); err != nil {
+			return err
+		}
+		toAct[i] = false
+		waiting--
+		if g.currentBet > bet { // a raise: everyone else has to answer it.
+			for j := range g.players {
+				if j != i && g.canAct(j) && !toAct[j] {
+					toAct[j] = true
+					waiting++
 				}
 			}
 		}
-		g.position = (g.blind + 2) % byte(len(g.players)) // the player after the big blind goes first
+	}
+	return nil
+}
 
+// nextAction reads actions until the player whose turn it is takes one that's allowed.
+func (g *Game) nextAction(actions <-chan Action) error {
+	for {
+		if g.onTurn != nil {
+			g.onTurn(g)
+		}
+		action, ok := <-actions
+		if !ok {
+			return fmt.Errorf("actions closed while waiting on %q", g.players[g.position].Name)
+		}
+		p := &g.players[g.position]
+		before := p.BetThisRound
+		if err := TakeAction(g, action.Player, action.Kind, action.Amount); err != nil {
+			log.Printf("error taking action: %v", err)
+			continue
+		}
+		e := Event{Player: p.Name, Amount: p.BetThisRound - before}
+		switch {
+		case p.Folded:
+			e.Kind = EventFold
+		case p.AllIn:
+			e.Kind = EventAllIn
+		case action.Kind == RAISE:
+			e.Kind = EventRaise
+		case e.Amount == 0:
+			e.Kind = EventCheck
+		default:
+			e.Kind = EventCall
+		}
+		g.emit(e)
+		return nil
 	}
 }
 
-// resolveHand resolves the current hand, giving the pot to the best hand.
+// resolveHand resolves the current hand, paying out the pot to the best hands: see sidePots and payouts.
 func (g *Game) resolveHand() {
 	stillIn := g.buf.stillIn[:0]
 	for i := range g.players {
@@ -237,67 +475,106 @@ func (g *Game) resolveHand() {
 		stillIn = append(stillIn, byte(i))
 	}
 	log.Printf("resolving hand... %d players left", len(stillIn))
-
-	switch len(stillIn) {
-	case 0: // no one left; no winner; should never happen
-		return
-	case 1: // one player left; they win
-		g.players[stillIn[0]].Cash += g.pot
-		log.Printf("player %q takes a pot worth %d", g.players[stillIn[0]].Name, g.pot)
-		g.pot = 0
+	if len(stillIn) == 0 { // no one left; no winner; should never happen
 		return
 	}
 
-	hands := g.buf.hands[:len(stillIn)]
-	var bestHand Hand
-	for i, j := range stillIn {
-		c := g.players[j].Cards
-		hands[i] = GetHand(c[0], c[1], &g.community)
-		if hands[i].Greater(bestHand) {
-			bestHand = hands[i]
+	// only compare hands if there's someone to compare them to: everyone else folding doesn't mean the board's been dealt.
+	hands := g.buf.hands[:min(len(g.players), len(g.buf.hands))]
+	if len(g.players) > len(g.buf.hands) { // a big table: more seats than the buffer, so allocate after all.
+		hands = make([]Hand, len(g.players))
+	}
+	for _, i := range stillIn {
+		hands[i] = Hand{}
+		if len(stillIn) > 1 {
+			c := g.players[i].Cards
+			hands[i] = g.variant.Hand(c, &g.community)
+			g.emit(Event{Kind: EventShowdown, Player: g.players[i].Name, Cards: slices.Clone(c), Best: hands[i].String()})
 		}
 	}
-	winners := g.buf.winners[:0]
-	for i, j := range stillIn {
-		if hands[i] == bestHand {
-			winners = append(winners, j)
+	for i, amount := range payouts(sidePots(g.players), hands, int(g.blind)) {
+		if amount > 0 {
+			g.players[i].Cash += amount
+			log.Printf("player %q takes %d", g.players[i].Name, amount)
+			g.emit(Event{Kind: EventPayout, Player: g.players[i].Name, Amount: amount})
 		}
 	}
-	switch len(winners) {
-	case 0: // no one won; should never happen
-		panic("no one won: this should never happen!")
-	case 1: // one winner; they take the pot
-		g.players[winners[0]].Cash += g.pot
-		log.Printf("player %q takes a pot worth %d", g.players[winners[0]].Name, g.pot)
-		g.pot = 0
-		return
-	default:
-		// time to split the pot among the winners. TODO: figure out the logic for splits on all-ins, etc.
-		// for now, we'll just split it evenly among the winners.
+	g.pot = 0
+	for i := range g.players {
+		g.players[i].BetThisHand = 0
+	}
+}
+
+// Pot is the main pot or a side pot: Amount, and the players who can win it, by index.
+type Pot struct {
+	Amount   int
+	Eligible []int
+}
 
-		payout := g.pot / len(winners)
-		for _, i := range winners {
-			g.players[i].Cash += payout
-			g.pot -= payout
-			log.Printf("player %q takes a 1/%d share of the pot worth %d", g.players[i].Name, len(winners), payout)
+// sidePots splits the money bet this hand into the main pot and side pots, smallest first: a player can only win as much from each opponent as they put in themselves.
+// i.e, if A goes all-in for 100 and B and C call for 300, the main pot is 3*100 = 300, which anyone can win, and the side pot is 2*200 = 400, which only B and C can.
+// Folded players' money stays in whichever pots it went into, but they can't win any of them.
+func sidePots(players []Player) []Pot {
+	var levels []int // the distinct amounts bet by players still in, in order.
+	for _, p := range players {
+		if !p.Folded && p.BetThisHand > 0 {
+			levels = append(levels, p.BetThisHand)
 		}
-		if g.pot > 0 {
-			log.Printf("house takes the remainder %d", g.pot)
-			g.pot = 0
+	}
+	slices.Sort(levels)
+	levels = slices.Compact(levels)
+
+	var pots []Pot
+	prev := 0
+	for _, level := range levels {
+		var pot Pot
+		for i, p := range players {
+			pot.Amount += min(p.BetThisHand, level) - min(p.BetThisHand, prev)
+			if !p.Folded && p.BetThisHand >= level {
+				pot.Eligible = append(pot.Eligible, i)
+			}
+		}
+		pots = append(pots, pot)
+		prev = level
+	}
+	// a folded player can have bet more than anyone still in: that goes to the last pot.
+	for _, p := range players {
+		if p.BetThisHand > prev && len(pots) > 0 {
+			pots[len(pots)-1].Amount += p.BetThisHand - prev
 		}
-		return
-
 	}
+	return pots
 }
 
-// bestHand returns the best hand of any remaining player.
-func bestHand(players []Player, shared *[5]Card) Hand {
-	var best Hand
-	for i := range players {
-		hand := GetHand(players[i].Cards[0], players[i].Cards[1], shared)
-		if hand.Greater(best) {
-			best = hand
+// payouts decides how much each player wins from pots, by index, given their hands: each pot goes to the best hand among the players eligible for it.
+// Ties split the pot evenly. The odd chips that don't divide evenly go one apiece to the tied players closest to the left of the button, starting with first, the small blind:
+// no one's money goes to the house.
+func payouts(pots []Pot, hands []Hand, first int) []int {
+	won := make([]int, len(hands))
+	for _, pot := range pots {
+		var winners []int
+		for _, i := range pot.Eligible {
+			switch {
+			case len(winners) == 0 || hands[i].Greater(hands[winners[0]]):
+				winners = append(winners[:0], i)
+			case !hands[i].Less(hands[winners[0]]): // neither better nor worse: a tie.
+				winners = append(winners, i)
+			}
+		}
+		if len(winners) == 0 {
+			continue // should never happen: somebody put the money in.
+		}
+		// seat order, starting with first.
+		slices.SortFunc(winners, func(a, b int) int {
+			return (a-first+len(hands))%len(hands) - (b-first+len(hands))%len(hands)
+		})
+		share, odd := pot.Amount/len(winners), pot.Amount%len(winners)
+		for j, i := range winners {
+			won[i] += share
+			if j < odd {
+				won[i]++
+			}
 		}
 	}
-	return best
+	return won
 }
@@ -0,0 +1,300 @@
+package poker
+
+import (
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// bets builds players who've bet the given amounts this hand; a negative amount means they bet that much, then folded.
+func bets(amounts ...int) []Player {
+	players := make([]Player, len(amounts))
+	for i, a := range amounts {
+		players[i].Name = string(rune('A' + i))
+		if a < 0 {
+			a, players[i].Folded = -a, true
+		}
+		players[i].BetThisHand = a
+	}
+	return players
+}
+
+func TestSidePots(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		players []Player
+		want    []Pot
+	}{
+		{"everyone called", bets(100, 100, 100), []Pot{{300, []int{0, 1, 2}}}},
+		{"one short all-in", bets(100, 300, 300), []Pot{{300, []int{0, 1, 2}}, {400, []int{1, 2}}}},
+		{"three different all-ins", bets(50, 100, 200, 200), []Pot{{200, []int{0, 1, 2, 3}}, {150, []int{1, 2, 3}}, {200, []int{2, 3}}}},
+		{"folded money stays in", bets(-60, 100, 300, 300), []Pot{{360, []int{1, 2, 3}}, {400, []int{2, 3}}}},
+		{"folded after betting more than an all-in", bets(50, -150, 200, 200), []Pot{{200, []int{0, 2, 3}}, {400, []int{2, 3}}}},
+		{"folded after betting more than anyone", bets(-500, 100, 100), []Pot{{700, []int{1, 2}}}},
+		{"uncalled bet comes back", bets(100, 250), []Pot{{200, []int{0, 1}}, {150, []int{1}}}},
+		{"everyone else folded", bets(-20, -40, 40), []Pot{{100, []int{2}}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sidePots(tt.players)
+			if !slices.EqualFunc(got, tt.want, func(a, b Pot) bool { return a.Amount == b.Amount && slices.Equal(a.Eligible, b.Eligible) }) {
+				t.Errorf("sidePots() = %v, want %v", got, tt.want)
+			}
+			total, want := 0, 0
+			for _, p := range got {
+				total += p.Amount
+			}
+			for _, p := range tt.players {
+				want += p.BetThisHand
+			}
+			if total != want {
+				t.Errorf("pots add up to %d, but %d was bet", total, want)
+			}
+		})
+	}
+}
+
+func TestPayouts(t *testing.T) {
+	var (
+		flush = Hand{Kind: Flush, High: King, Cards: [5]Rank{King, Jack, Nine, Five, Two}}
+		trips = Hand{Kind: ThreeOfAKind, High: Jack, Cards: [5]Rank{Jack, Jack, Jack, Ace, Four}}
+		pair  = Hand{Kind: Pair, High: Two, Cards: [5]Rank{Two, Two, Nine, Eight, Seven}}
+	)
+	for _, tt := range []struct {
+		name    string
+		players []Player
+		hands   []Hand
+		first   int // the small blind
+		want    []int
+	}{
+		{"best hand takes it all", bets(100, 100, 100), []Hand{pair, flush, trips}, 0, []int{0, 300, 0}},
+		{"short stack wins the main pot only",
+			bets(100, 300, 300), []Hand{flush, trips, pair}, 0, []int{300, 400, 0}},
+		{"short stack loses: the side pot doesn't care",
+			bets(100, 300, 300), []Hand{pair, trips, flush}, 0, []int{0, 0, 700}},
+		{"multi-way all-in, each pot to a different player",
+			bets(50, 100, 200, 200), []Hand{flush, trips, pair, Hand{Kind: HighCard, High: Ace, Cards: [5]Rank{Ace, Jack, Nine, Five, Three}}}, 0, []int{200, 150, 200, 0}},
+		{"tie splits the pot",
+			bets(100, 100, 100), []Hand{flush, flush, pair}, 0, []int{150, 150, 0}},
+		{"tie with the all-in splits the main pot; the side pot goes to the other",
+			bets(100, 300, 300), []Hand{flush, flush, pair}, 0, []int{150, 550, 0}},
+		{"odd chip goes left of the button",
+			bets(33, 33, 35), []Hand{flush, pair, flush}, 1, []int{49, 0, 52}}, // main pot 99 splits 49/50: player 2 is closer to the small blind, player 1.
+		{"odd chips, three ways",
+			bets(-1, 33, 33, 33), []Hand{{}, trips, trips, trips}, 3, []int{0, 33, 33, 34}},
+		{"folded hands never win", bets(-100, 100, 100), []Hand{flush, pair, pair}, 0, []int{0, 150, 150}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := payouts(sidePots(tt.players), tt.hands, tt.first)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("payouts() = %v, want %v", got, tt.want)
+			}
+			total, want := 0, 0
+			for i := range got {
+				total += got[i]
+				want += tt.players[i].BetThisHand
+			}
+			if total != want {
+				t.Errorf("paid out %d, but %d was bet: the house doesn't take a cut", total, want)
+			}
+		})
+	}
+}
+
+func TestResolveHand(t *testing.T) {
+	// a royal flush on the board: everyone who's still in plays it, and ties.
+	royal := [5]Card{{Ace, Spades}, {King, Spades}, {Queen, Spades}, {Jack, Spades}, {Ten, Spades}}
+	g := &Game{players: bets(50, -80, 200, 200), community: royal, pot: 530}
+	for i := range g.players {
+		g.players[i].Cards = []Card{{Two, Suit(i%4 + 1)}, {Three, Suit(i%4 + 1)}}
+	}
+	g.resolveHand()
+	// main pot: 4*50 = 200, split three ways, 67/67/66. side pot: the folder's 30 more, plus 2*150 from the others = 330, split two ways.
+	if got := []int{g.players[0].Cash, g.players[1].Cash, g.players[2].Cash, g.players[3].Cash}; !slices.Equal(got, []int{67, 0, 232, 231}) {
+		t.Errorf("after resolveHand, cash = %v", got)
+	}
+	if g.pot != 0 || g.players[2].BetThisHand != 0 {
+		t.Errorf("resolveHand should empty the pot and reset bets: pot %d, bet %d", g.pot, g.players[2].BetThisHand)
+	}
+
+	// everyone else folded: no showdown.
+	g = &Game{players: bets(-10, 20, -20), pot: 50}
+	g.resolveHand()
+	if g.players[1].Cash != 50 {
+		t.Errorf("last player standing got %d, want the whole pot of 50", g.players[1].Cash)
+	}
+	// more players than Game.buf has room for.
+	g = &Game{players: bets(-10, -10, -10, -10, -10, -10, -10, -10, 20), pot: 100}
+	g.resolveHand()
+	if g.players[8].Cash != 100 {
+		t.Errorf("last player standing at a table of 9 got %d, want the whole pot of 100", g.players[8].Cash)
+	}
+}
+
+// script plays g by calling bot for each action, sending them through the channel like anyone else does.
+func script(g *Game, bot func(g *Game) Action) <-chan Action {
+	actions := make(chan Action, 1)
+	g.onTurn = func(g *Game) { actions <- bot(g) }
+	return actions
+}
+
+// act is an Action for whoever's turn it is.
+func act(g *Game, kind ActionKind, amount int) Action {
+	return Action{Kind: kind, Amount: amount, Player: g.players[g.position].Name}
+}
+
+func TestPlayHand(t *testing.T) {
+	totalCash := func(g *Game) int {
+		total := g.pot
+		for _, p := range g.players {
+			total += p.Cash
+		}
+		return total
+	}
+	newTestGame := func(seed int64) *Game {
+		return newGame([]string{"A", "B", "C"}, 10, rand.New(rand.NewSource(seed)))
+	}
+
+	t.Run("everyone calls", func(t *testing.T) {
+		g := newTestGame(1)
+		turns := map[Round][]int{}
+		actions := script(g, func(g *Game) Action {
+			turns[g.round] = append(turns[g.round], int(g.position))
+			return act(g, CHECK_CALL, 0)
+		})
+		if err := g.playHand(actions); err != nil {
+			t.Fatal(err)
+		}
+		// the small blind is 1, the big blind is 2: 0 goes first before the flop, 1 after.
+		want := map[Round][]int{PreFlop: {0, 1, 2}, Flop: {1, 2, 0}, Turn: {1, 2, 0}, River: {1, 2, 0}}
+		for r, order := range want {
+			if !slices.Equal(turns[r], order) {
+				t.Errorf("%s: turns went %v, want %v", r, turns[r], order)
+			}
+		}
+		seen := map[Card]bool{}
+		for _, c := range append(append(append(g.community[:], g.players[0].Cards...), g.players[1].Cards...), g.players[2].Cards...) {
+			if c == (Card{}) || seen[c] {
+				t.Errorf("card %v dealt twice, or not at all: community %v", c, g.community)
+			}
+			seen[c] = true
+		}
+		if g.pot != 0 || totalCash(g) != 3*startingCash {
+			t.Errorf("after the showdown: pot %d, total cash %d", g.pot, totalCash(g))
+		}
+	})
+
+	t.Run("heads-up", func(t *testing.T) {
+		g := newGame([]string{"A", "B"}, 10, rand.New(rand.NewSource(6)))
+		turns := map[Round][]int{}
+		actions := script(g, func(g *Game) Action {
+			turns[g.round] = append(turns[g.round], int(g.position))
+			return act(g, CHECK_CALL, 0)
+		})
+		if err := g.playHand(actions); err != nil {
+			t.Fatal(err)
+		}
+		// the small blind is 1, and the dealer: 1 goes first before the flop, and the big blind, 0, after.
+		want := map[Round][]int{PreFlop: {1, 0}, Flop: {0, 1}, Turn: {0, 1}, River: {0, 1}}
+		for r, order := range want {
+			if !slices.Equal(turns[r], order) {
+				t.Errorf("%s: turns went %v, want %v", r, turns[r], order)
+			}
+		}
+	})
+
+	t.Run("folds to the big blind", func(t *testing.T) {
+		g := newTestGame(2)
+		if err := g.playHand(script(g, func(g *Game) Action { return act(g, FOLD, 0) })); err != nil {
+			t.Fatal(err)
+		}
+		if g.players[2].Cash != startingCash+10 || g.community != [5]Card{} {
+			t.Errorf("big blind has %d, community %v: want %d and no cards dealt", g.players[2].Cash, g.community, startingCash+10)
+		}
+	})
+
+	t.Run("raises reopen the betting", func(t *testing.T) {
+		g := newTestGame(3)
+		var preflop []string
+		steps := []func(g *Game) Action{
+			func(g *Game) Action { return Action{Kind: RAISE, Amount: 100, Player: "B"} }, // not B's turn: ignored.
+			func(g *Game) Action { return act(g, RAISE, 30) },                             // less than the big blind's 20, doubled: ignored.
+			func(g *Game) Action { return act(g, RAISE, 60) },                             // A raises to 60...
+			func(g *Game) Action { return act(g, CHECK_CALL, 0) },                         // ...B calls...
+			func(g *Game) Action { return act(g, RAISE, 200) },                            // ...C re-raises to 200...
+			func(g *Game) Action { return act(g, FOLD, 0) },                               // ...A folds...
+			func(g *Game) Action { return act(g, CHECK_CALL, 0) },                         // ...and B calls.
+		}
+		actions := script(g, func(g *Game) Action {
+			if g.round == PreFlop {
+				preflop = append(preflop, g.players[g.position].Name)
+			}
+			if len(steps) == 0 {
+				return act(g, CHECK_CALL, 0)
+			}
+			step := steps[0]
+			steps = steps[1:]
+			return step(g)
+		})
+		if err := g.playHand(actions); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(preflop, ""); got != "AAAB"+"C"+"A"+"B" {
+			t.Errorf("preflop turns: %s", got)
+		}
+		if g.players[0].Cash != startingCash-60 || totalCash(g) != 3*startingCash {
+			t.Errorf("A has %d, total %d: want %d and %d", g.players[0].Cash, totalCash(g), startingCash-60, 3*startingCash)
+		}
+	})
+
+	t.Run("all-in runs out the board", func(t *testing.T) {
+		g := newTestGame(4)
+		turns := 0
+		actions := script(g, func(g *Game) Action {
+			turns++
+			if g.position == 2 {
+				return act(g, FOLD, 0)
+			}
+			return act(g, ALLIN, 0)
+		})
+		if err := g.playHand(actions); err != nil {
+			t.Fatal(err)
+		}
+		if turns != 3 || g.community[4] == (Card{}) || totalCash(g) != 3*startingCash {
+			t.Errorf("got %d turns, community %v, total %d: want 3 turns, all five cards, and %d", turns, g.community, totalCash(g), 3*startingCash)
+		}
+	})
+
+	t.Run("actions closed", func(t *testing.T) {
+		g := newTestGame(5)
+		actions := make(chan Action)
+		close(actions)
+		if err := g.playHand(actions); err == nil {
+			t.Error("want an error")
+		}
+	})
+}
+
+func TestRun(t *testing.T) {
+	// A shoves every hand; everyone else folds unless they can check. no hand ever gets to a showdown, so the board doesn't matter:
+	// the others bleed their blinds to A until they bust.
+	g := newGame([]string{"A", "B", "C", "D"}, startingSmallBlind, rand.New(rand.NewSource(1)))
+	actions := script(g, func(g *Game) Action {
+		p := g.players[g.position]
+		switch {
+		case p.Name == "A":
+			return act(g, ALLIN, 0)
+		case p.BetThisRound == g.currentBet:
+			return act(g, CHECK_CALL, 0)
+		default:
+			return act(g, FOLD, 0)
+		}
+	})
+	winner, err := g.run(actions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if winner != "A" || len(g.players) != 1 {
+		t.Errorf("got winner %q with %d players left, want A alone", winner, len(g.players))
+	}
+}
@@ -0,0 +1,149 @@
+package poker
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+)
+
+// Strategy decides what a player does on their turn, given what they can see. Bots are Strategies: see CallingStation, PotOdds, and Tournament.
+type Strategy interface {
+	// Act returns the action to take. Its Player doesn't matter: the driver fills it in.
+	Act(view GameView) Action
+}
+
+// GameView is what a player can see on their turn: their own cards, but only their opponents' bets.
+type GameView struct {
+	Name      string
+	Variant   Variant
+	Hole      []Card // as many cards as Variant deals.
+	Community []Card // the community cards dealt so far.
+	Round     Round
+	Pot       int
+	Cash      int // how much the player has left to bet.
+	ToCall    int // how much more the player needs to bet to call; zero means they can check.
+	MinRaise  int // the least they can RAISE to, short of going all-in.
+	BigBlind  int
+	Opponents []Opponent // everyone else at the table, in the order they act after this player.
+}
+
+// Opponent is what a player can see of someone else at the table.
+type Opponent struct {
+	Name         string
+	Cash         int
+	BetThisRound int
+	Folded       bool
+	AllIn        bool
+}
+
+// InHand is how many opponents haven't folded.
+func (v GameView) InHand() int {
+	n := 0
+	for _, o := range v.Opponents {
+		if !o.Folded {
+			n++
+		}
+	}
+	return n
+}
+
+// view is what the player whose turn it is can see.
+func (g *Game) view() GameView {
+	me := g.players[g.position]
+	v := GameView{
+		Name: me.Name, Variant: g.variant, Hole: slices.Clone(me.Cards),
+		Community: g.community[:[...]int{PreFlop: 0, Flop: 3, Turn: 4, River: 5}[g.round]],
+		Round:     g.round, Pot: g.pot, Cash: me.Cash,
+		ToCall:   g.currentBet - me.BetThisRound,
+		MinRaise: max(g.currentBet*2, g.smallBlind*2),
+		BigBlind: g.smallBlind * 2,
+	}
+	for i := 1; i < len(g.players); i++ {
+		p := g.players[(int(g.position)+i)%len(g.players)]
+		v.Opponents = append(v.Opponents, Opponent{p.Name, p.Cash, p.BetThisRound, p.Folded, p.AllIn})
+	}
+	return v
+}
+
+// OnTurn sets f to be called whenever someone's about to act, with what they can see, before Play waits for their action.
+// It's for drivers that aren't a Strategy, like a server waiting on players over the network.
+// f runs on the goroutine playing the game, so it's the one place it's safe to look at g's Events and Snapshot while Play is running.
+func (g *Game) OnTurn(f func(g *Game, v GameView)) { g.onTurn = func(g *Game) { f(g, g.view()) } }
+
+// CallingStation is the simplest possible bot: it checks or calls, every time, no matter what.
+type CallingStation struct{}
+
+func (CallingStation) Act(GameView) Action { return Action{Kind: CHECK_CALL} }
+
+// PotOdds is a bot that calls when the pot is paying it enough for its chances, estimated by Equity: it needs to win at least ToCall/(Pot+ToCall) of the time.
+// It raises the pot when it's a big favorite, and folds the rest of the time, unless it can check for free.
+type PotOdds struct {
+	Iters int        // iterations of Equity to run per decision: 500 is plenty. Zero means 500.
+	Rand  *rand.Rand // for Equity. Not safe for concurrent use, so neither is the bot.
+	// Aggression is how much better than an even share of the pot its equity has to be before it raises:
+	// i.e, at 1.5, it raises heads-up when it wins 75% of the time, and three-handed at 50%. Zero means 1.5.
+	Aggression float64
+}
+
+func (b PotOdds) Act(v GameView) Action {
+	iters, aggression := b.Iters, b.Aggression
+	if iters == 0 {
+		iters = 500
+	}
+	if aggression == 0 {
+		aggression = 1.5
+	}
+	opponents := max(v.InHand(), 1)
+	win, tie, err := v.Variant.Equity(v.Hole, v.Community, opponents, iters, b.Rand)
+	if err != nil {
+		panic(fmt.Sprintf("PotOdds: %v: this should never happen", err)) // the game dealt us something impossible.
+	}
+	equity := win + tie/2 // a tie usually splits the pot: close enough.
+	switch {
+	case equity*float64(opponents+1) >= aggression && v.Cash > v.ToCall:
+		return Action{Kind: RAISE, Amount: max(v.MinRaise, v.Pot+v.ToCall)}
+	case v.ToCall == 0, equity >= float64(v.ToCall)/float64(v.Pot+v.ToCall):
+		return Action{Kind: CHECK_CALL}
+	default:
+		return Action{Kind: FOLD}
+	}
+}
+
+// maxRejected is how many actions in a row a bot can get rejected by Tournament before it folds for them.
+const maxRejected = 3
+
+// Tournament plays bots against each other, by name, until one has all the money, and returns who: see Run.
+// rng shuffles the seats and the deck, so the same seed plays the same game, if the bots are deterministic too.
+// A bot that keeps trying to do something it can't, like raising too little, folds.
+func Tournament(bots map[string]Strategy, rng *rand.Rand) (winner string, err error) {
+	if len(bots) < 2 {
+		return "", fmt.Errorf("tournament: need at least two bots, not %d", len(bots))
+	}
+	names := make([]string, 0, len(bots))
+	for name := range bots {
+		names = append(names, name)
+	}
+	slices.Sort(names) // map order is random: don't let it decide the seats.
+	g := newGame(names, startingSmallBlind, rng)
+
+	actions := make(chan Action, 1) // room for the one answer to each question: the bots run on the game's goroutine.
+	var last GameView
+	rejected := 0
+	g.onTurn = func(g *Game) {
+		v := g.view()
+		// asked again, with nothing changed: the last action was rejected.
+		if v.Name == last.Name && slices.Equal(v.Hole, last.Hole) && v.Pot == last.Pot && v.Round == last.Round && v.ToCall == last.ToCall {
+			rejected++
+		} else {
+			rejected = 0
+		}
+		last = v
+		action := bots[v.Name].Act(v)
+		if rejected >= maxRejected {
+			action = Action{Kind: FOLD}
+		}
+		action.Player = v.Name
+		actions <- action
+	}
+	return g.run(actions)
+}
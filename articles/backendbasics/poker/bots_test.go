@@ -0,0 +1,65 @@
+package poker
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestPotOdds(t *testing.T) {
+	bot := PotOdds{Iters: 2000, Rand: rand.New(rand.NewSource(1))}
+	hole := func(a, b string) []Card { return cards(t, a, b) }
+	heads := []Opponent{{Name: "villain", Cash: 1000}}
+	for _, tt := range []struct {
+		name string
+		view GameView
+		want ActionKind
+	}{
+		{"aces raise", GameView{Hole: hole("AS", "AH"), Pot: 30, ToCall: 10, MinRaise: 40, Cash: 990, Opponents: heads}, RAISE},
+		{"seven-deuce folds to a big bet", GameView{Hole: hole("7S", "2H"), Pot: 300, ToCall: 280, MinRaise: 560, Cash: 980, Opponents: heads}, FOLD},
+		{"seven-deuce checks when it's free", GameView{Hole: hole("7S", "2H"), Pot: 40, MinRaise: 20, Cash: 980, Opponents: heads}, CHECK_CALL},
+		{"a cheap call with a draw", GameView{ // a flush draw, getting 10 to 1: it only needs to win 1 in 11.
+			Hole: hole("AH", "9H"), Community: cards(t, "KH", "7H", "2C"), Round: Flop, Pot: 200, ToCall: 20, MinRaise: 40, Cash: 900, Opponents: heads}, CHECK_CALL},
+	} {
+		if got := bot.Act(tt.view); got.Kind != tt.want {
+			t.Errorf("%s: got %+v, want kind %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// stubborn always tries to raise too little: Tournament should fold for it, rather than wait forever.
+type stubborn struct{}
+
+func (stubborn) Act(GameView) Action { return Action{Kind: RAISE, Amount: 1} }
+
+func TestTournament(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		bots func() map[string]Strategy // new ones for each game, so PotOdds starts from the same seed.
+	}{
+		{"calling stations", func() map[string]Strategy {
+			return map[string]Strategy{"A": CallingStation{}, "B": CallingStation{}, "C": CallingStation{}}
+		}},
+		{"pot odds against the field", func() map[string]Strategy {
+			return map[string]Strategy{"odds": PotOdds{Iters: 200, Rand: rand.New(rand.NewSource(2))}, "B": CallingStation{}, "C": CallingStation{}}
+		}},
+		{"stubborn", func() map[string]Strategy { return map[string]Strategy{"stubborn": stubborn{}, "B": CallingStation{}} }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			bots := tt.bots()
+			winner, err := Tournament(bots, rand.New(rand.NewSource(1)))
+			if _, ok := bots[winner]; err != nil || !ok {
+				t.Fatalf("got winner %q, err %v", winner, err)
+			}
+			if tt.name == "stubborn" && winner != "B" {
+				t.Errorf("stubborn should have folded every hand away, but won")
+			}
+			// the same seed plays the same game.
+			if again, _ := Tournament(tt.bots(), rand.New(rand.NewSource(1))); again != winner {
+				t.Errorf("same seed, different winners: %q, then %q", winner, again)
+			}
+		})
+	}
+	if _, err := Tournament(map[string]Strategy{"lonely": CallingStation{}}, rand.New(rand.NewSource(1))); err == nil {
+		t.Error("a tournament of one: want an error")
+	}
+}
@@ -0,0 +1,141 @@
+package poker
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync"
+)
+
+// Equity estimates how often hole wins or ties against the given number of opponents, holding random cards, once the community cards are all dealt.
+// community is the cards dealt so far: none before the flop, then three, four, or five.
+// It deals out iters random endings to the hand, using rng, and counts: win is the fraction where hole beats everyone, and tie where it ties the best hand.
+// More iterations are more accurate: the error shrinks like 1/sqrt(iters), so 10,000 gets you within about a percent.
+// See ParallelEquity to use more than one core, and Variant.Equity for games other than hold'em.
+func Equity(hole [2]Card, community []Card, opponents, iters int, rng *rand.Rand) (win, tie float64, err error) {
+	return Holdem.Equity(hole[:], community, opponents, iters, rng)
+}
+
+// Equity is Equity, for v: hole has to have as many cards as v deals, and everything has to come from v's deck.
+func (v Variant) Equity(hole, community []Card, opponents, iters int, rng *rand.Rand) (win, tie float64, err error) {
+	s, err := newSim(v, hole, community, opponents)
+	if err != nil {
+		return 0, 0, err
+	}
+	if iters <= 0 {
+		return 0, 0, fmt.Errorf("equity: iters must be positive, not %d", iters)
+	}
+	wins, ties := s.run(iters, rng)
+	return float64(wins) / float64(iters), float64(ties) / float64(iters), nil
+}
+
+// ParallelEquity is Equity, splitting the iterations between workers goroutines: runtime.GOMAXPROCS(0) of them, if workers <= 0.
+// A *rand.Rand isn't safe for concurrent use, so each worker gets its own, seeded from rng: the same rng and workers get the same answer every time.
+func ParallelEquity(hole [2]Card, community []Card, opponents, iters, workers int, rng *rand.Rand) (win, tie float64, err error) {
+	s, err := newSim(Holdem, hole[:], community, opponents)
+	if err != nil {
+		return 0, 0, err
+	}
+	if iters <= 0 {
+		return 0, 0, fmt.Errorf("equity: iters must be positive, not %d", iters)
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, iters)
+
+	var wg sync.WaitGroup
+	wins, ties := make([]int, workers), make([]int, workers) // one apiece, so the workers don't have to share anything.
+	for w := 0; w < workers; w++ {
+		n := iters / workers
+		if w < iters%workers {
+			n++ // spread the remainder.
+		}
+		wrng := rand.New(rand.NewSource(rng.Int63()))
+		wg.Add(1)
+		go func(w, n int) {
+			defer wg.Done()
+			wins[w], ties[w] = s.run(n, wrng)
+		}(w, n)
+	}
+	wg.Wait()
+	var totalWins, totalTies int
+	for w := range wins {
+		totalWins += wins[w]
+		totalTies += ties[w]
+	}
+	return float64(totalWins) / float64(iters), float64(totalTies) / float64(iters), nil
+}
+
+// sim is a simulation of the rest of a hand: the known cards, and everything left in the deck.
+type sim struct {
+	variant   Variant
+	hole      []Card
+	community [5]Card
+	known     int // how many community cards are known.
+	opponents int
+	deck      []Card // the unknown cards.
+}
+
+func newSim(v Variant, hole, community []Card, opponents int) (*sim, error) {
+	switch len(community) {
+	case 0, 3, 4, 5:
+	default:
+		return nil, fmt.Errorf("equity: there should be 0, 3, 4, or 5 community cards, not %d", len(community))
+	}
+	if err := v.check(hole, community); err != nil {
+		return nil, fmt.Errorf("equity: %w", err)
+	}
+	s := &sim{variant: v, hole: hole, known: len(community), opponents: opponents}
+	d := v.Deck()
+	k := v.holeCards()
+	if needed := k*opponents + 5 - len(community); opponents < 1 || needed > d.Len()-k-len(community) {
+		return nil, fmt.Errorf("equity: can't deal to %d opponents: must be between 1 and %d", opponents, (d.Len()-k-5)/k)
+	}
+	copy(s.community[:], community)
+	known := make(map[Card]bool, k+5)
+	for _, c := range append(append([]Card(nil), hole...), community...) {
+		known[c] = true
+	}
+	for _, c := range d.Cards() {
+		if !known[c] {
+			s.deck = append(s.deck, c)
+		}
+	}
+	return s, nil
+}
+
+// run plays out n random endings to the hand, returning how many hole won outright, and how many it tied.
+// It's safe to call from more than one goroutine, as long as they don't share rng.
+func (s *sim) run(n int, rng *rand.Rand) (wins, ties int) {
+	deck := make([]Card, len(s.deck)) // our own copy, to shuffle.
+	copy(deck, s.deck)
+	k := s.variant.holeCards()
+	needed := 5 - s.known + k*s.opponents
+deals:
+	for i := 0; i < n; i++ {
+		// we only need the first few cards shuffled: a partial Fisher-Yates shuffle is still fair, even starting from the last one's order.
+		for j := 0; j < needed; j++ {
+			k := j + rng.Intn(len(deck)-j)
+			deck[j], deck[k] = deck[k], deck[j]
+		}
+		board := s.community
+		copy(board[s.known:], deck)
+		dealt := deck[5-s.known:]
+		ours := s.variant.Hand(s.hole, &board)
+		tied := false
+		for o := 0; o < s.opponents; o++ {
+			theirs := s.variant.Hand(dealt[k*o:k*o+k], &board)
+			if theirs.Greater(ours) {
+				continue deals // we lost.
+			}
+			tied = tied || theirs.Equal(ours)
+		}
+		if tied {
+			ties++
+		} else {
+			wins++
+		}
+	}
+	return wins, ties
+}
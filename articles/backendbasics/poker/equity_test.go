@@ -0,0 +1,108 @@
+package poker
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// cards parses cards in notation, like "AS", "KD".
+func cards(t testing.TB, notations ...string) []Card {
+	t.Helper()
+	cards := make([]Card, len(notations))
+	for i, s := range notations {
+		c, ok := CardFromNotation(s)
+		if !ok {
+			t.Fatalf("bad card %q", s)
+		}
+		cards[i] = c
+	}
+	return cards
+}
+
+func TestEquity(t *testing.T) {
+	hole := func(a, b string) [2]Card { return [2]Card(cards(t, a, b)) }
+	for _, tt := range []struct {
+		name             string
+		hole             [2]Card
+		community        []Card
+		opponents        int
+		wantWin, wantTie float64
+		tolerance        float64
+	}{
+		// the well-known preflop numbers, heads up: see any equity calculator.
+		{"pocket aces", hole("AS", "AH"), nil, 1, 0.849, 0.005, 0.015},
+		{"seven-deuce offsuit", hole("7S", "2H"), nil, 1, 0.32, 0.06, 0.015},
+		{"pocket aces, four ways", hole("AS", "AH"), nil, 3, 0.64, 0.005, 0.02},
+		// the board's a royal flush: nobody can beat it, so everybody ties.
+		{"board plays", hole("2C", "3D"), cards(t, "AS", "KS", "QS", "JS", "TS"), 2, 0, 1, 0},
+		// the nuts on the river: nothing to tie, nothing to lose.
+		{"nuts", hole("AS", "KS"), cards(t, "QS", "JS", "TS", "2D", "3C"), 4, 1, 0, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, equity := range map[string]func() (float64, float64, error){
+				"Equity": func() (float64, float64, error) {
+					return Equity(tt.hole, tt.community, tt.opponents, 20_000, rand.New(rand.NewSource(1)))
+				},
+				"ParallelEquity": func() (float64, float64, error) {
+					return ParallelEquity(tt.hole, tt.community, tt.opponents, 20_000, 4, rand.New(rand.NewSource(1)))
+				},
+			} {
+				win, tie, err := equity()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if math.Abs(win-tt.wantWin) > tt.tolerance || math.Abs(tie-tt.wantTie) > max(tt.tolerance, 0.005) {
+					t.Errorf("%s: win %.3f, tie %.3f: want %.3f and %.3f, give or take %.3f", name, win, tie, tt.wantWin, tt.wantTie, tt.tolerance)
+				}
+			}
+		})
+	}
+}
+
+// the same seed gets the same answer, every time, however many workers split it.
+func TestParallelEquitySeed(t *testing.T) {
+	hole := [2]Card(cards(t, "9H", "8H"))
+	win, tie, _ := ParallelEquity(hole, nil, 2, 5000, 3, rand.New(rand.NewSource(7)))
+	again, tieAgain, _ := ParallelEquity(hole, nil, 2, 5000, 3, rand.New(rand.NewSource(7)))
+	if win != again || tie != tieAgain {
+		t.Errorf("same seed, different answers: %v %v, then %v %v", win, tie, again, tieAgain)
+	}
+}
+
+func TestEquityErrors(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	aces := [2]Card(cards(t, "AS", "AH"))
+	for name, err := range map[string]error{
+		"no opponents":     func() error { _, _, err := Equity(aces, nil, 0, 100, rng); return err }(),
+		"too many":         func() error { _, _, err := Equity(aces, nil, 23, 100, rng); return err }(),
+		"two cards flop":   func() error { _, _, err := Equity(aces, cards(t, "2C", "3C"), 1, 100, rng); return err }(),
+		"dealt twice":      func() error { _, _, err := Equity(aces, cards(t, "AS", "3C", "4C"), 1, 100, rng); return err }(),
+		"invalid card":     func() error { _, _, err := Equity([2]Card{}, nil, 1, 100, rng); return err }(),
+		"no iterations":    func() error { _, _, err := ParallelEquity(aces, nil, 1, 0, 2, rng); return err }(),
+		"omaha, two cards": func() error { _, _, err := Omaha.Equity(aces[:], nil, 1, 100, rng); return err }(),
+		"short deck deuce": func() error { _, _, err := ShortDeck.Equity(cards(t, "AS", "2H"), nil, 1, 100, rng); return err }(),
+	} {
+		if err == nil {
+			t.Errorf("%s: want an error", name)
+		}
+	}
+	if _, _, err := Equity(aces, nil, 22, 100, rng); err != nil {
+		t.Errorf("22 opponents should fit in the deck: %v", err)
+	}
+}
+
+// the article's benchmarks: how much do more cores buy you?
+func BenchmarkEquity(b *testing.B) {
+	hole := [2]Card(cards(b, "AS", "KS"))
+	for i := 0; i < b.N; i++ {
+		Equity(hole, nil, 3, 1000, rand.New(rand.NewSource(int64(i))))
+	}
+}
+
+func BenchmarkParallelEquity(b *testing.B) {
+	hole := [2]Card(cards(b, "AS", "KS"))
+	for i := 0; i < b.N; i++ {
+		ParallelEquity(hole, nil, 3, 1000, 0, rand.New(rand.NewSource(int64(i))))
+	}
+}
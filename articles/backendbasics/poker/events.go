@@ -0,0 +1,190 @@
+package poker
+
+import (
+	"fmt"
+	"slices"
+)
+
+// EventKind is what happened in an Event.
+type EventKind string
+
+const (
+	EventHand      EventKind = "hand"      // a new hand starts: Seats and SmallBlind say who's playing, with how much.
+	EventBlind     EventKind = "blind"     // Player posts a blind of Amount.
+	EventDeal      EventKind = "deal"      // Player is dealt their hole Cards.
+	EventCommunity EventKind = "community" // the Cards for Round are dealt.
+	EventCheck     EventKind = "check"     // Player checks.
+	EventCall      EventKind = "call"      // Player calls, putting in Amount more.
+	EventRaise     EventKind = "raise"     // Player raises, putting in Amount more.
+	EventAllIn     EventKind = "allin"     // Player goes all-in, putting in Amount more.
+	EventFold      EventKind = "fold"      // Player folds.
+	EventShowdown  EventKind = "showdown"  // Player shows their Cards, for their Best hand.
+	EventPayout    EventKind = "payout"    // Player wins Amount from the pot.
+	EventBust      EventKind = "bust"      // Player leaves the game with Amount, too little for the big blind.
+	EventWinner    EventKind = "winner"    // Player wins the game.
+)
+
+// Event is one thing that happened in a Game. Only the fields that matter to the Kind are set: see the EventKind constants.
+// A Game's Events are an append-only log of everything it's done, so a hand can be replayed and audited: see Replay.
+type Event struct {
+	Seq        int       `json:"seq"`  // position in the log, from 0.
+	Hand       int       `json:"hand"` // which hand it happened in, from 0.
+	Kind       EventKind `json:"kind"`
+	Player     string    `json:"player,omitempty"`
+	Amount     int       `json:"amount,omitempty"`
+	Round      Round     `json:"round,omitempty"`
+	Cards      []Card    `json:"cards,omitempty"`
+	Seats      []Seat    `json:"seats,omitempty"`
+	SmallBlind int       `json:"small_blind,omitempty"`
+	Best       string    `json:"best,omitempty"`
+}
+
+// Seat is a player at the start of a hand, in the order they sit.
+type Seat struct {
+	Name string `json:"name"`
+	Cash int    `json:"cash"`
+}
+
+// emit appends e to the game's log.
+func (g *Game) emit(e Event) {
+	e.Seq, e.Hand = len(g.events), g.hand
+	g.events = append(g.events, e)
+}
+
+// Events returns a copy of everything that's happened in the game so far, in order.
+func (g *Game) Events() []Event { return slices.Clone(g.events) }
+
+// Snapshot is the state of a game between actions, as much as can be known from its Events: see Replay.
+type Snapshot struct {
+	Hand       int
+	Round      Round
+	SmallBlind int
+	Pot        int
+	CurrentBet int
+	Community  []Card // the community cards dealt so far.
+	Players    []Player
+}
+
+// Snapshot returns the current state of the game.
+func (g *Game) Snapshot() Snapshot {
+	n := 0
+	for n < len(g.community) && g.community[n] != (Card{}) {
+		n++
+	}
+	s := Snapshot{
+		Hand: g.hand, Round: g.round, SmallBlind: g.smallBlind,
+		Pot: g.pot, CurrentBet: g.currentBet,
+		Community: slices.Clone(g.community[:n]),
+		Players:   slices.Clone(g.players),
+	}
+	for i := range s.Players {
+		s.Players[i].Cards = slices.Clone(s.Players[i].Cards)
+	}
+	return s
+}
+
+// Replay reconstructs the state of a game from its events, checking as it goes that they add up:
+// the log is in order, nobody bets more than they have or is paid more than the pot, no card is dealt twice in a hand,
+// and every hand's pot is paid out before the next starts.
+// Replaying a Game's Events gets you its Snapshot.
+func Replay(events []Event) (Snapshot, error) {
+	var s Snapshot
+	seen := make(map[Card]bool, 52)
+	for i, e := range events {
+		if e.Seq != i {
+			return s, fmt.Errorf("event %d: out of order: has seq %d", i, e.Seq)
+		}
+		switch e.Kind {
+		case EventHand:
+		case EventBust, EventWinner: // between hands: they happen before the next one starts.
+			if e.Hand < s.Hand {
+				return s, fmt.Errorf("event %d: %s in hand %d, after hand %d", i, e.Kind, e.Hand, s.Hand)
+			}
+			s.Hand = e.Hand
+		default:
+			if e.Hand != s.Hand {
+				return s, fmt.Errorf("event %d: %s in hand %d, during hand %d", i, e.Kind, e.Hand, s.Hand)
+			}
+		}
+		var p *Player
+		if e.Player != "" {
+			j := slices.IndexFunc(s.Players, func(p Player) bool { return p.Name == e.Player })
+			if j == -1 {
+				return s, fmt.Errorf("event %d: %s: no player %q", i, e.Kind, e.Player)
+			}
+			p = &s.Players[j]
+		}
+		switch e.Kind {
+		case EventHand:
+			if s.Pot != 0 {
+				return s, fmt.Errorf("event %d: hand %d starts with %d left in the pot", i, e.Hand, s.Pot)
+			}
+			s = Snapshot{Hand: e.Hand, Round: PreFlop, SmallBlind: e.SmallBlind, CurrentBet: 2 * e.SmallBlind}
+			for _, seat := range e.Seats {
+				s.Players = append(s.Players, Player{Name: seat.Name, Cash: seat.Cash})
+			}
+			clear(seen)
+		case EventBlind, EventCheck, EventCall, EventRaise, EventAllIn:
+			if p == nil || e.Amount < 0 || e.Amount > p.Cash {
+				return s, fmt.Errorf("event %d: %s: can't bet %d", i, e.Kind, e.Amount)
+			}
+			p.Cash -= e.Amount
+			p.BetThisRound += e.Amount
+			p.BetThisHand += e.Amount
+			if p.Cash == 0 {
+				p.AllIn = true
+			}
+			s.Pot += e.Amount
+			s.CurrentBet = max(s.CurrentBet, p.BetThisRound)
+		case EventFold:
+			if p == nil {
+				return s, fmt.Errorf("event %d: fold: no player", i)
+			}
+			p.Folded = true
+		case EventDeal, EventCommunity:
+			for _, c := range e.Cards {
+				if seen[c] {
+					return s, fmt.Errorf("event %d: %s: %s was already dealt this hand", i, e.Kind, c)
+				}
+				seen[c] = true
+			}
+			if e.Kind == EventCommunity {
+				s.Round = e.Round
+				s.Community = append(s.Community, e.Cards...)
+				s.CurrentBet = 0
+				for j := range s.Players {
+					s.Players[j].BetThisRound = 0
+				}
+			} else if p == nil || len(e.Cards) == 0 || len(p.Cards) != 0 {
+				return s, fmt.Errorf("event %d: deal: need a player who hasn't been dealt in yet, and their cards", i)
+			} else {
+				p.Cards = slices.Clone(e.Cards)
+			}
+		case EventShowdown:
+			if p == nil || p.Folded || !slices.Equal(p.Cards, e.Cards) {
+				return s, fmt.Errorf("event %d: showdown: %q wasn't holding %v", i, e.Player, e.Cards)
+			}
+		case EventPayout:
+			if p == nil || e.Amount <= 0 || e.Amount > s.Pot {
+				return s, fmt.Errorf("event %d: payout: can't pay %d from a pot of %d", i, e.Amount, s.Pot)
+			}
+			p.Cash += e.Amount
+			s.Pot -= e.Amount
+			for j := range s.Players {
+				s.Players[j].BetThisHand = 0 // the pot's been split: nobody has a claim to it any more.
+			}
+		case EventBust:
+			if p == nil || p.Cash >= 2*s.SmallBlind {
+				return s, fmt.Errorf("event %d: bust: %q can still pay the big blind", i, e.Player)
+			}
+			s.Players = slices.DeleteFunc(s.Players, func(p Player) bool { return p.Name == e.Player })
+		case EventWinner:
+			if p == nil {
+				return s, fmt.Errorf("event %d: winner: no player", i)
+			}
+		default:
+			return s, fmt.Errorf("event %d: unknown kind %q", i, e.Kind)
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,108 @@
+package poker
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	// three calling stations and a maniac who raises the pot: plenty of showdowns, side pots, and busts.
+	g := newGame([]string{"A", "B", "C", "D"}, startingSmallBlind, rand.New(rand.NewSource(3)))
+	turns := 0
+	actions := script(g, func(g *Game) Action {
+		// replaying the log so far, mid-hand, gets us right back here.
+		if turns++; turns%50 == 0 {
+			if got, err := Replay(g.Events()); err != nil {
+				t.Fatalf("turn %d: %v", turns, err)
+			} else if want := g.Snapshot(); !reflect.DeepEqual(got, want) {
+				t.Fatalf("turn %d: replay got\n%+v\nwant\n%+v", turns, got, want)
+			}
+		}
+		if p := g.players[g.position]; p.Name == "A" {
+			return act(g, RAISE, max(2*g.currentBet, 2*g.smallBlind, g.pot))
+		}
+		return act(g, CHECK_CALL, 0)
+	})
+	winner, err := g.Play(actions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := g.Events()
+	if last := events[len(events)-1]; last.Kind != EventWinner || last.Player != winner {
+		t.Errorf("last event: got %+v, want %q winning", last, winner)
+	}
+	got, err := Replay(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := g.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("replay got\n%+v\nwant\n%+v", got, want)
+	}
+
+	// round trip through NDJSON.
+	var buf bytes.Buffer
+	if err := WriteEvents(&buf, events); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != len(events) {
+		t.Errorf("got %d lines for %d events", lines, len(events))
+	}
+	read, err := ReadEvents(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, events) {
+		t.Fatalf("round trip: got %d events, want %d, or they differ", len(read), len(events))
+	}
+}
+
+func TestReplayAudit(t *testing.T) {
+	g := newGame([]string{"A", "B", "C"}, startingSmallBlind, rand.New(rand.NewSource(1)))
+	if _, err := g.Play(script(g, func(g *Game) Action { return act(g, CHECK_CALL, 0) })); err != nil {
+		t.Fatal(err)
+	}
+	events := g.Events()
+	// find returns the index of the first event that matches.
+	find := func(kind EventKind, ok func(Event) bool) int {
+		for i, e := range events {
+			if e.Kind == kind && ok(e) {
+				return i
+			}
+		}
+		t.Fatalf("no %s event", kind)
+		return -1
+	}
+	always := func(Event) bool { return true }
+	for _, tt := range []struct {
+		name   string
+		tamper func(events []Event) []Event
+		want   string
+	}{
+		{"out of order", func(e []Event) []Event { e[3], e[4] = e[4], e[3]; return e }, "out of order"},
+		{"dropped event", func(e []Event) []Event { return append(e[:5], e[6:]...) }, "out of order"},
+		{"overpaid", func(e []Event) []Event { e[find(EventPayout, always)].Amount += 1; return e }, "can't pay"},
+		{"bet more than they have", func(e []Event) []Event { e[find(EventBlind, always)].Amount = 1 << 20; return e }, "can't bet"},
+		{"dealt twice", func(e []Event) []Event {
+			i := find(EventCommunity, always)
+			e[i].Cards = append([]Card{e[find(EventDeal, always)].Cards[0]}, e[i].Cards[1:]...)
+			return e
+		}, "already dealt"},
+		{"underpaid", func(e []Event) []Event {
+			i := find(EventPayout, func(e Event) bool { return e.Amount > 1 })
+			e[i].Amount--
+			return e
+		}, "left in the pot"},
+		{"a stranger", func(e []Event) []Event { e[find(EventCall, always)].Player = "nobody"; return e }, `no player "nobody"`},
+	} {
+		tampered := tt.tamper(g.Events())
+		if _, err := Replay(tampered); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want an error containing %q", tt.name, err, tt.want)
+		}
+	}
+	if _, err := ReadEvents(strings.NewReader(`{"seq": 0, "kind": "community", "round": "the fifth"}`)); err == nil {
+		t.Error("bad round: want an error")
+	}
+}
@@ -2,6 +2,7 @@
 package poker
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"strings"
@@ -19,62 +20,88 @@ type Card struct {
 	Suit
 }
 
-// Shuffle the deck using the provided rng.
-func (d *Deck) Shuffle(rng *rand.Rand) { rng.Shuffle(d.Len(), d.Swap) }
+// Shuffle puts every card back in the deck, dealt or not, and shuffles it using the provided rng.
+// The same rng, seeded the same way, shuffles the same way every time.
+func (d *Deck) Shuffle(rng *rand.Rand) {
+	d.dealt = 0
+	rng.Shuffle(d.Len(), d.Swap)
+}
+
+// ErrEmptyDeck is returned by Deal and Burn when there aren't enough cards left in the deck.
+var ErrEmptyDeck = errors.New("not enough cards left in the deck")
+
+// Deal deals n cards off the top of the deck, or returns ErrEmptyDeck, dealing nothing, if there aren't that many left.
+func (d *Deck) Deal(n int) ([]Card, error) {
+	if n < 0 || n > d.Remaining() {
+		return nil, fmt.Errorf("deal %d: %w: %d left", n, ErrEmptyDeck, d.Remaining())
+	}
+	cards := d.cards[d.dealt : d.dealt+n : d.dealt+n] // full slice expression: so appending to it can't scribble on the rest of the deck.
+	d.dealt += n
+	return cards, nil
+}
+
+// Burn discards the top card, face down, like a dealer does before the flop, the turn, and the river.
+func (d *Deck) Burn() error {
+	if _, err := d.Deal(1); err != nil {
+		return fmt.Errorf("burn: %w", err)
+	}
+	return nil
+}
+
+// Remaining is how many cards are left to Deal.
+func (d *Deck) Remaining() int { return len(d.cards) - d.dealt }
+
+// Cards returns a copy of the cards left in the deck, top first.
+func (d *Deck) Cards() []Card { return append([]Card(nil), d.cards[d.dealt:]...) }
 
 // NewDeck returns a new, unshuffled deck of cards.
 func NewDeck() Deck {
-	var d Deck
-	var i int
+	d := Deck{cards: make([]Card, 0, 52)}
 	for s := Suit(1); s < SuitMax; s++ {
 		for r := Rank(1); r < RankMax; r++ {
-			d[i] = Card{r, s}
-			i++
+			d.cards = append(d.cards, Card{r, s})
 		}
 	}
-
 	return d
 }
 
-// Equal returns true if the two hands are of the same kind and have the same high and low cards.
-func (h Hand) Equal(o Hand) bool {
+// Equal returns true if neither hand beats the other: they're of the same kind, with cards of the same ranks. Suits don't matter.
+func (h Hand) Equal(o Hand) bool { return h.Kind == o.Kind && h.Cards == o.Cards }
+
+// Greater returns true if h is a better hand than o.
+func (h Hand) Greater(o Hand) bool { return o.Less(h) }
+
+// Less returns true if h is a worse hand than o: first by kind, then rank by rank through the cards, in the order they count.
+// i.e, a pair of kings with an ace kicker beats a pair of kings with a queen, and the zero Hand loses to everything.
+func (h Hand) Less(o Hand) bool {
 	if h.Kind != o.Kind {
-		return false
+		return h.order() < o.order()
 	}
-	switch h.Kind {
-	case TwoPair, FullHouse:
-		return h.High == o.High && h.Low == o.Low
-	default:
-		return h.High == o.High
+	for i := range h.Cards {
+		if a, b := h.Cards[i].value(), o.Cards[i].value(); a != b {
+			return a < b
+		}
 	}
+	return false // a tie.
 }
 
-func (h Hand) Greater(o Hand) bool {
-	if h == o {
-		return false
+// order is where h's kind ranks: its Kind, except that in a short deck, a flush and a full house trade places. See ShortDeck.
+func (h Hand) order() HandKind {
+	switch {
+	case h.short && h.Kind == Flush:
+		return FullHouse
+	case h.short && h.Kind == FullHouse:
+		return Flush
 	}
-	return !h.Less(o)
+	return h.Kind
 }
 
-// Less returns true if h is a worse hand than o.
-func (h Hand) Less(o Hand) bool {
-	if (h == Hand{}) && (o != Hand{}) {
-		return true
-	}
-	switch {
-	case h.Kind < o.Kind:
-		return true
-	case h.Kind > o.Kind:
-		return false
-	case h.High < o.High:
-		return true
-	case h.High > o.High:
-		return false
-	case h.Kind == TwoPair || h.Kind == FullHouse:
-		return h.Low < o.Low
-	default:
-		return false // no way to decide
+// value is r's worth in a hand: aces high, so 2 through 14. See Hand.Cards for the ace-low straight.
+func (r Rank) value() int {
+	if r == Ace {
+		return 14
 	}
+	return int(r)
 }
 
 // Less orders cards. Aces are high; suits are ordered alphabetically.
@@ -111,21 +138,22 @@ func (c *Card) UnmarshalText(b []byte) error {
 // Notation returns the card's notation, e.g. "AC" for Ace of Clubs. Compare to String().
 func (c Card) Notation() string { return notation[c.Rank][c.Suit] }
 
+// notation is indexed by rank, then suit: both start from UNKNOWN.
 var notation = [RankMax][SuitMax]string{
-	UNKNOWN: {"??", "??", "??", "??"},
-	Ace:     {"AC", "AD", "AH", "AS"},
-	Two:     {"2C", "2D", "2H", "2S"},
-	Three:   {"3C", "3D", "3H", "3S"},
-	Four:    {"4C", "4D", "4H", "4S"},
-	Five:    {"5C", "5D", "5H", "5S"},
-	Six:     {"6C", "6D", "6H", "6S"},
-	Seven:   {"7C", "7D", "7H", "7S"},
-	Eight:   {"8C", "8D", "8H", "8S"},
-	Nine:    {"9C", "9D", "9H", "9S"},
-	Ten:     {"TC", "TD", "TH", "TS"},
-	Jack:    {"JC", "JD", "JH", "JS"},
-	Queen:   {"QC", "QD", "QH", "QS"},
-	King:    {"KC", "KD", "KH", "KS"},
+	UNKNOWN: {"??", "??", "??", "??", "??"},
+	Ace:     {"A?", "AC", "AD", "AH", "AS"},
+	Two:     {"2?", "2C", "2D", "2H", "2S"},
+	Three:   {"3?", "3C", "3D", "3H", "3S"},
+	Four:    {"4?", "4C", "4D", "4H", "4S"},
+	Five:    {"5?", "5C", "5D", "5H", "5S"},
+	Six:     {"6?", "6C", "6D", "6H", "6S"},
+	Seven:   {"7?", "7C", "7D", "7H", "7S"},
+	Eight:   {"8?", "8C", "8D", "8H", "8S"},
+	Nine:    {"9?", "9C", "9D", "9H", "9S"},
+	Ten:     {"T?", "TC", "TD", "TH", "TS"},
+	Jack:    {"J?", "JC", "JD", "JH", "JS"},
+	Queen:   {"Q?", "QC", "QD", "QH", "QS"},
+	King:    {"K?", "KC", "KD", "KH", "KS"},
 }
 
 // CardFromString parses a card from either it's formal name ("Ace of Clubs") or its notation ("AC").
@@ -333,22 +361,33 @@ var (
 
 func (k HandKind) String() string { return kindNames[k] }
 
-// Deck is a standard 52-card deck of playing cards.
-type Deck [52]Card
+// Deck is a deck of playing cards, and how far into it we've dealt: see NewDeck, Shuffle, and Deal.
+// Len, Less, and Swap sort the whole deck, dealt or not.
+type Deck struct {
+	cards []Card
+	dealt int // how many cards have been dealt or burned since the last Shuffle.
+}
 
-func (d *Deck) Len() int { return len(d) }
+func (d *Deck) Len() int { return len(d.cards) }
 func (d *Deck) Less(i, j int) bool {
-	if d[i].Rank == d[j].Rank {
-		return d[i].Suit < d[j].Suit
+	if d.cards[i].Rank == d.cards[j].Rank {
+		return d.cards[i].Suit < d.cards[j].Suit
 	}
-	return d[i].Rank < d[j].Rank
+	return d.cards[i].Rank < d.cards[j].Rank
 }
-func (d *Deck) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+func (d *Deck) Swap(i, j int) { d.cards[i], d.cards[j] = d.cards[j], d.cards[i] }
 
 type Hand struct {
 	Kind HandKind // kind of hand; e.g. Flush
 	High Rank     // highest scoring card; e.g, if we have a full house, this is the rank of the three-of-a-kind
-	Low  Rank     // lowest scoring card; e.g, if we have two pair, this is the lower pair's rank
+	Low  Rank     // lowest scoring card; e.g, if we have two pair, this is the lower pair's rank. Zero for other kinds of hands.
+	// Cards are the ranks of the five cards in the hand, in the order they're compared: the biggest group first, then by rank, aces high.
+	// i.e, a full house of kings over fours is K K K 4 4, and two pair with a kicker is Q Q 7 7 A.
+	// An ace-low straight (the "wheel") is 5 4 3 2 A: the ace counts as a one there, so it's the lowest straight, not the highest.
+	// In a short deck, the lowest straight is 9 8 7 6 A.
+	Cards [5]Rank
+
+	short bool // from a short deck: see order.
 }
 
 func (h Hand) String() string {
@@ -370,81 +409,93 @@ func (h Hand) String() string {
 // The first two cards are the player's "hole" cards, and the remaining
 // five are the "shared" cards.
 func GetHand(a, b Card, shared *[5]Card) Hand {
-	cards := make([]Card, 7)
-	copy(cards[:], shared[:])
-	var ranks [RankMax]byte
-	var suits [SuitMax]byte
-
-	for _, c := range cards {
-		ranks[c.Rank]++
-		suits[c.Suit]++
-	}
-
-	var flush Suit
+	cards := [7]Card{a, b}
+	copy(cards[2:], shared[:])
+	return bestHand5(cards[:], false)
+}
 
-	for i := range suits {
-		if suits[i] == 5 {
-			flush = Suit(i)
-			break
+// bestHand5 returns the best five-card hand among cards, by short-deck rules if short is set: there are only 21 ways to choose five of seven, so we try them all.
+func bestHand5(cards []Card, short bool) Hand {
+	var best Hand
+	choose(cards, 5, func(five []Card) {
+		if h := evalHand([5]Card(five), short); h.Greater(best) {
+			best = h
 		}
-	}
-	var straight, fourOfAKind, threeOfAKind, pair, pair2, high Rank
+	})
+	return best
+}
 
-	// check for rank-based hands; we'll choose the best one later
-	for i := Five; i <= King; i++ {
-		if ranks[i] > 0 && ranks[i-1] > 0 && ranks[i-2] > 0 && ranks[i-3] > 0 && ranks[i-4] > 0 {
-			straight = i
+// choose calls f with every way to choose k of cards, keeping them in order. f mustn't hold on to its argument: it's reused.
+func choose(cards []Card, k int, f func(chosen []Card)) {
+	chosen := make([]Card, k)
+	var rec func(start, n int)
+	rec = func(start, n int) {
+		if n == k {
+			f(chosen)
+			return
 		}
-		switch ranks[i] {
-		case 4:
-			fourOfAKind = i
-		case 3:
-			threeOfAKind = i
-		case 2:
-			if pair != 0 {
-				pair, pair2 = i, pair
-			} else {
-				pair = i
-			}
-		default:
-			high = i
+		for i := start; i <= len(cards)-(k-n); i++ {
+			chosen[n] = cards[i]
+			rec(i+1, n+1)
 		}
 	}
-	// check for royal straight
-	if ranks[Ace] > 0 && ranks[King] > 0 && ranks[Queen] > 0 && ranks[Jack] > 0 && ranks[Ten] > 0 {
-		straight = Ace
-	}
-	if ranks[Ace] > 0 {
-		high = Ace
-	}
+	rec(0, 0)
+}
 
-	// ok, now we know what kind of hand we have, and what the high card is
-	// let's build the best hand we can
+// evalHand says what kind of hand exactly five cards make, by short-deck rules if short is set.
+func evalHand(cards [5]Card, short bool) Hand {
+	var count [RankMax]int
+	flush := true
+	for _, c := range cards {
+		count[c.Rank]++
+		flush = flush && c.Suit == cards[0].Suit
+	}
 
-	switch {
-	case straight != 0 && flush != 0:
-		// is the straight the same as the flush?
-		for _, c := range cards {
-			if c.Suit == flush && c.Rank == straight {
-				return Hand{StraightFlush, straight, 0}
+	// order the ranks the way they're compared: biggest group first, then highest first.
+	h := Hand{short: short}
+	n := 0
+	for size := 4; size >= 1; size-- {
+		for _, r := range [...]Rank{Ace, King, Queen, Jack, Ten, Nine, Eight, Seven, Six, Five, Four, Three, Two} {
+			if count[r] == size {
+				for i := 0; i < size; i++ {
+					h.Cards[n] = r
+					n++
+				}
 			}
 		}
-		return Hand{Flush, high, 0}
-	case fourOfAKind != 0:
-		return Hand{FourOfAKind, fourOfAKind, high}
-	case threeOfAKind != 0 && pair != 0:
-		return Hand{FullHouse, threeOfAKind, pair}
-	case flush != 0:
-		return Hand{Flush, high, 0}
-	case straight != 0:
-		return Hand{Straight, straight, 0}
-	case threeOfAKind != 0:
-		return Hand{ThreeOfAKind, threeOfAKind, high}
-	case pair != 0 && pair2 != 0:
-		return Hand{TwoPair, pair, pair2}
-	case pair != 0:
-		return Hand{Pair, pair, high}
+	}
+
+	straight := false
+	switch {
+	case count[h.Cards[0]] != 1: // a pair or better can't be a straight.
+	case h.Cards[0].value()-h.Cards[4].value() == 4: // five different ranks, four apart: i.e, 9 8 7 6 5.
+		straight = true
+	case h.Cards == [5]Rank{Ace, Five, Four, Three, Two}: // the wheel: the ace plays low.
+		straight, h.Cards = true, [5]Rank{Five, Four, Three, Two, Ace}
+	case short && h.Cards == [5]Rank{Ace, Nine, Eight, Seven, Six}: // the short deck's wheel: there's nothing lower than a six for the ace to play after.
+		straight, h.Cards = true, [5]Rank{Nine, Eight, Seven, Six, Ace}
+	}
+
+	switch c := h.Cards; {
+	case straight && flush:
+		h.Kind = StraightFlush
+	case count[c[0]] == 4:
+		h.Kind = FourOfAKind
+	case count[c[0]] == 3 && count[c[3]] == 2:
+		h.Kind, h.Low = FullHouse, c[3]
+	case flush:
+		h.Kind = Flush
+	case straight:
+		h.Kind = Straight
+	case count[c[0]] == 3:
+		h.Kind = ThreeOfAKind
+	case count[c[0]] == 2 && count[c[2]] == 2:
+		h.Kind, h.Low = TwoPair, c[2]
+	case count[c[0]] == 2:
+		h.Kind = Pair
 	default:
-		return Hand{HighCard, high, 0}
+		h.Kind = HighCard
 	}
+	h.High = h.Cards[0]
+	return h
 }
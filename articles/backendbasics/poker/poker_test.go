@@ -0,0 +1,142 @@
+package poker
+
+import (
+	"bufio"
+	"errors"
+	"math/rand"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestGetHand checks GetHand against the hands in testdata/hands.txt: what each one is, and that each beats the next.
+func TestGetHand(t *testing.T) {
+	f, err := os.Open("testdata/hands.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var prev Hand
+	var prevLine string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tie := strings.HasPrefix(line, "= ")
+		rawCards, want, ok := strings.Cut(strings.TrimPrefix(line, "= "), ": ")
+		notations := strings.Fields(rawCards)
+		if !ok || len(notations) != 7 {
+			t.Fatalf("line %d: malformed: %q", n, line)
+		}
+		var cards [7]Card
+		for i, s := range notations {
+			if cards[i], ok = CardFromNotation(s); !ok {
+				t.Fatalf("line %d: bad card %q", n, s)
+			}
+		}
+		got := GetHand(cards[0], cards[1], (*[5]Card)(cards[2:]))
+		if got.String() != want {
+			t.Errorf("line %d: GetHand(%s) = %s, want %s", n, rawCards, got, want)
+		}
+		switch {
+		case prevLine == "":
+		case tie && !got.Equal(prev):
+			t.Errorf("line %d: %s (%v) should tie %s (%v)", n, rawCards, got.Cards, prevLine, prev.Cards)
+		case !tie && !prev.Greater(got):
+			t.Errorf("line %d: %s (%v) should lose to %s (%v)", n, rawCards, got.Cards, prevLine, prev.Cards)
+		}
+		prev, prevLine = got, rawCards
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// the order of the cards doesn't matter: not even which are in the hole.
+func TestGetHandOrder(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		d := NewDeck()
+		d.Shuffle(rng)
+		c, _ := d.Deal(7)
+		want := GetHand(c[0], c[1], (*[5]Card)(c[2:7]))
+		rng.Shuffle(7, func(i, j int) { c[i], c[j] = c[j], c[i] })
+		if got := GetHand(c[0], c[1], (*[5]Card)(c[2:7])); !got.Equal(want) {
+			t.Fatalf("%v: got %v, but in another order, %v", c, got, want)
+		}
+	}
+}
+
+func TestDeck(t *testing.T) {
+	d := NewDeck()
+	d.Shuffle(rand.New(rand.NewSource(1)))
+	order := d.Cards()
+	seen := make(map[Card]bool)
+	hole, err := d.Deal(2)
+	if err != nil || len(hole) != 2 {
+		t.Fatalf("Deal(2): got %v, %v", hole, err)
+	}
+	top := d.Cards()[0]
+	if err := d.Burn(); err != nil {
+		t.Fatal(err)
+	}
+	flop, _ := d.Deal(3)
+	if flop[0] == top {
+		t.Errorf("burned %v, then dealt it anyway", top)
+	}
+	rest, _ := d.Deal(d.Remaining())
+	for _, c := range append(append(hole, flop...), rest...) {
+		if seen[c] {
+			t.Fatalf("%v dealt twice", c)
+		}
+		seen[c] = true
+	}
+	if len(seen) != 51 || seen[top] { // everything but the burn.
+		t.Fatalf("dealt %d distinct cards, and the burn: %t; want 51 and false", len(seen), seen[top])
+	}
+	// an empty deck can't deal, or burn, or deal more than it has: and trying doesn't use anything up.
+	if _, err := d.Deal(1); !errors.Is(err, ErrEmptyDeck) {
+		t.Errorf("Deal(1) from an empty deck: got %v, want ErrEmptyDeck", err)
+	}
+	if err := d.Burn(); !errors.Is(err, ErrEmptyDeck) {
+		t.Errorf("Burn() from an empty deck: got %v, want ErrEmptyDeck", err)
+	}
+	d.Shuffle(rand.New(rand.NewSource(2))) // puts everything back.
+	if _, err := d.Deal(53); !errors.Is(err, ErrEmptyDeck) || d.Remaining() != 52 {
+		t.Errorf("Deal(53): got %v with %d left, want ErrEmptyDeck with 52", err, d.Remaining())
+	}
+	if _, err := d.Deal(-1); err == nil {
+		t.Error("Deal(-1): want an error")
+	}
+	// the same seed shuffles the same way.
+	again := NewDeck()
+	again.Shuffle(rand.New(rand.NewSource(1)))
+	if !reflect.DeepEqual(order, again.Cards()) {
+		t.Error("the same seed shuffled two decks differently")
+	}
+}
+
+func TestNewSeededGame(t *testing.T) {
+	play := func(seed int64) []Event {
+		g := NewSeededGame([]string{"A", "B", "C"}, startingSmallBlind, seed)
+		if g.Seed() != seed {
+			t.Fatalf("Seed: got %d, want %d", g.Seed(), seed)
+		}
+		if _, err := g.Play(script(g, func(g *Game) Action { return act(g, CHECK_CALL, 0) })); err != nil {
+			t.Fatal(err)
+		}
+		return g.Events()
+	}
+	if a, b := play(7), play(7); !reflect.DeepEqual(a, b) {
+		t.Error("the same seed played two different games")
+	}
+	if a, b := play(7), play(8); reflect.DeepEqual(a, b) {
+		t.Error("different seeds played the same game")
+	}
+	if seed := NewGame([]string{"A", "B"}, startingSmallBlind).Seed(); seed == 0 {
+		t.Error("NewGame: want a random seed, got 0")
+	}
+}
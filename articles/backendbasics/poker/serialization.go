@@ -1 +1,36 @@
 package poker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// WriteEvents writes events to w as newline-delimited JSON: one event per line.
+func WriteEvents(w io.Writer, events []Event) error {
+	enc := json.NewEncoder(w)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("writing event %d: %w", e.Seq, err)
+		}
+	}
+	return nil
+}
+
+// ReadEvents reads newline-delimited JSON events, as written by WriteEvents, until EOF.
+func ReadEvents(r io.Reader) ([]Event, error) {
+	var events []Event
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var e Event
+		switch err := dec.Decode(&e); err {
+		case nil:
+			events = append(events, e)
+		case io.EOF:
+			return events, nil
+		default:
+			return events, fmt.Errorf("reading event %d: %w", len(events), err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package poker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Variant is a way to play hold'em: how many hole cards everyone gets, how many of them a hand has to use, and what's in the deck.
+// Everything else, the blinds, the betting, and the board, is the same. The zero Variant is Holdem. See GameOpts.
+type Variant struct {
+	Name      string
+	HoleCards int  // how many cards each player is dealt. Zero means 2.
+	MustUse   int  // exactly how many hole cards a hand has to use. Zero means any number, from none of them to all of them.
+	Short     bool // a 36-card deck, sixes through aces, where a flush beats a full house, and A 6 7 8 9 is the lowest straight.
+}
+
+var (
+	Holdem    = Variant{Name: "Texas Hold'em", HoleCards: 2}
+	Omaha     = Variant{Name: "Omaha", HoleCards: 4, MustUse: 2}
+	ShortDeck = Variant{Name: "Short-deck Hold'em", HoleCards: 2, Short: true}
+)
+
+// Variants are the variants that come with the package, by a short name: i.e, for a command-line flag.
+var Variants = map[string]Variant{"holdem": Holdem, "omaha": Omaha, "shortdeck": ShortDeck}
+
+func (v Variant) String() string {
+	if v.Name == "" {
+		return Holdem.Name
+	}
+	return v.Name
+}
+
+// holeCards is how many cards each player is dealt.
+func (v Variant) holeCards() int {
+	if v.HoleCards == 0 {
+		return 2
+	}
+	return v.HoleCards
+}
+
+// Deck returns a new, unshuffled deck for v: every card, or for a short deck, sixes and up.
+func (v Variant) Deck() Deck {
+	d := NewDeck()
+	if v.Short {
+		short := d.cards[:0]
+		for _, c := range d.cards {
+			if c.Rank == Ace || c.Rank >= Six {
+				short = append(short, c)
+			}
+		}
+		d.cards = short
+	}
+	return d
+}
+
+// Hand returns the best hand a player holding hole can make with the five cards on the board, by v's rules.
+func (v Variant) Hand(hole []Card, board *[5]Card) Hand {
+	if v.MustUse == 0 {
+		return bestHand5(append(append(make([]Card, 0, len(hole)+5), hole...), board[:]...), v.Short)
+	}
+	// i.e, in omaha, every two of the four hole cards, with every three of the board.
+	var best Hand
+	var five [5]Card
+	choose(hole, v.MustUse, func(fromHole []Card) {
+		choose(board[:], 5-v.MustUse, func(fromBoard []Card) {
+			copy(five[copy(five[:], fromHole):], fromBoard)
+			if h := evalHand(five, v.Short); h.Greater(best) {
+				best = h
+			}
+		})
+	})
+	return best
+}
+
+// check returns an error if hole isn't a hand v could deal, or a card in hole or community isn't in v's deck, or is there twice.
+func (v Variant) check(hole, community []Card) error {
+	if len(hole) != v.holeCards() {
+		return fmt.Errorf("%s deals %d hole cards, not %d", v, v.holeCards(), len(hole))
+	}
+	d := v.Deck()
+	inDeck := make(map[Card]bool, d.Len())
+	for _, c := range d.cards {
+		inDeck[c] = true
+	}
+	seen := make(map[Card]bool, len(hole)+len(community))
+	for _, c := range append(append([]Card(nil), hole...), community...) {
+		switch {
+		case !inDeck[c]:
+			return fmt.Errorf("invalid card %#v: not in a %s deck", c, strings.ToLower(v.String()))
+		case seen[c]:
+			return fmt.Errorf("%s is dealt twice", c)
+		}
+		seen[c] = true
+	}
+	return nil
+}
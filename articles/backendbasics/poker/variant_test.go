@@ -0,0 +1,129 @@
+package poker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVariantHand(t *testing.T) {
+	board := func(notations ...string) *[5]Card { return (*[5]Card)(cards(t, notations...)) }
+	for _, tt := range []struct {
+		name         string
+		v            Variant
+		hole         []Card
+		board        *[5]Card
+		want         HandKind
+		wantHigh     Rank
+		beats, loses []Card // a hole that v makes into a worse hand, and a better one, on the same board.
+	}{
+		{
+			name: "omaha: four hearts in the hand and one on the board is no flush",
+			v:    Omaha, hole: cards(t, "AH", "KH", "QH", "JH"), board: board("2H", "7C", "8D", "3S", "9C"),
+			want: HighCard, wantHigh: Ace,
+		},
+		{
+			name: "omaha: two from the hand, three from the board",
+			v:    Omaha, hole: cards(t, "AH", "KH", "2C", "3D"), board: board("4H", "7H", "9H", "QS", "QC"),
+			want: Flush, wantHigh: Ace,
+		},
+		{
+			name: "omaha: the board's quads only play with two of your own",
+			v:    Omaha, hole: cards(t, "2C", "3D", "4H", "5S"), board: board("KS", "KH", "KD", "KC", "AS"),
+			want: ThreeOfAKind, wantHigh: King,
+		},
+		{
+			name: "hold'em plays the board",
+			v:    Holdem, hole: cards(t, "2C", "3D"), board: board("KS", "KH", "KD", "KC", "AS"),
+			want: FourOfAKind, wantHigh: King,
+		},
+		{
+			name: "short deck: A 6 7 8 9 is a straight",
+			v:    ShortDeck, hole: cards(t, "AS", "6H"), board: board("7D", "8C", "9S", "KH", "QD"),
+			want: Straight, wantHigh: Nine,
+			beats: cards(t, "AH", "KC"), loses: cards(t, "TD", "6C"),
+		},
+		{
+			name: "short deck: a flush beats a full house",
+			v:    ShortDeck, hole: cards(t, "AH", "6H"), board: board("7H", "8H", "KH", "KS", "KD"),
+			want: Flush, wantHigh: Ace,
+			beats: cards(t, "AS", "AD"), // aces full.
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.v.Hand(tt.hole, tt.board)
+			if got.Kind != tt.want || got.High != tt.wantHigh {
+				t.Fatalf("got %s, want %s, %s high", got, tt.want, tt.wantHigh)
+			}
+			if tt.beats != nil {
+				if worse := tt.v.Hand(tt.beats, tt.board); !got.Greater(worse) {
+					t.Errorf("%s should beat %s", got, worse)
+				}
+			}
+			if tt.loses != nil {
+				if better := tt.v.Hand(tt.loses, tt.board); !got.Less(better) {
+					t.Errorf("%s should lose to %s", got, better)
+				}
+			}
+		})
+	}
+}
+
+func TestVariantDeck(t *testing.T) {
+	for v, want := range map[Variant]int{Holdem: 52, Omaha: 52, ShortDeck: 36, {}: 52} {
+		if d := v.Deck(); d.Len() != want {
+			t.Errorf("%s: got %d cards, want %d", v, d.Len(), want)
+		}
+	}
+	short := ShortDeck.Deck()
+	for _, c := range short.Cards() {
+		if c.Rank != Ace && c.Rank < Six {
+			t.Errorf("short deck has %s", c)
+		}
+	}
+}
+
+func TestGameVariant(t *testing.T) {
+	for _, v := range []Variant{Omaha, ShortDeck} {
+		t.Run(v.String(), func(t *testing.T) {
+			g := NewSeededGame([]string{"A", "B", "C", "D"}, startingSmallBlind, 5, GameOpts{Variant: v})
+			if g.Variant() != v {
+				t.Fatalf("Variant: got %s, want %s", g.Variant(), v)
+			}
+			inDeck := make(map[Card]bool)
+			d := v.Deck()
+			for _, c := range d.Cards() {
+				inDeck[c] = true
+			}
+			actions := script(g, func(g *Game) Action {
+				if view := g.view(); len(view.Hole) != v.holeCards() || view.Variant != v {
+					t.Fatalf("%s sees %+v", view.Name, view)
+				}
+				if p := g.players[g.position]; p.Name == "A" {
+					return act(g, RAISE, max(2*g.currentBet, 2*g.smallBlind, g.pot))
+				}
+				return act(g, CHECK_CALL, 0)
+			})
+			if _, err := g.Play(actions); err != nil {
+				t.Fatal(err)
+			}
+			events := g.Events()
+			for _, e := range events {
+				for _, c := range e.Cards {
+					if !inDeck[c] {
+						t.Fatalf("event %d: %s isn't in a %s deck", e.Seq, c, v)
+					}
+				}
+				if e.Kind == EventDeal && len(e.Cards) != v.holeCards() {
+					t.Fatalf("event %d: dealt %v", e.Seq, e.Cards)
+				}
+			}
+			got, err := Replay(events)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := g.Snapshot(); !reflect.DeepEqual(got, want) {
+				t.Fatalf("replay got\n%+v\nwant\n%+v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package backendbasics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ParseRequest and ParseResponse need the whole message up front, but on a real socket you don't know where a message ends until you've parsed it:
+// the headers end at the first empty line, and the body ends after Content-Length bytes.
+// ReadRequest and ReadResponse read exactly one message from a *bufio.Reader, a line at a time, leaving the rest for the next call:
+//
+//	conn, _ := net.Dial("tcp", "eblog.fly.dev:80")
+//	req := Request{Method: "GET", Path: "/", Headers: Headers{{"Host", "eblog.fly.dev"}}}
+//	req.WriteTo(conn)
+//	resp, err := ReadResponse(bufio.NewReader(conn))
+
+// limits on what ReadRequest and ReadResponse will read, so a misbehaving peer can't make us buffer forever.
+const (
+	maxLineBytes = 8 << 10  // per line: the request line, status line, or a header.
+	maxHeaders   = 100      // per message.
+	maxBodyBytes = 10 << 20 // per message.
+)
+
+// ReadRequest reads one HTTP/1.1 request from r.
+// The body is Content-Length bytes long, or, if there's no Content-Length, empty.
+// Chunked request bodies aren't supported.
+// If r is at EOF before the request starts, i.e, the client hung up, the error wraps io.EOF.
+func ReadRequest(r *bufio.Reader) (req Request, err error) {
+	line, err := readFirstLine(r)
+	if err != nil {
+		return Request{}, fmt.Errorf("reading request line: %w", err)
+	}
+	first := strings.Fields(line)
+	if len(first) != 3 {
+		return Request{}, fmt.Errorf("malformed request line %q: should be of form 'METHOD /path HTTP/1.1'", line)
+	}
+	req.Method, req.Path = first[0], first[1]
+	if !strings.HasPrefix(req.Path, "/") {
+		return Request{}, fmt.Errorf("malformed request line %q: path should start with /", line)
+	}
+	if !strings.HasPrefix(first[2], "HTTP/") {
+		return Request{}, fmt.Errorf("malformed request line %q: should end with the HTTP version", line)
+	}
+	if req.Headers, err = readHeaders(r); err != nil {
+		return Request{}, err
+	}
+	if req.Host() == "" {
+		return Request{}, errors.New("malformed request: missing Host header")
+	}
+	if chunked(req.Headers) {
+		return Request{}, errors.New("chunked request bodies aren't supported")
+	}
+	if req.Body, err = readBody(r, req.Headers, false); err != nil {
+		return Request{}, err
+	}
+	return req, nil
+}
+
+// ReadResponse reads one HTTP/1.1 response from r. The body is, in order of preference:
+//   - empty, for a 1xx, 204 No Content, or 304 Not Modified.
+//   - Content-Length bytes long,
+//   - decoded from chunks, for Transfer-Encoding: chunked,
+//   - or everything until the server closes the connection.
+//
+// A response to a HEAD request has a Content-Length but no body: ReadResponse can't tell, so don't use it for those.
+func ReadResponse(r *bufio.Reader) (*Response, error) { return readResponse(r, false) }
+
+// readResponse is ReadResponse; if head is set, the response is to a HEAD request, so it has no body no matter what the headers say.
+func readResponse(r *bufio.Reader, head bool) (*Response, error) {
+	line, err := readFirstLine(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading status line: %w", err)
+	}
+	version, rest, _ := strings.Cut(line, " ")
+	code, _, _ := strings.Cut(rest, " ") // the status text is optional, and we don't need it.
+	if !strings.HasPrefix(version, "HTTP/") {
+		return nil, fmt.Errorf("malformed status line %q: should start with the HTTP version", line)
+	}
+	resp := new(Response)
+	if resp.StatusCode, err = strconv.Atoi(code); err != nil || len(code) != 3 {
+		return nil, fmt.Errorf("malformed status line %q: expected a 3-digit status code, got %q", line, code)
+	}
+	if resp.Headers, err = readHeaders(r); err != nil {
+		return nil, err
+	}
+	switch {
+	case head, resp.StatusCode/100 == 1, resp.StatusCode == 204, resp.StatusCode == 304: // no body.
+	case chunked(resp.Headers):
+		resp.Body, err = readChunked(r)
+	default:
+		resp.Body, err = readBody(r, resp.Headers, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// readLine reads a line ending in "\r\n" (or just "\n", to be lenient), returning it without the line ending.
+func readLine(r *bufio.Reader) (string, error) {
+	var b []byte
+	for {
+		chunk, isPrefix, err := r.ReadLine() // ReadLine strips the "\r\n" or "\n" for us.
+		if err != nil {
+			if err == io.EOF && len(b) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+		if b = append(b, chunk...); len(b) > maxLineBytes {
+			return "", fmt.Errorf("line too long: over %d bytes", maxLineBytes)
+		}
+		if !isPrefix {
+			return string(b), nil
+		}
+	}
+}
+
+// readFirstLine reads the request or status line, skipping empty lines before it:
+// RFC 9112 says to, and our own WriteTo leaves one after the body.
+func readFirstLine(r *bufio.Reader) (string, error) {
+	for i := 0; ; i++ {
+		line, err := readLine(r)
+		if err != nil || line != "" {
+			return line, err
+		}
+		if i == 8 {
+			return "", errors.New("too many empty lines before the message")
+		}
+	}
+}
+
+// readHeaders reads headers up to and including the empty line that ends them.
+func readHeaders(r *bufio.Reader) (Headers, error) {
+	var headers Headers
+	for {
+		line, err := readLine(r)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF // we haven't seen the empty line yet.
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading headers: %w", err)
+		}
+		if line == "" {
+			return headers, nil
+		}
+		if isObsFold(line) {
+			return nil, fmt.Errorf("malformed header %q: starts with whitespace (obsolete line folding)", line)
+		}
+		if len(headers) == maxHeaders {
+			return nil, fmt.Errorf("too many headers: over %d", maxHeaders)
+		}
+		key, val, ok := strings.Cut(line, ":")
+		if !ok || key == "" || strings.TrimSpace(key) != key {
+			return nil, fmt.Errorf("malformed header %q: should be of form 'key: value'", line)
+		}
+		headers = append(headers, Header{AsTitle(key), strings.TrimSpace(val)})
+	}
+}
+
+// chunked reports whether the body is chunked: if it is, that's the last transfer coding, as in "Transfer-Encoding: gzip, chunked".
+func chunked(headers Headers) bool {
+	codings := headers.Values("Transfer-Encoding")
+	return len(codings) > 0 && strings.EqualFold(codings[len(codings)-1], "chunked")
+}
+
+// readBody reads a body of Content-Length bytes. Without a Content-Length, it reads until EOF if untilEOF is set,
+// and otherwise reads nothing.
+func readBody(r *bufio.Reader, headers Headers, untilEOF bool) (string, error) {
+	cl := headers.Get("Content-Length") // two different Content-Lengths are joined into something that won't parse, as they should be.
+	if cl == "" {
+		if !untilEOF {
+			return "", nil
+		}
+		b, err := io.ReadAll(io.LimitReader(r, maxBodyBytes+1))
+		if err != nil {
+			return "", fmt.Errorf("reading body: %w", err)
+		}
+		if len(b) > maxBodyBytes {
+			return "", fmt.Errorf("body too long: over %d bytes", maxBodyBytes)
+		}
+		return string(b), nil
+	}
+	n, err := strconv.Atoi(cl)
+	if err != nil || n < 0 {
+		return "", fmt.Errorf("malformed Content-Length %q", cl)
+	}
+	if n > maxBodyBytes {
+		return "", fmt.Errorf("body too long: Content-Length %d is over %d bytes", n, maxBodyBytes)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", fmt.Errorf("reading %d-byte body: %w", n, err)
+	}
+	return string(b), nil
+}
+
+// readChunked reads a chunked body: a series of "size in hex\r\n" "data\r\n", ending with a 0-size chunk and optional trailers,
+// which we throw away. See RFC 9112, section 7.1.
+func readChunked(r *bufio.Reader) (string, error) {
+	var body strings.Builder
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return "", fmt.Errorf("reading chunk size: %w", err)
+		}
+		line, _, _ = strings.Cut(line, ";") // drop chunk extensions.
+		size, err := strconv.ParseInt(strings.TrimSpace(line), 16, 64)
+		if err != nil || size < 0 {
+			return "", fmt.Errorf("malformed chunk size %q", line)
+		}
+		if size == 0 {
+			if _, err := readHeaders(r); err != nil { // trailers.
+				return "", err
+			}
+			return body.String(), nil
+		}
+		if int64(body.Len())+size > maxBodyBytes {
+			return "", fmt.Errorf("body too long: over %d bytes", maxBodyBytes)
+		}
+		if _, err := io.CopyN(&body, r, size); err != nil {
+			return "", fmt.Errorf("reading %d-byte chunk: %w", size, err)
+		}
+		if line, err := readLine(r); err != nil || line != "" {
+			return "", fmt.Errorf("chunk of %d bytes isn't followed by a line ending", size)
+		}
+	}
+}
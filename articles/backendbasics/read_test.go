@@ -0,0 +1,120 @@
+package backendbasics
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadRequest(t *testing.T) {
+	// two requests, back to back, as on a keep-alive connection: each should stop exactly where it ends.
+	post := Request{Method: "POST", Path: "/echo", Headers: []Header{{"Host", "localhost"}, {"Content-Length", "10"}}, Body: "hello\r\nfoo"}
+	get := Request{Method: "GET", Path: "/", Headers: []Header{{"Host", "localhost"}}}
+	r := bufio.NewReader(strings.NewReader(post.String() + get.String()))
+	for _, want := range []Request{post, get} {
+		got, err := ReadRequest(r)
+		if err != nil {
+			t.Fatalf("ReadRequest: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ReadRequest = %#+v, want %#+v", got, want)
+		}
+	}
+	if _, err := ReadRequest(r); !errors.Is(err, io.EOF) {
+		t.Errorf("at the end: got %v, want io.EOF", err)
+	}
+
+	for name, raw := range map[string]string{
+		"no host":          "GET / HTTP/1.1\r\nAccept: */*\r\n\r\n",
+		"bad request line": "GET /\r\nHost: localhost\r\n\r\n",
+		"bad header":       "GET / HTTP/1.1\r\nHost localhost\r\n\r\n",
+		"short body":       "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10\r\n\r\nabc",
+		"no end":           "GET / HTTP/1.1\r\nHost: localhost\r\n",
+		"chunked":          "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+		"long line":        "GET /" + strings.Repeat("a", maxLineBytes) + " HTTP/1.1\r\nHost: localhost\r\n\r\n",
+	} {
+		if _, err := ReadRequest(bufio.NewReader(strings.NewReader(raw))); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestReadResponse(t *testing.T) {
+	for name, tt := range map[string]struct {
+		raw  string
+		want *Response
+	}{
+		"content-length": {
+			raw:  "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello, and then the next response",
+			want: &Response{StatusCode: 200, Headers: []Header{{"Content-Length", "5"}}, Body: "hello"},
+		},
+		"chunked": {
+			raw:  "HTTP/1.1 200 OK\r\ntransfer-encoding: chunked\r\n\r\n5\r\nhello\r\n7;ext=1\r\n, world\r\n0\r\nTrailer: x\r\n\r\n",
+			want: &Response{StatusCode: 200, Headers: []Header{{"Transfer-Encoding", "chunked"}}, Body: "hello, world"},
+		},
+		"gzip, chunked": { // chunked is the last coding, so it's still chunked.
+			raw:  "HTTP/1.1 200 OK\r\nTransfer-Encoding: gzip, chunked\r\n\r\n2\r\nhi\r\n0\r\n\r\n",
+			want: &Response{StatusCode: 200, Headers: Headers{{"Transfer-Encoding", "gzip, chunked"}}, Body: "hi"},
+		},
+		"until EOF": {
+			raw:  "HTTP/1.0 404 Not Found\r\nConnection: close\r\n\r\nnot here",
+			want: &Response{StatusCode: 404, Headers: []Header{{"Connection", "close"}}, Body: "not here"},
+		},
+		"no content": {
+			raw:  "HTTP/1.1 204\r\nX-Empty: yes\r\n\r\n",
+			want: &Response{StatusCode: 204, Headers: []Header{{"X-Empty", "yes"}}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := ReadResponse(bufio.NewReader(strings.NewReader(tt.raw)))
+			if err != nil {
+				t.Fatalf("ReadResponse(%q): %v", tt.raw, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadResponse(%q) = %#+v, want %#+v", tt.raw, got, tt.want)
+			}
+		})
+	}
+
+	for name, raw := range map[string]string{
+		"bad status":     "HTTP/1.1 2000 OK\r\n\r\n",
+		"not http":       "SSH-2.0-OpenSSH\r\n\r\n",
+		"bad chunk":      "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n",
+		"bad length":     "HTTP/1.1 200 OK\r\nContent-Length: -1\r\n\r\n",
+		"too big":        "HTTP/1.1 200 OK\r\nContent-Length: 999999999\r\n\r\n",
+		"missing header": "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n",
+	} {
+		if _, err := ReadResponse(bufio.NewReader(strings.NewReader(raw))); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// TestReadOverConn reads a request and its response over a real connection, one message at a time.
+func TestReadOverConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		req, err := ReadRequest(bufio.NewReader(server))
+		if err != nil {
+			t.Errorf("server: ReadRequest: %v", err)
+			return
+		}
+		resp := &Response{StatusCode: 200, Headers: []Header{{"Content-Length", "11"}}, Body: "you sent " + req.Body}
+		resp.WriteTo(server)
+	}()
+	req := Request{Method: "POST", Path: "/", Headers: []Header{{"Host", "localhost"}, {"Content-Length", "2"}}, Body: "hi"}
+	go req.WriteTo(client) // net.Pipe is unbuffered: the server reads while we write.
+	resp, err := ReadResponse(bufio.NewReader(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Body != "you sent hi" {
+		t.Errorf("got body %q, want \"you sent hi\"", resp.Body)
+	}
+}
@@ -0,0 +1,114 @@
+package backendbasics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// idleTimeout is how long Serve waits for the next request on a connection before hanging up.
+const idleTimeout = 2 * time.Minute
+
+// Serve accepts connections on l and answers the requests on each with handler, until l is closed.
+// It's a complete, if tiny, HTTP/1.1 server built on ReadRequest: net/http clients can talk to it.
+//
+//   - Connections are kept alive for the next request, unless the client sends "Connection: close" or the handler's response does.
+//   - Content-Length is filled in if the handler didn't set it.
+//   - A request that doesn't parse gets a 400 Bad Request, and the connection is closed, since we don't know where the next request starts.
+//   - A handler that panics gets the client a 500 Internal Server Error, and the connection is closed.
+//
+// Like http.Serve, it always returns a non-nil error: whatever l.Accept returned.
+func Serve(l net.Listener, handler func(Request) Response) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go serveConn(conn, handler)
+	}
+}
+
+// serveConn answers requests on conn until one of us closes it.
+func serveConn(conn net.Conn, handler func(Request) Response) {
+	defer conn.Close()
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		req, err := ReadRequest(r)
+		if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || errors.Is(err, os.ErrDeadlineExceeded) {
+			return // the client hung up, or went quiet: that's normal.
+		}
+		var resp Response
+		if err != nil {
+			resp = Response{StatusCode: http.StatusBadRequest, Body: err.Error(), Headers: Headers{{"Connection", "close"}}}
+		} else {
+			resp = callHandler(handler, req)
+			resp.Headers = slices.Clone(resp.Headers) // we're about to add to them: don't touch the handler's copy.
+		}
+		closing := err != nil || hasToken(req.Headers, "Connection", "close") || hasToken(resp.Headers, "Connection", "close")
+		if closing && !hasToken(resp.Headers, "Connection", "close") {
+			resp.Headers.Add("Connection", "close") // tell the client, so it doesn't try to send us another one.
+		}
+		if err := writeResponse(w, resp); err != nil {
+			return
+		}
+		if closing {
+			return
+		}
+	}
+}
+
+// callHandler calls handler, turning a panic into a 500 that closes the connection.
+func callHandler(handler func(Request) Response, req Request) (resp Response) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("backendbasics.Serve: %s %s: panic: %v", req.Method, req.Path, p)
+			resp = Response{StatusCode: http.StatusInternalServerError, Body: "internal server error", Headers: Headers{{"Connection", "close"}}}
+		}
+	}()
+	return handler(req)
+}
+
+// hasToken reports whether the header with the given key has token in its comma-separated list, ignoring case: i.e, "Connection: keep-alive, close" has "close".
+func hasToken(h Headers, key, token string) bool {
+	for _, v := range h.Values(key) {
+		if strings.EqualFold(v, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeResponse writes resp to w and flushes it, filling in the status and Content-Length if they're missing.
+func writeResponse(w *bufio.Writer, resp Response) error {
+	if resp.StatusCode == 0 {
+		resp.StatusCode = http.StatusOK
+	}
+	if resp.Headers.Get("Content-Length") == "" {
+		resp.Headers.Set("Content-Length", strconv.Itoa(len(resp.Body)))
+	}
+	return writeMessage(w, fmt.Sprintf("HTTP/1.1 %d %s", resp.StatusCode, http.StatusText(resp.StatusCode)), resp.Headers, resp.Body)
+}
+
+// writeMessage writes a request or response to w and flushes it.
+// Unlike Request.WriteTo and Response.WriteTo, it doesn't write an extra line ending after the body:
+// on a kept-alive connection, the other side would take that as the start of the next message.
+func writeMessage(w *bufio.Writer, first string, headers Headers, body string) error {
+	w.WriteString(first)
+	w.WriteString("\r\n")
+	for _, h := range headers {
+		fmt.Fprintf(w, "%s: %s\r\n", h.Key, h.Value)
+	}
+	w.WriteString("\r\n")
+	w.WriteString(body)
+	return w.Flush()
+}
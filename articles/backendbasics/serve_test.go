@@ -0,0 +1,106 @@
+package backendbasics
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestServe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go Serve(l, func(req Request) Response {
+		switch req.Path {
+		case "/echo":
+			return Response{StatusCode: 200, Body: req.Method + " " + req.Body, Headers: Headers{{"Content-Type", "text/plain"}}}
+		case "/bye":
+			return Response{StatusCode: 200, Body: "bye", Headers: Headers{{"Connection", "close"}}}
+		case "/panic":
+			panic("oops")
+		default:
+			return Response{StatusCode: 404, Body: "not found"}
+		}
+	})
+	base := "http://" + l.Addr().String()
+
+	// a net/http client should reuse its connection, since we keep it alive.
+	client := &http.Client{}
+	var reused []bool
+	get := func(method, path, body string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, base+path, strings.NewReader(body))
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) { reused = append(reused, info.Reused) },
+		}))
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("%s %s: reading body: %v", method, path, err)
+		}
+		return resp, string(b)
+	}
+	for _, tt := range []struct {
+		method, path, body string
+		wantStatus         int
+		wantBody           string
+	}{
+		{"GET", "/echo", "", 200, "GET "},
+		{"POST", "/echo", "hello, world", 200, "POST hello, world"},
+		{"GET", "/missing", "", 404, "not found"},
+		{"GET", "/bye", "", 200, "bye"},
+		{"GET", "/echo", "", 200, "GET "}, // on a new connection, since /bye closed the last one.
+		{"GET", "/panic", "", 500, "internal server error"},
+	} {
+		resp, body := get(tt.method, tt.path, tt.body)
+		if resp.StatusCode != tt.wantStatus || body != tt.wantBody {
+			t.Errorf("%s %s: got %d %q, want %d %q", tt.method, tt.path, resp.StatusCode, body, tt.wantStatus, tt.wantBody)
+		}
+	}
+	if want := []bool{false, true, true, true, false, true}; !slices.Equal(reused, want) {
+		t.Errorf("got connections reused %v, want %v", reused, want)
+	}
+
+	// the client asking to close works, too.
+	req, _ := http.NewRequest("GET", base+"/echo", nil)
+	req.Close = true // sends Connection: close
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !resp.Close {
+		t.Error("expected the server to close the connection when asked")
+	}
+
+	// garbage gets a 400, then the connection's closed.
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET / HTTP/1.1\r\nno colon here\r\n\r\n")
+	br := bufio.NewReader(conn)
+	resp, err = http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body) // Close won't read the rest of the body for us, since the connection's closing anyways.
+	if resp.StatusCode != 400 || !resp.Close {
+		t.Errorf("malformed request: got %d, close=%v, want 400 and close", resp.StatusCode, resp.Close)
+	}
+	if rest, err := io.ReadAll(br); err != nil || len(rest) > 0 {
+		t.Errorf("after a 400: got %q, %v, want the connection closed", rest, err)
+	}
+}
@@ -0,0 +1,366 @@
+package backendbasics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Sessions are the chess games the handlers serve, kept in Store.
+// The zero Sessions keeps them in memory, forever: a new MemoryStore with no TTL.
+type Sessions struct {
+	Store GameStore
+
+	once     sync.Once
+	watchers watchers // connections to LiveHandler, by game.
+}
+
+// store returns s.Store, defaulting it to a MemoryStore the first time it's needed.
+func (s *Sessions) store() GameStore {
+	s.once.Do(func() {
+		if s.Store == nil {
+			s.Store = new(MemoryStore)
+		}
+	})
+	return s.Store
+}
+
+// NewGame starts a game between white and black from StartPosition, with a random ID.
+func (s *Sessions) NewGame(ctx context.Context, white, black string) (*Game, error) {
+	g := &Game{ID: uuid.NewString(), White: white, Black: black, Start: StartPosition(), Position: StartPosition()}
+	if err := s.store().Create(ctx, g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// ErrNoGame is returned by a GameStore for a game it doesn't have: it never did, or it's been deleted or expired.
+var ErrNoGame = errors.New("no such game")
+
+// GameStore keeps chess games. Implementations must be safe for concurrent use.
+type GameStore interface {
+	// Create adds a new game. It's an error if one with the same ID exists.
+	Create(ctx context.Context, g *Game) error
+	// Get returns a copy of the game with the given ID, or ErrNoGame.
+	Get(ctx context.Context, id string) (*Game, error)
+	// Update calls f with the game with the given ID, and saves whatever f does to it, unless f returns an error,
+	// or the game's deleted or expired before f returns: then it's ErrNoGame.
+	// No one else can update that game until f returns: f should be quick.
+	Update(ctx context.Context, id string, f func(*Game) error) error
+	// Delete removes the game with the given ID, or returns ErrNoGame.
+	Delete(ctx context.Context, id string) error
+	// List returns a copy of every game, most recently updated first.
+	List(ctx context.Context) ([]*Game, error)
+}
+
+// MemoryStore is a GameStore that keeps games in memory. The zero MemoryStore is ready to use.
+type MemoryStore struct {
+	// TTL, if nonzero, is how long a game can go without an update before it's evicted: abandoned games don't pile up forever.
+	TTL time.Duration
+
+	mux   sync.RWMutex
+	games map[string]*memGame
+	now   func() time.Time // time.Now, except in tests.
+}
+
+// memGame is a game and its lock, so updating one game doesn't block the rest.
+// mux keeps Updates to this game in line. game and updated are only written holding both it and MemoryStore.mux,
+// so either one is enough to read them. Lock mux first, never the other way around.
+type memGame struct {
+	mux     sync.Mutex
+	game    *Game
+	updated time.Time
+}
+
+func (m *MemoryStore) clock() time.Time {
+	if m.now != nil {
+		return m.now()
+	}
+	return time.Now()
+}
+
+func (m *MemoryStore) expired(g *memGame, now time.Time) bool {
+	return m.TTL > 0 && now.Sub(g.updated) > m.TTL
+}
+
+// sweep evicts expired games. m.mux must be held for writing.
+func (m *MemoryStore) sweep(now time.Time) {
+	for id, g := range m.games {
+		if m.expired(g, now) {
+			delete(m.games, id)
+		}
+	}
+}
+
+func (m *MemoryStore) Create(_ context.Context, g *Game) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	now := m.clock()
+	m.sweep(now) // creating games is what fills up the map, so it's where we empty it, too.
+	if m.games == nil {
+		m.games = make(map[string]*memGame)
+	}
+	if _, ok := m.games[g.ID]; ok {
+		return fmt.Errorf("create game %q: already exists", g.ID)
+	}
+	m.games[g.ID] = &memGame{game: g.clone(), updated: now}
+	return nil
+}
+
+// find returns the unexpired game with the given ID. m.mux must be held.
+func (m *MemoryStore) find(id string) (*memGame, error) {
+	g, ok := m.games[id]
+	if !ok || m.expired(g, m.clock()) {
+		return nil, ErrNoGame
+	}
+	return g, nil
+}
+
+func (m *MemoryStore) Get(_ context.Context, id string) (*Game, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	g, err := m.find(id)
+	if err != nil {
+		return nil, err
+	}
+	return g.game.clone(), nil
+}
+
+func (m *MemoryStore) Update(_ context.Context, id string, f func(*Game) error) error {
+	m.mux.RLock() // read lock; check for this id
+	g, err := m.find(id)
+	m.mux.RUnlock() // f might be slow: don't hold up the rest of the games while it runs.
+	if err != nil {
+		return err
+	}
+	g.mux.Lock()         // obtain a write lock on THIS game
+	defer g.mux.Unlock() // unlock THIS game when we're done
+	updated := g.game.clone()
+	if err := f(updated); err != nil {
+		return err // f's changes, if any, are thrown away.
+	}
+	updated.ID = id // f doesn't get to move it.
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if cur, err := m.find(id); err != nil || cur != g { // deleted or evicted while f ran: don't save to a game no one can see.
+		return ErrNoGame
+	}
+	g.game, g.updated = updated, m.clock()
+	return nil
+}
+
+func (m *MemoryStore) Delete(_ context.Context, id string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	g, ok := m.games[id]
+	if !ok || m.expired(g, m.clock()) {
+		return ErrNoGame
+	}
+	delete(m.games, id)
+	return nil
+}
+
+func (m *MemoryStore) List(_ context.Context) ([]*Game, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.sweep(m.clock())
+	type entry struct {
+		game    *Game
+		updated time.Time
+	}
+	entries := make([]entry, 0, len(m.games))
+	for _, g := range m.games {
+		entries = append(entries, entry{g.game.clone(), g.updated})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].updated.After(entries[j].updated) })
+	games := make([]*Game, len(entries))
+	for i := range entries {
+		games[i] = entries[i].game
+	}
+	return games, nil
+}
+
+// PostgresStore is a GameStore in a Postgres database, so games survive a restart. Connect to the database as in cmd/dbping, then call Migrate once.
+// Each game is stored as its PGN, which has everything needed to replay it: see Game.PGN and ParsePGN.
+type PostgresStore struct {
+	DB *sql.DB
+	// TTL, if nonzero, is how long a game can go without an update before it's deleted, as in MemoryStore.
+	TTL time.Duration
+}
+
+// Migrate creates the chess_games table, if it doesn't exist.
+func (p *PostgresStore) Migrate(ctx context.Context) error {
+	_, err := p.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS chess_games (
+	id         TEXT PRIMARY KEY,
+	pgn        TEXT NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+)`)
+	return err
+}
+
+// sweep deletes expired games.
+func (p *PostgresStore) sweep(ctx context.Context, q interface {
+	ExecContext(context.Context, string, ...any) (sql.Result, error)
+}) error {
+	if p.TTL <= 0 {
+		return nil
+	}
+	_, err := q.ExecContext(ctx, `DELETE FROM chess_games WHERE updated_at < $1`, time.Now().Add(-p.TTL))
+	return err
+}
+
+func (p *PostgresStore) Create(ctx context.Context, g *Game) error {
+	pgn, err := g.PGN()
+	if err != nil {
+		return fmt.Errorf("create game %q: %w", g.ID, err)
+	}
+	if err := p.sweep(ctx, p.DB); err != nil {
+		return fmt.Errorf("create game %q: evicting expired games: %w", g.ID, err)
+	}
+	if _, err := p.DB.ExecContext(ctx, `INSERT INTO chess_games (id, pgn, updated_at) VALUES ($1, $2, $3)`, g.ID, pgn, time.Now()); err != nil {
+		return fmt.Errorf("create game %q: %w", g.ID, err)
+	}
+	return nil
+}
+
+// scanGame turns a row of (id, pgn, updated_at) back into a Game, or ErrNoGame if the row doesn't exist or has expired.
+func (p *PostgresStore) scanGame(row interface{ Scan(...any) error }) (*Game, error) {
+	var id, pgn string
+	var updated time.Time
+	if err := row.Scan(&id, &pgn, &updated); errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoGame
+	} else if err != nil {
+		return nil, err
+	}
+	if p.TTL > 0 && time.Since(updated) > p.TTL {
+		return nil, ErrNoGame
+	}
+	g, err := ParsePGN(pgn)
+	if err != nil {
+		return nil, fmt.Errorf("game %q: corrupt pgn: %w", id, err)
+	}
+	g.ID = id
+	return g, nil
+}
+
+func (p *PostgresStore) Get(ctx context.Context, id string) (*Game, error) {
+	return p.scanGame(p.DB.QueryRowContext(ctx, `SELECT id, pgn, updated_at FROM chess_games WHERE id = $1`, id))
+}
+
+func (p *PostgresStore) Update(ctx context.Context, id string, f func(*Game) error) (err error) {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	// FOR UPDATE locks the row until we commit or roll back: Postgres's version of obtaining a write lock on THIS game.
+	g, err := p.scanGame(tx.QueryRowContext(ctx, `SELECT id, pgn, updated_at FROM chess_games WHERE id = $1 FOR UPDATE`, id))
+	if err != nil {
+		return err
+	}
+	if err := f(g); err != nil {
+		return err
+	}
+	pgn, err := g.PGN()
+	if err != nil {
+		return fmt.Errorf("update game %q: %w", id, err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE chess_games SET pgn = $2, updated_at = $3 WHERE id = $1`, id, pgn, time.Now()); err != nil {
+		return fmt.Errorf("update game %q: %w", id, err)
+	}
+	return tx.Commit()
+}
+
+func (p *PostgresStore) Delete(ctx context.Context, id string) error {
+	res, err := p.DB.ExecContext(ctx, `DELETE FROM chess_games WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("delete game %q: %w", id, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNoGame
+	}
+	return nil
+}
+
+func (p *PostgresStore) List(ctx context.Context) ([]*Game, error) {
+	if err := p.sweep(ctx, p.DB); err != nil {
+		return nil, fmt.Errorf("list games: evicting expired games: %w", err)
+	}
+	rows, err := p.DB.QueryContext(ctx, `SELECT id, pgn, updated_at FROM chess_games ORDER BY updated_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("list games: %w", err)
+	}
+	defer rows.Close()
+	var games []*Game
+	for rows.Next() {
+		g, err := p.scanGame(rows)
+		if errors.Is(err, ErrNoGame) {
+			continue // expired since the sweep.
+		}
+		if err != nil {
+			return nil, fmt.Errorf("list games: %w", err)
+		}
+		games = append(games, g)
+	}
+	return games, rows.Err()
+}
+
+// gameSummary is what ListGamesHandler says about each game.
+type gameSummary struct {
+	ID     string `json:"id"`
+	White  string `json:"white"`
+	Black  string `json:"black"`
+	Moves  int    `json:"moves"`
+	FEN    string `json:"fen"`
+	Status string `json:"status"`
+}
+
+// ListGamesHandler serves GET: every game, most recently played first, as a JSON list of {id, white, black, moves, fen, status}.
+func ListGamesHandler(s *Sessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, fmt.Sprintf("invalid method %q", r.Method), http.StatusMethodNotAllowed)
+			return
+		}
+		games, err := s.store().List(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		summaries := make([]gameSummary, len(games))
+		for i, g := range games {
+			summaries[i] = gameSummary{g.ID, g.White, g.Black, len(g.Moves), g.Position.FEN(), g.Position.Status().String()}
+		}
+		WriteJSON(w, summaries)
+	}
+}
+
+// DeleteGameHandler serves DELETE ?gameID=...: it deletes the game, responding 204 No Content, or 404 Not Found if there's no such game.
+func DeleteGameHandler(s *Sessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, fmt.Sprintf("invalid method %q", r.Method), http.StatusMethodNotAllowed)
+			return
+		}
+		switch err := s.store().Delete(r.Context(), r.URL.Query().Get("gameID")); {
+		case errors.Is(err, ErrNoGame):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		default:
+			s.watchers.closeGame(r.URL.Query().Get("gameID")) // hang up on anyone watching it live.
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package backendbasics
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // register the "pgx" db driver
+)
+
+// testGameStore runs the same checks against any GameStore.
+func testGameStore(t *testing.T, store GameStore) {
+	t.Helper()
+	ctx := context.Background()
+	s := &Sessions{Store: store}
+	g, err := s.NewGame(ctx, "efron", "bobross")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(ctx, g); err == nil {
+		t.Errorf("Create(%q) twice: want an error", g.ID)
+	}
+	e4 := Move{From: sq("e2"), To: sq("e4"), White: true}
+	if err := store.Update(ctx, g.ID, func(g *Game) error {
+		next, err := NextMove(g.Position, e4)
+		g.Position, g.Moves = next, append(g.Moves, e4)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// a failed update changes nothing.
+	if err := store.Update(ctx, g.ID, func(g *Game) error {
+		g.White = "cheater"
+		return errors.New("nope")
+	}); err == nil || err.Error() != "nope" {
+		t.Errorf("Update: got %v, want f's error", err)
+	}
+	got, err := store.Get(ctx, g.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.White != "efron" || got.Black != "bobross" || len(got.Moves) != 1 || got.Position.WhiteToMove {
+		t.Errorf("Get: got %+v", got)
+	}
+	got.Moves = append(got.Moves, Move{}) // a copy: changing it doesn't change the store.
+	if again, _ := store.Get(ctx, g.ID); len(again.Moves) != 1 {
+		t.Errorf("Get returned the stored game, not a copy")
+	}
+
+	other, err := s.NewGame(ctx, "alice", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	games, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]bool{}
+	for _, g := range games {
+		ids[g.ID] = true
+	}
+	if !ids[g.ID] || !ids[other.ID] {
+		t.Errorf("List: got %v, want %s and %s", ids, g.ID, other.ID)
+	}
+
+	if err := store.Delete(ctx, g.ID); err != nil {
+		t.Fatal(err)
+	}
+	for name, err := range map[string]error{
+		"Get":    func() error { _, err := store.Get(ctx, g.ID); return err }(),
+		"Update": store.Update(ctx, g.ID, func(*Game) error { return nil }),
+		"Delete": store.Delete(ctx, g.ID),
+	} {
+		if !errors.Is(err, ErrNoGame) {
+			t.Errorf("%s after Delete: got %v, want ErrNoGame", name, err)
+		}
+	}
+	store.Delete(ctx, other.ID)
+}
+
+func TestMemoryStore(t *testing.T) {
+	testGameStore(t, new(MemoryStore))
+
+	t.Run("ttl", func(t *testing.T) {
+		ctx := context.Background()
+		now := time.Date(1858, 11, 2, 20, 0, 0, 0, time.UTC) // the night of the Opera Game.
+		m := &MemoryStore{TTL: time.Hour, now: func() time.Time { return now }}
+		for _, id := range []string{"stale", "fresh"} {
+			if err := m.Create(ctx, &Game{ID: id, Start: StartPosition(), Position: StartPosition()}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		now = now.Add(50 * time.Minute)
+		if err := m.Update(ctx, "fresh", func(*Game) error { return nil }); err != nil { // updating a game keeps it alive...
+			t.Fatal(err)
+		}
+		now = now.Add(20 * time.Minute)
+		if _, err := m.Get(ctx, "stale"); !errors.Is(err, ErrNoGame) { // ...and the rest expire.
+			t.Errorf("Get(stale) after the TTL: got %v, want ErrNoGame", err)
+		}
+		if _, err := m.Get(ctx, "fresh"); err != nil {
+			t.Errorf("Get(fresh): %v", err)
+		}
+		if games, _ := m.List(ctx); len(games) != 1 || len(m.games) != 1 {
+			t.Errorf("List should have evicted the stale game: got %d games, %d in the map", len(games), len(m.games))
+		}
+	})
+
+	t.Run("concurrent updates", func(t *testing.T) {
+		ctx := context.Background()
+		m := new(MemoryStore)
+		m.Create(ctx, &Game{ID: "busy"})
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				m.Update(ctx, "busy", func(g *Game) error { g.Moves = append(g.Moves, Move{}); return nil })
+			}()
+		}
+		wg.Wait()
+		if g, _ := m.Get(ctx, "busy"); len(g.Moves) != 100 {
+			t.Errorf("got %d moves after 100 concurrent updates: some were lost", len(g.Moves))
+		}
+	})
+
+	t.Run("update while deleted", func(t *testing.T) {
+		ctx := context.Background()
+		m := new(MemoryStore)
+		m.Create(ctx, &Game{ID: "doomed"})
+		started, deleted := make(chan struct{}), make(chan struct{})
+		errc := make(chan error)
+		go func() {
+			errc <- m.Update(ctx, "doomed", func(g *Game) error { close(started); <-deleted; g.White = "ghost"; return nil })
+		}()
+		<-started
+		if err := m.Delete(ctx, "doomed"); err != nil {
+			t.Fatal(err)
+		}
+		close(deleted)
+		if err := <-errc; !errors.Is(err, ErrNoGame) {
+			t.Errorf("Update of a game deleted while f ran: got %v, want ErrNoGame", err)
+		}
+		if _, err := m.Get(ctx, "doomed"); !errors.Is(err, ErrNoGame) {
+			t.Errorf("Get after Delete: got %v, want ErrNoGame", err)
+		}
+	})
+
+	t.Run("concurrent update, delete, and create", func(t *testing.T) { // run with -race.
+		ctx := context.Background()
+		m := &MemoryStore{TTL: time.Hour} // so Create's sweep and Delete look at when each game was updated.
+		m.Create(ctx, &Game{ID: "busy"})
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(3)
+			go func() {
+				defer wg.Done()
+				err := m.Update(ctx, "busy", func(g *Game) error { g.Moves = append(g.Moves, Move{}); return nil })
+				if err != nil && !errors.Is(err, ErrNoGame) {
+					t.Errorf("Update: %v", err)
+				}
+			}()
+			go func(i int) {
+				defer wg.Done()
+				m.Create(ctx, &Game{ID: fmt.Sprint(i)})
+			}(i)
+			go func(i int) {
+				defer wg.Done()
+				if i%10 == 0 {
+					m.Delete(ctx, "busy")
+					m.Create(ctx, &Game{ID: "busy"})
+				}
+				m.Get(ctx, "busy")
+				m.List(ctx)
+			}(i)
+		}
+		wg.Wait()
+	})
+}
+
+// TestPostgresStore needs a database: set the same environment variables as cmd/dbping.
+func TestPostgresStore(t *testing.T) {
+	get := func(key string) string {
+		val := os.Getenv(key)
+		if val == "" {
+			t.Skipf("%s not set: skipping", key)
+		}
+		return val
+	}
+	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s", get("PG_USER"), get("PG_PASSWORD"), get("PG_HOST"), get("PG_PORT"), get("PG_DATABASE"))
+	if mode := os.Getenv("PG_SSLMODE"); mode != "" {
+		dsn += "?sslmode=" + mode
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	p := &PostgresStore{DB: db, TTL: time.Hour}
+	if err := p.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	testGameStore(t, p)
+}
+
+func TestGameHandlers(t *testing.T) {
+	ctx := context.Background()
+	var s Sessions
+	g, err := ParsePGN(operaGame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.ID = "opera"
+	if err := s.store().Create(ctx, g); err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := s.NewGame(ctx, "efron", "bobross")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := httptest.NewServer(ListGamesHandler(&s))
+	defer list.Close()
+	resp, err := http.Get(list.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var games []gameSummary
+	json.NewDecoder(resp.Body).Decode(&games)
+	resp.Body.Close()
+	want := []gameSummary{ // most recent first.
+		{ID: fresh.ID, White: "efron", Black: "bobross", FEN: StartPosition().FEN(), Status: Ongoing.String()},
+		{ID: "opera", White: "Morphy", Black: "Duke Karl / Count Isouard", Moves: 33, FEN: g.Position.FEN(), Status: Checkmate.String()},
+	}
+	if len(games) != 2 || games[0] != want[0] || games[1] != want[1] {
+		t.Errorf("list: got %+v, want %+v", games, want)
+	}
+
+	del := httptest.NewServer(DeleteGameHandler(&s))
+	defer del.Close()
+	deleteGame := func(id string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodDelete, del.URL+"?gameID="+id, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := deleteGame("opera"); code != http.StatusNoContent {
+		t.Errorf("delete: got %d, want 204", code)
+	}
+	if code := deleteGame("opera"); code != http.StatusNotFound {
+		t.Errorf("delete twice: got %d, want 404", code)
+	}
+	if resp, _ := http.Get(del.URL + "?gameID=" + fresh.ID); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET on the delete handler: got %d, want 405", resp.StatusCode)
+	}
+}
@@ -0,0 +1,118 @@
+package ginex
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// goroutine is one goroutine's stack, parsed from runtime.Stack: see AllStacks.
+type goroutine struct {
+	header string  // i.e, "goroutine 7 [chan receive, 2 minutes]:".
+	frames []Frame // innermost first: the last is where it was created, if it wasn't the main goroutine. PC is always zero: runtime.Stack doesn't say.
+}
+
+// AllStacks formats the stacks of every goroutine, like FastStack does for one: with the line of source for each frame, if we can find it.
+// It's for finding deadlocks: i.e, from a /debug/stacks endpoint (see StacksHandler), or on a signal.
+// The world stops while runtime.Stack runs, so don't call it on a hot path.
+func AllStacks() []byte {
+	goroutines := parseStacks(allStacks())
+	if !localSourceUnavailable() {
+		var frames []*Frame
+		for i := range goroutines {
+			for j := range goroutines[i].frames {
+				frames = append(frames, &goroutines[i].frames[j])
+			}
+		}
+		addSource(frames, make([]byte, 0, 4096))
+	}
+	out := new(bytes.Buffer)
+	for i, g := range goroutines {
+		if i > 0 {
+			out.WriteByte('\n')
+		}
+		out.WriteString(g.header)
+		out.WriteByte('\n')
+		for _, f := range g.frames {
+			fmt.Fprintf(out, "%s:%d\t%s:%s\n", f.File, f.Line, f.Func, f.Source)
+		}
+	}
+	return out.Bytes()
+}
+
+// StacksHandler writes AllStacks as plain text: i.e, mux.HandleFunc("/debug/stacks", ginex.StacksHandler). Keep it somewhere private.
+func StacksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write(AllStacks())
+}
+
+// allStacks is runtime.Stack(buf, true), with a buffer big enough to hold all of it.
+func allStacks() []byte {
+	for size := 64 << 10; ; size *= 2 {
+		buf := make([]byte, size)
+		if n := runtime.Stack(buf, true); n < size {
+			return buf[:n]
+		}
+	}
+}
+
+// parseStacks parses the output of runtime.Stack: blank-line separated goroutines, each a header, then a line naming each function
+// and a tab-indented file:line under it, like so:
+//
+//	goroutine 7 [chan receive]:
+//	main.worker(0xc000012345)
+//		/src/main.go:20 +0x2d
+//	created by main.main in goroutine 1
+//		/src/main.go:12 +0x4f
+//
+// Lines it doesn't understand, like "...additional frames elided...", are skipped.
+func parseStacks(stacks []byte) []goroutine {
+	var goroutines []goroutine
+	for _, block := range strings.Split(strings.TrimSpace(string(stacks)), "\n\n") {
+		lines := strings.Split(block, "\n")
+		if !strings.HasPrefix(lines[0], "goroutine ") {
+			continue
+		}
+		g := goroutine{header: lines[0]}
+		for i := 1; i+1 < len(lines); i++ {
+			fn, loc := lines[i], lines[i+1]
+			if !strings.HasPrefix(loc, "\t") {
+				continue
+			}
+			i++
+			file, line, ok := parseLocation(strings.TrimPrefix(loc, "\t"))
+			if !ok {
+				continue
+			}
+			g.frames = append(g.frames, Frame{File: file, Line: line, Func: parseFunc(fn)})
+		}
+		goroutines = append(goroutines, g)
+	}
+	return goroutines
+}
+
+// parseLocation parses "/src/main.go:20 +0x2d" (the offset is optional) into a file and line.
+func parseLocation(loc string) (file string, line int, ok bool) {
+	loc, _, _ = strings.Cut(loc, " +0x")
+	i := strings.LastIndexByte(loc, ':')
+	if i < 0 {
+		return "", 0, false
+	}
+	line, err := strconv.Atoi(loc[i+1:])
+	return loc[:i], line, err == nil
+}
+
+// parseFunc turns a function line from runtime.Stack into a Frame's Func: "main.(*T).f(0x1, 0x2)" into "(*T).f", and "created by main.main in goroutine 1" into "created by main".
+func parseFunc(fn string) string {
+	if created, ok := strings.CutPrefix(fn, "created by "); ok {
+		created, _, _ = strings.Cut(created, " in goroutine ")
+		return "created by " + trimFunction(created)
+	}
+	if i := strings.LastIndexByte(fn, '('); i > 0 && strings.HasSuffix(fn, ")") {
+		fn = fn[:i]
+	}
+	return trimFunction(fn)
+}
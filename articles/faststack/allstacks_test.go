@@ -0,0 +1,61 @@
+package ginex
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseStacks(t *testing.T) {
+	const stacks = `goroutine 1 [running]:
+main.main()
+	/src/main.go:12 +0x1d
+
+goroutine 7 [chan receive, 2 minutes]:
+gitlab.com/efronlicht/blog/articles/faststack.(*T).worker(0xc000012345, {0x1, 0x2})
+	/src/faststack/worker.go:20 +0x2d
+...additional frames elided...
+created by gitlab.com/efronlicht/blog/articles/faststack.start in goroutine 1
+	/src/faststack/worker.go:9
+`
+	want := []goroutine{
+		{"goroutine 1 [running]:", []Frame{{File: "/src/main.go", Line: 12, Func: "main"}}},
+		{"goroutine 7 [chan receive, 2 minutes]:", []Frame{
+			{File: "/src/faststack/worker.go", Line: 20, Func: "(*T).worker"},
+			{File: "/src/faststack/worker.go", Line: 9, Func: "created by start"},
+		}},
+	}
+	if got := parseStacks([]byte(stacks)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestAllStacks(t *testing.T) {
+	block, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		<-block // waiting here, where AllStacks can see it.
+	}()
+	defer func() { close(block); <-done }()
+
+	// the goroutine might not have gotten to its channel yet: give it a few tries.
+	const waiting = "TestAllStacks.func1:<-block // waiting here, where AllStacks can see it."
+	var stacks string
+	for try := 0; try < 100 && !strings.Contains(stacks, waiting); try++ {
+		runtime.Gosched()
+		w := httptest.NewRecorder()
+		StacksHandler(w, httptest.NewRequest("GET", "/debug/stacks", nil))
+		stacks = w.Body.String()
+	}
+	for _, want := range []string{
+		"[running]:\n",
+		waiting,
+		"created by TestAllStacks:go func() {",
+	} {
+		if !strings.Contains(stacks, want) {
+			t.Errorf("missing %q in\n%s", want, stacks)
+		}
+	}
+}
@@ -30,3 +30,18 @@ func BenchmarkSlowStack(b *testing.B) {
 		})
 	}
 }
+
+// the same, without the source cache: every trace rescans every file, the way it did before we had one.
+func BenchmarkFastStackUncached(b *testing.B) {
+	defer func(cached *sourceCache) { sources = cached }(sources)
+	sources = newSourceCache(0)
+	b.ReportAllocs()
+	for i := 8; i <= 2048; i *= 2 {
+		b.Run(fmt.Sprintf("depth=%d", 2*i), func(b *testing.B) {
+			for j := 0; j < b.N; j++ {
+				b.StopTimer()
+				_res = Ping(b, FastStack, i)
+			}
+		})
+	}
+}
@@ -5,11 +5,12 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	ginex "gitlab.com/efronlicht/blog/articles/faststack"
 )
 
 func main() {
 	engine := gin.New()
-	engine.Use(gin.Recovery())
+	engine.Use(ginex.Recovery()) // run with DEBUG=1 to see the stack, source and all, in the response.
 	engine.GET("/panic", func(c *gin.Context) {
 		fmt.Fprintf(c.Writer, "%s", f())
 	})
@@ -1,13 +1,10 @@
 package ginex
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
-	"log"
 	"os"
 	"runtime"
-	"runtime/debug"
 	"sort"
 	"strings"
 	"sync"
@@ -31,103 +28,93 @@ func localSourceUnavailable() bool {
 	return localSourceNotFound
 }
 
-type debugInfo struct {
-	*runtime.Frame
-	Source string // line of code where the call appeared
-	Depth  int
-}
-
 // FastStack returns a formatted FastStack frame, skipping debug frames
 func FastStack(skip int) (formatted []byte) {
+	// allocate a 4KiB reusable buffer, exactly once. we will use this both to read the input and format the output.
+	buf := make([]byte, 0, 4096)
+	frames := stackFrames(skip, buf)
+	if frames == nil {
+		return nil
+	}
+	// format it all into the buffer. we're safe to reuse buf, since we're done reading source: every Source is its own string.
+	out := bytes.NewBuffer(buf[:0])
+	writeFrames(out, frames)
+	return out.Bytes()
+}
+
+// writeFrames writes frames to out, one line apiece, in FastStack's format.
+func writeFrames(out *bytes.Buffer, frames []Frame) {
+	for _, f := range frames {
+		fmt.Fprintf(out, "%s:%d (0x%x)\t%s:%s\n", f.File, f.Line, f.PC, f.Func, f.Source)
+	}
+}
+
+// FastStackFrames is FastStack, as structured frames instead of text, outermost call last: i.e, to attach to a structured log. See Frame.MarshalJSON and ZapStack.
+// skip is as for FastStack.
+func FastStackFrames(skip int) []Frame { return stackFrames(skip, make([]byte, 0, 4096)) }
+
+// stackFrames does the work for FastStack and FastStackFrames, as if runtime.Callers(skip) were called by its caller. buf is scratch space.
+func stackFrames(skip int, buf []byte) []Frame {
 	// grab the stack frame
 	pc := make([]uintptr, 64)
-	n := runtime.Callers(skip, pc)
+	n := runtime.Callers(skip+1, pc)
 	if n == 0 { // no callers: e.g, skip > len(callstack).
 		return nil
 	}
 	pc = pc[:n] // pass only valid pcs to runtime.Caller
-	frames := runtime.CallersFrames(pc)
-	// allocate a 4KiB reusable buffer, exactly once. we will use this both to read the input and format the output.
-	buf := make([]byte, 0, 4096)
-	if localSourceUnavailable() {
-		// fast path: just format the frames in the order they occur without looking up the source.
-		out := bytes.NewBuffer(buf)
-		for {
-			frame, more := frames.Next()
-			fmt.Fprintf(out, "%s:%d (0x%x)\t%s:%s\n", frame.File, frame.Line, frame.PC, trimFunction(frame.Function), "")
-			if !more {
-				return out.Bytes()
-			}
-		}
-	}
-	// slow path: at least some local source is available, so we want to populate the debuginfo with the lines of code that appear in the stack  trace.
-	di := make([]debugInfo, 0, n)
-	for depth := 0; ; depth++ {
-		frame, more := frames.Next()
-		di = append(di, debugInfo{Frame: &frame, Depth: depth})
+	callers := runtime.CallersFrames(pc)
+	frames := make([]Frame, 0, n)
+	for {
+		f, more := callers.Next()
+		frames = append(frames, Frame{File: f.File, Line: f.Line, Func: trimFunction(f.Function), PC: f.PC})
 		if !more {
 			break
 		}
 	}
+	if localSourceUnavailable() {
+		// fast path: just return the frames in the order they occur without looking up the source.
+		return frames
+	}
+	// slow path: at least some local source is available, so we want to populate the frames with the lines of code that appear in the stack trace.
+	byFile := make([]*Frame, len(frames))
+	for i := range frames {
+		byFile[i] = &frames[i]
+	}
+	addSource(byFile, buf)
+	return frames
+}
 
-	// group the debuginfo by file and line: we'll resort them by depth later.
-	sort.Slice(di, func(i, j int) bool {
-		return di[i].File < di[j].File || (di[i].File == di[j].File && di[i].Line < di[j].Line)
+// addSource fills in the Source of each of frames, sorting them by file and line so we only open each file once:
+// that reorders the pointers, not the Frames they point to. buf is scratch space.
+func addSource(frames []*Frame, buf []byte) {
+	sort.Slice(frames, func(i, j int) bool {
+		return frames[i].File < frames[j].File || (frames[i].File == frames[j].File && frames[i].Line < frames[j].Line)
 	})
-	// populate debug info with source.
-	func() {
-		line := 0
-		lastFile := di[0].File
-		f, err := os.Open(lastFile)
-		defer func() {
-			// scanner.Scan() can panic if it hits too many newlines.
-			// in that case, we immediately abandon trying to get more sourceInfo and just write as much as we can.
-			if p := recover(); p != nil {
-				log.Println("panic while formatting stack: too many empty lines in sourcefile?", p, debug.Stack())
-				f.Close()
-			}
-		}()
-
-		scanner := bufio.NewScanner(f)
-		scanner.Buffer(buf[:0], bufio.MaxScanTokenSize)
-		for i := range di {
-			if di[i].File != lastFile {
-				if err == nil {
-					f.Close()
-				}
-				// reset: we're at the beginning of a new file
-				line = 0
-				f, err = os.Open(di[i].File)
-				if err != nil {
-					continue
-				}
-				scanner = bufio.NewScanner(f)
-				scanner.Buffer(buf[:0], bufio.MaxScanTokenSize)
-			}
-			if err != nil {
-				continue
-			}
-			// it's possible that we have multiple calls to the same function in the stack, such as during recursion,
-			// so we check that we haven't gone past BEFORE we advance the scanner.
-			for ; line < di[i].Line; line++ {
-				scanner.Scan()
-			}
-			di[i].Source = scanner.Text()
-
-			i++
+	for start := 0; start < len(frames); {
+		end := start + 1
+		for end < len(frames) && frames[end].File == frames[start].File {
+			end++
 		}
-		_ = f.Close()
-	}()
-
-	// put the debuginfo back in depth-first order
-	sort.Slice(di, func(i, j int) bool { return di[i].Depth < di[j].Depth })
-	// format it all into the buffer. we're safe to reuse buf, since we're done with all the scanners.
-	out := bytes.NewBuffer(buf[:0])
-	for i := range di {
-		fmt.Fprintf(out, "%s:%d (0x%x)\t%s:%s\n", di[i].File, di[i].Line, di[i].PC, trimFunction(di[i].Function), strings.TrimSpace(di[i].Source))
+		readSource(frames[start:end], buf)
+		start = end
 	}
+}
 
-	return out.Bytes()
+// readSource fills in the Source of each of frames, which all share a File, using the line offsets in sources. buf is scratch space.
+// If we can't read the file, we leave the Source empty: a stack trace without source is better than none.
+func readSource(frames []*Frame, buf []byte) {
+	f, err := os.Open(frames[0].File)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	src, err := sources.get(f, buf)
+	if err != nil {
+		return
+	}
+	for _, frame := range frames {
+		frame.Source = string(bytes.TrimSpace(src.line(f, frame.Line, buf)))
+	}
 }
 
 func trimFunction(name string) string {
@@ -0,0 +1,63 @@
+package ginex
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Frame is one frame of a stack trace, with the line of source it's on, if we could find it. See FastStackFrames.
+type Frame struct {
+	File   string
+	Line   int
+	Func   string // without the package path: i.e, *T.method.
+	PC     uintptr
+	Source string // the line of code where the call appeared, trimmed of space; empty if we couldn't read it.
+}
+
+// jsonFrame is how a Frame looks in JSON: see Frame.MarshalJSON.
+type jsonFrame struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Func   string `json:"func"`
+	PC     string `json:"pc"`
+	Source string `json:"source,omitempty"`
+}
+
+// MarshalJSON writes f as an object with lowercase keys, with the PC in hex, the way FastStack writes it:
+// i.e, {"file": "/src/main.go", "line": 12, "func": "main", "pc": "0x4a5b2c", "source": "f()"}.
+func (f Frame) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonFrame{f.File, f.Line, f.Func, fmt.Sprintf("0x%x", f.PC), f.Source})
+}
+
+// MarshalLogObject writes f to a zap log, with the same keys as MarshalJSON.
+func (f Frame) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("file", f.File)
+	enc.AddInt("line", f.Line)
+	enc.AddString("func", f.Func)
+	enc.AddString("pc", fmt.Sprintf("0x%x", f.PC))
+	if f.Source != "" {
+		enc.AddString("source", f.Source)
+	}
+	return nil
+}
+
+// zapFrames is a stack trace, as a zap array of objects.
+type zapFrames []Frame
+
+func (frames zapFrames) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, f := range frames {
+		if err := enc.AppendObject(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ZapStack is a zap.Field holding the stack trace under key, as an array of Frames:
+// i.e, logger.Error("recovered from panic", ginex.ZapStack("stack", 2)), to start at the caller. skip is as for FastStack, so 1 starts with ZapStack itself.
+func ZapStack(key string, skip int) zap.Field {
+	return zap.Array(key, zapFrames(FastStackFrames(skip+1)))
+}
@@ -0,0 +1,48 @@
+package ginex
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestFastStackFrames(t *testing.T) {
+	frames := FastStackFrames(2) // skip FastStackFrames itself: start here.
+	if len(frames) < 2 {
+		t.Fatalf("got %d frames", len(frames))
+	}
+	top := frames[0]
+	if top.Func != "TestFastStackFrames" || !strings.HasSuffix(top.File, "frame_test.go") || top.Source != "frames := FastStackFrames(2) // skip FastStackFrames itself: start here." {
+		t.Fatalf("top frame: got %+v", top)
+	}
+	if frames[1].Func != "tRunner" {
+		t.Errorf("next frame: got %+v, want testing.tRunner", frames[1])
+	}
+
+	b, err := json.Marshal(frames[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]any
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0]["func"] != top.Func || got[0]["line"] != float64(top.Line) || got[0]["source"] != top.Source || !strings.HasPrefix(got[0]["pc"].(string), "0x") {
+		t.Errorf("json: got %s", b)
+	}
+	if b, _ := json.Marshal(Frame{Func: "f"}); strings.Contains(string(b), "source") {
+		t.Errorf("json: a frame without source shouldn't have a source: got %s", b)
+	}
+
+	enc := zapcore.NewMapObjectEncoder()
+	ZapStack("stack", 2).AddTo(enc)
+	stack, ok := enc.Fields["stack"].([]any)
+	if !ok || len(stack) == 0 {
+		t.Fatalf("zap: got %#v", enc.Fields)
+	}
+	if first := stack[0].(map[string]any); first["func"] != "TestFastStackFrames" || first["source"] != `ZapStack("stack", 2).AddTo(enc)` {
+		t.Errorf("zap: got first frame %v", first)
+	}
+}
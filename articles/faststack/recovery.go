@@ -0,0 +1,94 @@
+package ginex
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DebugEnv is the environment variable that, when it's true by strconv.ParseBool, makes Recovery and RecoveryHandler
+// put the stack trace in the response, as well as the log. Never set it in production: the source of your handlers is nobody else's business.
+const DebugEnv = "DEBUG"
+
+// RecoveryConfig configures RecoveryWithConfig and RecoveryHandlerWithConfig.
+type RecoveryConfig struct {
+	// Debug puts the stack trace in the response, whether or not DebugEnv is set: as a page (see HTMLStack) for a browser, or plain text for anything else.
+	Debug bool
+}
+
+// Recovery returns gin middleware that recovers from panics like gin.Recovery does, but logs the stack with FastStack,
+// writing a 500 and "internal server error" unless the response has already started. See DebugEnv to see the stack in the response, too.
+// A panic with http.ErrAbortHandler is how a handler deliberately aborts a response: it panics again, so the http.Server can close the connection.
+func Recovery() gin.HandlerFunc { return RecoveryWithConfig(RecoveryConfig{}) }
+
+// RecoveryWithConfig is Recovery, configured by cfg.
+func RecoveryWithConfig(cfg RecoveryConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			cfg.recovered(c.Writer, c.Request, p, FastStackFrames(3), c.Writer.Written())
+			c.Abort()
+		}()
+		c.Next()
+	}
+}
+
+// RecoveryHandler is Recovery, as plain net/http middleware. It can't tell if h already started the response, so it always tries to write the 500.
+func RecoveryHandler(h http.Handler) http.HandlerFunc {
+	return RecoveryHandlerWithConfig(h, RecoveryConfig{})
+}
+
+// RecoveryHandlerWithConfig is RecoveryHandler, configured by cfg.
+func RecoveryHandlerWithConfig(h http.Handler, cfg RecoveryConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			cfg.recovered(w, r, p, FastStackFrames(3), false)
+		}()
+		h.ServeHTTP(w, r)
+	}
+}
+
+// recovered logs the panic p and its stack, then answers with a 500, unless written says it's too late.
+func (cfg RecoveryConfig) recovered(w http.ResponseWriter, r *http.Request, p any, frames []Frame, written bool) {
+	stack := new(bytes.Buffer)
+	writeFrames(stack, frames)
+	log.Printf("%s %s: panic: %v\n%s", r.Method, r.URL, p, stack)
+	if written {
+		return
+	}
+	debug, _ := strconv.ParseBool(os.Getenv(DebugEnv))
+	switch {
+	case (cfg.Debug || debug) && strings.Contains(r.Header.Get("Accept"), "text/html"):
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'") // the page's styles are inline.
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = HTMLStack(w, fmt.Sprintf("panic: %v", p), frames)
+	case cfg.Debug || debug:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "panic: %v\n\n%s", p, stack)
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("internal server error"))
+	}
+}
@@ -0,0 +1,66 @@
+package ginex
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRecovery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(Recovery())
+	engine.GET("/panic", func(c *gin.Context) { panic("gin handler panics") })
+	engine.GET("/late", func(c *gin.Context) {
+		c.String(http.StatusTeapot, "too late for a 500")
+		panic("gin handler panics after writing")
+	})
+	plain := RecoveryHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("http handler panics") }))
+	page := RecoveryHandlerWithConfig(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("dev handler panics") }), RecoveryConfig{Debug: true})
+
+	for _, tt := range []struct {
+		name     string
+		h        http.Handler
+		path     string
+		accept   string
+		debug    string
+		wantCode int
+		want     string // in the body: with debug on, the source of the line that panicked.
+	}{
+		{"gin", engine, "/panic", "", "", 500, "internal server error"},
+		{"gin debug", engine, "/panic", "", "1", 500, `panic("gin handler panics")`},
+		{"gin already written", engine, "/late", "", "true", http.StatusTeapot, "too late for a 500"},
+		{"http", plain, "/", "", "false", 500, "internal server error"},
+		{"http debug", plain, "/", "", "true", 500, `panic("http handler panics")`},
+		{"html", plain, "/", "text/html", "", 500, "internal server error"},
+		{"html debug", plain, "/", "text/html", "1", 500, `<h1>panic: http handler panics</h1>`},
+		{"html config", page, "/", "text/html,*/*", "", 500, `panic(&#34;dev handler panics&#34;)`},
+		{"text config", page, "/", "", "", 500, `panic("dev handler panics")`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(DebugEnv, tt.debug)
+			w, r := httptest.NewRecorder(), httptest.NewRequest("GET", tt.path, nil)
+			r.Header.Set("Accept", tt.accept)
+			tt.h.ServeHTTP(w, r)
+			body, _ := io.ReadAll(w.Body)
+			if w.Code != tt.wantCode || !strings.Contains(string(body), tt.want) {
+				t.Fatalf("got %d: %s\nwant %d containing %q", w.Code, body, tt.wantCode, tt.want)
+			}
+			if debug := strings.Contains(string(body), "recovery_test.go"); debug != (tt.debug == "1" || tt.debug == "true" || strings.HasSuffix(tt.name, "config")) && tt.wantCode == 500 {
+				t.Errorf("stack in the response: got %v, want it only with %s=%q", debug, DebugEnv, tt.debug)
+			}
+		})
+	}
+
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("http.ErrAbortHandler: got %v, want it to panic again", p)
+		}
+	}()
+	RecoveryHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic(http.ErrAbortHandler) })).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
@@ -0,0 +1,115 @@
+package ginex
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strings"
+)
+
+// ANSI escape codes for ColorStack.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiFaint  = "\x1b[2m"
+	ansiCyan   = "\x1b[1;36m" // bold, too.
+	ansiYellow = "\x1b[33m"
+)
+
+// ColorStack formats frames like FastStack, colored for a terminal: the file paths faint, the function names bold cyan, and the source yellow,
+// so your eye goes to what's running, not where it lives.
+func ColorStack(frames []Frame) []byte {
+	out := new(bytes.Buffer)
+	for _, f := range frames {
+		fmt.Fprintf(out, "%s%s:%d (0x%x)%s\t%s%s%s:%s%s%s\n", ansiFaint, f.File, f.Line, f.PC, ansiReset, ansiCyan, f.Func, ansiReset, ansiYellow, f.Source, ansiReset)
+	}
+	return out.Bytes()
+}
+
+// contextLines is how many lines of source HTMLStack shows on either side of each frame's.
+const contextLines = 3
+
+// htmlFrame is a Frame, with the source around it: see HTMLStack.
+type htmlFrame struct {
+	Frame
+	Context []sourceLine // empty if we couldn't read the file.
+}
+
+// sourceLine is one numbered line of source; Current is the frame's own.
+type sourceLine struct {
+	N       int
+	Text    string
+	Current bool
+}
+
+// HTMLStack writes a page showing frames, with a few lines of source around each one, under title: i.e, "panic: runtime error: index out of range".
+// It's a debugging screen for development, like other frameworks': it shows your source to whoever's looking, so keep it off in production.
+// The page's styles are inline: serve it with a Content-Security-Policy that allows them, like "default-src 'none'; style-src 'unsafe-inline'".
+func HTMLStack(w io.Writer, title string, frames []Frame) error {
+	page := struct {
+		Title  string
+		Frames []htmlFrame
+	}{Title: title, Frames: make([]htmlFrame, len(frames))}
+	buf := make([]byte, 0, 4096)
+	for i, f := range frames {
+		page.Frames[i] = htmlFrame{Frame: f, Context: around(f, buf)}
+	}
+	return htmlStack.Execute(w, page)
+}
+
+// around reads the lines of source on either side of f's, using the line offsets in sources. buf is scratch space.
+func around(f Frame, buf []byte) []sourceLine {
+	file, err := os.Open(f.File)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	src, err := sources.get(file, buf)
+	if err != nil {
+		return nil
+	}
+	var lines []sourceLine
+	for n := max(f.Line-contextLines, 1); n <= f.Line+contextLines && n < len(src.offsets); n++ {
+		text := strings.TrimRight(string(src.line(file, n, buf)), "\r\n")
+		lines = append(lines, sourceLine{N: n, Text: strings.ReplaceAll(text, "\t", "    "), Current: n == f.Line})
+	}
+	return lines
+}
+
+var htmlStack = template.Must(template.New("stack").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { background: #1e1e1e; color: #d4d4d4; font-family: sans-serif; margin: 2em; }
+h1 { color: #f48771; font-size: 1.4em; font-family: monospace; white-space: pre-wrap; }
+ol { list-style: none; padding: 0; }
+li { margin: 0 0 1em 0; border-left: 3px solid #3c3c3c; padding-left: 1em; }
+.func { color: #4ec9b0; font-weight: bold; font-family: monospace; }
+.file { color: #808080; font-family: monospace; font-size: 0.9em; }
+pre { background: #252526; margin: 0.4em 0 0 0; padding: 0.4em 0; overflow-x: auto; }
+pre span { display: block; padding: 0 0.8em; }
+pre .n { display: inline; color: #6e7681; padding: 0 1em 0 0; user-select: none; }
+pre .current { background: #4b1818; color: #ffffff; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<ol>
+{{- range .Frames}}
+<li>
+<div class="func">{{.Func}}</div>
+<div class="file">{{.File}}:{{.Line}}</div>
+{{- if .Context}}
+<pre>{{range .Context}}<span{{if .Current}} class="current"{{end}}><span class="n">{{printf "%4d" .N}}</span>{{.Text}}</span>{{end}}</pre>
+{{- else if .Source}}
+<pre><span class="current">{{.Source}}</span></pre>
+{{- end}}
+</li>
+{{- end}}
+</ol>
+</body>
+</html>
+`))
@@ -0,0 +1,41 @@
+package ginex
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestColorStack(t *testing.T) {
+	got := string(ColorStack([]Frame{{File: "/src/main.go", Line: 12, Func: "main", PC: 0x1d, Source: "f()"}}))
+	if want := "\x1b[2m/src/main.go:12 (0x1d)\x1b[0m\t\x1b[1;36mmain\x1b[0m:\x1b[33mf()\x1b[0m\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestHTMLStack(t *testing.T) {
+	frames := FastStackFrames(2)
+	frames = append(frames, Frame{File: "/no/such/file.go", Line: 3, Func: "gone", Source: "x := <-ch"})
+	var page bytes.Buffer
+	if err := HTMLStack(&page, "panic: <script>alert(1)</script>", frames); err != nil {
+		t.Fatal(err)
+	}
+	got := page.String()
+	for _, want := range []string{
+		"<title>panic: &lt;script&gt;alert(1)&lt;/script&gt;</title>",
+		`<div class="func">TestHTMLStack</div>`,
+		// the frame's own line, and the ones around it.
+		`class="current"><span class="n">  17</span>    frames := FastStackFrames(2)</span>`,
+		`<span class="n">  18</span>    frames = append(frames`,
+		`<span class="n">  16</span>func TestHTMLStack(t *testing.T) {</span>`,
+		// without the file, we show what source we have.
+		`<pre><span class="current">x := &lt;-ch</span></pre>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "<script>") {
+		t.Error("the title wasn't escaped")
+	}
+}
@@ -0,0 +1,112 @@
+package ginex
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// sources remembers where the lines start in the files FastStack has read: see sourceCache.
+var sources = newSourceCache(128)
+
+// sourceCache is an LRU cache of line offsets by file, so a hot service that panics over and over doesn't rescan the same files every time:
+// once we know where a line starts and ends, reading it is a single ReadAt.
+// An entry is only good as long as its file's size and modification time are the same as when we scanned it.
+type sourceCache struct {
+	mux     sync.Mutex
+	max     int                      // how many files to remember. zero or less means don't remember any.
+	entries map[string]*list.Element // by path: the elements' values are *sourceFile.
+	lru     *list.List               // most recently used first.
+}
+
+// sourceFile is where each line of a file starts, as of when it was scanned.
+type sourceFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+	offsets []int64 // line n, counting from 1, is the bytes from offsets[n-1] to offsets[n]. the last offset is the end of the file.
+}
+
+func newSourceCache(max int) *sourceCache {
+	return &sourceCache{max: max, entries: make(map[string]*list.Element), lru: list.New()}
+}
+
+// get returns the line offsets for f, scanning it only if we haven't already, or it's changed since we did.
+// buf is scratch space for the scan.
+func (c *sourceCache) get(f *os.File, buf []byte) (*sourceFile, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	c.mux.Lock()
+	if e, ok := c.entries[f.Name()]; ok {
+		if src := e.Value.(*sourceFile); src.size == info.Size() && src.modTime.Equal(info.ModTime()) {
+			c.lru.MoveToFront(e)
+			c.mux.Unlock()
+			return src, nil
+		}
+		c.lru.Remove(e) // stale: the file's changed.
+		delete(c.entries, f.Name())
+	}
+	c.mux.Unlock()
+
+	src, err := scanOffsets(f, info, buf) // outside the lock: this is the slow part.
+	if err != nil {
+		return nil, err
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.max <= 0 {
+		return src, nil
+	}
+	if e, ok := c.entries[src.path]; ok { // someone else scanned it while we were.
+		c.lru.Remove(e)
+	}
+	c.entries[src.path] = c.lru.PushFront(src)
+	for c.lru.Len() > c.max {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*sourceFile).path)
+	}
+	return src, nil
+}
+
+// scanOffsets reads f from the start to find where each line begins.
+func scanOffsets(f *os.File, info fs.FileInfo, buf []byte) (*sourceFile, error) {
+	src := &sourceFile{path: f.Name(), size: info.Size(), modTime: info.ModTime(), offsets: []int64{0}}
+	var pos int64
+	for {
+		n, err := f.Read(buf[:cap(buf)])
+		chunk := buf[:n]
+		for i := bytes.IndexByte(chunk, '\n'); i >= 0; i = bytes.IndexByte(chunk, '\n') {
+			pos += int64(i + 1)
+			chunk = chunk[i+1:]
+			src.offsets = append(src.offsets, pos)
+		}
+		pos += int64(len(chunk))
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if pos != src.offsets[len(src.offsets)-1] { // the last line doesn't end in a newline.
+		src.offsets = append(src.offsets, pos)
+	}
+	return src, nil
+}
+
+// line reads line n of f, counting from 1, newline and all, into buf, cutting it short if it doesn't fit: or returns nil, if there's no such line.
+func (src *sourceFile) line(f io.ReaderAt, n int, buf []byte) []byte {
+	if n < 1 || n >= len(src.offsets) {
+		return nil
+	}
+	start, end := src.offsets[n-1], src.offsets[n]
+	b := buf[:min(int(end-start), cap(buf))]
+	read, _ := f.ReadAt(b, start) // a short read is still as much of the line as we can get.
+	return b[:read]
+}
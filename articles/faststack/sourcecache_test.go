@@ -0,0 +1,70 @@
+package ginex
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFastStackSource(t *testing.T) {
+	stack := FastStack(1) // the line we're looking for.
+	if !bytes.Contains(stack, []byte("stack := FastStack(1) // the line we're looking for.")) {
+		t.Fatalf("missing our own line of source:\n%s", stack)
+	}
+	if again := FastStack(1); !bytes.Contains(again, []byte("again := FastStack(1)")) {
+		t.Fatalf("from the cache, missing our own line of source:\n%s", again)
+	}
+}
+
+func TestSourceCache(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, contents string, modTime time.Time) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	c := newSourceCache(2)
+	line := func(path string, n int) string {
+		t.Helper()
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		src, err := c.get(f, make([]byte, 0, 8)) // a tiny buffer: lines span reads.
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(src.line(f, n, make([]byte, 0, 64)))
+	}
+	then := time.Now().Add(-time.Hour).Truncate(time.Second)
+	a := write("a.go", "package a\n\nfunc A() {}", then)
+	for n, want := range []string{"", "package a\n", "\n", "func A() {}", ""} {
+		if got := line(a, n); got != want {
+			t.Errorf("line %d: got %q, want %q", n, got, want)
+		}
+	}
+
+	// same size, new modification time: it's rescanned.
+	write("a.go", "package b\n\n\nfunc B(){}", then.Add(time.Second))
+	if got := line(a, 4); got != "func B(){}" {
+		t.Errorf("after the file changed: got %q", got)
+	}
+
+	// a third file pushes out the least recently used.
+	b, d := write("b.go", "package b\n", then), write("d.go", "package d\n", then)
+	line(b, 1)
+	line(a, 1)
+	line(d, 1)
+	if _, ok := c.entries[b]; ok || len(c.entries) != 2 || c.lru.Len() != 2 {
+		t.Errorf("after three files in a cache of two: got %d entries, with b.go still in it: %v", len(c.entries), ok)
+	}
+}
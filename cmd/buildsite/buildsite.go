@@ -0,0 +1,136 @@
+// buildsite builds the whole static site in one process: it renders the markdown under SRC into DST, checks the links,
+// brings the feeds up to date, and writes articles.json, rss.xml, atom.xml, sitemap.xml, index.html, and the zip the server embeds.
+// Every step shares the same render.Meta for each article, rather than reading back what the last one wrote: see package site.
+// cmd/rendermd, cmd/buildrss, cmd/buildindex, and cmd/prezip each do one of the steps.
+//
+//	usage:
+//	   buildsite [-layout DIR] [-site URL] [-ext EXTENSIONS] [-cache FILE] [-feed DIR] [-force] [-zip FILE] [-policy EXT=METHOD,...] [-level N] SRC DST
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+
+	"gitlab.com/efronlicht/blog/render"
+	"gitlab.com/efronlicht/blog/site"
+)
+
+func main() {
+	log.SetPrefix("buildsite\t")
+	layoutDir := flag.String("layout", "", "directory of *.html templates overriding parts of the default page layout: see render.ParseLayout")
+	siteURL := flag.String("site", render.DefaultSiteURL, "URL the site is served from, for canonical URLs, og: tags, the feeds, and the sitemap")
+	extFlag := flag.String("ext", "", "comma-separated markdown extensions to enable, or all: "+render.AllExtensions.String())
+	cachePath := flag.String("cache", "cmd/rendermd/cache.json", "file of checksums from the last run, so unchanged articles aren't rendered again")
+	feedDir := flag.String("feed", "cmd/buildrss", "directory of what the feeds remember between builds: see site.Feed")
+	force := flag.Bool("force", false, "render every article, whether or not it's changed")
+	workers := flag.Int("j", runtime.NumCPU(), "how many files to render at once")
+	checkLinks := flag.Bool("checklinks", true, "fail if a relative href or src in an article doesn't resolve to a file in dstdir or one of -routes")
+	routesFlag := flag.String("routes", site.DefaultRoutes, "comma-separated paths the server answers without a file, for -checklinks: i.e, redirects")
+	zipPath := flag.String("zip", "", "where to write the zip of dstdir for the server to embed: default dstdir/assets.zip")
+	policyFlag := flag.String("policy", site.DefaultPolicy, "comma-separated EXT=METHOD: how to compress each file in -zip, by extension, with * for the rest. methods are store, deflate, and zstd")
+	level := flag.Int("level", 0, "compression level for -zip: 1-9 for deflate (more is 9), 1-22 for zstd, or 0 for each method's default")
+	flag.Parse()
+	if flag.NArg() != 2 {
+		log.Print("expected two command-line arguments")
+		log.Fatal("USAGE: buildsite [flags] srcdir dstdir")
+	}
+	srcDir, dstDir := must(filepath.Abs(flag.Arg(0))), must(filepath.Abs(flag.Arg(1)))
+	if *zipPath == "" {
+		*zipPath = filepath.Join(dstDir, "assets.zip")
+	}
+	zcfg := site.ZipConfig{Exclude: []string{*zipPath}, Policy: must(site.ParsePolicy(*policyFlag)), Level: *level} // so a bad flag fails before we've built anything.
+	start := time.Now()
+
+	// --- render ---
+	cfg := render.Config{SiteURL: *siteURL, Extensions: must(render.ParseExtensions(*extFlag))}
+	if *layoutDir != "" {
+		cfg.Layout = must(render.ParseLayout(*layoutDir))
+	}
+	rcfg := site.RenderConfig{
+		Src:      srcDir,
+		Dst:      dstDir,
+		Render:   cfg,
+		Layout:   must(site.LayoutSum(cfg, *layoutDir)),
+		Workers:  *workers,
+		Progress: func(src, dst string) { log.Printf("%s\t->\t%s", src, dst) },
+	}
+	if !*force {
+		rcfg.Cache = must(site.ReadCache(*cachePath))
+	}
+	out, err := site.Render(rcfg)
+	must(0, site.WriteCache(*cachePath, out.Cache)) // what did work is still good for next time, even if something didn't.
+	if err != nil {
+		log.Print(err)
+		log.Fatalf("rendering failed: rendered %d articles, skipped %d unchanged, copied %d images", out.Rendered, out.Skipped, out.Copied)
+	}
+	log.Printf("rendered %d articles, skipped %d unchanged, copied %d images", out.Rendered, out.Skipped, out.Copied)
+	must(0, site.WriteMetas(filepath.Join(dstDir, "articles.json"), out.Metas))
+
+	// --- links ---
+	if *checkLinks {
+		pages := make([]string, len(out.Metas))
+		for i := range out.Metas {
+			pages[i] = out.Metas[i].Name
+		}
+		broken := must(site.CheckLinks(dstDir, pages, site.ParseRoutes(*routesFlag)))
+		for _, l := range broken {
+			log.Printf("broken link %s in %s: %s", l.Link, l.Page, l.Reason)
+		}
+		if len(broken) > 0 {
+			log.Fatal("broken links: fix them, or see -routes and -checklinks")
+		}
+	}
+
+	// --- feeds ---
+	feed := must(site.ReadFeed(*feedDir))
+	var changed int
+	items := make([]site.Item, 0, len(out.Metas))
+	for _, m := range out.Metas {
+		page := must(os.ReadFile(filepath.Join(dstDir, m.Name)))
+		if must(feed.Update(m.Name, *siteURL, page, start)) {
+			log.Printf("%s: feed item updated", m.Name)
+			changed++
+		}
+		items = append(items, feed.Items[m.Name])
+	}
+	if changed > 0 {
+		must(0, feed.Write(*feedDir))
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].PubDate.After(items[j].PubDate) }) // newest first.
+	writeFile(filepath.Join(dstDir, "rss.xml"), must(site.RSS(items, *siteURL, start)))
+	writeFile(filepath.Join(dstDir, "atom.xml"), must(site.Atom(items, *siteURL, start)))
+
+	// --- sitemap & index ---
+	writeFile(filepath.Join(dstDir, "sitemap.xml"), must(site.Sitemap(items, *siteURL)))
+	log.Printf("wrote %s", must(site.WriteIndex(dstDir)))
+
+	// --- zip ---
+	f := must(os.Create(*zipPath))
+	files, bytes, err := site.ZipWithConfig(f, dstDir, zcfg)
+	if err == nil {
+		err = f.Close()
+	}
+	must(0, err)
+	log.Printf("combined %d files (%04d KiB) into %s", files, bytes>>10, *zipPath)
+	log.Printf("built site in %s", time.Since(start).Round(time.Millisecond))
+}
+
+func writeFile(path string, b []byte) {
+	must(0, os.WriteFile(path, b, 0o777))
+	log.Printf("wrote %s", path)
+}
+
+func must[T any](t T, err error) T {
+	if err != nil {
+		_, f, line, _ := runtime.Caller(1)
+		fmt.Fprintf(os.Stderr, "%s %d: fatal err: %v\n", f, line, err)
+		os.Exit(1)
+	}
+	return t
+}
@@ -1,56 +1,50 @@
-// prezip walks a directory recursively, combining non-zipped files into an archive and omitting them to stdout.
-// it uses DEFLATE on most file types, but
-// just stores files that are already compressed (.png, .woff2 .jpg; perhaps more later )
+// prezip walks a directory recursively, combining non-zipped files into an archive, written to -o (DIR/assets.zip by default, or stdout for -o -).
+// by default, it uses DEFLATE on most file types, but
+// just stores files that are already compressed (.png, .woff2 .jpg): -policy says otherwise, i.e, to use zstd (see site.ParsePolicy),
+// and -level how hard to try. see site.ZipWithConfig.
+// cmd/buildsite does this too, as well as the rest of the site's build.
 //
 //	usage:
-//	   prezip DIR
+//	   prezip [-o FILE] [-policy EXT=METHOD,...] [-level N] DIR
 package main
 
 import (
-	"archive/zip"
+	"flag"
 	"io"
-	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
+
+	"gitlab.com/efronlicht/blog/site"
 )
 
 func main() {
-	dir := must(filepath.Abs(os.Args[1]))
-	log.SetPrefix("prezip")
-
-	f := must(os.Create(filepath.Join(dir, "assets.zip")))
-	zw := zip.NewWriter(os.Stdout)
-	var files, bytes int64
-	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
-		if strings.Contains(d.Name(), ".zip") || strings.Contains(d.Name(), ".gz") || d.IsDir() {
-			return nil
-		}
-
-		src := must(os.Open(filepath.Join(dir, d.Name())))
-		var dst io.Writer
-		switch filepath.Ext(src.Name()) {
-		case ".woff2", ".png", ".jpg": // already compressed; a layer of deflate won't help.
-			header := must(zip.FileInfoHeader(must(d.Info())))
-			header.Method = zip.Store
-			dst = must(zw.CreateHeader(header))
-		default:
-			dst = must(zw.Create(d.Name()))
-		}
-		bytes += must(io.Copy(dst, src))
+	log.SetPrefix("prezip\t")
+	out := flag.String("o", "", "file to write the archive to, or - for stdout: default DIR/assets.zip")
+	policyFlag := flag.String("policy", site.DefaultPolicy, "comma-separated EXT=METHOD: how to compress each file, by extension, with * for the rest. methods are store, deflate, and zstd")
+	level := flag.Int("level", 0, "compression level: 1-9 for deflate (more is 9), 1-22 for zstd, or 0 for each method's default")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("expected exactly one command-line argument\nusage:\tprezip [-o FILE] DIR")
+	}
+	dir := must(filepath.Abs(flag.Arg(0)))
+	if *out == "" {
+		*out = filepath.Join(dir, "assets.zip")
+	}
 
-		files++
-		src.Close()
-		return nil
-	})
-	if err != nil {
-		panic(err)
+	var w io.WriteCloser = os.Stdout
+	cfg := site.ZipConfig{Policy: must(site.ParsePolicy(*policyFlag)), Level: *level}
+	if *out != "-" {
+		w = must(os.Create(*out))
+		cfg.Exclude = []string{*out} // if it's in dir, don't zip the half-written archive into itself.
+	}
+	files, bytes, err := site.ZipWithConfig(w, dir, cfg)
+	if err == nil {
+		err = w.Close()
 	}
-	zw.Close()
-	f.Close()
+	must(0, err)
 
-	log.Printf("combined %d files (%04d KiB)", files, bytes)
+	log.Printf("combined %d files (%04d KiB) into %s", files, bytes>>10, *out)
 }
 
 func must[T any](t T, err error) T {
@@ -1,27 +1,27 @@
-// rendermarkdown searches a directory for markdown files and renders them as HTML to the output directory.
+// rendermarkdown searches a directory for markdown files and renders them as HTML to the output directory: see site.Render.
+// cmd/buildsite does this too, as well as the rest of the site's build.
 // // USAGE:
-// // rendermarkdown SRC DST
+// // rendermarkdown [-layout DIR] [-site URL] [-ext EXTENSIONS] [-cache FILE] [-force] [-watch] [-addr ADDR] SRC DST
+// afterwards, it checks that every relative link in the articles goes somewhere (see -checklinks), failing if one doesn't.
+// with -watch, it keeps running after the first render, re-rendering articles as they change and serving DST on ADDR with pages that reload themselves.
+// articles whose source, layout, and site haven't changed since the last run (see -cache) aren't rendered again.
 package main
 
 import (
-	"bytes"
-	_ "embed"
+	"context"
+	"flag"
 	"fmt"
-	"io/fs"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"regexp"
 	"runtime"
+	"slices"
 	"strings"
-	"sync"
 	"text/tabwriter"
 
-	"github.com/PuerkitoBio/goquery"
-	"github.com/sourcegraph/syntaxhighlight"
-
-	"github.com/gomarkdown/markdown"
-	"github.com/gomarkdown/markdown/html"
+	"gitlab.com/efronlicht/blog/render"
+	"gitlab.com/efronlicht/blog/site"
 )
 
 func must[T any](t T, err error) T {
@@ -35,108 +35,113 @@ func must[T any](t T, err error) T {
 
 func main() {
 	log.SetPrefix("rendermd\t")
-
-	if len(os.Args) != 3 {
+	layoutDir := flag.String("layout", "", "directory of *.html templates overriding parts of the default page layout: see render.ParseLayout")
+	siteURL := flag.String("site", render.DefaultSiteURL, "URL the site is served from, for canonical URLs and og: tags")
+	cachePath := flag.String("cache", "cmd/rendermd/cache.json", "file of checksums from the last run, so unchanged articles aren't rendered again")
+	force := flag.Bool("force", false, "render every article, whether or not it's changed")
+	watchMode := flag.Bool("watch", false, "after rendering, re-render articles as they change, previewing them on -addr until interrupted")
+	addr := flag.String("addr", "localhost:8081", "address to serve the preview on, with -watch")
+	checkLinksFlag := flag.Bool("checklinks", true, "fail if a relative href or src in an article doesn't resolve to a file in dstdir or one of -routes")
+	extFlag := flag.String("ext", "", "comma-separated markdown extensions to enable, or all: "+render.AllExtensions.String())
+	workers := flag.Int("j", runtime.NumCPU(), "how many files to render at once")
+	routesFlag := flag.String("routes", site.DefaultRoutes, "comma-separated paths the server answers without a file, for -checklinks: i.e, redirects")
+	flag.Parse()
+
+	if flag.NArg() != 2 {
 		log.Print("expected two command-line arguments")
-		log.Fatal("USAGE: rendermd srcdir dstdir")
+		log.Fatal("USAGE: rendermd [flags] srcdir dstdir")
+	}
+	srcDir, dstDir := must(filepath.Abs(flag.Arg(0))), must(filepath.Abs(flag.Arg(1)))
+	cfg := render.Config{SiteURL: *siteURL, Extensions: must(render.ParseExtensions(*extFlag))}
+	if *layoutDir != "" {
+		cfg.Layout = must(render.ParseLayout(*layoutDir))
 	}
-	srcDir, dstDir := must(filepath.Abs(os.Args[1])), must(filepath.Abs(os.Args[2]))
-	must(0, os.MkdirAll(dstDir, 0o777))
 	log.Println("srcDir: ", srcDir)
 	log.Println("dstDir: ", dstDir)
-	const format = "rendermd\t%s\t->\t%s\n"
 	log.Println("scanning...")
-	var wg sync.WaitGroup              // guards against premature exit before all goroutines are done processing markdown files
-	type res struct{ md, html string } // communicates results from goroutines to main thread
-	ch := make(chan res, 24)
-	// walkFunc is called for each file in the directory tree.
-	// it renders markdown files as HTML, and copies other files as-is.
-	// because the markdown rendering is CPU-bound, it uses a goroutine for each markdown file,
-
-	walkFunc := func(srcPath string, d fs.DirEntry, err error) error {
-		tw := tabwriter.NewWriter(os.Stderr, 2, 2, 2, ' ', 0)
-
-		defer tw.Flush()
-		if strings.Contains(srcPath, "vendor") || !strings.Contains(srcPath, "efronlicht") || strings.Contains(srcPath, dstDir) {
-			return fs.SkipDir
-		}
-		_ = must(0, err)
-		switch filepath.Ext(srcPath) {
-		default:
-			return nil
-		case ".gif", ".png":
-			b := must(os.ReadFile(srcPath))
-			dstPath := filepath.Join(dstDir, filepath.Base(srcPath))
-			if err := os.WriteFile(dstPath, b, 0o777); err != nil {
-				log.Fatal(err)
-			}
-			ch <- res{md: srcPath, html: dstPath}
-			return nil
-		case ".md":
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				dstPath := strings.ReplaceAll(filepath.Join(dstDir, filepath.Base(srcPath)), ".md", ".html")
-
-				fmt.Fprintf(tw, format, srcPath, dstPath)
-				must(0, os.WriteFile(dstPath, renderMarkdown(srcPath), 0o777))
-				ch <- res{md: srcPath, html: dstPath}
-			}()
-			return nil
-		}
+	rcfg := site.RenderConfig{
+		Src:     srcDir,
+		Dst:     dstDir,
+		Render:  cfg,
+		Layout:  must(site.LayoutSum(cfg, *layoutDir)),
+		Workers: *workers,
+		Ignore: func(path string) bool {
+			return strings.Contains(path, "vendor") || !strings.Contains(path, "efronlicht") || strings.Contains(path, dstDir)
+		},
 	}
-
-	err := filepath.WalkDir(srcDir, walkFunc)
-	if err != nil {
-		log.Fatal(err)
+	if !*force {
+		rcfg.Cache = must(site.ReadCache(*cachePath))
 	}
-	go func() {
-		wg.Wait()
-		close(ch)
-	}()
+	const format = "rendermd\t%s\t->\t%s\n"
 	tw := tabwriter.NewWriter(os.Stderr, 2, 2, 2, ' ', 0)
 	fmt.Fprintf(tw, format, "src", "dst")
 	fmt.Fprintf(tw, format, strings.Repeat("-", 20), strings.Repeat("-", 20))
 	defer tw.Flush()
-	for r := range ch {
-		fmt.Fprintf(tw, format, r.md, r.html)
+	rcfg.Progress = func(src, dst string) { fmt.Fprintf(tw, format, src, dst) }
+	out, err := site.Render(rcfg)
+	if err != nil { // what did work is still good for next time: but articles.json would be missing articles.
+		must(0, site.WriteCache(*cachePath, out.Cache))
+		tw.Flush()
+		log.Print(err)
+		log.Fatalf("rendering failed: rendered %d articles, skipped %d unchanged, copied %d images", out.Rendered, out.Skipped, out.Copied)
 	}
-}
-
-var findtitleRE = regexp.MustCompile(`^# (.+)`) // like # Golang Quirks & Intermediate Tricks, Pt 1: Declarations, Control Flow, & Typesystem
-
-//go:embed article_list.md
-var articlelist []byte
-
-func renderMarkdown(path string) []byte {
-	b := markdown.NormalizeNewlines(must(os.ReadFile(path)))
-	var title string
-	if match := findtitleRE.FindSubmatch(b); len(match) > 1 {
-		title = strings.TrimSpace(string(match[1])) // use title from markdown
-	} else {
-		title = strings.TrimSuffix(filepath.Base(path), ".md") // default to filename
+	metas, fresh := out.Metas, out.Cache
+	metaPath := filepath.Join(dstDir, "articles.json")
+	must(0, site.WriteMetas(metaPath, metas))
+	fmt.Fprintf(tw, format, "(metadata)", metaPath)
+	must(0, site.WriteCache(*cachePath, fresh))
+	fmt.Fprintf(tw, format, "(cache)", *cachePath)
+	tw.Flush()
+	log.Printf("rendered %d articles, skipped %d unchanged, copied %d images", out.Rendered, out.Skipped, out.Copied)
+
+	routes := site.ParseRoutes(*routesFlag)
+	// reportLinks checks the links in pages, reporting any broken ones: false if there are.
+	reportLinks := func(pages ...string) bool {
+		if !*checkLinksFlag {
+			return true
+		}
+		broken := must(site.CheckLinks(dstDir, pages, routes))
+		if len(broken) == 0 {
+			return true
+		}
+		tw := tabwriter.NewWriter(os.Stderr, 2, 2, 2, ' ', 0)
+		fmt.Fprintf(tw, "rendermd\tbroken link\tin\t%s\n", "why")
+		for _, l := range broken {
+			fmt.Fprintf(tw, "rendermd\t%s\tin\t%s: %s\n", l.Link, l.Page, l.Reason)
+		}
+		tw.Flush()
+		return false
+	}
+	pages := make([]string, len(metas))
+	for i := range metas {
+		pages[i] = metas[i].Name
+	}
+	if ok := reportLinks(pages...); !ok && !*watchMode {
+		log.Fatal("broken links: fix them, or see -routes and -checklinks")
+	}
+	if !*watchMode {
+		return
 	}
 
-	const placeholder = `<<article list placeholder>>`
-	b = bytes.ReplaceAll(b, []byte(placeholder), articlelist)
-
-	renderer := html.NewRenderer(html.RendererOptions{
-		Icon:           "/favicon.ico",
-		AbsolutePrefix: "",
-		CSS:            "/s.css",
-		Flags:          html.CommonFlags | html.CompletePage,
-		Title:          title,
-	})
-	html := markdown.ToHTML(b, nil, renderer)
-	doc := must(goquery.NewDocumentFromReader(bytes.NewReader(html)))
-	// find code-parts via css selector and replace them with highlighted versions
-	doc.Find("code[class*=\"language-\"]").Each(func(i int, s *goquery.Selection) {
-		oldCode := s.Text()
-		s.SetHtml(string(must(syntaxhighlight.AsHTML([]byte(oldCode)))))
-	})
-	html = []byte((must(doc.Html())))
-	html = bytes.ReplaceAll(html, []byte("<html><head></head><body>"), nil)
-	html = bytes.ReplaceAll(html, []byte("</body></html>"), nil)
-
-	return html
+	// the render's done, so nothing else touches metas or fresh: watch calls rebuild one file at a time.
+	rebuild := func(srcPath string) error {
+		entry, err := site.RenderArticle(rcfg, srcPath)
+		if err != nil {
+			return err
+		}
+		fresh[must(filepath.Rel(srcDir, srcPath))] = entry
+		i := slices.IndexFunc(metas, func(m render.Meta) bool { return m.Name == entry.Meta.Name })
+		if i < 0 {
+			metas = append(metas, entry.Meta)
+		} else {
+			metas[i] = entry.Meta
+		}
+		must(0, site.WriteMetas(metaPath, metas))
+		must(0, site.WriteCache(*cachePath, fresh))
+		reportLinks(entry.Meta.Name) // just a warning: the author's probably mid-edit.
+		return nil
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	must(0, watch(ctx, *addr, srcDir, dstDir, rcfg.Ignore, rebuild))
 }
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadPath is where the preview's pages listen for re-renders: see reloadScript.
+const reloadPath = "/_rendermd/reload"
+
+// reloadScript goes at the end of every page the preview serves: it reloads the page whenever something's re-rendered.
+const reloadScript = `<script>new EventSource("` + reloadPath + `").onmessage = () => location.reload();</script>`
+
+// watch serves dstDir on addr, re-rendering markdown under srcDir with rebuild when it changes, and telling every open page to reload.
+// ignore says which paths to leave alone, like the initial walk. It runs until ctx is done.
+func watch(ctx context.Context, addr, srcDir, dstDir string, ignore func(path string) bool, rebuild func(srcPath string) error) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	// fsnotify isn't recursive, so we have to add every directory ourselves.
+	err = filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if name := d.Name(); name == "vendor" || name == ".git" || path == dstDir {
+			return fs.SkipDir
+		}
+		return watcher.Add(path)
+	})
+	if err != nil {
+		return err
+	}
+
+	rl := &reloader{listeners: make(map[chan struct{}]struct{})}
+	mux := http.NewServeMux()
+	mux.Handle(reloadPath, rl)
+	mux.Handle("/", preview(dstDir))
+	srv := &http.Server{Addr: addr, Handler: mux}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	log.Printf("watching %s: previewing %s at http://%s", srcDir, dstDir, addr)
+
+	for {
+		select {
+		case <-ctx.Done():
+			srv.Close() // not Shutdown: the open pages' event streams never finish on their own.
+			return nil
+		case err := <-errc:
+			return err
+		case err := <-watcher.Errors:
+			log.Printf("watcher error: %v", err)
+		case ev := <-watcher.Events:
+			if filepath.Ext(ev.Name) != ".md" || !ev.Has(fsnotify.Write|fsnotify.Create) || ignore(ev.Name) {
+				continue
+			}
+			if err := rebuild(ev.Name); err != nil { // keep watching: the author's probably mid-edit.
+				log.Printf("%s: %v", ev.Name, err)
+				continue
+			}
+			log.Printf("re-rendered %s", ev.Name)
+			rl.reload()
+		}
+	}
+}
+
+// reloader serves a text/event-stream that sends an event every time reload is called.
+type reloader struct {
+	mu        sync.Mutex
+	listeners map[chan struct{}]struct{}
+}
+
+// reload tells every listening page to reload. It doesn't block: a page that hasn't caught up with the last one only needs to reload once.
+func (rl *reloader) reload() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	for ch := range rl.listeners {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (rl *reloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	ch := make(chan struct{}, 1)
+	rl.mu.Lock()
+	rl.listeners[ch] = struct{}{}
+	rl.mu.Unlock()
+	defer func() {
+		rl.mu.Lock()
+		delete(rl.listeners, ch)
+		rl.mu.Unlock()
+	}()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ch:
+			fmt.Fprint(w, "data: reload\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// preview serves dstDir, putting reloadScript at the end of every HTML page's body.
+func preview(dstDir string) http.Handler {
+	files := http.FileServer(http.Dir(dstDir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+		if name == "/" {
+			name = "/index.html"
+		}
+		if path.Ext(name) != ".html" {
+			files.ServeHTTP(w, r)
+			return
+		}
+		b, err := os.ReadFile(filepath.Join(dstDir, filepath.FromSlash(name)))
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if i := bytes.LastIndex(b, []byte("</body>")); i >= 0 {
+			b = append(b[:i:i], append([]byte(reloadScript), b[i:]...)...)
+		} else {
+			b = append(b, reloadScript...)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		_, _ = w.Write(b)
+	})
+}
@@ -10,6 +10,8 @@ import (
 	"net"
 	"os"
 	"strings"
+
+	"gitlab.com/efronlicht/blog/articles/backendbasics"
 )
 
 // define flags
@@ -62,14 +64,13 @@ func main() {
 	conn.Write([]byte(request))
 	log.Printf("sent request:\n%s", request)
 
-	for scanner := bufio.NewScanner(conn); scanner.Scan(); {
-		line := scanner.Bytes()
-		if _, err := fmt.Fprintf(os.Stdout, "%s\n", line); err != nil {
-			log.Printf("error writing to connection: %s", err)
-		}
-		if scanner.Err() != nil {
-			log.Printf("error reading from connection: %s", err)
-			return
-		}
+	// read exactly one response: the status line, the headers, and Content-Length bytes of body (or the chunks, if it's chunked).
+	// see backendbasics.ReadResponse.
+	resp, err := backendbasics.ReadResponse(bufio.NewReader(conn))
+	if err != nil {
+		log.Fatalf("error reading response: %v", err)
+	}
+	if _, err := resp.WriteTo(os.Stdout); err != nil {
+		log.Printf("error writing to stdout: %s", err)
 	}
 }
@@ -1,6 +1,6 @@
 // writetcp connects to a TCP server at localhost with the specified port (8080 by default) and forwards stdin to the server,
 // line-by-line, until EOF is reached.
-// received lines from the server are printed to stdout.
+// received lines from the server are printed to stdout; or, with -http, parsed as HTTP responses and printed one at a time.
 package main
 
 import (
@@ -11,6 +11,8 @@ import (
 	"log"
 	"net"
 	"os"
+
+	"gitlab.com/efronlicht/blog/articles/backendbasics"
 )
 
 func main() {
@@ -20,6 +22,7 @@ func main() {
 	// register the command-line flags: -p specifies the port to connect to
 	port := flag.Int("p", 8080, "port to connect to")
 	host := flag.String("h", "", "host to connect to; leave empty for localhost")
+	parseHTTP := flag.Bool("http", false, "parse what the server sends as HTTP/1.1 responses, rather than printing it line by line")
 	flag.Parse()
 
 	var ip net.IP // find the ip address of the host we want to connect to
@@ -45,6 +48,16 @@ func main() {
 	defer conn.Close()
 	go func() { // spawn a goroutine to read incoming lines from the server and print them to stdout.
 		// TCP is full-duplex, so we can read and write at the same time; we just need to spawn a goroutine to do the reading.
+		if *parseHTTP {
+			// one bufio.Reader for the whole connection: whatever it's read past the end of one response is the start of the next.
+			for r := bufio.NewReader(conn); ; {
+				resp, err := backendbasics.ReadResponse(r)
+				if err != nil {
+					log.Fatalf("error reading response from %s: %v", conn.RemoteAddr(), err)
+				}
+				resp.WriteTo(os.Stdout)
+			}
+		}
 
 		for connScanner := bufio.NewScanner(conn); connScanner.Scan(); {
 
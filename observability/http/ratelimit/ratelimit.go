@@ -0,0 +1,158 @@
+// package ratelimit contains token-bucket rate limiting middleware for http servers.
+// Basic usage:
+//
+//	h = ratelimit.Server(h, ratelimit.Config{
+//		Global: ratelimit.Limit{RPS: 500, Burst: 1000}, // the whole server
+//		PerIP:  ratelimit.Limit{RPS: 10, Burst: 20},    // each client
+//	})
+//	h = tracemw.Server(h, logger) // so rejected requests still get traced and logged.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket: it holds up to Burst tokens, refilling at RPS tokens per second.
+// Each request takes a token. The zero Limit is unlimited.
+// A Limit with an RPS but no Burst gets a second's worth: max(1, ceil(RPS)). Otherwise, setting only the rate would turn the limit off.
+type Limit struct {
+	RPS   float64
+	Burst int
+}
+
+func (l Limit) enabled() bool { return l.RPS > 0 && l.Burst > 0 }
+
+// withDefaults is l, with its default Burst.
+func (l Limit) withDefaults() Limit {
+	if l.RPS > 0 && l.Burst == 0 {
+		l.Burst = max(1, int(math.Ceil(l.RPS)))
+	}
+	return l
+}
+
+// Config configures Server.
+type Config struct {
+	Global Limit // shared by every request.
+	PerIP  Limit // one bucket per client IP.
+	// IPHeader, if set, is a header to take the client IP from instead of the connection's remote address:
+	// i.e, "Fly-Client-IP" or "X-Forwarded-For" behind a proxy. Only set this if the proxy overwrites it; clients can forge it.
+	IPHeader string
+}
+
+// Server limits the rate of requests to h, responding 429 Too Many Requests with a Retry-After header when a bucket is empty.
+// The per-IP bucket is checked first, so one noisy client can't drain the global bucket for everyone else.
+func Server(h http.Handler, cfg Config) http.HandlerFunc {
+	if cfg.Global.RPS < 0 || cfg.Global.Burst < 0 || cfg.PerIP.RPS < 0 || cfg.PerIP.Burst < 0 {
+		panic(fmt.Sprintf("negative rate limit: %+v", cfg))
+	}
+	cfg.Global, cfg.PerIP = cfg.Global.withDefaults(), cfg.PerIP.withDefaults()
+	l := newLimiter(cfg, time.Now)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := l.allow(clientIP(r, cfg.IPHeader)); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprintf(w, `{"error": %q}`, "rate limit exceeded: retry after "+wait.Round(time.Millisecond).String())
+			return
+		}
+		h.ServeHTTP(w, r)
+	}
+}
+
+// limiter holds the buckets. Idle per-IP buckets are swept out every so often so the map doesn't grow forever.
+type limiter struct {
+	cfg       Config
+	now       func() time.Time
+	mu        sync.Mutex
+	global    bucket
+	perIP     map[string]*bucket
+	lastSweep time.Time
+}
+
+func newLimiter(cfg Config, now func() time.Time) *limiter {
+	t := now()
+	return &limiter{
+		cfg:       cfg,
+		now:       now,
+		global:    bucket{tokens: float64(cfg.Global.Burst), last: t},
+		perIP:     make(map[string]*bucket),
+		lastSweep: t,
+	}
+}
+
+// allow takes a token from ip's bucket and the global one, returning false and how long to wait if either is empty.
+func (l *limiter) allow(ip string) (ok bool, wait time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if l.cfg.PerIP.enabled() {
+		if now.Sub(l.lastSweep) > time.Minute {
+			l.sweep(now)
+		}
+		b, ok := l.perIP[ip]
+		if !ok {
+			b = &bucket{tokens: float64(l.cfg.PerIP.Burst), last: now}
+			l.perIP[ip] = b
+		}
+		if ok, wait := b.take(now, l.cfg.PerIP); !ok {
+			return false, wait
+		}
+	}
+	if l.cfg.Global.enabled() {
+		return l.global.take(now, l.cfg.Global)
+	}
+	return true, 0
+}
+
+// sweep forgets buckets that have refilled completely: they're indistinguishable from new ones.
+func (l *limiter) sweep(now time.Time) {
+	for ip, b := range l.perIP {
+		if b.refill(now, l.cfg.PerIP) >= float64(l.cfg.PerIP.Burst) {
+			delete(l.perIP, ip)
+		}
+	}
+	l.lastSweep = now
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time // last time tokens was updated
+}
+
+// refill adds the tokens accumulated since the last update, returning the new total.
+func (b *bucket) refill(now time.Time, l Limit) float64 {
+	b.tokens = math.Min(float64(l.Burst), b.tokens+now.Sub(b.last).Seconds()*l.RPS)
+	b.last = now
+	return b.tokens
+}
+
+// take removes a token if one is available; otherwise, it reports how long until one will be.
+func (b *bucket) take(now time.Time, l Limit) (ok bool, wait time.Duration) {
+	if b.refill(now, l) >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.RPS * float64(time.Second))
+}
+
+// clientIP is the IP address of the client that sent r: from header, if set and present, or the remote address otherwise.
+func clientIP(r *http.Request, header string) string {
+	if header != "" {
+		if v := r.Header.Get(header); v != "" {
+			first, _, _ := strings.Cut(v, ",") // X-Forwarded-For: client, proxy1, proxy2
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
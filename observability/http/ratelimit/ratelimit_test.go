@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newLimiter(Config{Global: Limit{RPS: 10, Burst: 3}, PerIP: Limit{RPS: 1, Burst: 2}}, func() time.Time { return now })
+
+	for _, step := range []struct {
+		advance time.Duration
+		ip      string
+		wantOK  bool
+	}{
+		{0, "a", true},
+		{0, "a", true},
+		{0, "a", false}, // a's burst is used up...
+		{0, "b", true},  // ...but b has its own bucket...
+		{0, "c", false}, // ...and now the global bucket is empty.
+		{100 * time.Millisecond, "c", true},
+		{900 * time.Millisecond, "a", true}, // a refilled one token in a second.
+		{0, "a", false},
+	} {
+		now = now.Add(step.advance)
+		if ok, wait := l.allow(step.ip); ok != step.wantOK {
+			t.Fatalf("at %s: allow(%q) = %v (wait %s), want %v", now.Sub(time.Unix(0, 0)), step.ip, ok, wait, step.wantOK)
+		} else if !ok && wait <= 0 {
+			t.Fatalf("at %s: allow(%q) rejected with non-positive wait %s", now.Sub(time.Unix(0, 0)), step.ip, wait)
+		}
+	}
+
+	now = now.Add(2 * time.Minute)
+	l.allow("d") // triggers a sweep: everyone else has refilled.
+	if len(l.perIP) != 1 {
+		t.Fatalf("expected idle buckets to be swept, but have %d", len(l.perIP))
+	}
+}
+
+func TestServer(t *testing.T) {
+	h := Server(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), Config{PerIP: Limit{RPS: 0.5, Burst: 1}, IPHeader: "X-Forwarded-For"})
+	for i, want := range []int{200, 429} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Forwarded-For", "10.0.0.1, 10.0.0.2")
+		h(rec, req)
+		if rec.Code != want {
+			t.Fatalf("request %d: expected %d, got %d", i, want, rec.Code)
+		}
+		if want == 429 && rec.Header().Get("Retry-After") != "2" {
+			t.Fatalf("expected Retry-After: 2, got %q", rec.Header().Get("Retry-After"))
+		}
+	}
+	// a different client isn't affected.
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Forwarded-For", "10.0.0.3")
+	if h(rec, req); rec.Code != 200 {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+}
+
+func TestDefaultBurst(t *testing.T) {
+	// only an RPS, as from RATE_LIMIT_RPS without RATE_LIMIT_BURST: still limited, with a burst of ceil(RPS).
+	h := Server(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), Config{PerIP: Limit{RPS: 1.5}})
+	for i, want := range []int{200, 200, 429} {
+		rec := httptest.NewRecorder()
+		if h(rec, httptest.NewRequest("GET", "/", nil)); rec.Code != want {
+			t.Fatalf("request %d: expected %d, got %d", i, want, rec.Code)
+		}
+	}
+	for _, tt := range []struct {
+		in   Limit
+		want int
+	}{{Limit{RPS: 0.1}, 1}, {Limit{RPS: 10}, 10}, {Limit{RPS: 10, Burst: 3}, 3}, {Limit{}, 0}} {
+		if got := tt.in.withDefaults().Burst; got != tt.want {
+			t.Errorf("%+v: expected burst %d, got %d", tt.in, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package secheaders_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gitlab.com/efronlicht/blog/observability/http/secheaders"
+)
+
+func TestServer(t *testing.T) {
+	p := secheaders.Default().
+		CSPOverrides("img-src 'self' https://img.example.com; object-src; script-src 'self'").
+		HSTS(time.Hour, true, false).
+		FrameOptions("")
+	h := secheaders.Server(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Referrer-Policy", "no-referrer") // handlers can override.
+	}), p)
+	p.Set("X-Late-Addition", "ignored") // too late: Server already copied the policy.
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", "/", nil))
+	for k, want := range map[string]string{
+		"Content-Security-Policy":   "default-src 'self'; img-src 'self' https://img.example.com; base-uri 'self'; form-action 'self'; frame-ancestors 'none'; script-src 'self'",
+		"Strict-Transport-Security": "max-age=3600; includeSubDomains",
+		"X-Content-Type-Options":    "nosniff",
+		"Referrer-Policy":           "no-referrer",
+		"X-Frame-Options":           "",
+		"X-Late-Addition":           "",
+	} {
+		if got := rec.Header().Get(k); got != want {
+			t.Errorf("%s: got %q, want %q", k, got, want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// package timeout contains per-request timeout middleware for http servers.
+// Unlike a bare context.WithTimeout (see articles/backendbasics/middleware.TimeoutMiddleware),
+// a handler that runs out the clock doesn't just get its output cut off wherever it happened to be:
+// the client gets a proper 503 with a JSON error, and the timeout shows up in the logs with the request's trace.
+// Basic usage:
+//
+//	h = timeout.Server(h, 2*time.Second, logger)
+//	h = tracemw.Server(h, logger) // outermost, so the timeout is logged with the trace.
+package timeout
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"gitlab.com/efronlicht/blog/observability/trace"
+	"go.uber.org/zap"
+)
+
+// Server runs h with a deadline of d on the request's context.
+// h's response is buffered until it returns, so that if the deadline passes first, we can throw away whatever it wrote so far
+// and respond 503 Service Unavailable instead. After that, h's writes fail with http.ErrHandlerTimeout;
+// it should notice its context is done and return promptly.
+//
+// Since responses are buffered in memory, don't wrap handlers that stream or serve large files.
+// A panic in h is re-raised in the caller's goroutine, so recovery middleware further out still sees it.
+func Server(h http.Handler, d time.Duration, logger *zap.Logger) http.HandlerFunc {
+	if d <= 0 {
+		panic(fmt.Sprintf("non-positive timeout %s", d))
+	}
+	if logger == nil {
+		panic("nil logger: if you want to omit logging, use zap.NewNop()")
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		tw := &writer{ctx: ctx, header: make(http.Header)}
+		done, panicked := make(chan struct{}), make(chan any, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+			h.ServeHTTP(tw, r.WithContext(ctx))
+			close(done)
+		}()
+		select {
+		case p := <-panicked:
+			panic(p)
+		case <-done:
+		case <-ctx.Done():
+		}
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		// the handler might finish just as the deadline passes: what matters is whether it got its whole response in first.
+		select {
+		case <-done:
+			if !tw.late {
+				dst := w.Header()
+				for k, v := range tw.header {
+					dst[k] = v
+				}
+				if tw.statusCode == 0 {
+					tw.statusCode = http.StatusOK
+				}
+				w.WriteHeader(tw.statusCode)
+				_, _ = w.Write(tw.body.Bytes())
+				return
+			}
+		default:
+		}
+		tw.late = true // no more writes.
+		t, _ := trace.FromCtx(r.Context())
+		fields := []zap.Field{
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Duration("timeout", d),
+			zap.Duration("elapsed", time.Since(start)),
+			zap.Int("discarded_status_code", tw.statusCode),
+			zap.Int("discarded_bytes", tw.body.Len()),
+			zap.Stringer("trace_id", t.TraceID),
+			zap.Stringers("request_id", t.RequestIDs),
+		}
+		if err := ctx.Err(); err != context.DeadlineExceeded { // the client went away: there's no one to respond to.
+			logger.Debug("timeout: request canceled", append(fields, zap.Error(err))...)
+			return
+		}
+		logger.Error("timeout: handler exceeded deadline", fields...)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, `{"error": %q}`, "request timed out after "+d.String())
+	}
+}
+
+// writer buffers a response. Once the request's context is done, writes fail, and the response is discarded.
+type writer struct {
+	ctx        context.Context
+	mu         sync.Mutex
+	header     http.Header
+	body       bytes.Buffer
+	statusCode int
+	late       bool // a write came in after the context was done (or Server gave up waiting).
+}
+
+// Header returns the buffered header map. Like http.TimeoutHandler, we don't lock it: handlers shouldn't touch it after they return.
+func (w *writer) Header() http.Header { return w.header }
+
+func (w *writer) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.late || w.ctx.Err() != nil {
+		w.late = true
+		return 0, http.ErrHandlerTimeout
+	}
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+func (w *writer) WriteHeader(statusCode int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.late || w.statusCode != 0 {
+		return
+	}
+	w.statusCode = statusCode
+}
@@ -0,0 +1,67 @@
+package timeout_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/efronlicht/blog/observability/http/timeout"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestServer(t *testing.T) {
+	var logs bytes.Buffer
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewDevelopmentEncoderConfig()), zapcore.AddSync(&logs), zapcore.DebugLevel))
+	writeErr := make(chan error, 1)
+	h := timeout.Server(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Handler", "yes")
+		if r.URL.Path == "/fast" {
+			w.WriteHeader(http.StatusTeapot)
+			w.Write([]byte("done"))
+			return
+		}
+		w.Write([]byte("partial output"))
+		<-r.Context().Done()
+		_, err := w.Write([]byte("too late"))
+		writeErr <- err
+	}), 20*time.Millisecond, logger)
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", "/fast", nil))
+	if rec.Code != http.StatusTeapot || rec.Body.String() != "done" || rec.Header().Get("X-Handler") != "yes" {
+		t.Fatalf("expected the handler's response, got %d %q %v", rec.Code, rec.Body.String(), rec.Header())
+	}
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", "/slow", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rec.Code)
+	}
+	if body := rec.Body.String(); strings.Contains(body, "partial") || !strings.Contains(body, "timed out") {
+		t.Fatalf("expected a JSON error and none of the partial output, got %q", body)
+	}
+	if rec.Header().Get("X-Handler") != "" {
+		t.Fatal("expected the handler's headers to be discarded")
+	}
+	if err := <-writeErr; !errors.Is(err, http.ErrHandlerTimeout) {
+		t.Fatalf("expected writes after the timeout to fail with ErrHandlerTimeout, got %v", err)
+	}
+	if !strings.Contains(logs.String(), "exceeded deadline") || !strings.Contains(logs.String(), `"discarded_bytes":14`) {
+		t.Fatalf("expected the timeout to be logged, got %s", logs.String())
+	}
+}
+
+func TestServerPanic(t *testing.T) {
+	h := timeout.Server(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { panic("boom") }), time.Second, zap.NewNop())
+	defer func() {
+		if p := recover(); p != "boom" {
+			t.Fatalf("expected the handler's panic to propagate, got %v", p)
+		}
+	}()
+	h(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
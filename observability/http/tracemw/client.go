@@ -1,10 +1,8 @@
 package tracemw
 
 import (
-	"bytes"
 	"fmt"
 	"net/http"
-	"sync"
 	"time"
 
 	"gitlab.com/efronlicht/blog/observability/trace"
@@ -19,15 +17,9 @@ type ClientInterface interface {
 	Do(r *http.Request) (*http.Response, error)
 }
 
-var excludeHeaders = map[string]bool{
-	http.CanonicalHeaderKey("Authorization"): true,
-}
-
 // ClientFunc implements *http.RoundTripper and Do()
 type ClientFunc func(*http.Request) (*http.Response, error)
 
-var bufpool = sync.Pool{New: func() any { return bytes.NewBuffer(make([]byte, 0, 256)) }}
-
 // HTTPClientMW logs and traces a request.
 // It does the following:
 //   - populates the request headers with a Trace before sending off a request.
@@ -40,47 +32,66 @@ var bufpool = sync.Pool{New: func() any { return bytes.NewBuffer(make([]byte, 0,
 //	c := Client(http.DefaultClient, zap.L())
 //	req, _ := http.NewRequest("GET", "https://example.com/ping", nil)
 //	resp, err := c.Do(req)
+//
+// It follows the sampling decision of the trace in the request's context, if any, and samples everything else: see ClientWithLogConfig.
 func Client(
 	client ClientInterface,
 	log *zap.Logger,
 ) ClientInterface {
+	opts := DefaultOptions()
+	opts.Log.ParentBased = true
+	return ClientWithOptions(client, log, opts)
+}
+
+// ClientWithLogConfig is Client, sampling requests according to cfg: an unsampled request is only logged if it fails.
+// The decision is sent along to the server. cfg.QuietPaths doesn't apply: successful requests are always logged at Debug.
+func ClientWithLogConfig(client ClientInterface, log *zap.Logger, cfg LogConfig) ClientInterface {
+	opts := DefaultOptions()
+	opts.Log = cfg
+	return ClientWithOptions(client, log, opts)
+}
+
+// ClientWithOptions is Client, configured by opts. See ClientWithLogConfig for how opts.Log applies to a client.
+func ClientWithOptions(client ClientInterface, log *zap.Logger, opts Options) ClientInterface {
 	if client == nil {
 		panic("nil client: try using &http.DefaultClient")
 	}
 	if log == nil {
 		panic("nil logger: if you want to omit logging, use zap.NewNoOp()")
 	}
+	cfg, headers := opts.Log, newHeaderLogger(opts)
 	return ClientFunc(func(req *http.Request) (*http.Response, error) {
-		t := trace.FromCtxOrNew(req.Context())
+		t := cfg.sampler().Sample(trace.FromCtxOrNew(req.Context()))
+		sampled := t.Sampling == trace.Sampled
 		start := time.Now()
 		log := log.With(zap.String("method", req.Method), zap.String("path", req.URL.Path))
 		prefix := fmt.Sprintf("client: %s %s: ", req.Method, req.URL.Path)
 
-		{ // log request
-			buf := bufpool.Get().(*bytes.Buffer)
-			buf.Reset()
-			if err := req.Header.WriteSubset(buf, excludeHeaders); err != nil {
-				panic(err)
-			}
+		if sampled { // log request
 			log.Debug(prefix+"begin",
 				zap.String("user-agent", req.UserAgent()),
 				zap.Stringer("trace_id", t.TraceID),
 				zap.Stringers("request_id", t.RequestIDs),
 				zap.String("remote_addr", req.RemoteAddr),
-				zap.Stringer("headers", buf),
+				headers.field(req.Header),
 			)
-			bufpool.Put(buf)
 		}
 
+		exporter := trace.Exporter()
+		if exporter != nil {
+			// the client's span is a hop of its own, between the caller's span and the server's.
+			t = t.AddHop()
+		}
 		trace.PopulateHttpHeader(req.Header, t)
 		resp, err := client.Do(req)
+		exportClientSpan(exporter, req, t, start, resp, err)
 		if err != nil {
 			log.Error(prefix+"end: request failed", zap.Error(err))
 			return resp, err
 		}
 		if returnedTrace, ok := trace.FromCtx(req.Context()); ok {
 			t = returnedTrace
-		} else {
+		} else if sampled {
 			log.Debug(prefix + "response failed to return trace")
 		}
 		// log resposne
@@ -89,11 +100,40 @@ func Client(
 			return resp, err
 		}
 
+		if !sampled {
+			return resp, err
+		}
 		log.Debug(prefix+"end: ok", zap.Duration("elapsed", time.Since(start)), zap.Int("status_code", resp.StatusCode), zap.Stringer("trace_id", t.TraceID), zap.Stringers("request_id", t.RequestIDs))
 		return resp, err
 	})
 }
 
+// exportClientSpan sends the span for a request to exporter, if it's non-nil.
+// Unlike the server's side, a 4xx is an error: the request didn't do what we wanted.
+func exportClientSpan(exporter *trace.OTLPExporter, req *http.Request, t trace.Trace, start time.Time, resp *http.Response, err error) {
+	if exporter == nil || t.Sampling == trace.NotSampled {
+		return
+	}
+	span := trace.Span{
+		Trace: t, Name: req.Method, Kind: trace.SpanKindClient, Start: start, End: time.Now(),
+		Attributes: map[string]any{
+			"http.request.method": req.Method,
+			"url.full":            req.URL.Redacted(),
+			"server.address":      req.URL.Hostname(),
+		},
+	}
+	switch {
+	case err != nil:
+		span.StatusCode, span.StatusMessage = trace.StatusError, err.Error()
+	case resp.StatusCode >= 400:
+		span.StatusCode, span.StatusMessage = trace.StatusError, resp.Status
+		fallthrough
+	default:
+		span.Attributes["http.response.status_code"] = resp.StatusCode
+	}
+	exporter.Export(span)
+}
+
 func (cf ClientFunc) Do(req *http.Request) (*http.Response, error) {
 	return cf(req)
 }
@@ -1,16 +1,22 @@
 package tracemw_test
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"gitlab.com/efronlicht/blog/observability/http/tracemw"
+	"gitlab.com/efronlicht/blog/observability/metrics"
 	"gitlab.com/efronlicht/blog/observability/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -96,3 +102,308 @@ func TestTraceFromServerOnly(t *testing.T) {
 		}
 	}
 }
+
+func TestLogConfig(t *testing.T) {
+	var logs bytes.Buffer
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewDevelopmentEncoderConfig()), zapcore.AddSync(&logs), zapcore.InfoLevel))
+	h := tracemw.ServerWithLogConfig(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/debug/fail" {
+			w.WriteHeader(500)
+		}
+	}), logger, tracemw.LogConfig{SampleRate: 0, QuietPaths: []string{"/debug/"}})
+	for _, tt := range []struct {
+		path    string
+		wantLog bool
+	}{
+		{"/debug/uptime", false}, // quiet path
+		{"/index.html", false},   // not sampled
+		{"/debug/fail", true},    // errors are always logged
+	} {
+		logs.Reset()
+		h(httptest.NewRecorder(), httptest.NewRequest("GET", tt.path, nil))
+		if got := logs.Len() > 0; got != tt.wantLog {
+			t.Errorf("%s: expected logged=%v, got %v: %s", tt.path, tt.wantLog, got, logs.String())
+		}
+	}
+	// a full sample logs everything.
+	logs.Reset()
+	tracemw.ServerWithLogConfig(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), logger, tracemw.LogConfig{SampleRate: 1})(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if logs.Len() == 0 {
+		t.Error("expected a log with SampleRate 1")
+	}
+}
+
+func TestExportSpans(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		spans []map[string]any
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct{ Spans []map[string]any }
+			}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range body.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}))
+	defer collector.Close()
+	exporter := trace.NewOTLPExporter(collector.URL+"/v1/traces", "test", nil, time.Hour, func(err error) { t.Error(err) })
+	trace.SetExporter(exporter)
+	defer trace.SetExporter(nil)
+
+	logger := zap.NewNop()
+	srv := httptest.NewServer(tracemw.Server(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(404) }), logger))
+	defer srv.Close()
+	caller := trace.New()
+	req, _ := http.NewRequestWithContext(trace.SaveCtx(context.Background(), caller), "GET", srv.URL+"/missing", nil)
+	resp, err := tracemw.Client(srv.Client(), logger).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want a server and a client span: %v", len(spans), spans)
+	}
+	server, client := spans[0], spans[1] // the server finishes first.
+	if server["kind"] != float64(trace.SpanKindServer) || client["kind"] != float64(trace.SpanKindClient) {
+		t.Fatalf("got kinds %v, %v", server["kind"], client["kind"])
+	}
+	callerSpan := caller.TraceParent()[36:52]
+	if client["parentSpanId"] != callerSpan || server["parentSpanId"] != client["spanId"] || server["traceId"] != client["traceId"] {
+		t.Errorf("want caller %s -> client %s -> server %s, got parents %v and %v", callerSpan, client["spanId"], server["spanId"], client["parentSpanId"], server["parentSpanId"])
+	}
+	// a 404 is the client's problem, not the server's.
+	if status, _ := server["status"].(map[string]any); status["code"] != nil {
+		t.Errorf("server status: got %v, want unset", status)
+	}
+	if status, _ := client["status"].(map[string]any); status["code"] != float64(trace.StatusError) {
+		t.Errorf("client status: got %v, want an error", status)
+	}
+}
+
+func TestParentBasedSampling(t *testing.T) {
+	var logs bytes.Buffer
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewDevelopmentEncoderConfig()), zapcore.AddSync(&logs), zapcore.DebugLevel))
+	h := tracemw.ServerWithLogConfig(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(500)
+		}
+	}), logger, tracemw.LogConfig{SampleRate: 0.5, ParentBased: true})
+	for _, tt := range []struct {
+		path, sampled string
+		wantLogs      int
+	}{
+		{"/", "1", 2},     // begin and end.
+		{"/", "0", 0},     // the caller said no.
+		{"/fail", "0", 1}, // but errors are always logged.
+	} {
+		logs.Reset()
+		req := httptest.NewRequest("GET", tt.path, nil)
+		trace.PopulateHttpHeader(req.Header, trace.New())
+		req.Header.Set(trace.SampledHeader, tt.sampled)
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if got := strings.Count(logs.String(), "\n"); got != tt.wantLogs {
+			t.Errorf("%s, sampled=%s: got %d log lines, want %d: %s", tt.path, tt.sampled, got, tt.wantLogs, logs.String())
+		}
+		if got := rec.Header().Get(trace.SampledHeader); got != tt.sampled {
+			t.Errorf("%s, sampled=%s: response has E-Trace-Sampled %q, want the caller's decision", tt.path, tt.sampled, got)
+		}
+	}
+
+	// the client follows the decision of the trace it's sending, and passes it along.
+	logs.Reset()
+	var gotSampled string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { gotSampled = r.Header.Get(trace.SampledHeader) }))
+	defer srv.Close()
+	tr := trace.New()
+	tr.Sampling = trace.NotSampled
+	req, _ := http.NewRequestWithContext(trace.SaveCtx(context.Background(), tr), "GET", srv.URL, nil)
+	resp, err := tracemw.Client(srv.Client(), logger).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if logs.Len() != 0 || gotSampled != "0" {
+		t.Errorf("unsampled client request: got logs %q and E-Trace-Sampled %q, want no logs and \"0\"", logs.String(), gotSampled)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	var logs bytes.Buffer
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewDevelopmentEncoderConfig()), zapcore.AddSync(&logs), zapcore.DebugLevel))
+	noop := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	req := func() *http.Request {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer hunter2")
+		req.Header.Set("X-Api-Key", "swordfish")
+		req.Header.Set("X-Color", "blue")
+		return req
+	}
+
+	// by default, everything but Authorization.
+	tracemw.Server(noop, logger)(httptest.NewRecorder(), req())
+	if s := logs.String(); strings.Contains(s, "hunter2") || !strings.Contains(s, "swordfish") || !strings.Contains(s, "X-Color: blue") {
+		t.Errorf("default options: got logs %s, want every header but Authorization", s)
+	}
+
+	logs.Reset()
+	opts := tracemw.DefaultOptions()
+	opts.ExcludeHeaders = append(opts.ExcludeHeaders, "x-api-key") // case doesn't matter.
+	tracemw.ServerWithOptions(noop, logger, opts)(httptest.NewRecorder(), req())
+	if s := logs.String(); strings.Contains(s, "hunter2") || strings.Contains(s, "swordfish") || !strings.Contains(s, "X-Color: blue") {
+		t.Errorf("excluding X-Api-Key: got logs %s, want only X-Color", s)
+	}
+
+	logs.Reset()
+	opts.LogHeaders = false
+	tracemw.ServerWithOptions(noop, logger, opts)(httptest.NewRecorder(), req())
+	if s := logs.String(); logs.Len() == 0 || strings.Contains(s, `"headers"`) {
+		t.Errorf("LogHeaders=false: got logs %s, want logs without headers", s)
+	}
+
+	// the client, too.
+	logs.Reset()
+	srv := httptest.NewServer(noop)
+	defer srv.Close()
+	r, _ := http.NewRequest("GET", srv.URL, nil)
+	r.Header = req().Header
+	resp, err := tracemw.ClientWithOptions(srv.Client(), logger, opts).Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if s := logs.String(); logs.Len() == 0 || strings.Contains(s, `"headers"`) {
+		t.Errorf("client, LogHeaders=false: got logs %s, want logs without headers", s)
+	}
+}
+
+func TestServerMetrics(t *testing.T) {
+	opts := tracemw.DefaultOptions()
+	opts.Metrics = metrics.NewRegistry()
+	h := tracemw.ServerWithOptions(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(404)
+		case "/panic":
+			panic("oops")
+		}
+	}), zap.NewNop(), opts)
+	for _, path := range []string{"/", "/", "/missing", "/panic"} {
+		h(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	var b strings.Builder
+	opts.Metrics.WriteTo(&b)
+	for _, want := range []string{
+		`http_server_requests_total{class="2xx"} 2`,
+		`http_server_requests_total{class="4xx"} 1`,
+		`http_server_requests_total{class="5xx"} 1`,
+		`http_server_request_duration_seconds_count 4`,
+	} {
+		if !strings.Contains(b.String(), want+"\n") {
+			t.Errorf("expected %q in metrics:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestWriterPassThrough(t *testing.T) {
+	var logs bytes.Buffer // locked: the websocket handler can still be logging while the next request starts.
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewDevelopmentEncoderConfig()), zapcore.Lock(zapcore.AddSync(&logs)), zapcore.InfoLevel))
+	next := make(chan struct{})
+	var done sync.WaitGroup // the server doesn't wait for hijacked connections, so we have to.
+	done.Add(3)
+	h := tracemw.Server(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/events": // server-sent events: the client should get each one as soon as it's flushed.
+			w.Header().Set("Content-Type", "text/event-stream")
+			if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Second)); err != nil {
+				t.Errorf("SetWriteDeadline: %v", err)
+			}
+			io.WriteString(w, "data: first\n\n")
+			w.(http.Flusher).Flush()
+			<-next
+			io.WriteString(w, "data: second\n\n")
+		case "/socket": // like a websocket: take over the connection and echo a line.
+			conn, rw, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf("Hijack: %v", err)
+				return
+			}
+			defer conn.Close()
+			rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n")
+			rw.Flush()
+			line, _ := rw.ReadString('\n')
+			rw.WriteString(line)
+			rw.Flush()
+		case "/file":
+			w.(io.ReaderFrom).ReadFrom(strings.NewReader("0123456789"))
+		}
+	}), logger)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer done.Done()
+		h(w, r)
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := make([]byte, len("data: first\n\n"))
+	if _, err := io.ReadFull(resp.Body, first); err != nil || string(first) != "data: first\n\n" {
+		t.Fatalf("expected the first event before the handler finished, got %q, %v", first, err)
+	}
+	close(next)
+	rest, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(rest) != "data: second\n\n" {
+		t.Errorf("got %q, want the second event", rest)
+	}
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET /socket HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\nhello\n")
+	br := bufio.NewReader(conn)
+	resp, err = http.ReadResponse(br, nil)
+	if err != nil || resp.StatusCode != 101 {
+		t.Fatalf("expected 101 Switching Protocols, got %v, %v", resp, err)
+	}
+	if line, _ := br.ReadString('\n'); line != "hello\n" {
+		t.Errorf("got echo %q, want \"hello\\n\"", line)
+	}
+
+	resp, err = http.Get(srv.URL + "/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "0123456789" {
+		t.Errorf("got %q from ReadFrom", body)
+	}
+	done.Wait() // for the handlers to finish logging.
+	for _, want := range []string{`"status_code":101`, `"content_length":10`} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("expected %s in logs: %s", want, logs.String())
+		}
+	}
+	if strings.Contains(logs.String(), "end: error") {
+		t.Errorf("expected no errors: %s", logs.String())
+	}
+}
@@ -0,0 +1,114 @@
+package tracemw
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"gitlab.com/efronlicht/blog/observability/metrics"
+	"go.uber.org/zap"
+)
+
+// Options configures Server and Client. Start from DefaultOptions and change what you need:
+//
+//	opts := tracemw.DefaultOptions()
+//	opts.ExcludeHeaders = append(opts.ExcludeHeaders, "Cookie", "X-Api-Key")
+//	h = tracemw.ServerWithOptions(h, logger, opts)
+type Options struct {
+	// Log controls which requests are logged: see LogConfig.
+	Log LogConfig
+	// LogHeaders is whether to log the request's headers at all.
+	LogHeaders bool
+	// ExcludeHeaders are never logged, even if LogHeaders is set: i.e, credentials. Case doesn't matter.
+	ExcludeHeaders []string
+	// BufferSize is the starting capacity, in bytes, of the pooled buffers headers are formatted into.
+	// Buffers that grow past 16 times that aren't reused, so one huge request doesn't pin its memory forever.
+	BufferSize int
+	// Metrics, if non-nil, is where Server records request durations and counts by status class: see serverMetrics.
+	Metrics *metrics.Registry
+}
+
+// DefaultOptions returns the options Server uses: sample everything, log all headers but Authorization, and record metrics to metrics.Default.
+// Client uses the same, but with a ParentBased LogConfig.
+func DefaultOptions() Options {
+	return Options{
+		Log:            LogConfig{SampleRate: 1},
+		LogHeaders:     true,
+		ExcludeHeaders: []string{"Authorization"},
+		BufferSize:     256,
+		Metrics:        metrics.Default,
+	}
+}
+
+// headerLogger formats headers for logging according to an Options.
+type headerLogger struct {
+	enabled bool
+	exclude map[string]bool // canonical keys
+	maxSize int
+	pool    sync.Pool
+}
+
+func newHeaderLogger(opts Options) *headerLogger {
+	if opts.BufferSize <= 0 {
+		panic("tracemw: Options.BufferSize must be > 0")
+	}
+	hl := &headerLogger{enabled: opts.LogHeaders, exclude: make(map[string]bool, len(opts.ExcludeHeaders)), maxSize: 16 * opts.BufferSize}
+	for _, k := range opts.ExcludeHeaders {
+		hl.exclude[http.CanonicalHeaderKey(k)] = true
+	}
+	hl.pool.New = func() any { return bytes.NewBuffer(make([]byte, 0, opts.BufferSize)) }
+	return hl
+}
+
+// field returns h as a zap field, or zap.Skip() if headers aren't logged.
+func (hl *headerLogger) field(h http.Header) zap.Field {
+	if !hl.enabled {
+		return zap.Skip()
+	}
+	buf := hl.pool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if err := h.WriteSubset(buf, hl.exclude); err != nil {
+		panic(err) // can't happen: writes to a bytes.Buffer don't fail.
+	}
+	f := zap.String("headers", buf.String())
+	if buf.Cap() <= hl.maxSize {
+		hl.pool.Put(buf)
+	}
+	return f
+}
+
+// serverMetrics are the metrics Server records for every request, no matter how it's sampled:
+//   - http_server_request_duration_seconds: a histogram of how long requests took.
+//   - http_server_requests_total: a count of requests, by status class: class="2xx", etc.
+type serverMetrics struct {
+	duration *metrics.Histogram
+	classes  [6]*metrics.Counter // by status / 100. 0 is unused.
+}
+
+// newServerMetrics looks up Server's metrics in r, or returns nil if r is nil.
+func newServerMetrics(r *metrics.Registry) *serverMetrics {
+	if r == nil {
+		return nil
+	}
+	m := &serverMetrics{duration: r.Histogram("http_server_request_duration_seconds", "how long http requests took to serve, in seconds", metrics.DefaultBuckets)}
+	for class := 1; class < len(m.classes); class++ {
+		m.classes[class] = r.Counter("http_server_requests_total", "http requests served, by status class", "class", fmt.Sprintf("%dxx", class))
+	}
+	return m
+}
+
+// record a finished request. A nil *serverMetrics records nothing.
+func (m *serverMetrics) record(statusCode int, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.duration.ObserveDuration(elapsed)
+	if statusCode == 0 {
+		statusCode = 200 // the handler never wrote anything: net/http sends a 200.
+	}
+	if class := statusCode / 100; class > 0 && class < len(m.classes) {
+		m.classes[class].Inc()
+	}
+}
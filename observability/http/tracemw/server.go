@@ -1,10 +1,13 @@
 package tracemw
 
 import (
-	"bytes"
+	"bufio"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,10 +18,51 @@ import (
 
 var responseCount sync.Map
 
+// LogConfig controls how much Server and Client log about successful requests, by head-based sampling: see trace.Sampler.
+// A sampled request is logged at Debug when it begins and at Info when it ends; an unsampled one isn't logged at all.
+// Either way, failed requests (status >= 300, an error, or a panic) are always logged at Error, no matter what.
+// The decision travels with the trace, in the E-Trace-Sampled header and the traceparent's sampled flag.
+type LogConfig struct {
+	// SampleRate is the fraction of traces to sample, in [0, 1].
+	// Traces are chosen by trace ID, so every service sampling at the same rate logs the same traces.
+	SampleRate float64
+	// ParentBased keeps the sampling decision a trace arrives with, if it has one, rather than deciding by SampleRate.
+	ParentBased bool
+	// QuietPaths are logged at Debug rather than Info on success, even if sampled: i.e, health checks. A path ending in "/" matches everything under it.
+	QuietPaths []string
+}
+
+func (cfg LogConfig) sampler() trace.Sampler {
+	return trace.Sampler{Rate: cfg.SampleRate, ParentBased: cfg.ParentBased}
+}
+
+// quiet reports whether a successful request for path should be logged at Debug rather than Info.
+func (cfg LogConfig) quiet(path string) bool {
+	for _, p := range cfg.QuietPaths {
+		if path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			return true
+		}
+	}
+	return false
+}
+
 // HttpServerTraceMiddleware retrieves a trace from the http headers, adds a new RequestID to the chain, and adds the trace to the request's context before calling the original handler h.
 // A missing or invalid trace will generate a new trace instead.
-// logError is an optional parameter for when FromHttpHeader returns an error; if nil, it's a no-op.
+// It logs every request, ignoring the caller's sampling decision: see ServerWithLogConfig to log fewer.
 func Server(h http.Handler, logger *zap.Logger) http.HandlerFunc {
+	return ServerWithLogConfig(h, logger, LogConfig{SampleRate: 1})
+}
+
+// ServerWithLogConfig is Server, logging successful requests according to cfg.
+func ServerWithLogConfig(h http.Handler, logger *zap.Logger, cfg LogConfig) http.HandlerFunc {
+	opts := DefaultOptions()
+	opts.Log = cfg
+	return ServerWithOptions(h, logger, opts)
+}
+
+// ServerWithOptions is Server, configured by opts.
+func ServerWithOptions(h http.Handler, logger *zap.Logger, opts Options) http.HandlerFunc {
+	cfg, headers, stats := opts.Log, newHeaderLogger(opts), newServerMetrics(opts.Metrics)
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		t, err := trace.FromHttpHeader(r.Header)
@@ -26,23 +70,18 @@ func Server(h http.Handler, logger *zap.Logger) http.HandlerFunc {
 			t.TraceID = uuid.New()
 		}
 		logger := logger.With(zap.String("method", r.Method), zap.String("path", r.URL.Path))
-		t.RequestIDs = append(t.RequestIDs, uuid.New())
+		t = cfg.sampler().Sample(t.AddHop())
 		trace.PopulateHttpHeader(w.Header(), t)
 		prefix := fmt.Sprintf("server: %s %s: ", r.Method, r.URL.Path)
-		{ // log request
-			buf := bufpool.Get().(*bytes.Buffer)
-			buf.Reset()
-			if err := r.Header.WriteSubset(buf, excludeHeaders); err != nil {
-				panic(err)
-			}
+		if t.Sampling == trace.Sampled { // log request
 			logger.Debug(prefix+"begin",
 				zap.String("user-agent", r.UserAgent()),
 				zap.Stringer("trace_id", t.TraceID),
 				zap.Stringers("request_id", t.RequestIDs),
+				zap.Duration("trace_elapsed", t.Elapsed[len(t.Elapsed)-1]), // how long the trace had been going when it got to us.
 				zap.String("remote_addr", r.RemoteAddr),
-				zap.Stringer("headers", buf),
+				headers.field(r.Header),
 			)
-			bufpool.Put(buf)
 		}
 
 		lw := &writer{ResponseWriter: w}
@@ -50,25 +89,62 @@ func Server(h http.Handler, logger *zap.Logger) http.HandlerFunc {
 			elapsed := time.Since(start)
 			if p := recover(); p != nil {
 				lw.WriteHeader(500)
+				stats.record(lw.statusCode, elapsed)
+				exportServerSpan(r, t, start, lw.statusCode, fmt.Sprintf("panic: %v", p))
 				logger.Error(prefix+"end: panic", zap.Any("panic", p), zap.ByteString("stack", debug.Stack()), zap.Int("status_code", lw.statusCode), zap.Int("content_length", lw.contentLength))
 				return
 			}
-			buf := bufpool.Get().(*bytes.Buffer)
-			buf.Reset()
-			if err := r.Header.WriteSubset(buf, excludeHeaders); err != nil {
-				panic(err)
-			}
+			stats.record(lw.statusCode, elapsed)
+			exportServerSpan(r, t, start, lw.statusCode, "")
 			if lw.statusCode >= 300 {
-				logger.Error(prefix+"end: error", zap.Int("status_code", lw.statusCode), zap.Duration("elapsed", elapsed), zap.Stringer("headers", buf))
+				logger.Error(prefix+"end: error", zap.Int("status_code", lw.statusCode), zap.Duration("elapsed", elapsed), headers.field(r.Header))
 				return
 			}
-			logger.Info(prefix+"end: ok", zap.Int("status_code", lw.statusCode), zap.Int("content_length", lw.contentLength), zap.Duration("elapsed", elapsed), zap.Stringer("headers", buf))
+			if t.Sampling != trace.Sampled {
+				return
+			}
+			level := zap.InfoLevel
+			if cfg.quiet(r.URL.Path) {
+				level = zap.DebugLevel
+			}
+			logger.Log(level, prefix+"end: ok", zap.Int("status_code", lw.statusCode), zap.Int("content_length", lw.contentLength), zap.Duration("elapsed", elapsed), headers.field(r.Header))
 		}()
 		h.ServeHTTP(lw, r.WithContext(trace.SaveCtx(r.Context(), t)))
 	}
 }
 
-// loggingWriter sniffs calls to WriteHeader() and Write(), recording the status code and the total number of bytes written to the response body.
+// exportServerSpan sends the span for a request to the OTLP exporter, if there is one: see trace.Exporter.
+// Following OpenTelemetry's conventions, only a 5xx is an error on the server's side: a 4xx is the client's fault.
+func exportServerSpan(r *http.Request, t trace.Trace, start time.Time, statusCode int, panicMsg string) {
+	e := trace.Exporter()
+	if e == nil || t.Sampling == trace.NotSampled {
+		return
+	}
+	if statusCode == 0 {
+		statusCode = 200 // the handler never wrote anything: net/http sends a 200.
+	}
+	span := trace.Span{
+		Trace: t, Name: r.Method + " " + r.URL.Path, Kind: trace.SpanKindServer, Start: start, End: time.Now(),
+		Attributes: map[string]any{
+			"http.request.method":       r.Method,
+			"url.path":                  r.URL.Path,
+			"http.response.status_code": statusCode,
+			"user_agent.original":       r.UserAgent(),
+			"client.address":            r.RemoteAddr,
+		},
+	}
+	switch {
+	case panicMsg != "":
+		span.StatusCode, span.StatusMessage = trace.StatusError, panicMsg
+	case statusCode >= 500:
+		span.StatusCode, span.StatusMessage = trace.StatusError, http.StatusText(statusCode)
+	}
+	e.Export(span)
+}
+
+// writer sniffs calls to WriteHeader(), Write(), and ReadFrom(), recording the status code and the total number of bytes written to the response body.
+// It passes through http.Flusher, http.Hijacker, and io.ReaderFrom, and unwraps for http.ResponseController,
+// so streaming (server-sent events) and websocket handlers work behind the middleware.
 type writer struct {
 	http.ResponseWriter
 	statusCode, contentLength int
@@ -89,3 +165,35 @@ func (w *writer) WriteHeader(statusCode int) {
 	}
 	w.ResponseWriter.WriteHeader(statusCode)
 }
+
+// ReadFrom copies from src, using the underlying writer's ReadFrom if it has one: net/http's can sendfile() straight from an *os.File.
+func (w *writer) ReadFrom(src io.Reader) (int64, error) {
+	if w.statusCode < 200 {
+		w.WriteHeader(200)
+	}
+	n, err := io.Copy(w.ResponseWriter, src) // not w: that would call us again.
+	w.contentLength += int(n)
+	return n, err
+}
+
+// Flush sends any buffered data to the client. It does nothing if the underlying writer can't flush.
+func (w *writer) Flush() {
+	if w.statusCode < 200 {
+		w.statusCode = 200 // flushing sends the header.
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack takes over the connection, i.e, for a websocket: see http.Hijacker.
+// A hijacked request is logged as a 101 Switching Protocols, unless the handler already wrote a status,
+// and its content length only counts what was written before the hijack.
+func (w *writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil && w.statusCode < 200 {
+		w.statusCode = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying response writer, for http.ResponseController: i.e, SetWriteDeadline.
+func (w *writer) Unwrap() http.ResponseWriter { return w.ResponseWriter }
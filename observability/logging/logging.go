@@ -0,0 +1,97 @@
+// package logging is one logging contract for the whole repo.
+// tracemw and friends want a *zap.Logger, the articles' middleware wants a *slog.Logger, and older code uses a *log.Logger:
+// Logger adapts any of them, and ToZap and ToSlog turn any Logger back into what a given middleware wants.
+//
+//	logger := logging.Slog(slog.Default())
+//	h = tracemw.Server(h, logging.ToZap(logger)) // tracemw logs through slog.
+//
+// Fields are key-value pairs, as in slog: log.Log(logging.Info, "served", "path", r.URL.Path, "status", 200).
+package logging
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// Level is a log level. It's slog's, since that's in the standard library: see ToZap and Zap for how it maps to zap's.
+type Level = slog.Level
+
+const (
+	Debug = slog.LevelDebug
+	Info  = slog.LevelInfo
+	Warn  = slog.LevelWarn
+	Error = slog.LevelError
+)
+
+// Logger is a structured logger.
+type Logger interface {
+	// Enabled reports whether the logger logs at level: callers can skip expensive work if not.
+	Enabled(level Level) bool
+	// Log logs msg at level with key-value pairs kv. Keys should be strings.
+	Log(level Level, msg string, kv ...any)
+	// With returns a logger that adds kv to everything it logs.
+	With(kv ...any) Logger
+}
+
+// badKey is the key for a value without one, as in slog.
+const badKey = "!BADKEY"
+
+// pairs visits the key-value pairs in kv. A value missing its key gets badKey, as in slog.
+func pairs(kv []any, f func(k string, v any)) {
+	for i := 0; i < len(kv); i++ {
+		if k, ok := kv[i].(string); ok && i+1 < len(kv) {
+			f(k, kv[i+1])
+			i++
+			continue
+		}
+		f(badKey, kv[i])
+	}
+}
+
+// Std adapts a stdlib *log.Logger, logging messages at min or above as "LEVEL msg key=value ...".
+// Values are quoted if they need it, as in slog's text handler.
+func Std(l *log.Logger, min Level) Logger { return &stdLogger{l: l, min: min} }
+
+type stdLogger struct {
+	l      *log.Logger
+	min    Level
+	prefix string // from With, already formatted.
+}
+
+func (s *stdLogger) Enabled(level Level) bool { return level >= s.min }
+
+func (s *stdLogger) Log(level Level, msg string, kv ...any) {
+	if !s.Enabled(level) {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	b.WriteString(s.prefix)
+	appendText(&b, kv)
+	s.l.Output(2, b.String())
+}
+
+func (s *stdLogger) With(kv ...any) Logger {
+	var b strings.Builder
+	appendText(&b, kv)
+	return &stdLogger{l: s.l, min: s.min, prefix: s.prefix + b.String()}
+}
+
+// appendText appends " key=value" for each pair in kv.
+func appendText(b *strings.Builder, kv []any) {
+	pairs(kv, func(k string, v any) {
+		b.WriteByte(' ')
+		b.WriteString(k)
+		b.WriteByte('=')
+		s := fmt.Sprint(v)
+		if s == "" || strings.ContainsAny(s, " \t\n\"=") || !strconv.CanBackquote(s) {
+			s = strconv.Quote(s)
+		}
+		b.WriteString(s)
+	})
+}
@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"bytes"
+	"log"
+	"log/slog"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestStd(t *testing.T) {
+	var buf bytes.Buffer
+	l := Std(log.New(&buf, "", 0), Info).With("service", "blog")
+	l.Log(Debug, "hidden")
+	l.Log(Info, "served", "path", "/index.html", "status", 200, "agent", `curl "8.0"`, "odd")
+	const want = `INFO served service=blog path=/index.html status=200 agent="curl \"8.0\"" !BADKEY=odd` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestToZap(t *testing.T) {
+	var buf bytes.Buffer
+	z := ToZap(Std(log.New(&buf, "", 0), Info)).Named("server")
+	z.Debug("hidden")
+	z.With(zap.Namespace("req")).Info("done", zap.String("path", "/"), zap.Int("status", 200), zap.Duration("elapsed", time.Second), zap.Skip())
+	const want = "INFO server: done req.path=/ req.status=200 req.elapsed=1s\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestToSlog(t *testing.T) {
+	var buf bytes.Buffer
+	s := ToSlog(Std(log.New(&buf, "", 0), Info)).With("service", "blog").WithGroup("req")
+	s.Debug("hidden")
+	s.Warn("slow", "path", "/search", slog.Group("client", "ip", "127.0.0.1"))
+	const want = "WARN slow service=blog req.path=/search req.client.ip=127.0.0.1\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAdapters(t *testing.T) {
+	var buf bytes.Buffer
+	z := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zapcore.EncoderConfig{MessageKey: "msg", LevelKey: "level", EncodeLevel: zapcore.LowercaseLevelEncoder}), zapcore.AddSync(&buf), zapcore.InfoLevel))
+	l := Zap(z)
+	if l.Enabled(Debug) || !l.Enabled(Warn) {
+		t.Error("zap: expected Info and up to be enabled, and nothing else")
+	}
+	l.With("service", "blog").Log(Warn, "slow", "ms", 1200)
+	if got, want := buf.String(), `{"level":"warn","msg":"slow","service":"blog","ms":1200}`+"\n"; got != want {
+		t.Errorf("zap: got %q, want %q", got, want)
+	}
+	if ToZap(l) != z {
+		t.Error("ToZap(Zap(z)) should be z")
+	}
+
+	buf.Reset()
+	s := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+		if a.Key == slog.TimeKey {
+			return slog.Attr{}
+		}
+		return a
+	}}))
+	Slog(s).Log(Error, "failed", "err", "boom")
+	if got, want := buf.String(), "level=ERROR msg=failed err=boom\n"; got != want {
+		t.Errorf("slog: got %q, want %q", got, want)
+	}
+	if ToSlog(Slog(s)) != s {
+		t.Error("ToSlog(Slog(s)) should be s")
+	}
+}
@@ -0,0 +1,78 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Slog adapts a *slog.Logger.
+func Slog(l *slog.Logger) Logger { return slogLogger{l} }
+
+type slogLogger struct{ l *slog.Logger }
+
+func (s slogLogger) Enabled(level Level) bool { return s.l.Enabled(context.Background(), level) }
+func (s slogLogger) Log(level Level, msg string, kv ...any) {
+	s.l.Log(context.Background(), level, msg, kv...)
+}
+func (s slogLogger) With(kv ...any) Logger { return slogLogger{s.l.With(kv...)} }
+
+// ToSlog returns a *slog.Logger that logs to l: for middleware that wants one, like the articles'.
+// Groups are flattened into dotted keys: slog.Group("req", "path", "/") is logged as "req.path", "/".
+// If l came from Slog, you get its *slog.Logger back.
+func ToSlog(l Logger) *slog.Logger {
+	if s, ok := l.(slogLogger); ok {
+		return s.l
+	}
+	return slog.New(&slogHandler{l: l})
+}
+
+// slogHandler is a slog.Handler that logs to a Logger.
+type slogHandler struct {
+	l      Logger
+	prefix string // the open groups, as "a.b.", from WithGroup.
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool { return h.l.Enabled(level) }
+
+func (h *slogHandler) Handle(_ context.Context, r slog.Record) error {
+	kv := make([]any, 0, 2*r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		kv = appendAttr(kv, h.prefix, a)
+		return true
+	})
+	h.l.Log(r.Level, r.Message, kv...)
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var kv []any
+	for _, a := range attrs {
+		kv = appendAttr(kv, h.prefix, a)
+	}
+	return &slogHandler{l: h.l.With(kv...), prefix: h.prefix}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &slogHandler{l: h.l, prefix: h.prefix + name + "."}
+}
+
+// appendAttr appends a as key-value pairs to kv, flattening groups into dotted keys.
+func appendAttr(kv []any, prefix string, a slog.Attr) []any {
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() != slog.KindGroup {
+		if a.Equal(slog.Attr{}) {
+			return kv // slog says to ignore empty attrs.
+		}
+		return append(kv, prefix+a.Key, a.Value.Any())
+	}
+	if a.Key != "" { // an unnamed group's attrs are inlined.
+		prefix += a.Key + "."
+	}
+	for _, a := range a.Value.Group() {
+		kv = appendAttr(kv, prefix, a)
+	}
+	return kv
+}
@@ -0,0 +1,118 @@
+package logging
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Zap adapts a *zap.Logger. Levels below Info are zap's Debug; Error and above are its Error.
+func Zap(l *zap.Logger) Logger { return zapLogger{l} }
+
+type zapLogger struct{ l *zap.Logger }
+
+func (z zapLogger) Enabled(level Level) bool { return z.l.Core().Enabled(toZapLevel(level)) }
+
+func (z zapLogger) Log(level Level, msg string, kv ...any) {
+	if ce := z.l.WithOptions(zap.AddCallerSkip(1)).Check(toZapLevel(level), msg); ce != nil {
+		ce.Write(zapFields(kv)...)
+	}
+}
+
+func (z zapLogger) With(kv ...any) Logger { return zapLogger{z.l.With(zapFields(kv)...)} }
+
+func zapFields(kv []any) []zap.Field {
+	fields := make([]zap.Field, 0, len(kv)/2)
+	pairs(kv, func(k string, v any) { fields = append(fields, zap.Any(k, v)) })
+	return fields
+}
+
+func toZapLevel(level Level) zapcore.Level {
+	switch {
+	case level < Info:
+		return zapcore.DebugLevel
+	case level < Warn:
+		return zapcore.InfoLevel
+	case level < Error:
+		return zapcore.WarnLevel
+	default:
+		return zapcore.ErrorLevel
+	}
+}
+
+func fromZapLevel(level zapcore.Level) Level {
+	switch {
+	case level < zapcore.InfoLevel:
+		return Debug
+	case level == zapcore.InfoLevel:
+		return Info
+	case level == zapcore.WarnLevel:
+		return Warn
+	default: // Error, DPanic, Panic, Fatal: zap itself handles the panicking and exiting.
+		return Error
+	}
+}
+
+// ToZap returns a *zap.Logger that logs to l: for middleware that wants one, like tracemw.
+// Each field is logged as its key and the value zap would encode: i.e, a zap.Duration's value is a time.Duration.
+// If l came from Zap, you get its *zap.Logger back.
+func ToZap(l Logger) *zap.Logger {
+	if z, ok := l.(zapLogger); ok {
+		return z.l
+	}
+	return zap.New(zapCore{l: l})
+}
+
+// zapCore is a zapcore.Core that logs to a Logger.
+type zapCore struct {
+	l      Logger
+	prefix string // the open namespaces, as "a.b.", from With.
+}
+
+func (c zapCore) Enabled(level zapcore.Level) bool { return c.l.Enabled(fromZapLevel(level)) }
+
+func (c zapCore) With(fields []zapcore.Field) zapcore.Core {
+	kv, prefix := zapKV(c.prefix, fields)
+	return zapCore{l: c.l.With(kv...), prefix: prefix}
+}
+
+func (c zapCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(e.Level) {
+		return ce.AddCore(e, c)
+	}
+	return ce
+}
+
+func (c zapCore) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	msg := e.Message
+	if e.LoggerName != "" {
+		msg = e.LoggerName + ": " + msg
+	}
+	kv, _ := zapKV(c.prefix, fields)
+	c.l.Log(fromZapLevel(e.Level), msg, kv...)
+	return nil
+}
+
+func (c zapCore) Sync() error { return nil }
+
+// zapKV turns zap fields into key-value pairs, in order.
+// Namespaces are flattened into dotted keys: zap.Namespace("req") then zap.String("path", "/") is "req.path", "/".
+// It returns the prefix for fields after these, which is longer if they opened a namespace.
+func zapKV(prefix string, fields []zapcore.Field) ([]any, string) {
+	enc := zapcore.NewMapObjectEncoder()
+	kv := make([]any, 0, 2*len(fields))
+	for _, f := range fields {
+		switch f.Type {
+		case zapcore.SkipType:
+			continue
+		case zapcore.NamespaceType:
+			prefix += f.Key + "."
+			continue
+		}
+		f.AddTo(enc)
+		for k, v := range enc.Fields { // just the one.
+			kv = append(kv, prefix+k, v)
+			delete(enc.Fields, k)
+		}
+	}
+	return kv, prefix
+}
@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"syscall"
 )
 
 func OpenFileHandles() (int, error) {
@@ -35,3 +36,12 @@ func MemInfo() (
 	}
 	return mi, nil
 }
+
+// DiskFree returns the number of bytes available to unprivileged users on the filesystem containing path.
+func DiskFree(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return st.Bavail * uint64(st.Bsize), nil
+}
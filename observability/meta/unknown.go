@@ -2,7 +2,10 @@
 
 package meta
 
-import "regexp"
+import (
+	"errors"
+	"regexp"
+)
 
 func OpenFileHandles() (int, error) {
 	return 0, nil
@@ -18,3 +21,6 @@ func MemInfo() (
 ) {
 	return mi, nil
 }
+
+// DiskFree always returns errors.ErrUnsupported.
+func DiskFree(path string) (uint64, error) { return 0, errors.ErrUnsupported }
@@ -0,0 +1,272 @@
+// package metrics contains counters, gauges, and histograms, served in the Prometheus text exposition format.
+// Basic usage:
+//
+//	requests := metrics.Default.Counter("jobs_total", "jobs run, by result", "result", "ok")
+//	latency := metrics.Default.Histogram("job_duration_seconds", "how long jobs take", metrics.DefaultBuckets)
+//	start := time.Now()
+//	// ... run the job
+//	requests.Inc()
+//	latency.ObserveDuration(time.Since(start))
+//	// and elsewhere:
+//	mux.Handle("/debug/metrics", metrics.Default)
+//
+// Updating a metric is a few atomic operations and never allocates, so it's fine to do on every request.
+// Look metrics up once, outside the hot path: Counter, Gauge, and Histogram take a lock.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Counter is a count that only goes up: i.e, requests served.
+type Counter struct{ n atomic.Uint64 }
+
+func (c *Counter) Inc()          { c.n.Add(1) }
+func (c *Counter) Add(n uint64)  { c.n.Add(n) }
+func (c *Counter) Value() uint64 { return c.n.Load() }
+
+// Gauge is a value that goes up and down: i.e, open connections.
+type Gauge struct{ f atomicFloat }
+
+func (g *Gauge) Set(v float64)  { g.f.store(v) }
+func (g *Gauge) Add(v float64)  { g.f.add(v) }
+func (g *Gauge) Value() float64 { return g.f.load() }
+
+// Histogram counts observations into buckets by their upper bounds: i.e, request durations.
+type Histogram struct {
+	bounds []float64       // sorted upper bounds. the last bucket, +Inf, is implicit.
+	counts []atomic.Uint64 // len(bounds)+1. NOT cumulative: each observation goes in exactly one bucket.
+	sum    atomicFloat
+}
+
+// DefaultBuckets are Prometheus's default buckets, in seconds: good for request durations from 5ms to 10s.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Observe records v in the first bucket whose upper bound is >= v.
+func (h *Histogram) Observe(v float64) {
+	h.counts[sort.SearchFloat64s(h.bounds, v)].Add(1)
+	h.sum.add(v)
+}
+
+// ObserveDuration records d in seconds, the base unit Prometheus expects.
+func (h *Histogram) ObserveDuration(d time.Duration) { h.Observe(d.Seconds()) }
+
+// atomicFloat is a float64 stored as its bits.
+type atomicFloat struct{ bits atomic.Uint64 }
+
+func (f *atomicFloat) load() float64   { return math.Float64frombits(f.bits.Load()) }
+func (f *atomicFloat) store(v float64) { f.bits.Store(math.Float64bits(v)) }
+func (f *atomicFloat) add(v float64) {
+	for {
+		old := f.bits.Load()
+		if f.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// Registry holds a set of metrics and serves them in the Prometheus text format: see https://prometheus.io/docs/instrumenting/exposition_formats/
+// The zero Registry is not ready to use: call NewRegistry.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+// Default is the registry middleware in this repo records to, unless told otherwise.
+var Default = NewRegistry()
+
+func NewRegistry() *Registry { return &Registry{families: make(map[string]*family)} }
+
+// family is every metric with the same name, distinguished by their labels.
+type family struct {
+	name, help, typ string
+	buckets         []float64      // histograms only.
+	metrics         map[string]any // by formatted labels, i.e, `method="GET",class="2xx"`: *Counter, *Gauge, or *Histogram.
+}
+
+// Counter returns the counter with this name and labels, creating it if it doesn't exist.
+// labels are key-value pairs: i.e, r.Counter("http_requests_total", "requests served", "class", "2xx").
+// It panics if the name's already used by a different kind of metric, or if the name or labels are invalid.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	return r.get(name, help, "counter", nil, labels, func() any { return new(Counter) }).(*Counter)
+}
+
+// Gauge returns the gauge with this name and labels, creating it if it doesn't exist. See Counter.
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	return r.get(name, help, "gauge", nil, labels, func() any { return new(Gauge) }).(*Gauge)
+}
+
+// Histogram returns the histogram with this name and labels, creating it if it doesn't exist. See Counter.
+// buckets are upper bounds: they're sorted for you, and +Inf is implied.
+// Every histogram with the same name needs the same buckets, or it panics.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	buckets = slices.Clone(buckets)
+	sort.Float64s(buckets)
+	if len(buckets) > 0 && math.IsInf(buckets[len(buckets)-1], +1) {
+		buckets = buckets[:len(buckets)-1] // it's implied.
+	}
+	return r.get(name, help, "histogram", buckets, labels, func() any {
+		return &Histogram{bounds: buckets, counts: make([]atomic.Uint64, len(buckets)+1)}
+	}).(*Histogram)
+}
+
+func (r *Registry) get(name, help, typ string, buckets []float64, labels []string, create func() any) any {
+	// validate arguments OUTSIDE of the lock.
+	if !validName(name, true) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", name))
+	}
+	key := formatLabels(labels)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.families[name]
+	switch {
+	case f == nil:
+		f = &family{name: name, help: help, typ: typ, buckets: buckets, metrics: make(map[string]any)}
+		r.families[name] = f
+	case f.typ != typ:
+		panic(fmt.Sprintf("metrics: %s is a %s, not a %s", name, f.typ, typ))
+	case typ == "histogram" && !slices.Equal(f.buckets, buckets):
+		panic(fmt.Sprintf("metrics: histogram %s already has buckets %v, not %v", name, f.buckets, buckets))
+	}
+	m, ok := f.metrics[key]
+	if !ok {
+		m = create()
+		f.metrics[key] = m
+	}
+	return m
+}
+
+// validName reports whether s is a valid metric name, or, if !metric, a valid label name.
+func validName(s string, metric bool) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c == '_', 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case c == ':' && metric:
+		case '0' <= c && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+// formatLabels formats key-value pairs as they go between the braces: i.e, `method="GET",class="2xx"`.
+func formatLabels(labels []string) string {
+	if len(labels)%2 != 0 {
+		panic(fmt.Sprintf("metrics: labels must be key-value pairs, but got an odd number: %q", labels))
+	}
+	var b strings.Builder
+	for i := 0; i < len(labels); i += 2 {
+		if !validName(labels[i], false) || strings.HasPrefix(labels[i], "__") || labels[i] == "le" {
+			panic(fmt.Sprintf("metrics: invalid label name %q", labels[i]))
+		}
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1]))
+	}
+	return b.String()
+}
+
+// WriteTo writes every metric in the Prometheus text format, sorted by name and then labels, so the output is stable.
+// Each histogram is read bucket by bucket while it may still be changing, so its sum can be a few observations off from its count.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	// snapshot the families and metrics, so we don't hold the lock while formatting.
+	type sample struct {
+		labels string
+		metric any
+	}
+	type snapshot struct {
+		*family
+		samples []sample
+	}
+	r.mu.Lock()
+	families := make([]snapshot, 0, len(r.families))
+	for _, f := range r.families {
+		s := snapshot{family: f, samples: make([]sample, 0, len(f.metrics))}
+		for k, m := range f.metrics {
+			s.samples = append(s.samples, sample{k, m})
+		}
+		sort.Slice(s.samples, func(i, j int) bool { return s.samples[i].labels < s.samples[j].labels })
+		families = append(families, s)
+	}
+	r.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	var b []byte
+	for _, f := range families {
+		b = fmt.Appendf(b, "# HELP %s %s\n# TYPE %s %s\n", f.name, helpEscaper.Replace(f.help), f.name, f.typ)
+		for _, s := range f.samples {
+			switch m := s.metric.(type) {
+			case *Counter:
+				b = appendSample(b, f.name, "", s.labels, "", float64(m.Value()))
+			case *Gauge:
+				b = appendSample(b, f.name, "", s.labels, "", m.Value())
+			case *Histogram:
+				var total uint64
+				for i := range m.counts {
+					total += m.counts[i].Load()
+					le := "+Inf"
+					if i < len(m.bounds) {
+						le = strconv.FormatFloat(m.bounds[i], 'g', -1, 64)
+					}
+					b = appendSample(b, f.name, "_bucket", s.labels, `le="`+le+`"`, float64(total))
+				}
+				b = appendSample(b, f.name, "_sum", s.labels, "", m.sum.load())
+				b = appendSample(b, f.name, "_count", s.labels, "", float64(total))
+			}
+		}
+	}
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// appendSample appends one line: name+suffix{labels,extra} value.
+func appendSample(b []byte, name, suffix, labels, extra string, v float64) []byte {
+	b = append(b, name...)
+	b = append(b, suffix...)
+	if labels != "" || extra != "" {
+		b = append(b, '{')
+		b = append(b, labels...)
+		if labels != "" && extra != "" {
+			b = append(b, ',')
+		}
+		b = append(b, extra...)
+		b = append(b, '}')
+	}
+	b = append(b, ' ')
+	switch {
+	case math.IsInf(v, +1):
+		b = append(b, "+Inf"...)
+	case math.IsInf(v, -1):
+		b = append(b, "-Inf"...)
+	default:
+		b = strconv.AppendFloat(b, v, 'g', -1, 64)
+	}
+	return append(b, '\n')
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format, for Prometheus (or a person with curl) to scrape.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = r.WriteTo(w)
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("requests_total", "requests served, by class", "class", "2xx").Add(3)
+	r.Counter("requests_total", "requests served, by class", "class", "5xx").Inc()
+	r.Counter("requests_total", "requests served, by class", "class", "2xx").Inc() // same counter.
+	g := r.Gauge("temperature", `a "gauge"`+"\nwith a newline", "room", `the "big" one`)
+	g.Set(20)
+	g.Add(-1.5)
+	h := r.Histogram("duration_seconds", "how long", []float64{1, 0.1, 0.5}) // sorted for us.
+	for _, v := range []float64{0.0625, 0.1, 0.25, 2} { // bounds are inclusive: 0.1 goes in the 0.1 bucket.
+		h.Observe(v)
+	}
+	h.ObserveDuration(750 * time.Millisecond)
+
+	const want = `# HELP duration_seconds how long
+# TYPE duration_seconds histogram
+duration_seconds_bucket{le="0.1"} 2
+duration_seconds_bucket{le="0.5"} 3
+duration_seconds_bucket{le="1"} 4
+duration_seconds_bucket{le="+Inf"} 5
+duration_seconds_sum 3.1625
+duration_seconds_count 5
+# HELP requests_total requests served, by class
+# TYPE requests_total counter
+requests_total{class="2xx"} 4
+requests_total{class="5xx"} 1
+# HELP temperature a "gauge"\nwith a newline
+# TYPE temperature gauge
+temperature{room="the \"big\" one"} 18.5
+`
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/metrics", nil))
+	if got := rec.Body.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("got Content-Type %q", ct)
+	}
+}
+
+func TestRegistryPanics(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("x", "")
+	r.Histogram("h", "", DefaultBuckets)
+	for name, f := range map[string]func(){
+		"wrong type":       func() { r.Gauge("x", "") },
+		"different bucket": func() { r.Histogram("h", "", []float64{1, 2}) },
+		"bad name":         func() { r.Counter("9lives", "") },
+		"bad label":        func() { r.Counter("y", "", "a-b", "c") },
+		"odd labels":       func() { r.Counter("y", "", "a") },
+		"reserved label":   func() { r.Counter("y", "", "le", "1") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected a panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestNoAllocs(t *testing.T) {
+	r := NewRegistry()
+	c, g, h := r.Counter("c", ""), r.Gauge("g", ""), r.Histogram("h", "", DefaultBuckets)
+	if n := testing.AllocsPerRun(100, func() {
+		c.Inc()
+		g.Add(1)
+		h.ObserveDuration(30 * time.Millisecond)
+	}); n != 0 {
+		t.Errorf("got %v allocations per update, want 0", n)
+	}
+}
+
+func BenchmarkHistogramObserve(b *testing.B) {
+	h := NewRegistry().Histogram("h", "", DefaultBuckets)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			h.Observe(0.042)
+		}
+	})
+}
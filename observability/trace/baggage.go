@@ -0,0 +1,87 @@
+package trace
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// BaggageHeader is the W3C baggage header: see https://www.w3.org/TR/baggage/
+const BaggageHeader = "Baggage"
+
+// Baggage is a small set of key-value pairs that travels with a trace from service to service, like a request's user ID,
+// so services further down the line can log it without every API in between having to pass it along.
+// It's sent on every request: keep it small, and don't put anything secret in it.
+type Baggage map[string]string
+
+// limits on baggage, from https://www.w3.org/TR/baggage/#limits: members past either limit are dropped.
+const (
+	maxBaggageMembers = 64
+	maxBaggageBytes   = 8192
+)
+
+// isToken reports whether s is a valid baggage key: an HTTP token, as in RFC 7230, section 3.2.6.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`"(),/:;<=>?@[\]{}`, c) != -1 {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseBaggage parses a W3C baggage header, i.e, "userId=alice,tenant=acme%20corp;prop=ignored".
+// It's lenient, since baggage is best-effort: malformed members are skipped, properties are ignored,
+// and members past the size limits are dropped.
+func ParseBaggage(s string) Baggage {
+	var b Baggage
+	size := 0
+	for _, member := range strings.Split(s, ",") {
+		member, _, _ = strings.Cut(member, ";") // drop the properties.
+		k, v, ok := strings.Cut(member, "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || !isToken(k) {
+			continue
+		}
+		v, err := url.PathUnescape(v)
+		if err != nil {
+			continue
+		}
+		if size += len(member) + 1; len(b) == maxBaggageMembers || size > maxBaggageBytes {
+			break
+		}
+		if b == nil {
+			b = make(Baggage)
+		}
+		b[k] = v
+	}
+	return b
+}
+
+// String formats b as a W3C baggage header, sorted by key, with values percent-encoded.
+// Members with invalid keys are skipped; so are members past the size limits.
+func (b Baggage) String() string {
+	keys := make([]string, 0, len(b))
+	for k := range b {
+		if isToken(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	for i, k := range keys {
+		member := k + "=" + url.PathEscape(b[k])
+		if i == maxBaggageMembers || sb.Len()+len(member)+1 > maxBaggageBytes {
+			break
+		}
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(member)
+	}
+	return sb.String()
+}
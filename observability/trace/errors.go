@@ -0,0 +1,63 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+
+	"github.com/google/uuid"
+)
+
+// Error is an error annotated with the trace it happened in and where it was made, so it can be matched up with the request's logs
+// no matter how far it travels before someone logs it. Make one with Errorf; get it back out with errors.As:
+//
+//	var te *trace.Error
+//	if errors.As(err, &te) {
+//		logger.Error("failed", zap.Error(err), zap.Stringer("trace_id", te.TraceID))
+//	}
+type Error struct {
+	TraceID   uuid.UUID // zero if there was no trace in the context.
+	RequestID uuid.UUID // the newest request in the trace.
+	Caller    string    // where Errorf was called, as "file.go:123 (pkg.Func)".
+	err       error     // from fmt.Errorf, so %w works as usual.
+}
+
+// Errorf is fmt.Errorf, annotating the error with the trace in ctx, if any, and the caller's position.
+// %w wraps as usual: errors.Is and errors.As see through an *Error to whatever it wraps.
+//
+// The trace is added to the message, i.e, "get user 12: not found (trace_id=... request_id=... at users.go:40 (main.getUser))",
+// unless a wrapped error already said it: wrapping the same trace's errors again just adds the new message.
+func Errorf(ctx context.Context, format string, args ...any) error {
+	e := &Error{err: fmt.Errorf(format, args...)}
+	if t, ok := ctx.Value(ctxKey{}).(Trace); ok {
+		e.TraceID = t.TraceID
+		if len(t.RequestIDs) > 0 {
+			e.RequestID = t.RequestIDs[len(t.RequestIDs)-1]
+		}
+	}
+	if pc, file, line, ok := runtime.Caller(1); ok {
+		e.Caller = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+		if f := runtime.FuncForPC(pc); f != nil {
+			e.Caller += " (" + filepath.Base(f.Name()) + ")"
+		}
+	}
+	return e
+}
+
+func (e *Error) Error() string {
+	msg := e.err.Error()
+	var inner *Error
+	switch {
+	case errors.As(e.err, &inner) && inner.TraceID == e.TraceID:
+		return msg // already annotated.
+	case e.TraceID == (uuid.UUID{}):
+		return fmt.Sprintf("%s (at %s)", msg, e.Caller)
+	default:
+		return fmt.Sprintf("%s (trace_id=%s request_id=%s at %s)", msg, e.TraceID, e.RequestID, e.Caller)
+	}
+}
+
+// Unwrap returns the error as fmt.Errorf made it: errors.Is and errors.As look through it to anything wrapped with %w.
+func (e *Error) Unwrap() error { return e.err }
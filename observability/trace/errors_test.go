@@ -0,0 +1,43 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+func TestErrorf(t *testing.T) {
+	tr := New().AddHop()
+	ctx := SaveCtx(context.Background(), tr)
+	err := Errorf(ctx, "open config: %w", fs.ErrNotExist)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Error("expected errors.Is to see through to the wrapped error")
+	}
+	var te *Error
+	if !errors.As(err, &te) || te.TraceID != tr.TraceID || te.RequestID != tr.RequestIDs[1] {
+		t.Fatalf("expected an *Error with the trace and newest request ID, got %#v", te)
+	}
+	if !strings.HasPrefix(te.Caller, "errors_test.go:") || !strings.HasSuffix(te.Caller, "(trace.TestErrorf)") {
+		t.Errorf("expected the caller to be TestErrorf in errors_test.go, got %q", te.Caller)
+	}
+	want := "open config: file does not exist (trace_id=" + tr.TraceID.String() + " request_id=" + tr.RequestIDs[1].String() + " at " + te.Caller + ")"
+	if err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+
+	// wrapping again in the same trace doesn't repeat the IDs...
+	outer := Errorf(ctx, "start server: %w", err)
+	if got := outer.Error(); got != "start server: "+want || !errors.Is(outer, fs.ErrNotExist) {
+		t.Errorf("got %q, want the IDs only once", got)
+	}
+	// ...but a different trace gets its own.
+	if got := Errorf(SaveCtx(context.Background(), New()), "retry: %w", err).Error(); strings.Count(got, "trace_id=") != 2 {
+		t.Errorf("got %q, want both traces", got)
+	}
+	// and no trace at all is just the caller.
+	if got := Errorf(context.Background(), "no trace").Error(); !strings.HasPrefix(got, "no trace (at errors_test.go:") {
+		t.Errorf("got %q, want the message and caller", got)
+	}
+}
@@ -0,0 +1,323 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SpanKind is the role of a span in a request: see https://opentelemetry.io/docs/specs/otel/trace/api/#spankind
+type SpanKind int
+
+const (
+	SpanKindServer SpanKind = 2 // handling an incoming request.
+	SpanKindClient SpanKind = 3 // making an outgoing request.
+)
+
+// Span status codes, as OTLP numbers them.
+const (
+	StatusUnset = 0
+	StatusOK    = 1
+	StatusError = 2
+)
+
+// Span is a finished unit of work: one hop of a Trace.
+type Span struct {
+	Trace         Trace // the span's ID is its newest RequestID; its parent is the one before that, if any.
+	Name          string
+	Kind          SpanKind
+	Start, End    time.Time
+	Attributes    map[string]any // string, bool, int, int64, or float64 values; anything else is formatted with %v.
+	StatusCode    int            // StatusUnset, StatusOK, or StatusError.
+	StatusMessage string
+}
+
+// spanID is the first 8 bytes of a request ID, as in TraceParent.
+func spanID(id uuid.UUID) string { return hex.EncodeToString(id[:8]) }
+
+// OTLPExporter batches spans and sends them to an OpenTelemetry collector using OTLP over HTTP, in its JSON encoding.
+// See https://opentelemetry.io/docs/specs/otlp/#otlphttp. A nil *OTLPExporter discards everything, so callers needn't check.
+type OTLPExporter struct {
+	endpoint string // the full URL, i.e, http://localhost:4318/v1/traces
+	service  string
+	headers  http.Header
+	client   *http.Client
+
+	mu      sync.RWMutex // guards closing spans.
+	closed  bool
+	spans   chan Span
+	done    chan struct{}
+	dropped atomic.Int64
+	errLog  func(error)
+}
+
+// maxBatch is the most spans sent in one request; exportQueue is how many can wait to be sent before Export drops them.
+const (
+	maxBatch    = 512
+	exportQueue = 4 * maxBatch
+)
+
+// NewOTLPExporter returns an exporter that sends spans from service to endpoint every interval, or whenever it has a full batch.
+// Send failures are passed to onErr, if it's non-nil: spans that fail to send are dropped, not retried.
+// Call Shutdown to send whatever's left.
+func NewOTLPExporter(endpoint, service string, headers http.Header, interval time.Duration, onErr func(error)) *OTLPExporter {
+	if interval <= 0 {
+		panic("interval must be > 0")
+	}
+	if onErr == nil {
+		onErr = func(error) {}
+	}
+	e := &OTLPExporter{
+		endpoint: endpoint, service: service, headers: headers.Clone(),
+		client: &http.Client{Timeout: 10 * time.Second},
+		spans:  make(chan Span, exportQueue), done: make(chan struct{}),
+		errLog: onErr,
+	}
+	go e.run(interval)
+	return e
+}
+
+// OTLPExporterFromEnv builds an exporter from the standard OpenTelemetry environment variables,
+// or returns nil if neither OTEL_EXPORTER_OTLP_TRACES_ENDPOINT nor OTEL_EXPORTER_OTLP_ENDPOINT is set:
+//   - OTEL_EXPORTER_OTLP_TRACES_ENDPOINT: the full URL to send spans to.
+//   - OTEL_EXPORTER_OTLP_ENDPOINT: the collector's base URL; spans go to $OTEL_EXPORTER_OTLP_ENDPOINT/v1/traces.
+//   - OTEL_EXPORTER_OTLP_HEADERS: extra headers, as comma-separated key=value pairs: i.e, for an API key.
+//   - OTEL_SERVICE_NAME: the service's name. Defaults to the executable's name.
+func OTLPExporterFromEnv(onErr func(error)) *OTLPExporter {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if base == "" {
+			return nil
+		}
+		endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	headers := make(http.Header)
+	for _, kv := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			headers.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+		}
+	}
+	service := os.Getenv("OTEL_SERVICE_NAME")
+	if service == "" {
+		exe, _ := os.Executable()
+		service = exe[strings.LastIndexByte(exe, os.PathSeparator)+1:]
+	}
+	return NewOTLPExporter(endpoint, service, headers, 5*time.Second, onErr)
+}
+
+var (
+	defaultExporter     *OTLPExporter
+	defaultExporterOnce sync.Once
+)
+
+// Exporter returns the exporter set with SetExporter, or, if there is none, one configured from the environment: see OTLPExporterFromEnv.
+// It's nil if exporting isn't configured at all.
+func Exporter() *OTLPExporter {
+	defaultExporterOnce.Do(func() {
+		if defaultExporter == nil {
+			defaultExporter = OTLPExporterFromEnv(nil)
+		}
+	})
+	return defaultExporter
+}
+
+// SetExporter replaces the exporter returned by Exporter. It must be called before anything calls Exporter, i.e, at the start of main.
+func SetExporter(e *OTLPExporter) {
+	defaultExporterOnce.Do(func() {})
+	defaultExporter = e
+}
+
+// Export queues a span to be sent. If the queue is full, the span is dropped: tracing should never slow down the thing being traced.
+// So is a span exported after Shutdown.
+func (e *OTLPExporter) Export(s Span) {
+	if e == nil {
+		return
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return
+	}
+	select {
+	case e.spans <- s:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+// Shutdown sends any queued spans and stops the exporter.
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.spans)
+	}
+	e.mu.Unlock()
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *OTLPExporter) run(interval time.Duration) {
+	defer close(e.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	batch := make([]Span, 0, maxBatch)
+	flush := func() {
+		if n := e.dropped.Swap(0); n > 0 {
+			e.errLog(fmt.Errorf("otlp: dropped %d spans: queue full", n))
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil {
+			e.errLog(fmt.Errorf("otlp: sending %d spans: %w", len(batch), err))
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case s, ok := <-e.spans:
+			if !ok {
+				flush()
+				return
+			}
+			if batch = append(batch, s); len(batch) == maxBatch {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// the OTLP JSON encoding: see https://github.com/open-telemetry/opentelemetry-proto/blob/main/examples/trace.json
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope struct {
+			Name string `json:"name"`
+		} `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		TraceState        string         `json:"traceState,omitempty"`
+		Name              string         `json:"name"`
+		Kind              SpanKind       `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"` // 64-bit integers are strings in OTLP's JSON.
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            struct {
+			Code    int    `json:"code,omitempty"`
+			Message string `json:"message,omitempty"`
+		} `json:"status"`
+	}
+	otlpKeyValue struct {
+		Key   string         `json:"key"`
+		Value map[string]any `json:"value"` // exactly one of stringValue, boolValue, intValue, doubleValue.
+	}
+)
+
+func otlpAttributes(attrs map[string]any) []otlpKeyValue {
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for k, v := range attrs {
+		var value map[string]any
+		switch v := v.(type) {
+		case string:
+			value = map[string]any{"stringValue": v}
+		case bool:
+			value = map[string]any{"boolValue": v}
+		case int:
+			value = map[string]any{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]any{"doubleValue": v}
+		default:
+			value = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		kvs = append(kvs, otlpKeyValue{Key: k, Value: value})
+	}
+	return kvs
+}
+
+func (e *OTLPExporter) send(batch []Span) error {
+	scope := otlpScopeSpans{Spans: make([]otlpSpan, 0, len(batch))}
+	scope.Scope.Name = "gitlab.com/efronlicht/blog/observability/trace"
+	for _, s := range batch {
+		if len(s.Trace.RequestIDs) == 0 {
+			continue // no ID, so nothing could refer to it anyways.
+		}
+		ids := s.Trace.RequestIDs
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.Trace.TraceID[:]),
+			SpanID:            spanID(ids[len(ids)-1]),
+			TraceState:        s.Trace.TraceState,
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes),
+		}
+		if len(ids) > 1 {
+			span.ParentSpanID = spanID(ids[len(ids)-2])
+		}
+		span.Status.Code, span.Status.Message = s.StatusCode, s.StatusMessage
+		scope.Spans = append(scope.Spans, span)
+	}
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes(map[string]any{"service.name": e.service})},
+		ScopeSpans: []otlpScopeSpans{scope},
+	}}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range e.headers {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOTLPExporter(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		reqs []map[string]any
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" || r.Header.Get("Api-Key") != "secret" {
+			t.Errorf("got %s %s with headers %v", r.Method, r.URL, r.Header)
+		}
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		reqs = append(reqs, body)
+		mu.Unlock()
+	}))
+	defer collector.Close()
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", collector.URL)
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "api-key=secret")
+	t.Setenv("OTEL_SERVICE_NAME", "eblog")
+	e := OTLPExporterFromEnv(func(err error) { t.Error(err) })
+
+	tr := New()
+	parent := tr.RequestIDs[0]
+	tr.RequestIDs = append(tr.RequestIDs, New().RequestIDs[0])
+	start := time.Unix(1_700_000_000, 0)
+	e.Export(Span{
+		Trace: tr, Name: "GET /", Kind: SpanKindServer, Start: start, End: start.Add(time.Millisecond),
+		Attributes: map[string]any{"http.response.status_code": 500, "url.path": "/"},
+		StatusCode: StatusError, StatusMessage: "Internal Server Error",
+	})
+	e.Export(Span{Name: "no ids"}) // skipped.
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	e.Export(Span{Trace: tr}) // dropped, not a panic.
+
+	if len(reqs) != 1 {
+		t.Fatalf("got %d requests, want 1", len(reqs))
+	}
+	b, _ := json.Marshal(reqs[0])
+	var got otlpRequest
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	rs := got.ResourceSpans[0]
+	if kv := rs.Resource.Attributes[0]; kv.Key != "service.name" || kv.Value["stringValue"] != "eblog" {
+		t.Errorf("resource: got %+v", rs.Resource)
+	}
+	spans := rs.ScopeSpans[0].Spans
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	s := spans[0]
+	switch {
+	case s.TraceID != tr.TraceParent()[3:35]:
+		t.Errorf("traceId: got %s, want %s", s.TraceID, tr.TraceParent()[3:35])
+	case s.SpanID != tr.TraceParent()[36:52] || s.ParentSpanID != spanID(parent):
+		t.Errorf("spanId, parentSpanId: got %s, %s", s.SpanID, s.ParentSpanID)
+	case s.StartTimeUnixNano != "1700000000000000000" || s.EndTimeUnixNano != "1700000000001000000":
+		t.Errorf("times: got %s - %s", s.StartTimeUnixNano, s.EndTimeUnixNano)
+	case s.Kind != SpanKindServer || s.Status.Code != StatusError || s.Status.Message != "Internal Server Error":
+		t.Errorf("kind, status: got %v, %+v", s.Kind, s.Status)
+	case len(s.Attributes) != 2:
+		t.Errorf("attributes: got %+v", s.Attributes)
+	}
+	for _, kv := range s.Attributes {
+		if kv.Key == "http.response.status_code" && kv.Value["intValue"] != "500" {
+			t.Errorf("ints are strings in OTLP's JSON: got %#v", kv.Value)
+		}
+	}
+}
+
+func TestOTLPExporterFromEnvUnset(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	e := OTLPExporterFromEnv(nil)
+	if e != nil {
+		t.Fatal("expected no exporter")
+	}
+	e.Export(Span{}) // a nil exporter is a no-op.
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,54 @@
+package trace
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Sampling is a head-based sampling decision: made once, by the first service to see a trace, and passed along to the rest,
+// so that a trace is either logged in detail everywhere or nowhere.
+type Sampling uint8
+
+const (
+	Undecided  Sampling = iota // nobody's decided yet.
+	Sampled                    // log this trace in detail.
+	NotSampled                 // don't.
+)
+
+func (s Sampling) String() string {
+	switch s {
+	case Sampled:
+		return "sampled"
+	case NotSampled:
+		return "not sampled"
+	default:
+		return "undecided"
+	}
+}
+
+// Sampler makes sampling decisions.
+type Sampler struct {
+	// Rate is the fraction of traces to sample, in [0, 1].
+	// Traces are chosen by trace ID, so every service sampling at the same rate picks the same traces, even without ParentBased.
+	Rate float64
+	// ParentBased keeps the decision a trace arrives with, if any, so that whoever started the trace decides for everyone.
+	// Otherwise, Rate decides every trace, no matter what the caller said.
+	ParentBased bool
+}
+
+// Sample returns t with its Sampling decided.
+func (s Sampler) Sample(t Trace) Trace {
+	if s.ParentBased && t.Sampling != Undecided {
+		return t
+	}
+	t.Sampling = NotSampled
+	switch {
+	case s.Rate >= 1:
+		t.Sampling = Sampled
+	case s.Rate <= 0:
+	// uuids are random, so the first 8 bytes are a uniformly-distributed uint64.
+	case float64(binary.BigEndian.Uint64(t.TraceID[:8])) < s.Rate*math.MaxUint64:
+		t.Sampling = Sampled
+	}
+	return t
+}
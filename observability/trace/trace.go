@@ -15,27 +15,71 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
 
-// New makes a new Trace with a freshly-generated TraceID and RequestID.
+// New makes a new Trace with a freshly-generated TraceID and RequestID, starting now.
 func New() Trace {
-	return Trace{TraceID: uuid.New(), RequestIDs: []uuid.UUID{uuid.New()}}
+	return Trace{TraceID: uuid.New(), RequestIDs: []uuid.UUID{uuid.New()}, Start: time.Now(), Elapsed: []time.Duration{0}}
 }
 
 // Trace contains a TraceID and one or more RequestIDs. RequestIDs are always preserved in order of creation, oldest first.
 type Trace struct {
 	TraceID    uuid.UUID   `json:"trace_id,omitempty"`
 	RequestIDs []uuid.UUID `json:"request_ids,omitempty"`
+	// TraceState is the W3C "tracestate" header, if any: vendor-specific data we pass along untouched.
+	TraceState string `json:"trace_state,omitempty"`
+	// Start is when the trace began, by the clock of the service that began it. Zero if unknown.
+	Start time.Time `json:"start,omitempty"`
+	// Elapsed[i] is how long after Start that RequestIDs[i] began, by the clock of the service that made it:
+	// so clock skew between services shows up here, too. Nil if unknown, or if it doesn't line up with RequestIDs.
+	Elapsed []time.Duration `json:"elapsed,omitempty"`
+	// Baggage is a small set of key-value pairs propagated along with the trace: i.e, a user or tenant ID. See Baggage.
+	Baggage Baggage `json:"baggage,omitempty"`
+	// Sampling is whether this trace was chosen for detailed logging, by whoever decided first. See Sampler.
+	Sampling Sampling `json:"sampling,omitempty"`
+}
+
+// AddHop returns a copy of t with a new request, beginning now, appended to the chain.
+// A trace with no Start starts now.
+func (t Trace) AddHop() Trace {
+	now := time.Now()
+	if t.Start.IsZero() {
+		t.Start, t.Elapsed = now, make([]time.Duration, len(t.RequestIDs)) // we don't know when the earlier ones began: call it 0.
+	} else if len(t.Elapsed) != len(t.RequestIDs) {
+		t.Elapsed = make([]time.Duration, len(t.RequestIDs))
+	}
+	// clip, so that two hops added to the same trace don't share a backing array.
+	t.RequestIDs = append(slices.Clip(t.RequestIDs), uuid.New())
+	t.Elapsed = append(slices.Clip(t.Elapsed), now.Sub(t.Start))
+	return t
+}
+
+// Since returns how long ago the trace started: the cumulative latency of every hop so far. It's 0 if the start is unknown.
+func (t Trace) Since() time.Duration {
+	if t.Start.IsZero() {
+		return 0
+	}
+	return time.Since(t.Start)
 }
 
 const (
-	TraceIDHeader = "E-Trace-Id"
-	ReqIDHeader   = "E-Req-Id"
+	TraceIDHeader    = "E-Trace-Id"
+	ReqIDHeader      = "E-Req-Id"
+	TraceStartHeader = "E-Trace-Start"   // Start, in RFC 3339 format
+	ElapsedHeader    = "E-Req-Elapsed"   // Elapsed, one per E-Req-Id
+	SampledHeader    = "E-Trace-Sampled" // "1" if Sampled, "0" if NotSampled, missing if Undecided.
+	// W3C Trace Context headers: see https://www.w3.org/TR/trace-context/
+	TraceParentHeader = "Traceparent"
+	TraceStateHeader  = "Tracestate"
 )
 
-// PopulateRequestHeaders adds the traceID and RequestIDs to the request headers.
+// PopulateRequestHeaders adds the traceID and RequestIDs to the request headers,
+// both as our own E-Trace-Id and E-Req-Id headers and as a W3C traceparent (and tracestate, if any), so standard tracing infrastructure can follow along.
 // In general, this function should not be used directly: use the HTTPClientWrapper instead.
 func PopulateHttpHeader(h http.Header, t Trace) {
 	reqIDs := make([]string, len(t.RequestIDs))
@@ -44,6 +88,89 @@ func PopulateHttpHeader(h http.Header, t Trace) {
 	}
 	h.Set(TraceIDHeader, t.TraceID.String())
 	h[ReqIDHeader] = reqIDs
+	h.Del(TraceStartHeader)
+	h.Del(ElapsedHeader)
+	if !t.Start.IsZero() && len(t.Elapsed) == len(t.RequestIDs) {
+		h.Set(TraceStartHeader, t.Start.UTC().Format(time.RFC3339Nano))
+		for _, d := range t.Elapsed {
+			h.Add(ElapsedHeader, d.String())
+		}
+	}
+	switch t.Sampling {
+	case Sampled:
+		h.Set(SampledHeader, "1")
+	case NotSampled:
+		h.Set(SampledHeader, "0")
+	default:
+		h.Del(SampledHeader)
+	}
+	if b := t.Baggage.String(); b != "" {
+		h.Set(BaggageHeader, b)
+	} else {
+		h.Del(BaggageHeader)
+	}
+	if tp := t.TraceParent(); tp != "" {
+		h.Set(TraceParentHeader, tp)
+	}
+	if t.TraceState != "" {
+		h.Set(TraceStateHeader, t.TraceState)
+	} else {
+		h.Del(TraceStateHeader)
+	}
+}
+
+// TraceParent formats t as a W3C traceparent header: "00-<trace id>-<parent id>-<flags>".
+// The W3C trace ID is our TraceID; the parent ID is the first 8 bytes of the newest RequestID.
+// The flags are "00" if t is NotSampled, and "01" (sampled) otherwise.
+// It returns "" for a trace without a TraceID or RequestIDs, which has nothing to say.
+func (t Trace) TraceParent() string {
+	if t.TraceID == uuid.Nil || len(t.RequestIDs) == 0 {
+		return ""
+	}
+	parent := t.RequestIDs[len(t.RequestIDs)-1]
+	flags := 1
+	if t.Sampling == NotSampled {
+		flags = 0
+	}
+	return fmt.Sprintf("00-%x-%x-%02x", t.TraceID[:], parent[:8], flags)
+}
+
+// ParseTraceParent parses a W3C traceparent header into a Trace whose only RequestID holds the parent ID in its first 8 bytes,
+// and whose Sampling is the header's sampled flag.
+// Versions after 00 are parsed as 00, ignoring anything extra, as the spec says to.
+func ParseTraceParent(s string) (Trace, error) {
+	// version "-" trace-id "-" parent-id "-" trace-flags
+	// 2       1   32         1   16          1   2      == 55
+	const size = 55
+	if len(s) < size || (len(s) > size && s[size] != '-') || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return Trace{}, fmt.Errorf("traceparent %q: expected the form 00-<32 hex digits>-<16 hex digits>-<2 hex digits>", s)
+	}
+	version, traceID, parentID, flags := s[:2], s[3:35], s[36:52], s[53:55]
+	for _, part := range []string{version, traceID, parentID, flags} {
+		if strings.ToLower(part) != part {
+			return Trace{}, fmt.Errorf("traceparent %q: hex digits must be lowercase", s)
+		}
+	}
+	if v, err := hex.DecodeString(version); err != nil || v[0] == 0xff || (v[0] == 0 && len(s) != size) {
+		return Trace{}, fmt.Errorf("traceparent %q: invalid version", s)
+	}
+	var t Trace
+	var parent uuid.UUID
+	if _, err := hex.Decode(t.TraceID[:], []byte(traceID)); err != nil || t.TraceID == uuid.Nil {
+		return Trace{}, fmt.Errorf("traceparent %q: invalid trace id", s)
+	}
+	if _, err := hex.Decode(parent[:8], []byte(parentID)); err != nil || parent == uuid.Nil {
+		return Trace{}, fmt.Errorf("traceparent %q: invalid parent id", s)
+	}
+	f, err := hex.DecodeString(flags)
+	if err != nil {
+		return Trace{}, fmt.Errorf("traceparent %q: invalid trace flags", s)
+	}
+	t.RequestIDs, t.Sampling = []uuid.UUID{parent}, NotSampled
+	if f[0]&1 == 1 {
+		t.Sampling = Sampled
+	}
+	return t, nil
 }
 
 // ErrNoTraceIDHeader is returned FromHTTPHeader when no  "E-Trace-Id" header is ound.
@@ -53,8 +180,68 @@ var ErrNoTraceIDHeader = errors.New("no E-Trace-Id header")
 var ErrNoReqIDHeader = errors.New("no E-Req-ID header")
 
 // FromHttpReq decodes a Trace from the request's headers. In general, this function should not be used directly: use the ServerMiddleware instead.
+// Our own E-Trace-Id and E-Req-Id headers win; without an E-Trace-Id, it falls back to a W3C traceparent header, if any.
+// Either way, the tracestate header is passed along in TraceState.
 func FromHttpHeader(h http.Header) (Trace, error) {
+	t, err := fromHttpHeader(h)
+	t.TraceState = traceState(h)
+	t.Baggage = ParseBaggage(strings.Join(h.Values(BaggageHeader), ","))
+	t.Start, t.Elapsed = timing(h, len(t.RequestIDs))
+	t.Sampling = sampling(h)
+	return t, err
+}
+
+// sampling reads the sampling decision from the E-Trace-Sampled header, or, failing that, the traceparent's sampled flag.
+func sampling(h http.Header) Sampling {
+	switch h.Get(SampledHeader) {
+	case "1":
+		return Sampled
+	case "0":
+		return NotSampled
+	}
+	if tp, err := ParseTraceParent(h.Get(TraceParentHeader)); err == nil {
+		return tp.Sampling
+	}
+	return Undecided
+}
+
+// timing parses the E-Trace-Start and E-Req-Elapsed headers, returning zeroes if they're missing, malformed,
+// or don't line up with the n request IDs.
+func timing(h http.Header, n int) (time.Time, []time.Duration) {
+	start, err := time.Parse(time.RFC3339Nano, h.Get(TraceStartHeader))
+	if err != nil {
+		return time.Time{}, nil
+	}
+	raw := h.Values(ElapsedHeader)
+	if len(raw) != n {
+		return start, nil
+	}
+	elapsed := make([]time.Duration, n)
+	for i := range raw {
+		if elapsed[i], err = time.ParseDuration(raw[i]); err != nil {
+			return start, nil
+		}
+	}
+	return start, elapsed
+}
+
+// maxTraceStateLen is the longest tracestate header we pass along: see https://www.w3.org/TR/trace-context/#tracestate-limits
+const maxTraceStateLen = 512
+
+// traceState joins the tracestate headers, dropping the whole thing if it's too long to safely propagate.
+func traceState(h http.Header) string {
+	s := strings.Join(h.Values(TraceStateHeader), ",")
+	if len(s) > maxTraceStateLen {
+		return ""
+	}
+	return s
+}
+
+func fromHttpHeader(h http.Header) (Trace, error) {
 	rawTrace := h.Get(TraceIDHeader)
+	if rawTrace == "" && h.Get(TraceParentHeader) != "" {
+		return ParseTraceParent(h.Get(TraceParentHeader))
+	}
 	traceID, err := uuid.Parse(rawTrace)
 	if err != nil {
 		return Trace{}, fmt.Errorf("E-Trace-Id header had invalid value %q expected a UUID: %w", rawTrace, err)
@@ -89,6 +276,9 @@ func FromCtx(ctx context.Context) (Trace, bool) {
 	if len(t.RequestIDs) == 0 {
 		t.RequestIDs = []uuid.UUID{uuid.New()}
 	}
+	if t.Start.IsZero() {
+		t.Start, t.Elapsed = time.Now(), make([]time.Duration, len(t.RequestIDs))
+	}
 	return t, true
 }
 
@@ -104,6 +294,9 @@ func FromCtxOrNew(ctx context.Context) Trace {
 	if len(t.RequestIDs) == 0 {
 		t.RequestIDs = []uuid.UUID{uuid.New()}
 	}
+	if t.Start.IsZero() {
+		t.Start, t.Elapsed = time.Now(), make([]time.Duration, len(t.RequestIDs))
+	}
 	return t
 }
 
@@ -0,0 +1,211 @@
+package trace
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestTraceParent(t *testing.T) {
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" // the example from the spec.
+	got, err := ParseTraceParent(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TraceID.String() != "4bf92f35-77b3-4da6-a3ce-929d0e0e4736" || len(got.RequestIDs) != 1 {
+		t.Fatalf("got %+v", got)
+	}
+	if got.TraceParent() != tp {
+		t.Errorf("round trip: got %q, want %q", got.TraceParent(), tp)
+	}
+	if _, err := ParseTraceParent("cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-what-the-future-holds"); err != nil {
+		t.Errorf("future version: %v", err)
+	}
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", // version 00 is exactly 55 characters.
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",       // ff is forbidden.
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",       // uppercase.
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",       // all-zero trace id.
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",       // all-zero parent id.
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0g",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7_01",
+	} {
+		if _, err := ParseTraceParent(bad); err == nil {
+			t.Errorf("ParseTraceParent(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestHttpHeaderW3C(t *testing.T) {
+	// a request from something that only speaks W3C.
+	h := http.Header{}
+	h.Set(TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.Add(TraceStateHeader, "rojo=00f067aa0ba902b7")
+	h.Add(TraceStateHeader, "congo=t61rcWkgMzE")
+	got, err := FromHttpHeader(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TraceID.String() != "4bf92f35-77b3-4da6-a3ce-929d0e0e4736" || got.TraceState != "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE" {
+		t.Fatalf("got %+v", got)
+	}
+
+	// we add a hop and send it on: both kinds of headers go out, and the W3C parent is our newest request.
+	got.RequestIDs = append(got.RequestIDs, uuid.New())
+	out := http.Header{}
+	PopulateHttpHeader(out, got)
+	if out.Get(TraceIDHeader) != got.TraceID.String() || len(out[ReqIDHeader]) != 2 {
+		t.Errorf("legacy headers: got %v", out)
+	}
+	if tp := out.Get(TraceParentHeader); !strings.HasPrefix(tp, "00-4bf92f3577b34da6a3ce929d0e0e4736-") || strings.Contains(tp, "00f067aa0ba902b7") {
+		t.Errorf("traceparent: got %q, want the same trace with a new parent", tp)
+	}
+	if out.Get(TraceStateHeader) != got.TraceState {
+		t.Errorf("tracestate: got %q, want %q", out.Get(TraceStateHeader), got.TraceState)
+	}
+
+	// our own headers win over W3C's.
+	legacy := New()
+	PopulateHttpHeader(h, legacy)
+	h.Set(TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if got, err := FromHttpHeader(h); err != nil || got.TraceID != legacy.TraceID || got.RequestIDs[0] != legacy.RequestIDs[0] {
+		t.Errorf("got %+v, %v, want %+v", got, err, legacy)
+	}
+
+	// an oversized tracestate is dropped rather than passed along.
+	h.Set(TraceStateHeader, "a="+strings.Repeat("x", maxTraceStateLen))
+	if got, _ := FromHttpHeader(h); got.TraceState != "" {
+		t.Errorf("got a %d-byte tracestate, want it dropped", len(got.TraceState))
+	}
+}
+
+func TestTiming(t *testing.T) {
+	tr := New()
+	tr.Start = tr.Start.Add(-time.Second) // pretend it's been going a while.
+	hop := tr.AddHop()
+	if len(hop.RequestIDs) != 2 || len(hop.Elapsed) != 2 || hop.Elapsed[1] < time.Second {
+		t.Fatalf("AddHop: got %+v", hop)
+	}
+	if other := tr.AddHop(); other.RequestIDs[1] == hop.RequestIDs[1] || &other.Elapsed[0] == &hop.Elapsed[0] {
+		t.Error("AddHop: hops from the same trace share state")
+	}
+	if hop.Since() < time.Second {
+		t.Errorf("Since: got %s, want at least 1s", hop.Since())
+	}
+
+	h := http.Header{}
+	PopulateHttpHeader(h, hop)
+	got, err := FromHttpHeader(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Start.Equal(hop.Start) || !slices.Equal(got.Elapsed, hop.Elapsed) {
+		t.Errorf("round trip: got start %s, elapsed %v; want %s, %v", got.Start, got.Elapsed, hop.Start, hop.Elapsed)
+	}
+
+	// elapsed times that don't line up with the request IDs are dropped.
+	h.Add(ElapsedHeader, "1s")
+	if got, _ := FromHttpHeader(h); got.Elapsed != nil || got.Start.IsZero() {
+		t.Errorf("mismatched: got start %s, elapsed %v; want the start, but no elapsed", got.Start, got.Elapsed)
+	}
+	// a trace from before timing existed starts its timing at the next hop.
+	legacy := Trace{TraceID: uuid.New(), RequestIDs: []uuid.UUID{uuid.New()}}.AddHop()
+	if legacy.Start.IsZero() || !slices.Equal(legacy.Elapsed, []time.Duration{0, 0}) {
+		t.Errorf("legacy: got start %s, elapsed %v", legacy.Start, legacy.Elapsed)
+	}
+}
+
+func TestBaggage(t *testing.T) {
+	got := ParseBaggage(" userId = alice%20smith ,tenant=acme;ttl=1, bad key=x,noequals,escape=%zz, =empty")
+	want := Baggage{"userId": "alice smith", "tenant": "acme"}
+	if !maps.Equal(got, want) {
+		t.Errorf("ParseBaggage: got %v, want %v", got, want)
+	}
+	if s := (Baggage{"b": "x,y;z", "a": "1", "bad key": "dropped"}).String(); s != "a=1,b=x%2Cy%3Bz" {
+		t.Errorf("String: got %q", s)
+	}
+	if got := ParseBaggage(Baggage{"b": "x,y;z"}.String()); got["b"] != "x,y;z" {
+		t.Errorf("round trip: got %q", got["b"])
+	}
+
+	// too many members, or too many bytes: the rest are dropped.
+	big := make(Baggage)
+	for i := 0; i < 2*maxBaggageMembers; i++ {
+		big[fmt.Sprintf("k%03d", i)] = "v"
+	}
+	if got := ParseBaggage(big.String()); len(got) != maxBaggageMembers {
+		t.Errorf("got %d members, want %d", len(got), maxBaggageMembers)
+	}
+	huge := Baggage{"a": strings.Repeat("x", maxBaggageBytes), "b": "small"}
+	if s := huge.String(); s != "" {
+		t.Errorf("got %d bytes, want the oversized member (and everything after it) dropped", len(s))
+	}
+	if got := ParseBaggage("a=" + strings.Repeat("x", maxBaggageBytes)); len(got) != 0 {
+		t.Errorf("got %d members from an oversized header, want 0", len(got))
+	}
+
+	// it travels in the headers.
+	tr := New()
+	tr.Baggage = Baggage{"userId": "alice"}
+	h := http.Header{}
+	PopulateHttpHeader(h, tr)
+	if got, _ := FromHttpHeader(h); got.Baggage["userId"] != "alice" {
+		t.Errorf("headers: got %v", got.Baggage)
+	}
+}
+
+func TestSampler(t *testing.T) {
+	tr := New()
+	for _, tt := range []struct {
+		s      Sampler
+		parent Sampling
+		want   Sampling
+	}{
+		{Sampler{Rate: 1}, Undecided, Sampled},
+		{Sampler{Rate: 0}, Undecided, NotSampled},
+		{Sampler{Rate: 1}, NotSampled, Sampled}, // not parent-based: we decide.
+		{Sampler{Rate: 1, ParentBased: true}, NotSampled, NotSampled},
+		{Sampler{Rate: 0, ParentBased: true}, Sampled, Sampled},
+		{Sampler{Rate: 0, ParentBased: true}, Undecided, NotSampled},
+	} {
+		tr.Sampling = tt.parent
+		if got := tt.s.Sample(tr).Sampling; got != tt.want {
+			t.Errorf("%+v.Sample(%s): got %s, want %s", tt.s, tt.parent, got, tt.want)
+		}
+	}
+
+	// a rate samples about that fraction of traces.
+	sampled := 0
+	for i := 0; i < 10_000; i++ {
+		if (Sampler{Rate: 0.25}).Sample(New()).Sampling == Sampled {
+			sampled++
+		}
+	}
+	if sampled < 2_000 || sampled > 3_000 {
+		t.Errorf("Rate 0.25: sampled %d of 10000", sampled)
+	}
+
+	// the decision travels in the headers: ours, and the traceparent's flags.
+	for _, want := range []Sampling{Sampled, NotSampled} {
+		tr.Sampling = want
+		h := http.Header{}
+		PopulateHttpHeader(h, tr)
+		if got, _ := FromHttpHeader(h); got.Sampling != want {
+			t.Errorf("E-Trace-Sampled: got %s, want %s", got.Sampling, want)
+		}
+		h.Del(SampledHeader)
+		if got, _ := FromHttpHeader(h); got.Sampling != want {
+			t.Errorf("traceparent %s: got %s, want %s", h.Get(TraceParentHeader), got.Sampling, want)
+		}
+	}
+	if got, _ := FromHttpHeader(http.Header{}); got.Sampling != Undecided {
+		t.Errorf("no headers: got %s, want undecided", got.Sampling)
+	}
+}
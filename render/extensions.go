@@ -0,0 +1,156 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gomarkdown/markdown/parser"
+	xhtml "golang.org/x/net/html"
+)
+
+// Extensions are markdown syntax beyond what every article gets (gomarkdown's CommonExtensions: fenced code, tables, definition lists, and so on).
+// They're off unless Config asks for them, so an article that happens to contain the syntax doesn't change on its own.
+type Extensions uint8
+
+const (
+	// Footnotes are pandoc-style: "text[^1]", then "[^1]: the note" on a line of its own. They're collected under the article, in <div class="footnotes">, with links back.
+	Footnotes Extensions = 1 << iota
+	// TaskLists turn list items starting with "[ ]" or "[x]" into disabled checkboxes.
+	TaskLists
+	// Admonitions turn blockquotes starting with a GitHub-style "[!NOTE]", "[!TIP]", "[!IMPORTANT]", "[!WARNING]", or "[!CAUTION]"
+	// into <div class="admonition note">, titled with <p class="admonition-title">.
+	Admonitions
+
+	// AllExtensions is every extension.
+	AllExtensions = Footnotes | TaskLists | Admonitions
+)
+
+// extensionNames are how ParseExtensions and String spell each extension: i.e, on rendermd's command line.
+var extensionNames = [...]struct {
+	ext  Extensions
+	name string
+}{{Footnotes, "footnotes"}, {TaskLists, "tasklists"}, {Admonitions, "admonitions"}}
+
+// ParseExtensions parses a comma-separated list of extensions, like "footnotes,tasklists": "all" means AllExtensions, and "" means none.
+func ParseExtensions(s string) (Extensions, error) {
+	var exts Extensions
+	for _, name := range strings.Split(s, ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "":
+			continue
+		case "all":
+			exts |= AllExtensions
+			continue
+		}
+		found := false
+		for _, e := range extensionNames {
+			if e.name == name {
+				exts |= e.ext
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown markdown extension %q: want some of %s, or all", name, AllExtensions)
+		}
+	}
+	return exts, nil
+}
+
+// String is the inverse of ParseExtensions.
+func (exts Extensions) String() string {
+	var names []string
+	for _, e := range extensionNames {
+		if exts&e.ext != 0 {
+			names = append(names, e.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// parserExtensions are the gomarkdown extensions to parse with. Only Footnotes needs the parser: the rest rewrite the rendered HTML (see rewrite).
+func (exts Extensions) parserExtensions() parser.Extensions {
+	if exts&Footnotes != 0 {
+		return parser.CommonExtensions | parser.Footnotes
+	}
+	return parser.CommonExtensions
+}
+
+// rewrite applies the extensions that work on the rendered HTML, rather than the markdown.
+func (exts Extensions) rewrite(doc *goquery.Document) {
+	if exts&TaskLists != 0 {
+		doc.Find("li").Each(func(_ int, li *goquery.Selection) { taskListItem(li.Nodes[0]) })
+	}
+	if exts&Admonitions != 0 {
+		doc.Find("blockquote").Each(func(_ int, quote *goquery.Selection) { admonition(quote) })
+	}
+}
+
+// taskListItem turns an <li> starting with "[ ] " or "[x] " into a checkbox, unchecked or checked. In a loose list, the text is in a <p>.
+func taskListItem(li *xhtml.Node) {
+	text := li.FirstChild
+	if text != nil && text.Type == xhtml.ElementNode && text.Data == "p" {
+		text = text.FirstChild
+	}
+	if text == nil || text.Type != xhtml.TextNode {
+		return
+	}
+	var checked bool
+	switch {
+	case strings.HasPrefix(text.Data, "[ ] "):
+	case strings.HasPrefix(text.Data, "[x] "), strings.HasPrefix(text.Data, "[X] "):
+		checked = true
+	default:
+		return
+	}
+	text.Data = text.Data[len("[ ] "):]
+	box := &xhtml.Node{Type: xhtml.ElementNode, Data: "input", Attr: []xhtml.Attribute{{Key: "type", Val: "checkbox"}, {Key: "disabled"}}}
+	if checked {
+		box.Attr = append(box.Attr, xhtml.Attribute{Key: "checked"})
+	}
+	text.Parent.InsertBefore(box, text)
+	text.Parent.InsertBefore(&xhtml.Node{Type: xhtml.TextNode, Data: " "}, text)
+	addClass(li, "task")
+}
+
+// admonitionKinds are the kinds of Admonitions, by their marker.
+var admonitionKinds = map[string]string{"[!NOTE]": "Note", "[!TIP]": "Tip", "[!IMPORTANT]": "Important", "[!WARNING]": "Warning", "[!CAUTION]": "Caution"}
+
+// admonition turns a blockquote whose first paragraph starts with one of admonitionKinds into a titled <div>.
+func admonition(quote *goquery.Selection) {
+	p := quote.Children().First()
+	if !p.Is("p") || p.Nodes[0].FirstChild == nil || p.Nodes[0].FirstChild.Type != xhtml.TextNode {
+		return
+	}
+	text := p.Nodes[0].FirstChild
+	marker, rest, _ := strings.Cut(strings.TrimLeft(text.Data, " \t"), "\n")
+	title, ok := admonitionKinds[strings.TrimSpace(marker)]
+	if !ok {
+		return
+	}
+	text.Data = strings.TrimLeft(rest, " \t")
+	if text.Data == "" && text.NextSibling == nil { // the marker was the whole paragraph.
+		p.Remove()
+	}
+	div := &xhtml.Node{Type: xhtml.ElementNode, Data: "div", Attr: []xhtml.Attribute{{Key: "class", Val: "admonition " + strings.ToLower(title)}}}
+	heading := &xhtml.Node{Type: xhtml.ElementNode, Data: "p", Attr: []xhtml.Attribute{{Key: "class", Val: "admonition-title"}}}
+	heading.AppendChild(&xhtml.Node{Type: xhtml.TextNode, Data: title})
+	div.AppendChild(heading)
+	node := quote.Nodes[0]
+	for c := node.FirstChild; c != nil; c = node.FirstChild {
+		node.RemoveChild(c)
+		div.AppendChild(c)
+	}
+	node.Parent.InsertBefore(div, node)
+	node.Parent.RemoveChild(node)
+}
+
+func addClass(n *xhtml.Node, class string) {
+	for i, a := range n.Attr {
+		if a.Key == "class" {
+			n.Attr[i].Val += " " + class
+			return
+		}
+	}
+	n.Attr = append(n.Attr, xhtml.Attribute{Key: "class", Val: class})
+}
@@ -0,0 +1,109 @@
+package render_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitlab.com/efronlicht/blog/render"
+)
+
+func TestExtensions(t *testing.T) {
+	const src = `# extensions
+
+a claim[^1].
+
+[^1]: the evidence.
+
+- [ ] todo
+- [x] done
+- plain
+
+> [!WARNING]
+> mind the gap.
+
+between.
+
+> just a quote.
+
+| a | b |
+|---|---|
+| 1 | 2 |
+
+Term
+: its definition.
+`
+	md := filepath.Join(t.TempDir(), "ext.md")
+	if err := os.WriteFile(md, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	always := []string{"<table>", "<td>1</td>", "<dt>Term</dt>", "<dd>its definition.</dd>", "<blockquote>\n<p>just a quote.</p>"}
+	for _, tt := range []struct {
+		exts         render.Extensions
+		want, absent []string
+	}{
+		{
+			exts:   0,
+			want:   append([]string{"[^1]", "[ ] todo", "[!WARNING]"}, always...),
+			absent: []string{`class="footnotes"`, "<input", "admonition"},
+		},
+		{
+			exts: render.AllExtensions,
+			want: append([]string{
+				`<div class="footnotes">`,
+				"the evidence.",
+				`<li class="task"><input type="checkbox" disabled=""/> todo</li>`,
+				`<li class="task"><input type="checkbox" disabled="" checked=""/> done</li>`,
+				"<li>plain</li>",
+				`<div class="admonition warning"><p class="admonition-title">Warning</p>`,
+				"mind the gap.",
+			}, always...),
+			absent: []string{"[^1]", "[!WARNING]", "[x]"},
+		},
+	} {
+		t.Run(tt.exts.String(), func(t *testing.T) {
+			out, _, err := render.ArticleWithConfig(md, render.Config{Extensions: tt.exts})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(out), want) {
+					t.Errorf("expected output to contain %s, got\n%s", want, out)
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(string(out), absent) {
+					t.Errorf("expected output not to contain %s, got\n%s", absent, out)
+				}
+			}
+		})
+	}
+}
+
+func TestParseExtensions(t *testing.T) {
+	for _, tt := range []struct {
+		s       string
+		want    render.Extensions
+		wantErr bool
+	}{
+		{s: "", want: 0},
+		{s: "footnotes", want: render.Footnotes},
+		{s: "tasklists, admonitions", want: render.TaskLists | render.Admonitions},
+		{s: "all", want: render.AllExtensions},
+		{s: "footnotes,typo", wantErr: true},
+	} {
+		got, err := render.ParseExtensions(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("ParseExtensions(%q): expected error: %v, got %v", tt.s, tt.wantErr, err)
+		}
+		if got != tt.want {
+			t.Errorf("ParseExtensions(%q): expected %v, got %v", tt.s, tt.want, got)
+		}
+		if err == nil {
+			if again, _ := render.ParseExtensions(got.String()); again != got {
+				t.Errorf("ParseExtensions(%q).String() doesn't round-trip: %q", tt.s, got.String())
+			}
+		}
+	}
+}
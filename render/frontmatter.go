@@ -0,0 +1,55 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Meta is an article's metadata. Everything but Name, Words, and Minutes comes from its frontmatter:
+// an optional YAML block at the very top of the markdown file, between two '---' lines, like this:
+//
+//	---
+//	title: "Go Quirks & Tricks, Pt 1"
+//	date: 2023-06-01
+//	tags: [go, performance]
+//	summary: declarations, control flow, and the typesystem.
+//	---
+//
+// cmd/rendermd writes every article's Meta to articles.json, which the server reads for the listing page, feeds, and search.
+type Meta struct {
+	Name    string    `json:"name" yaml:"-"` // of the rendered file, like "quirks.html"
+	Title   string    `json:"title" yaml:"title"`
+	Date    time.Time `json:"date" yaml:"date"` // zero if unknown
+	Tags    []string  `json:"tags,omitempty" yaml:"tags"`
+	Summary string    `json:"summary,omitempty" yaml:"summary"`
+	Words   int       `json:"words,omitempty" yaml:"-"`   // of the rendered article's text, code included
+	Minutes int       `json:"minutes,omitempty" yaml:"-"` // to read it: see ReadingMinutes
+}
+
+var frontmatterDelim = []byte("---\n")
+
+// Frontmatter splits src into its frontmatter and the markdown body that follows.
+// If src has no frontmatter, meta is zero and body is src. Unknown keys are an error, so typos don't go unnoticed.
+// src's newlines should already be normalized to "\n".
+func Frontmatter(src []byte) (meta Meta, body []byte, err error) {
+	if !bytes.HasPrefix(src, frontmatterDelim) {
+		return Meta{}, src, nil
+	}
+	rest := src[len(frontmatterDelim):]
+	end := bytes.Index(rest, append([]byte("\n"), frontmatterDelim...))
+	switch {
+	case bytes.HasPrefix(rest, frontmatterDelim): // empty frontmatter
+		return Meta{}, rest[len(frontmatterDelim):], nil
+	case end < 0:
+		return Meta{}, nil, fmt.Errorf("frontmatter: missing closing %q", bytes.TrimSpace(frontmatterDelim))
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(rest[:end+1]))
+	dec.KnownFields(true)
+	if err := dec.Decode(&meta); err != nil {
+		return Meta{}, nil, fmt.Errorf("frontmatter: %w", err)
+	}
+	return meta, rest[end+1+len(frontmatterDelim):], nil
+}
@@ -0,0 +1,45 @@
+package render_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gitlab.com/efronlicht/blog/render"
+)
+
+func TestFrontmatter(t *testing.T) {
+	for _, tt := range []struct {
+		name, src string
+		want      render.Meta
+		body      string
+		wantErr   bool
+	}{
+		{name: "none", src: "# title\nbody\n", body: "# title\nbody\n"},
+		{name: "empty", src: "---\n---\nbody\n", body: "body\n"},
+		{
+			name: "full",
+			src:  "---\ntitle: \"Hello: World\"\ndate: 2023-06-01\ntags: [go, perf]\nsummary: a test.\n---\n# heading\n",
+			want: render.Meta{Title: "Hello: World", Date: time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC), Tags: []string{"go", "perf"}, Summary: "a test."},
+			body: "# heading\n",
+		},
+		{name: "unclosed", src: "---\ntitle: x\n# heading\n", wantErr: true},
+		{name: "unknown key", src: "---\ntitel: x\n---\n", wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			meta, body, err := render.Frontmatter([]byte(tt.src))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error: %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(meta, tt.want) {
+				t.Errorf("expected meta %+v, got %+v", tt.want, meta)
+			}
+			if string(body) != tt.body {
+				t.Errorf("expected body %q, got %q", tt.body, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package render
+
+import (
+	"crypto/md5"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"path/filepath"
+)
+
+// DefaultSiteURL is where the blog is served, for canonical URLs and og: tags when Config doesn't say otherwise.
+const DefaultSiteURL = "https://eblog.fly.dev"
+
+//go:embed layout.html
+var layoutHTML string
+
+// DefaultSum is the md5 of what every article's HTML is made of besides its own source: the default layout and the article list.
+// cmd/rendermd uses it to tell when a cached render is stale.
+var DefaultSum = md5.Sum([]byte(layoutHTML + string(articlelist)))
+
+// Page is what a layout's templates get: the article's metadata, its rendered body, and where it's served.
+type Page struct {
+	Meta
+	Body      template.HTML // the rendered article, already highlighted.
+	Site      string        // the site's URL, without a trailing slash: i.e, https://eblog.fly.dev.
+	Canonical string        // the article's URL: i.e, https://eblog.fly.dev/quirks.html.
+}
+
+// ParseLayout parses the default layout, then every *.html file in dir over it.
+// A file that {{define}}s "head", "header", "nav", or "footer" replaces just that part of the page;
+// one that defines "layout" replaces the whole thing. Each gets a Page.
+func ParseLayout(dir string) (*template.Template, error) {
+	t, err := parseDefaultLayout().ParseGlob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return nil, fmt.Errorf("parsing layout in %s: %w", dir, err)
+	}
+	return t, nil
+}
+
+// defaultLayout is the layout used when Config doesn't have one.
+var defaultLayout = parseDefaultLayout()
+
+// parseDefaultLayout parses the embedded layout.html. ParseLayout needs its own copy: an html/template can't be redefined once it's executed.
+func parseDefaultLayout() *template.Template {
+	return template.Must(template.New("layout.html").Parse(layoutHTML))
+}
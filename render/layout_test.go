@@ -0,0 +1,77 @@
+package render_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitlab.com/efronlicht/blog/render"
+)
+
+func TestArticleLayout(t *testing.T) {
+	dir := t.TempDir()
+	md := filepath.Join(dir, "hello.md")
+	src := "---\ntitle: Hello & Goodbye\ndate: 2023-06-01\ntags: [go]\nsummary: a \"test\".\n---\n# heading\n\n```go\nfunc main() {}\n```\n"
+	if err := os.WriteFile(md, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, meta, err := render.Article(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Name != "hello.html" {
+		t.Errorf("expected name hello.html, got %q", meta.Name)
+	}
+	if meta.Words != 4 || meta.Minutes != 1 { // heading func main() {}
+		t.Errorf("expected 4 words and 1 minute, got %d and %d", meta.Words, meta.Minutes)
+	}
+	page := string(out)
+	for _, want := range []string{
+		"<title>Hello &amp; Goodbye</title>",
+		`<link rel="canonical" href="https://eblog.fly.dev/hello.html"/>`,
+		`<meta property="og:title" content="Hello &amp; Goodbye"/>`,
+		`<meta property="og:description" content="a &#34;test&#34;."/>`,
+		`<meta property="article:published_time" content="2023-06-01"/>`,
+		`<meta property="article:tag" content="go"/>`,
+		`<time datetime="2023-06-01">Jun 2023</time>`,
+		`<h1>heading</h1><p class="reading-time">4 words · 1 min read</p>`,
+		`<span class="kwd">func</span>`, // highlighted.
+		"<footer>",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected page to contain %s, got\n%s", want, page)
+		}
+	}
+	if n := strings.Count(page, "<body>"); n != 1 {
+		t.Errorf("expected one <body>, got %d", n)
+	}
+
+	// override just the footer, on another site.
+	layoutDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(layoutDir, "footer.html"), []byte(`{{define "footer"}}<footer>bye from {{.Site}}</footer>{{end}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	layout, err := render.ParseLayout(layoutDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _, err = render.ArticleWithConfig(md, render.Config{Layout: layout, SiteURL: "http://localhost:8080/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page = string(out)
+	for _, want := range []string{"<footer>bye from http://localhost:8080</footer>", `href="http://localhost:8080/hello.html"`, "<h1>heading</h1>"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected page with custom footer to contain %s, got\n%s", want, page)
+		}
+	}
+	if strings.Contains(page, "more articles") {
+		t.Errorf("expected the default footer to be replaced, got\n%s", page)
+	}
+
+	if _, err := render.ParseLayout(t.TempDir()); err == nil {
+		t.Error("expected an error for a layout directory with no templates")
+	}
+}
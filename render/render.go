@@ -0,0 +1,130 @@
+// Package render turns the blog's markdown articles into HTML.
+// It's shared by cmd/rendermd, which renders everything ahead of time,
+// and the server's dev mode, which renders articles on demand as they change.
+package render
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/html"
+	"github.com/gomarkdown/markdown/parser"
+	"github.com/sourcegraph/syntaxhighlight"
+)
+
+var findtitleRE = regexp.MustCompile(`^# (.+)`) // like # Golang Quirks & Intermediate Tricks, Pt 1: Declarations, Control Flow, & Typesystem
+
+//go:embed article_list.md
+var articlelist []byte
+
+// Config configures ArticleWithConfig. The zero Config renders with the default layout, for DefaultSiteURL.
+type Config struct {
+	Layout     *template.Template // executed as "layout" with a Page: see ParseLayout. nil means the default, layout.html.
+	SiteURL    string             // where the site is served, for canonical URLs and og: tags. Empty means DefaultSiteURL.
+	Extensions Extensions         // optional markdown syntax: see Extensions.
+}
+
+// wordsPerMinute is how fast ReadingMinutes assumes you read: slowish, since the articles are technical.
+const wordsPerMinute = 200
+
+// ReadingMinutes is about how many minutes it takes to read words words: at least one.
+func ReadingMinutes(words int) int { return max(1, (words+wordsPerMinute/2)/wordsPerMinute) }
+
+// Markdown reads the markdown file at path and renders it as HTML, syntax-highlighting any fenced code blocks.
+func Markdown(path string) ([]byte, error) {
+	out, _, err := Article(path)
+	return out, err
+}
+
+// Article is Markdown, also returning the article's metadata: see Meta.
+// A title missing from the frontmatter comes from the first '# heading', or failing that, the file name.
+func Article(path string) ([]byte, Meta, error) { return ArticleWithConfig(path, Config{}) }
+
+// ArticleWithConfig is Article, laid out as cfg says.
+func ArticleWithConfig(path string, cfg Config) ([]byte, Meta, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, Meta{}, err
+	}
+	meta, b, err := Frontmatter(markdown.NormalizeNewlines(src))
+	if err != nil {
+		return nil, Meta{}, fmt.Errorf("%s: %w", path, err)
+	}
+	meta.Name = strings.TrimSuffix(filepath.Base(path), ".md") + ".html"
+	if meta.Title == "" {
+		if match := findtitleRE.FindSubmatch(b); len(match) > 1 {
+			meta.Title = strings.TrimSpace(string(match[1])) // use title from markdown
+		} else {
+			meta.Title = strings.TrimSuffix(filepath.Base(path), ".md") // default to filename
+		}
+	}
+
+	const placeholder = `<<article list placeholder>>`
+	b = bytes.ReplaceAll(b, []byte(placeholder), articlelist)
+
+	// just the article: the layout makes the rest of the page.
+	flags := html.CommonFlags
+	if cfg.Extensions&Footnotes != 0 {
+		flags |= html.FootnoteReturnLinks
+	}
+	out := markdown.ToHTML(b, parser.NewWithExtensions(cfg.Extensions.parserExtensions()), html.NewRenderer(html.RendererOptions{Flags: flags}))
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(out))
+	if err != nil {
+		return nil, Meta{}, fmt.Errorf("parsing rendered html for %s: %w", path, err)
+	}
+	cfg.Extensions.rewrite(doc)
+	// find code-parts via css selector and replace them with highlighted versions
+	doc.Find("code[class*=\"language-\"]").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		var highlighted []byte
+		highlighted, err = syntaxhighlight.AsHTML([]byte(s.Text()))
+		if err != nil {
+			return false
+		}
+		s.SetHtml(string(highlighted))
+		return true
+	})
+	if err != nil {
+		return nil, Meta{}, fmt.Errorf("highlighting code in %s: %w", path, err)
+	}
+	article := doc.Find("body") // goquery wraps the fragment in <html><head></head><body>.
+	meta.Words = len(strings.Fields(article.Text()))
+	meta.Minutes = ReadingMinutes(meta.Words)
+
+	layout, site := cfg.Layout, strings.TrimSuffix(cfg.SiteURL, "/")
+	if layout == nil {
+		layout = defaultLayout
+	}
+	if site == "" {
+		site = DefaultSiteURL
+	}
+	page := Page{Meta: meta, Site: site, Canonical: site + "/" + meta.Name}
+	var buf bytes.Buffer
+	if t := layout.Lookup("readingtime"); t != nil { // goes under the title: see layout.html.
+		if err := t.Execute(&buf, page); err != nil {
+			return nil, Meta{}, fmt.Errorf("laying out %s: %w", path, err)
+		}
+		if h1 := article.Find("h1").First(); h1.Length() > 0 {
+			h1.AfterHtml(buf.String())
+		} else {
+			article.PrependHtml(buf.String())
+		}
+		buf.Reset()
+	}
+	body, err := article.Html()
+	if err != nil {
+		return nil, Meta{}, fmt.Errorf("serializing html for %s: %w", path, err)
+	}
+	page.Body = template.HTML(body)
+	if err := layout.ExecuteTemplate(&buf, "layout", page); err != nil {
+		return nil, Meta{}, fmt.Errorf("laying out %s: %w", path, err)
+	}
+	return buf.Bytes(), meta, nil
+}
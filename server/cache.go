@@ -0,0 +1,71 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"path"
+	"strings"
+)
+
+//go:embed cache.txt
+var defaultCachePolicy string
+
+// cachePolicy maps file name patterns to Cache-Control directives. The first matching rule wins.
+type cachePolicy []cacheRule
+
+type cacheRule struct{ pattern, directives string }
+
+// parseCachePolicy parses rules like
+//
+//	# comment
+//	*.woff2	public, max-age=604800, immutable
+//	*	no-cache
+//
+// one per line or separated by ';'.
+func parseCachePolicy(s string) (cachePolicy, error) {
+	var cp cachePolicy
+	for i, line := range splitRules(s) {
+		sep := strings.IndexAny(line, " \t")
+		if sep < 0 || strings.TrimSpace(line[sep:]) == "" {
+			return nil, fmt.Errorf("cache policy rule %d: %q: expected PATTERN DIRECTIVES", i, line)
+		}
+		pattern, directives := line[:sep], strings.TrimSpace(line[sep:])
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("cache policy rule %d: bad pattern %q: %w", i, pattern, err)
+		}
+		cp = append(cp, cacheRule{pattern: pattern, directives: directives})
+	}
+	return cp, nil
+}
+
+// directives returns the Cache-Control value for the file at urlPath, or "no-cache" if no rule matches.
+func (cp cachePolicy) directives(urlPath string) string {
+	name := path.Base(urlPath)
+	for _, rule := range cp {
+		if ok, _ := path.Match(rule.pattern, name); ok {
+			return rule.directives
+		}
+	}
+	return "no-cache"
+}
+
+// splitRules splits a table like cache.txt or redirects.txt into its rules: one per line or separated by ';',
+// trimmed, skipping blank lines and '#' comments. A comment starts at a '#' at the start of a line or after whitespace,
+// so a URL fragment like /a.html#b isn't one, and runs to the end of the line, so it can contain ';'.
+func splitRules(s string) []string {
+	var rules []string
+	for _, line := range strings.Split(s, "\n") {
+		for i := range line {
+			if line[i] == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+				line = line[:i]
+				break
+			}
+		}
+		for _, rule := range strings.Split(line, ";") {
+			if rule = strings.TrimSpace(rule); rule != "" {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	return rules
+}
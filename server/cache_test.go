@@ -0,0 +1,28 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitRules(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"a 1\nb 2", []string{"a 1", "b 2"}},
+		{"a 1; b 2;;", []string{"a 1", "b 2"}},
+		{"  a 1  \n\n\t\n", []string{"a 1"}},
+		{"# whole line; not a rule\na 1", []string{"a 1"}},
+		{"\t# indented\na 1", []string{"a 1"}},
+		{"a 1 # trailing; not a rule\nb 2", []string{"a 1", "b 2"}},
+		{"a 1\t# after a tab", []string{"a 1"}},
+		{"/old.html /new.html#section 301", []string{"/old.html /new.html#section 301"}}, // a fragment, not a comment.
+		{"a 1; b 2 # the rest; of the line", []string{"a 1", "b 2"}},
+	} {
+		if got := splitRules(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitRules(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"gitlab.com/efronlicht/blog/render"
+	"go.uber.org/zap"
+)
+
+// devServer serves articles straight from their markdown sources instead of the embedded assets.zip,
+// re-rendering each one whenever it changes on disk. Everything else (css, fonts, images) comes from staticDir.
+// It's meant for writing articles, not for production: start the server with DEV=1.
+type devServer struct {
+	srcDir    string
+	staticDir string        // not watched, even if it's inside srcDir: we'd see our own output.
+	cfg       render.Config // how to render: i.e, with which markdown extensions.
+	static    http.Handler
+	logger    *zap.Logger
+	mu        sync.RWMutex
+	sources   map[string]string // rendered name -> markdown path; e.g, "quirks.html" -> "/home/efron/blog/articles/quirks/quirks.md"
+	rendered  map[string][]byte // rendered name -> html, lazily filled
+	renderErr map[string]error  // rendered name -> error from the last render, if any
+}
+
+// newDevServer scans srcDir for markdown files and watches their directories for changes until ctx is done. It renders them as cfg says.
+func newDevServer(ctx context.Context, logger *zap.Logger, srcDir, staticDir string, cfg render.Config) (*devServer, error) {
+	srcDir, err := filepath.Abs(srcDir)
+	if err != nil {
+		return nil, err
+	}
+	staticDir, err = filepath.Abs(staticDir)
+	if err != nil {
+		return nil, err
+	}
+	ds := &devServer{
+		srcDir:    srcDir,
+		staticDir: staticDir,
+		cfg:       cfg,
+		static:    http.FileServer(http.Dir(staticDir)),
+		logger:    logger,
+		sources:   make(map[string]string),
+		rendered:  make(map[string][]byte),
+		renderErr: make(map[string]error),
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := ds.add(watcher, srcDir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	logger.Info("dev mode: serving articles from markdown", zap.String("src", srcDir), zap.String("static", staticDir), zap.Int("articles", len(ds.sources)))
+	go ds.watch(ctx, watcher)
+	return ds, nil
+}
+
+// add watches dir and every directory under it, and serves every markdown file in them.
+// fsnotify isn't recursive, so we have to add every directory ourselves: at startup, and whenever one's created.
+func (ds *devServer) add(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name := d.Name(); name == "vendor" || name == ".git" || path == ds.staticDir {
+				return fs.SkipDir
+			}
+			return watcher.Add(path)
+		}
+		if filepath.Ext(path) == ".md" {
+			ds.mu.Lock()
+			ds.sources[htmlName(path)] = path
+			delete(ds.rendered, htmlName(path)) // i.e, moved back in: render it again on next request.
+			delete(ds.renderErr, htmlName(path))
+			ds.mu.Unlock()
+		}
+		return nil
+	})
+}
+
+// forget stops serving the articles at path, or under it, if it was a directory: it was removed or renamed away.
+func (ds *devServer) forget(path string) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	for name, src := range ds.sources {
+		if src == path || strings.HasPrefix(src, path+string(filepath.Separator)) {
+			delete(ds.sources, name)
+			delete(ds.rendered, name)
+			delete(ds.renderErr, name)
+			ds.logger.Info("dev mode: removed", zap.String("src", src), zap.String("dst", name))
+		}
+	}
+}
+
+// htmlName is the name an article is served under: a/b/quirks.md -> quirks.html.
+func htmlName(mdPath string) string {
+	return strings.TrimSuffix(filepath.Base(mdPath), ".md") + ".html"
+}
+
+// watch re-renders markdown files as they're written, watches new directories, and forgets removed or renamed files. It runs until ctx is done.
+func (ds *devServer) watch(ctx context.Context, watcher *fsnotify.Watcher) {
+	defer watcher.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-watcher.Errors:
+			ds.logger.Error("dev mode: watcher error", zap.Error(err))
+		case ev := <-watcher.Events:
+			if ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) { // a rename's new name shows up as a Create, if it's somewhere we watch.
+				ds.forget(ev.Name)
+				_ = watcher.Remove(ev.Name) // if it was a directory we watched: errors if it wasn't, which is fine.
+				continue
+			}
+			if ev.Has(fsnotify.Create) {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					if err := ds.add(watcher, ev.Name); err != nil {
+						ds.logger.Error("dev mode: watching new directory", zap.String("dir", ev.Name), zap.Error(err))
+					}
+					continue
+				}
+			}
+			if filepath.Ext(ev.Name) != ".md" || !ev.Has(fsnotify.Write|fsnotify.Create) {
+				continue
+			}
+			name := htmlName(ev.Name)
+			ds.mu.Lock()
+			ds.sources[name] = ev.Name
+			ds.mu.Unlock()
+			ds.render(name, ev.Name)
+		}
+	}
+}
+
+// render renders the markdown at mdPath and caches the result under name.
+func (ds *devServer) render(name, mdPath string) ([]byte, error) {
+	b, _, err := render.ArticleWithConfig(mdPath, ds.cfg)
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if err != nil {
+		ds.logger.Error("dev mode: render failed", zap.String("src", mdPath), zap.Error(err))
+		delete(ds.rendered, name)
+		ds.renderErr[name] = err
+		return nil, err
+	}
+	ds.logger.Info("dev mode: rendered", zap.String("src", mdPath), zap.String("dst", name))
+	delete(ds.renderErr, name)
+	ds.rendered[name] = b
+	return b, nil
+}
+
+// ServeHTTP serves rendered articles, falling back to the static directory for everything else.
+func (ds *devServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(r.URL.Path, "/")
+	ds.mu.RLock()
+	mdPath, ok := ds.sources[name]
+	b, cached := ds.rendered[name]
+	err := ds.renderErr[name]
+	ds.mu.RUnlock()
+	if !ok {
+		ds.static.ServeHTTP(w, r)
+		return
+	}
+	if !cached && err == nil {
+		b, err = ds.render(name, mdPath)
+	}
+	if err != nil { // show the author what went wrong rather than a stale page.
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(b)
+}
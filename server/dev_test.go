@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gitlab.com/efronlicht/blog/render"
+	"go.uber.org/zap"
+)
+
+func TestDevServerWatch(t *testing.T) {
+	src, static := t.TempDir(), t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ds, err := newDevServer(ctx, zap.NewNop(), src, static, render.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	has := func(name string) bool {
+		ds.mu.RLock()
+		defer ds.mu.RUnlock()
+		_, ok := ds.sources[name]
+		return ok
+	}
+	eventually := func(what string, f func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); !f(); time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatal(what)
+			}
+		}
+	}
+
+	// a new directory, with an article already in it: i.e, moved in from elsewhere.
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "moved.md"), []byte("# moved\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(outside, filepath.Join(src, "new")); err != nil {
+		t.Fatal(err)
+	}
+	eventually("expected moved.html after its directory was moved into src", func() bool { return has("moved.html") })
+
+	// and a file written into it afterwards: we're watching it now.
+	if err := os.WriteFile(filepath.Join(src, "new", "later.md"), []byte("# later\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	eventually("expected later.html after writing it into the new directory", func() bool { return has("later.html") })
+
+	if err := os.Remove(filepath.Join(src, "new", "later.md")); err != nil {
+		t.Fatal(err)
+	}
+	eventually("expected later.html to be gone after removing it", func() bool { return !has("later.html") })
+	if err := os.RemoveAll(filepath.Join(src, "new")); err != nil {
+		t.Fatal(err)
+	}
+	eventually("expected moved.html to be gone after removing its directory", func() bool { return !has("moved.html") })
+}
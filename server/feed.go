@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"gitlab.com/efronlicht/blog/server/static"
+	"gitlab.com/efronlicht/blog/site"
+)
+
+// feed is a pre-rendered RSS or Atom document. Since the articles are embedded in the binary,
+// the feed can't change while we're running: we render it once at startup and serve it with a stable ETag.
+type feed struct {
+	body        []byte
+	etag        string
+	contentType string
+	built       time.Time
+}
+
+func newFeed(b []byte, contentType string, built time.Time) *feed {
+	sum := sha256.Sum256(b)
+	return &feed{body: b, etag: `"` + hex.EncodeToString(sum[:8]) + `"`, contentType: contentType, built: built}
+}
+
+// ServeHTTP serves the feed, answering conditional requests (If-None-Match, If-Modified-Since) with 304s.
+func (f *feed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Set("Content-Type", f.contentType)
+	h.Set("Cache-Control", "public, max-age=1800") // matches the RSS ttl: feed readers shouldn't poll more often than that anyways.
+	h.Set("ETag", f.etag)
+	http.ServeContent(w, r, "", f.built, bytes.NewReader(f.body))
+}
+
+// buildFeeds renders RSS 2.0 and Atom 1.0 feeds for the embedded articles: see site.RSS and site.Atom.
+// Articles without a known modification time fall back to the build time, since Atom requires one.
+// If cmd/buildsite embedded its own rss.xml or atom.xml, we serve that instead: they remember when each article was first published,
+// so they don't depend on the frontmatter having a date, but they're for the site URL it was built with.
+func buildFeeds(articles []static.Article, siteURL string, built time.Time) (rssFeed, atomFeed *feed, err error) {
+	siteURL = strings.TrimSuffix(siteURL, "/")
+	built = built.UTC().Truncate(time.Second)
+	items := make([]site.Item, len(articles))
+	for i, art := range articles {
+		link := siteURL + "/" + art.Name
+		items[i] = site.Item{Title: art.Title, Link: link, GUID: link, PubDate: art.Modified, Description: art.Summary, Categories: art.Tags}
+	}
+	b, err := site.RSS(items, siteURL, built)
+	if err != nil {
+		return nil, nil, err
+	}
+	if embedded, ok := static.ReadFile("rss.xml"); ok {
+		b = embedded
+	}
+	rssFeed = newFeed(b, "application/rss+xml; charset=utf-8", built)
+	if b, err = site.Atom(items, siteURL, built); err != nil {
+		return nil, nil, err
+	}
+	if embedded, ok := static.ReadFile("atom.xml"); ok {
+		b = embedded
+	}
+	return rssFeed, newFeed(b, "application/atom+xml; charset=utf-8", built), nil
+}
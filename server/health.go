@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"gitlab.com/efronlicht/blog/observability/meta"
+)
+
+// readiness answers /debug/readyz by running every registered check concurrently.
+// The server is ready only if all of them pass within the timeout.
+// Liveness (/debug/healthz) is much dumber: if we can answer at all, we're alive.
+type readiness struct {
+	mu      sync.Mutex
+	checks  []readinessCheck
+	timeout time.Duration
+}
+
+type readinessCheck struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// checkResult is the JSON form of a single check.
+type checkResult struct {
+	Name    string        `json:"name"`
+	Status  string        `json:"status"` // "ok", "fail", or "timeout"
+	Latency time.Duration `json:"latency_ns"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// register adds a check. fn should return promptly once ctx is done.
+func (rd *readiness) register(name string, fn func(ctx context.Context) error) {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	rd.checks = append(rd.checks, readinessCheck{name: name, fn: fn})
+}
+
+// run runs every check concurrently, returning the results in registration order.
+func (rd *readiness) run(ctx context.Context) (results []checkResult, ok bool) {
+	rd.mu.Lock()
+	checks := rd.checks
+	rd.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, rd.timeout)
+	defer cancel()
+	results = make([]checkResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		i, c := i, c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			done := make(chan error, 1)
+			go func() { done <- c.fn(ctx) }()
+			res := checkResult{Name: c.name, Status: "ok"}
+			select {
+			case err := <-done:
+				if err != nil {
+					res.Status, res.Error = "fail", err.Error()
+				}
+			case <-ctx.Done():
+				res.Status, res.Error = "timeout", ctx.Err().Error()
+			}
+			res.Latency = time.Since(start)
+			results[i] = res
+		}()
+	}
+	wg.Wait()
+	ok = true
+	for _, res := range results {
+		ok = ok && res.Status == "ok"
+	}
+	return results, ok
+}
+
+// ServeHTTP writes the results of all checks as JSON, with status 200 if they all passed and 503 otherwise.
+func (rd *readiness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	results, ok := rd.run(r.Context())
+	status, code := "ok", http.StatusOK
+	if !ok {
+		status, code = "fail", http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(struct {
+		Status string        `json:"status"`
+		Checks []checkResult `json:"checks"`
+	}{status, results})
+}
+
+// healthz is the liveness check.
+func healthz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write([]byte(`{"status": "ok"}`))
+}
+
+// checkDiskFree fails if the filesystem containing path has less than min bytes free.
+// It passes on platforms where we can't tell.
+func checkDiskFree(path string, min uint64) func(context.Context) error {
+	return func(context.Context) error {
+		free, err := meta.DiskFree(path)
+		switch {
+		case errors.Is(err, errors.ErrUnsupported):
+			return nil
+		case err != nil:
+			return err
+		case free < min:
+			return fmt.Errorf("%s: only %d bytes free, want at least %d", path, free, min)
+		}
+		return nil
+	}
+}
+
+// checkUpstream fails unless a GET to url returns a 2xx status.
+func checkUpstream(client *http.Client, url string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("GET %s: %s", url, resp.Status)
+		}
+		return nil
+	}
+}
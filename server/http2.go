@@ -0,0 +1,38 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"slices"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// configureHTTP2 turns HTTP/2 on or off for srv. Call it after setting srv.Handler and srv.TLSConfig, but before serving.
+//
+// When enabled, TLS listeners negotiate h2 via ALPN, and plaintext listeners accept h2c
+// (HTTP/2 without TLS, either by prior knowledge or by an Upgrade: h2c request) - that's what fly.io's proxy speaks to us
+// when the service sets h2_backend, since it terminates TLS itself.
+// HTTP/1.1 clients are unaffected either way.
+func configureHTTP2(srv *http.Server, enabled bool) error {
+	if !enabled {
+		// a non-nil, empty TLSNextProto is the documented way to turn off the standard library's automatic HTTP/2...
+		srv.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+		// ...but we still have to stop advertising it, or clients will negotiate h2 and then speak it to an HTTP/1.1 server.
+		// autocert's config lists "h2" explicitly.
+		if srv.TLSConfig != nil {
+			srv.TLSConfig.NextProtos = slices.DeleteFunc(slices.Clone(srv.TLSConfig.NextProtos), func(p string) bool { return p == "h2" })
+		}
+		return nil
+	}
+	h2s := &http2.Server{IdleTimeout: srv.IdleTimeout}
+	if srv.TLSConfig != nil {
+		if err := http2.ConfigureServer(srv, h2s); err != nil {
+			return err
+		}
+	}
+	// requests that already arrived over h2 (or plain HTTP/1.1) pass straight through to the handler.
+	srv.Handler = h2c.NewHandler(srv.Handler, h2s)
+	return nil
+}
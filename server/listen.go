@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"go.uber.org/zap"
+)
+
+// listener is a net.Listener, and whether to serve TLS on it.
+type listener struct {
+	name string // identifies it across restarts: see restart.go.
+	net.Listener
+	tls bool
+}
+
+// serve serves srv on each listener in its own goroutine, logging (but not returning) any error but http.ErrServerClosed or net.ErrClosed.
+// A single srv.Shutdown stops all of them.
+func serve(logger *zap.Logger, srv *http.Server, listeners ...listener) {
+	for _, l := range listeners {
+		l := l
+		logger.Info("serving", zap.String("network", l.Addr().Network()), zap.String("addr", l.Addr().String()), zap.Bool("tls", l.tls))
+		go func() {
+			var err error
+			if l.tls {
+				err = srv.ServeTLS(l, "", "") // certificates come from srv.TLSConfig, so no files here.
+			} else {
+				err = srv.Serve(l)
+			}
+			// net.ErrClosed means restart closed the listener to hand it off: see restart.go.
+			if err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
+				logger.Error("server failed", zap.String("addr", l.Addr().String()), zap.Error(err))
+			}
+		}()
+	}
+}
+
+// listenUnix listens on a unix domain socket at path with the given permissions,
+// first removing a stale socket left behind by a previous run that didn't shut down cleanly.
+// The socket file is removed again when the listener closes.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("removing stale socket: %w", err)
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
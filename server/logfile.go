@@ -0,0 +1,165 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// logFile is a zapcore.WriteSyncer that writes gzipped logs to dir/$APPNAME_$INSTANCE_ID.log.gz,
+// rotating to a new file once maxSize compressed bytes have been written and keeping at most maxFiles of them around, counting the current one.
+// Old files are matched by $APPNAME_ alone, so retention applies across restarts, not just within one instance.
+type logFile struct {
+	mu                sync.Mutex
+	dir, prefix, name string // name is the current file's path.
+	maxSize           int64
+	maxFiles          int
+	rotations         int
+
+	f       *os.File
+	gz      *gzip.Writer
+	written int64 // compressed bytes written to f
+}
+
+// openLogFile opens a new log file in dir, creating dir if necessary.
+func openLogFile(dir, appName, instanceID string, maxSize int64, maxFiles int) (*logFile, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("max log size must be > 0, but got %d", maxSize)
+	}
+	if maxFiles < 1 {
+		return nil, fmt.Errorf("max log files must be >= 1, but got %d", maxFiles)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	prefix := strings.NewReplacer("/", "-", "\\", "-").Replace(appName) + "_" // efronlicht/blog/server -> efronlicht-blog-server_
+	lf := &logFile{
+		dir:      dir,
+		prefix:   prefix,
+		name:     filepath.Join(dir, prefix+instanceID+".log.gz"),
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+	}
+	if err := lf.open(); err != nil {
+		return nil, err
+	}
+	return lf, lf.prune()
+}
+
+func (lf *logFile) open() error {
+	f, err := os.OpenFile(lf.name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	lf.f, lf.written = f, 0
+	lf.gz = gzip.NewWriter(countingWriter{f, &lf.written})
+	return nil
+}
+
+// Write implements io.Writer, rotating the file first if it's full.
+// If rotating fails, b still goes to the file we have, and we try again on the next Write.
+func (lf *logFile) Write(b []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	var rotateErr error
+	if lf.written >= lf.maxSize {
+		if err := lf.rotate(); err != nil {
+			rotateErr = fmt.Errorf("rotating log file %s: %w", lf.name, err)
+		}
+	}
+	n, err := lf.gz.Write(b)
+	return n, errors.Join(rotateErr, err)
+}
+
+// Sync flushes buffered, compressed data to disk. It implements zapcore.WriteSyncer.
+func (lf *logFile) Sync() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if err := lf.gz.Flush(); err != nil {
+		return err
+	}
+	return lf.f.Sync()
+}
+
+// Close finishes the gzip stream and closes the underlying file.
+func (lf *logFile) Close() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	return lf.close()
+}
+
+func (lf *logFile) close() error {
+	if err := lf.gz.Close(); err != nil {
+		lf.f.Close()
+		return err
+	}
+	return lf.f.Close()
+}
+
+// rotate moves the current file aside as $APPNAME_$INSTANCE_ID.$N.log.gz, starts a fresh one, and prunes old files.
+// It only closes the old file once the new one's open, so if anything fails, we can keep writing to the old one.
+func (lf *logFile) rotate() error {
+	rotated := strings.TrimSuffix(lf.name, ".log.gz") + fmt.Sprintf(".%d.log.gz", lf.rotations+1)
+	if err := os.Rename(lf.name, rotated); err != nil { // we still have it open, so we can move it out from under ourselves.
+		return err
+	}
+	f, gz := lf.f, lf.gz
+	if err := lf.open(); err != nil {
+		if undo := os.Rename(rotated, lf.name); undo != nil { // put it back, so the next rotation can try again.
+			return errors.Join(err, undo)
+		}
+		return err
+	}
+	lf.rotations++
+	err := gz.Close()
+	lf.written = 0 // the old stream's last bytes were counted as the new file's.
+	return errors.Join(err, f.Close(), lf.prune())
+}
+
+// prune removes the oldest of this app's log files until at most maxFiles remain.
+func (lf *logFile) prune() error {
+	matches, err := filepath.Glob(filepath.Join(lf.dir, lf.prefix+"*.log.gz"))
+	if err != nil {
+		return err
+	}
+	type file struct {
+		path  string
+		mtime int64
+	}
+	files := make([]file, 0, len(matches))
+	for _, m := range matches {
+		if m == lf.name {
+			continue // never remove the file we're writing to.
+		}
+		info, err := os.Stat(m)
+		if err != nil {
+			continue // removed out from under us; nothing to do.
+		}
+		files = append(files, file{m, info.ModTime().UnixNano()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].mtime < files[j].mtime }) // oldest first
+	for len(files) > lf.maxFiles-1 {
+		if err := os.Remove(files[0].path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	f *os.File
+	n *int64
+}
+
+func (cw countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.f.Write(b)
+	*cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gunzip returns the decompressed contents of the gzipped file at path.
+func gunzip(t *testing.T, path string) string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return string(b)
+}
+
+// logFiles lists the files in dir, sorted.
+func logFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func mustWrite(t *testing.T, lf *logFile, s string) {
+	t.Helper()
+	if _, err := lf.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogFileRotate(t *testing.T) {
+	dir := t.TempDir()
+	lf, err := openLogFile(dir, "efronlicht/blog/server", "abc", 1, 10) // the gzip header alone fills it: every Write after the first rotates.
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"first\n", "second\n", "third\n"} {
+		mustWrite(t, lf, s)
+	}
+	if err := lf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"efronlicht-blog-server_abc.1.log.gz": "first\n",
+		"efronlicht-blog-server_abc.2.log.gz": "second\n",
+		"efronlicht-blog-server_abc.log.gz":   "third\n",
+	}
+	if got := logFiles(t, dir); len(got) != len(want) {
+		t.Fatalf("expected %d files, got %q", len(want), got)
+	}
+	for name, content := range want {
+		if got := gunzip(t, filepath.Join(dir, name)); got != content {
+			t.Errorf("%s: expected %q, got %q", name, content, got)
+		}
+	}
+}
+
+func TestLogFilePrune(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-time.Hour)
+	for i, name := range []string{"app_oldest.log.gz", "app_older.1.log.gz", "other_app.log.gz"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, old, old.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lf, err := openLogFile(dir, "app", "new", 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Close()
+	// the current file and the newest other one of this app's, from any instance: other apps' files are left alone.
+	if got, want := strings.Join(logFiles(t, dir), ","), "app_new.log.gz,app_older.1.log.gz,other_app.log.gz"; got != want {
+		t.Errorf("after opening: expected %s, got %s", want, got)
+	}
+	mustWrite(t, lf, "a")
+	mustWrite(t, lf, "b") // rotates: app_new.1.log.gz is newer than app_older.1.log.gz, so that goes.
+	if got, want := strings.Join(logFiles(t, dir), ","), "app_new.1.log.gz,app_new.log.gz,other_app.log.gz"; got != want {
+		t.Errorf("after rotating: expected %s, got %s", want, got)
+	}
+}
+
+func TestLogFileRotateFails(t *testing.T) {
+	dir := t.TempDir()
+	lf, err := openLogFile(dir, "app", "abc", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocker := filepath.Join(dir, "app_abc.1.log.gz", "not empty")
+	if err := os.MkdirAll(blocker, 0o755); err != nil { // a non-empty directory where the rotated file should go: the rename fails.
+		t.Fatal(err)
+	}
+	mustWrite(t, lf, "first\n")
+	if _, err := lf.Write([]byte("second\n")); err == nil {
+		t.Error("expected an error rotating onto a directory")
+	}
+	if err := lf.Sync(); err != nil {
+		t.Fatalf("the log file should still be usable after a failed rotation: %v", err)
+	}
+	if err := os.RemoveAll(filepath.Dir(blocker)); err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, lf, "third\n") // rotates after all.
+	if err := lf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := gunzip(t, filepath.Join(dir, "app_abc.1.log.gz")); got != "first\nsecond\n" {
+		t.Errorf("rotated file: expected the first two lines, got %q", got)
+	}
+	if got := gunzip(t, filepath.Join(dir, "app_abc.log.gz")); got != "third\n" {
+		t.Errorf("current file: expected the third line, got %q", got)
+	}
+}
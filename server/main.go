@@ -4,6 +4,7 @@ import (
 	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -12,12 +13,20 @@ import (
 	"os/signal"
 	"os/user"
 	"runtime"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/google/uuid"
+	ginex "gitlab.com/efronlicht/blog/articles/faststack"
+	"gitlab.com/efronlicht/blog/observability/http/ratelimit"
+	"gitlab.com/efronlicht/blog/observability/http/secheaders"
+	"gitlab.com/efronlicht/blog/observability/http/timeout"
 	"gitlab.com/efronlicht/blog/observability/http/tracemw"
+	"gitlab.com/efronlicht/blog/observability/metrics"
+	"gitlab.com/efronlicht/blog/observability/trace"
+	"gitlab.com/efronlicht/blog/render"
 	"gitlab.com/efronlicht/blog/server/static"
 	"gitlab.com/efronlicht/enve"
 	"go.uber.org/zap"
@@ -36,31 +45,110 @@ func main() {
 	log.Println("successful shutdown")
 }
 
-func setupLogger() *zap.Logger {
+func setupLogger(sd *shutdown) (*zap.Logger, error) {
 	// for larger projects, especially distributed systems, we may want to use some kind of structured logging
 	// package. I like Zap and Zerolog.
-	// we'll log to standard error and a gzipped file, $APPNAME_$INSTANCE_ID.log.gz
+	// we'll log to standard error and, if LOG_DIR is set, a gzipped file, $APPNAME_$INSTANCE_ID.log.gz
 	cfg := zap.NewProductionEncoderConfig()
 	cfg.EncodeTime = zapcore.RFC3339TimeEncoder
 	cfg.EncodeLevel = zapcore.CapitalColorLevelEncoder
 	cfg.EncodeDuration = zapcore.NanosDurationEncoder
-	logger := zap.New(zapcore.NewCore(
-		zapcore.NewConsoleEncoder(cfg),
-		&zapcore.BufferedWriteSyncer{WS: os.Stderr, FlushInterval: time.Second},
-		zapcore.DebugLevel,
-	)) //
+	stderr := &zapcore.BufferedWriteSyncer{WS: os.Stderr, FlushInterval: time.Second}
+	core := zapcore.NewCore(zapcore.NewConsoleEncoder(cfg), stderr, zapcore.DebugLevel)
+
+	var file *zapcore.BufferedWriteSyncer
+	if dir := enve.StringOr("LOG_DIR", ""); dir != "" {
+		lf, err := openLogFile(dir, Meta.AppName, Meta.InstanceID, int64(enve.IntOr("LOG_MAX_SIZE", 64<<20)), enve.IntOr("LOG_MAX_FILES", 8))
+		if err != nil {
+			return nil, fmt.Errorf("opening log file: %w", err)
+		}
+		// closed after the logger is flushed, since closers run LIFO.
+		sd.register("log file", func(context.Context) error { return lf.Close() })
+		fileCfg := zap.NewProductionEncoderConfig() // no colors in the file: it's for machines.
+		fileCfg.EncodeTime = zapcore.RFC3339TimeEncoder
+		fileCfg.EncodeDuration = zapcore.NanosDurationEncoder
+		file = &zapcore.BufferedWriteSyncer{WS: lf, FlushInterval: time.Second}
+		core = zapcore.NewTee(core, zapcore.NewCore(zapcore.NewJSONEncoder(fileCfg), file, zapcore.DebugLevel))
+	}
+	logger := zap.New(core)
+	sd.register("logger", func(context.Context) error {
+		// stderr is usually a pipe or terminal, which can't be fsync'd; that's fine, we only need the buffer flushed.
+		if err := stderr.Stop(); err != nil && !errors.Is(err, syscall.EINVAL) && !errors.Is(err, syscall.ENOTTY) {
+			return err
+		}
+		if file != nil {
+			return file.Stop()
+		}
+		return nil
+	})
 	zap.ReplaceGlobals(logger)
 	zap.RedirectStdLog(logger)
 	logger.Info("initialized logger")
 	go logger.Info("metadata dump", zap.Reflect("meta", Meta))
-	return logger
+	return logger, nil
 }
 
 // Run the server.
 func Run(ctx context.Context) (err error) {
-	logger := setupLogger()
+	var sd shutdown
+	// the logger registers its closers first, so they run last: everything else gets a chance to log before we flush.
+	logger, err := setupLogger(&sd)
+	if err != nil {
+		return err
+	}
+
+	// spans go to an OpenTelemetry collector if OTEL_EXPORTER_OTLP_ENDPOINT is set; otherwise, we just log.
+	exporter := trace.OTLPExporterFromEnv(func(err error) { logger.Warn("exporting spans", zap.Error(err)) })
+	trace.SetExporter(exporter)
+	sd.register("otlp exporter", exporter.Shutdown) // nil-safe: a no-op if there's no exporter.
+
+	serveFile := static.ServeFile
+	dev := enve.BoolOr("DEV", false)
+	if dev {
+		// serve articles straight from their markdown sources, so writing one doesn't require rebuilding the binary.
+		// MARKDOWN_EXT is rendermd's -ext, so the preview matches what it'll build.
+		exts, err := render.ParseExtensions(enve.StringOr("MARKDOWN_EXT", ""))
+		if err != nil {
+			return fmt.Errorf("starting dev mode: %w", err)
+		}
+		ds, err := newDevServer(ctx, logger, enve.StringOr("DEV_SRC_DIR", "."), enve.StringOr("DEV_STATIC_DIR", "./server/static"), render.Config{Extensions: exts})
+		if err != nil {
+			return fmt.Errorf("starting dev mode: %w", err)
+		}
+		serveFile = ds.ServeHTTP
+	}
+	rssFeed, atomFeed, err := buildFeeds(static.Articles, enve.StringOr("SITE_URL", "https://eblog.fly.dev"), start)
+	if err != nil {
+		return fmt.Errorf("building feeds: %w", err)
+	}
+	cache, err := parseCachePolicy(enve.StringOr("CACHE_POLICY", defaultCachePolicy))
+	if err != nil {
+		return fmt.Errorf("parsing cache policy: %w", err)
+	}
+	redirects, err := parseRedirects(enve.StringOr("REDIRECTS", defaultRedirects))
+	if err != nil {
+		return fmt.Errorf("parsing redirects: %w", err)
+	}
+	searchIndex := newSearchIndex(static.Articles)
 
-	defer logger.Sync()
+	ready := &readiness{timeout: enve.DurationOr("READY_TIMEOUT", time.Second)}
+	ready.register("static assets", func(context.Context) error {
+		if len(static.FS.File) == 0 {
+			return errors.New("no embedded assets")
+		}
+		return nil
+	})
+	ready.register("search index", func(context.Context) error { _, err := searchIndex.Get(); return err })
+	ready.register("disk", checkDiskFree(enve.StringOr("LOG_DIR", "."), uint64(enve.IntOr("READY_MIN_DISK_FREE", 64<<20))))
+	if upstreams := enve.StringOr("READY_UPSTREAMS", ""); upstreams != "" { // comma-separated URLs we depend on.
+		client := &http.Client{Timeout: ready.timeout}
+		for _, u := range strings.Split(upstreams, ",") {
+			u = strings.TrimSpace(u)
+			ready.register("upstream "+u, checkUpstream(client, u))
+		}
+	}
+
+	pprof := pprofHandler(enve.StringOr("PPROF_USER", ""), enve.StringOr("PPROF_PASSWORD", ""))
 	var router http.Handler // build router.
 	{
 		// a router just maps requests to responses.
@@ -69,6 +157,8 @@ func Run(ctx context.Context) (err error) {
 		router = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			p := strings.TrimSuffix(r.URL.Path, "/")
 			switch {
+			case p == "/debug/pprof" || strings.HasPrefix(p, "/debug/pprof/"): // before the method check: pprof's symbol lookup uses POST.
+				pprof.ServeHTTP(w, r)
 			case r.Method != "GET":
 				w.WriteHeader(http.StatusMethodNotAllowed)
 			case p == "/debug/uptime":
@@ -79,28 +169,65 @@ func Run(ctx context.Context) (err error) {
 				_, _ = fmt.Fprintf(w, "%2dd %02dh %02dm %02ds", int(d/DAY), int(d/HOUR)%24, int(d/MIN)%60, int(d)%60)
 			case p == "/debug/meta":
 				_, _ = w.Write(metaJSON)
+			case p == "/debug/metrics": // recorded by tracemw.Server: request durations and counts by status class.
+				metrics.Default.ServeHTTP(w, r)
+			case p == "/debug/healthz":
+				healthz(w, r)
+			case p == "/debug/readyz":
+				ready.ServeHTTP(w, r)
+			case p == "/rss.xml":
+				rssFeed.ServeHTTP(w, r)
+			case p == "/atom.xml":
+				atomFeed.ServeHTTP(w, r)
+			case p == "/articles":
+				static.ServeListing(w, r)
+			case p == "/search":
+				searchHandler(searchIndex)(w, r)
 			case p == "":
 				http.Redirect(w, r, "./index.html", http.StatusPermanentRedirect)
+			case redirects.serve(w, r): // moved or renamed: see redirects.txt
 			default:
-				// fonts are immutable and large, so we can cache them for a long time.~
-				// everything else is tiny and might change, so we don't cache it.
-				if strings.Contains(r.URL.Path, ".woff2") {
-					r.Header.Add("cache-control", "immutable")
-					r.Header.Add("cache-control", "max-age=604800")
-					r.Header.Add("cache-control", "public")
-				} else {
-					r.Header.Add("cache-control", "no-cache")
-				}
-				static.ServeFile(w, r)
+				w.Header().Set("Cache-Control", cache.directives(r.URL.Path)) // see cache.txt
+				serveFile(w, r)
 			}
 		})
 		// apply middleware. middleware executes Last-In, First-Out.
-		router = tracemw.Server(router, logger)
+		if dev { // a panic shows its stack, source and all, in the browser. never in production: that's our source.
+			router = ginex.RecoveryHandlerWithConfig(router, ginex.RecoveryConfig{Debug: true})
+		}
+		router = secheaders.Server(router, secheaders.Default().
+			CSPOverrides(enve.StringOr("CSP_OVERRIDES", "")). // i.e, "img-src 'self' https://images.example.com; script-src 'self'"
+			HSTS(enve.DurationOr("HSTS_MAX_AGE", 365*24*time.Hour), false, false))
+		// rate limits are off unless configured: 0 RPS means unlimited, and 0 burst means a second's worth of RPS (see ratelimit.Limit).
+		router = ratelimit.Server(router, ratelimit.Config{
+			Global:   ratelimit.Limit{RPS: enve.FloatOr("RATE_LIMIT_GLOBAL_RPS", 0), Burst: enve.IntOr("RATE_LIMIT_GLOBAL_BURST", 0)},
+			PerIP:    ratelimit.Limit{RPS: enve.FloatOr("RATE_LIMIT_RPS", 0), Burst: enve.IntOr("RATE_LIMIT_BURST", 0)},
+			IPHeader: enve.StringOr("RATE_LIMIT_IP_HEADER", ""), // Fly-Client-IP, on fly.io
+		})
+		// off unless configured: static files are served straight from memory, so the timeout mostly matters for search.
+		if d := enve.DurationOr("REQUEST_TIMEOUT", 0); d > 0 {
+			router = timeout.Server(router, d, logger)
+		}
+		// successful requests that aren't sampled aren't logged, and those on a skipped path are logged at Debug: i.e, TRACE_LOG_SAMPLE=0.1 TRACE_LOG_SKIP_PATHS=/debug/uptime,/debug/healthz
+		// with TRACE_SAMPLE_PARENT, a caller that already made a sampling decision makes it for us, too.
+		logCfg := tracemw.LogConfig{SampleRate: enve.FloatOr("TRACE_LOG_SAMPLE", 1), ParentBased: enve.BoolOr("TRACE_SAMPLE_PARENT", false)}
+		if paths := enve.StringOr("TRACE_LOG_SKIP_PATHS", ""); paths != "" {
+			for _, p := range strings.Split(paths, ",") {
+				logCfg.QuietPaths = append(logCfg.QuietPaths, strings.TrimSpace(p))
+			}
+		}
+		router = tracemw.ServerWithLogConfig(router, logger, logCfg)
 
 	}
 
+	port := enve.IntOr("PORT", 8080)
+	tlsConfig, redirect, err := setupTLS(logger, port)
+	if err != nil {
+		return fmt.Errorf("configuring tls: %w", err)
+	}
 	server := http.Server{
-		Addr:         fmt.Sprintf(":%04d", enve.IntOr("PORT", 8080)),
+		Addr:         fmt.Sprintf(":%04d", port),
+		TLSConfig:    tlsConfig,
 		Handler:      router,
 		ReadTimeout:  enve.DurationOr("READ_TIMEOUT", 2*time.Second),
 		WriteTimeout: enve.DurationOr("WRITE_TIMEOUT", 5*time.Second),
@@ -109,15 +236,85 @@ func Run(ctx context.Context) (err error) {
 		BaseContext: func(_ net.Listener) context.Context { return ctx },
 	}
 
+	if err := configureHTTP2(&server, enve.BoolOr("HTTP2", true)); err != nil {
+		return fmt.Errorf("configuring http/2: %w", err)
+	}
+
+	// bind everything up front, so a port that's already in use is an error rather than a log line.
+	// if we're replacing an older process (see restart.go), we take over its sockets instead.
+	// the TCP listener speaks TLS if it's configured; the unix socket never does, since it sits behind a local reverse proxy.
+	ho, err := inheritHandoff()
+	if err != nil {
+		return err
+	}
+	tcp, err := ho.listen("tcp", func() (net.Listener, error) { return net.Listen("tcp", server.Addr) })
+	if err != nil {
+		return err
+	}
+	listeners := []listener{{name: "tcp", Listener: tcp, tls: tlsConfig != nil}}
+	if path := enve.StringOr("UNIX_SOCKET", ""); path != "" {
+		unix, err := ho.listen("unix", func() (net.Listener, error) {
+			return listenUnix(path, os.FileMode(enve.IntOr("UNIX_SOCKET_MODE", 0o660)))
+		})
+		if err != nil {
+			tcp.Close()
+			return fmt.Errorf("listening on unix socket: %w", err)
+		}
+		listeners = append(listeners, listener{name: "unix", Listener: unix})
+	}
+	handoffs := slices.Clone(listeners)                                                     // everything we'd pass on to a new process on restart.
+	if httpPort := enve.IntOr("HTTP_REDIRECT_PORT", 0); tlsConfig != nil && httpPort != 0 { // plain http just sends you to https.
+		redirectServer := &http.Server{
+			Addr:         fmt.Sprintf(":%04d", httpPort),
+			Handler:      tracemw.Server(redirect, logger),
+			ReadTimeout:  server.ReadTimeout,
+			WriteTimeout: server.WriteTimeout,
+			IdleTimeout:  server.IdleTimeout,
+			BaseContext:  server.BaseContext,
+		}
+		l, err := ho.listen("redirect", func() (net.Listener, error) { return net.Listen("tcp", redirectServer.Addr) })
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return fmt.Errorf("listening for http->https redirects: %w", err)
+		}
+		rl := listener{name: "redirect", Listener: l}
+		handoffs = append(handoffs, rl)
+		serve(logger, redirectServer, rl)
+		sd.register("http redirect server", redirectServer.Shutdown)
+	}
+
 	logger.Sugar().Infof("took %s to start", time.Since(start))
-	logger.Info("serving http", zap.String("addr", server.Addr))
-	go server.ListenAndServe()
-	<-ctx.Done() // wait for (ctrl+c)
+	serve(logger, &server, listeners...)
+	sd.register("http server", server.Shutdown)
+	if err := ho.notifyReady(); err != nil {
+		logger.Error("failed to notify previous process that we're ready", zap.Error(err))
+	}
 
-	logger.Debug(fmt.Sprintf("%V: shutting down server in %s", ctx.Err(), 2*time.Second))
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	// wait for (ctrl+c), or a SIGHUP asking us to hand off to a new copy of ourselves.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	timeout := enve.DurationOr("SHUTDOWN_TIMEOUT", 2*time.Second)
+wait:
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Debug(fmt.Sprintf("%v: shutting down in %s", ctx.Err(), timeout))
+			break wait
+		case <-hup:
+			if err := restart(logger, handoffs, enve.DurationOr("RESTART_TIMEOUT", 10*time.Second)); err != nil {
+				logger.Error("restart failed: still serving", zap.Error(err))
+				continue
+			}
+			logger.Info(fmt.Sprintf("restart: new process is serving: shutting down in %s", timeout))
+			break wait
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-	return server.Shutdown(ctx)
+	return sd.run(ctx, logger)
 }
 
 var (
@@ -0,0 +1,25 @@
+package main
+
+import "sync"
+
+// nonblocking[T] is a lazy-initialized value of type T. See articles/startfast for the whole story.
+// build a nonblocking[T] with newEager[T]()
+type nonblocking[T any] struct {
+	once sync.Once         // guards initialization
+	val  T                 // result of initialization, once initialized
+	err  error             // error from initialization, once initialized
+	fn   func() (T, error) // initializing function, called with Once().
+}
+
+// initialize the nonblocking[T] by evaluating fn() and storing the result.
+func (nb *nonblocking[T]) initialize() { nb.once.Do(func() { nb.val, nb.err = nb.fn() }) }
+
+// newEager returns a *nonblocking[T] that will be initialized immediately in its own goroutine.
+func newEager[T any](f func() (T, error)) *nonblocking[T] {
+	nb := &nonblocking[T]{fn: f}
+	go nb.initialize()
+	return nb
+}
+
+// Get returns the value of the nonblocking[T], initializing it if necessary.
+func (nb *nonblocking[T]) Get() (T, error) { nb.initialize(); return nb.val, nb.err }
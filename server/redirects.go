@@ -0,0 +1,68 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//go:embed redirects.txt
+var defaultRedirects string
+
+// redirects maps old paths (without a trailing slash) to where they live now.
+type redirects map[string]redirect
+
+type redirect struct {
+	to   string
+	code int // http.StatusMovedPermanently or http.StatusFound
+}
+
+// parseRedirects parses rules like
+//
+//	# comment
+//	/oldname.html	/newname.html
+//	/draft.html	/index.html	302
+//
+// one per line or separated by ';'.
+func parseRedirects(s string) (redirects, error) {
+	rd := make(redirects)
+	for i, line := range splitRules(s) {
+		fields := strings.Fields(line)
+		if len(fields) != 2 && len(fields) != 3 {
+			return nil, fmt.Errorf("redirect %d: %q: expected FROM TO [CODE]", i, line)
+		}
+		from, r := fields[0], redirect{to: fields[1], code: http.StatusMovedPermanently}
+		if !strings.HasPrefix(from, "/") {
+			return nil, fmt.Errorf("redirect %d: %q: FROM must be an absolute path", i, line)
+		}
+		if len(fields) == 3 {
+			code, err := strconv.Atoi(fields[2])
+			if err != nil || (code != http.StatusMovedPermanently && code != http.StatusFound) {
+				return nil, fmt.Errorf("redirect %d: %q: CODE must be 301 or 302", i, line)
+			}
+			r.code = code
+		}
+		from = strings.TrimSuffix(from, "/")
+		if _, ok := rd[from]; ok {
+			return nil, fmt.Errorf("redirect %d: duplicate redirect from %s", i, from)
+		}
+		rd[from] = r
+	}
+	return rd, nil
+}
+
+// serve redirects the request if there's a rule for it, reporting whether it did.
+func (rd redirects) serve(w http.ResponseWriter, r *http.Request) bool {
+	target, ok := rd[strings.TrimSuffix(r.URL.Path, "/")]
+	if !ok {
+		return false
+	}
+	to := target.to
+	if r.URL.RawQuery != "" && !strings.Contains(to, "?") {
+		to += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, to, target.code)
+	return true
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Zero-downtime restarts work like this:
+//   - on SIGHUP, the old process starts a new copy of its own binary, passing it every listening socket as an extra file
+//     (fd 3 onwards, named in RESTART_FDS) and the write end of a pipe (RESTART_READY_FD).
+//   - the new process picks those sockets up instead of binding its own, starts serving, and writes a byte to the pipe.
+//   - only then does the old process shut down gracefully, finishing its in-flight requests.
+//
+// Both processes share the same sockets the whole time, so connections that arrive during the handoff just wait in the kernel's accept queue
+// rather than being refused. If the new process fails to start, the old one keeps serving.
+
+// handoff holds what this process inherited from the one it replaced, if anything.
+type handoff struct {
+	listeners map[string]net.Listener // by name; see listener.name.
+	ready     *os.File                // write a byte here once we're serving; nil if we weren't started by restart.
+}
+
+// inheritHandoff picks up the listeners and readiness pipe passed by restart, if any.
+// It clears the environment variables involved, so they don't leak into anything we start ourselves.
+func inheritHandoff() (*handoff, error) {
+	h := &handoff{listeners: make(map[string]net.Listener)}
+	names, readyFD := os.Getenv("RESTART_FDS"), os.Getenv("RESTART_READY_FD")
+	os.Unsetenv("RESTART_FDS")
+	os.Unsetenv("RESTART_READY_FD")
+	if names != "" {
+		for i, name := range strings.Split(names, ":") {
+			f := os.NewFile(uintptr(3+i), name)
+			l, err := net.FileListener(f) // dups the fd...
+			f.Close()                     // ...so we close the original.
+			if err != nil {
+				return nil, fmt.Errorf("inheriting listener %q from fd %d: %w", name, 3+i, err)
+			}
+			if ul, ok := l.(*net.UnixListener); ok {
+				ul.SetUnlinkOnClose(true) // it's ours to clean up now, like one from listenUnix.
+			}
+			h.listeners[name] = l
+		}
+	}
+	if readyFD != "" {
+		fd, err := strconv.Atoi(readyFD)
+		if err != nil {
+			return nil, fmt.Errorf("bad RESTART_READY_FD %q: %w", readyFD, err)
+		}
+		h.ready = os.NewFile(uintptr(fd), "ready")
+	}
+	return h, nil
+}
+
+// listen returns the inherited listener with the given name, or calls listen to make a new one if there isn't one.
+func (h *handoff) listen(name string, listen func() (net.Listener, error)) (net.Listener, error) {
+	if l, ok := h.listeners[name]; ok {
+		delete(h.listeners, name)
+		return l, nil
+	}
+	return listen()
+}
+
+// notifyReady tells the process we replaced that we're serving, so it can shut down.
+// Any listeners we inherited but didn't use (i.e, because the configuration changed) are closed.
+func (h *handoff) notifyReady() error {
+	for name, l := range h.listeners {
+		l.Close()
+		delete(h.listeners, name)
+	}
+	if h.ready == nil {
+		return nil
+	}
+	defer h.ready.Close()
+	_, err := h.ready.Write([]byte{1})
+	h.ready = nil
+	return err
+}
+
+// restart starts a new copy of this process, handing it listeners, and waits up to timeout for it to start serving.
+// On success, the caller should shut down gracefully; on failure, the new process has been killed, and the caller should carry on as before.
+func restart(logger *zap.Logger, listeners []listener, timeout time.Duration) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("finding executable: %w", err)
+	}
+	files := make([]*os.File, 0, len(listeners)+1)
+	defer func() {
+		for _, f := range files {
+			f.Close() // the new process has its own copies.
+		}
+	}()
+	names := make([]string, len(listeners))
+	for i, l := range listeners {
+		fl, ok := l.Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("listener %q (%T) can't be handed off", l.name, l.Listener)
+		}
+		f, err := fl.File()
+		if err != nil {
+			return fmt.Errorf("listener %q: %w", l.name, err)
+		}
+		files = append(files, f)
+		names[i] = l.name
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	files = append(files, w)
+
+	env := append(os.Environ(), "RESTART_FDS="+strings.Join(names, ":"), "RESTART_READY_FD="+strconv.Itoa(3+len(listeners)))
+	p, err := os.StartProcess(exe, os.Args, &os.ProcAttr{Env: env, Files: append([]*os.File{os.Stdin, os.Stdout, os.Stderr}, files...)})
+	if err != nil {
+		return fmt.Errorf("starting new process: %w", err)
+	}
+	w.Close() // so that if the new process dies, we see EOF instead of waiting for the timeout.
+	logger.Info("restart: started new process; waiting for it to serve", zap.Int("pid", p.Pid))
+
+	_ = r.SetReadDeadline(time.Now().Add(timeout))
+	if _, err := r.Read(make([]byte, 1)); err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			err = fmt.Errorf("not serving after %s", timeout)
+		}
+		_ = p.Kill()
+		_, _ = p.Wait()
+		return fmt.Errorf("new process %d: %w", p.Pid, err)
+	}
+	// stop accepting, so every new connection goes to the new process.
+	// (don't delete the unix socket out from under it when we close ours.)
+	for _, l := range listeners {
+		if ul, ok := l.Listener.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+		l.Close()
+	}
+	// http.Server.Shutdown drops connections that haven't finished sending their first request yet,
+	// so give the ones we just accepted a moment to do so before the caller shuts down.
+	time.Sleep(handoffGrace)
+	return p.Release()
+}
+
+// handoffGrace is how long restart waits between closing the old process's listeners and returning.
+const handoffGrace = 250 * time.Millisecond
@@ -0,0 +1,235 @@
+// Package search is a tiny full-text search engine for the blog's articles.
+// It builds an inverted index (term -> documents) once, then ranks matches by TF-IDF.
+// There are only a couple dozen articles, so everything lives in memory and there's no need for anything fancier.
+package search
+
+import (
+	"bytes"
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// Document is a single searchable page.
+type Document struct {
+	Path  string // like "/quirks.html"
+	Title string
+	Text  string // plain text, with markup already stripped: see TextFromHTML.
+}
+
+// Result is a single search hit, best first.
+type Result struct {
+	Title   string  `json:"title"`
+	Path    string  `json:"path"`
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet"` // HTML-escaped text around the first match, with matched terms wrapped in <mark>.
+}
+
+// Index is an inverted index over a fixed set of documents. It's safe for concurrent use once built.
+type Index struct {
+	docs     []Document
+	lengths  []int                // number of terms in each document
+	postings map[string][]posting // term -> documents containing it, in document order
+}
+
+type posting struct {
+	doc, count int
+}
+
+// New indexes docs.
+func New(docs []Document) *Index {
+	ix := &Index{docs: docs, lengths: make([]int, len(docs)), postings: make(map[string][]posting)}
+	for i, d := range docs {
+		counts := make(map[string]int)
+		for _, tok := range tokenize(d.Title + " " + d.Text) {
+			counts[tok.term]++
+			ix.lengths[i]++
+		}
+		for term, n := range counts {
+			ix.postings[term] = append(ix.postings[term], posting{doc: i, count: n})
+		}
+	}
+	return ix
+}
+
+// Search returns up to limit documents matching any of the terms in q, ranked by TF-IDF.
+func (ix *Index) Search(q string, limit int) []Result {
+	terms := uniqueTerms(q)
+	scores := make(map[int]float64)
+	for _, term := range terms {
+		ps := ix.postings[term]
+		if len(ps) == 0 {
+			continue
+		}
+		idf := math.Log(1 + float64(len(ix.docs))/float64(len(ps)))
+		for _, p := range ps {
+			tf := float64(p.count) / float64(ix.lengths[p.doc])
+			scores[p.doc] += tf * idf
+		}
+	}
+	results := make([]Result, 0, len(scores))
+	for i, score := range scores {
+		d := ix.docs[i]
+		results = append(results, Result{Title: d.Title, Path: d.Path, Score: score, Snippet: snippet(d.Text, terms)})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Path < results[j].Path // deterministic order for ties
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// token is a normalized term and its byte offsets in the original text.
+type token struct {
+	term       string
+	start, end int
+}
+
+// tokenize splits s into lowercase words of two or more letters or digits.
+func tokenize(s string) []token {
+	var toks []token
+	start := -1
+	for i, r := range s {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case isWord && start < 0:
+			start = i
+		case !isWord && start >= 0:
+			toks = appendToken(toks, s, start, i)
+			start = -1
+		}
+	}
+	if start >= 0 {
+		toks = appendToken(toks, s, start, len(s))
+	}
+	return toks
+}
+
+func appendToken(toks []token, s string, start, end int) []token {
+	if end-start < 2 {
+		return toks // single letters are noise.
+	}
+	return append(toks, token{term: strings.ToLower(s[start:end]), start: start, end: end})
+}
+
+func uniqueTerms(q string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, tok := range tokenize(q) {
+		if !seen[tok.term] {
+			seen[tok.term] = true
+			terms = append(terms, tok.term)
+		}
+	}
+	return terms
+}
+
+// snippet returns about 160 bytes of text around the first occurrence of any of terms, HTML-escaped, with every matched term in <mark>.
+func snippet(text string, terms []string) string {
+	const before, width = 60, 160
+	want := make(map[string]bool, len(terms))
+	for _, t := range terms {
+		want[t] = true
+	}
+	toks := tokenize(text)
+	first := -1
+	for i, tok := range toks {
+		if want[tok.term] {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return html.EscapeString(truncate(text, width))
+	}
+	// snap the window to token boundaries so we never cut a word (or a UTF-8 sequence) in half.
+	start := 0
+	for j := first; j >= 0 && toks[first].start-toks[j].start <= before; j-- {
+		start = toks[j].start
+	}
+	end := len(text)
+	for _, tok := range toks[first:] {
+		if tok.end-start > width {
+			break
+		}
+		end = tok.end
+	}
+	var buf strings.Builder
+	if start > 0 {
+		buf.WriteString("…")
+	}
+	last := start
+	for _, tok := range toks {
+		if tok.start < start || tok.end > end || !want[tok.term] {
+			continue
+		}
+		buf.WriteString(html.EscapeString(text[last:tok.start]))
+		buf.WriteString("<mark>")
+		buf.WriteString(html.EscapeString(text[tok.start:tok.end]))
+		buf.WriteString("</mark>")
+		last = tok.end
+	}
+	buf.WriteString(html.EscapeString(text[last:end]))
+	if end < len(text) {
+		buf.WriteString("…")
+	}
+	return buf.String()
+}
+
+// truncate cuts s to at most width bytes, without splitting a UTF-8 sequence.
+func truncate(s string, width int) string {
+	if len(s) <= width {
+		return s
+	}
+	end := width
+	for end > 0 && !utfStart(s[end]) {
+		end--
+	}
+	return s[:end] + "…"
+}
+
+func utfStart(b byte) bool { return b&0xC0 != 0x80 }
+
+// TextFromHTML strips the markup from an HTML document, returning its visible text with whitespace collapsed.
+// <script>, <style>, and <head> contents are skipped, as are <nav> and <footer>: they're the page layout's, not the article's (see render.ParseLayout).
+func TextFromHTML(b []byte) string {
+	z := xhtml.NewTokenizer(bytes.NewReader(b))
+	var buf strings.Builder
+	skip := 0 // depth inside elements whose text isn't visible
+	for {
+		switch z.Next() {
+		case xhtml.ErrorToken: // io.EOF, or garbage: either way, we're done.
+			return strings.Join(strings.Fields(buf.String()), " ")
+		case xhtml.StartTagToken:
+			if name, _ := z.TagName(); invisible(name) {
+				skip++
+			}
+		case xhtml.EndTagToken:
+			if name, _ := z.TagName(); invisible(name) && skip > 0 {
+				skip--
+			}
+		case xhtml.TextToken:
+			if skip == 0 {
+				buf.Write(z.Text())
+				buf.WriteByte(' ')
+			}
+		}
+	}
+}
+
+func invisible(tag []byte) bool {
+	switch string(tag) {
+	case "script", "style", "head", "nav", "footer":
+		return true
+	}
+	return false
+}
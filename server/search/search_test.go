@@ -0,0 +1,59 @@
+package search_test
+
+import (
+	"strings"
+	"testing"
+
+	"gitlab.com/efronlicht/blog/server/search"
+)
+
+func TestSearch(t *testing.T) {
+	ix := search.New([]search.Document{
+		{Path: "/a.html", Title: "goroutines", Text: "a goroutine is a lightweight thread. goroutines leak if you never stop them."},
+		{Path: "/b.html", Title: "channels", Text: "channels connect goroutines. a nil channel blocks forever."},
+		{Path: "/c.html", Title: "reflection", Text: "reflect lets you inspect types at runtime."},
+	})
+	for _, tt := range []struct {
+		q         string
+		wantPaths []string
+	}{
+		{"goroutines", []string{"/a.html", "/b.html"}},
+		{"LEAK", []string{"/a.html"}},
+		{"runtime channels", []string{"/b.html", "/c.html"}}, // twice as many "channels" in b
+		{"nothing matches this", nil},
+		{"", nil},
+	} {
+		results := ix.Search(tt.q, 10)
+		var got []string
+		for _, r := range results {
+			got = append(got, r.Path)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.wantPaths, ",") {
+			t.Errorf("Search(%q): got %v, want %v", tt.q, got, tt.wantPaths)
+		}
+	}
+	if got := ix.Search("goroutines", 1); len(got) != 1 {
+		t.Errorf("Search(%q, 1): expected 1 result, got %d", "goroutines", len(got))
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	ix := search.New([]search.Document{{Path: "/a.html", Title: "t", Text: strings.Repeat("filler ", 40) + "the <needle> is here " + strings.Repeat("filler ", 40)}})
+	got := ix.Search("needle", 1)[0].Snippet
+	for _, want := range []string{"&lt;<mark>needle</mark>&gt;", "…"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected snippet to contain %q, got %q", want, got)
+		}
+	}
+	if len(got) > 200 {
+		t.Errorf("expected a short snippet, got %d bytes: %q", len(got), got)
+	}
+}
+
+func TestTextFromHTML(t *testing.T) {
+	got := search.TextFromHTML([]byte(`<html><head><title>x</title></head><body><nav><a href="/">home</a></nav><h1>Hello</h1>
+	<script>var y = 1;</script><p>world &amp; <b>friends</b></p><footer>more articles</footer></body></html>`))
+	if want := "Hello world & friends"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
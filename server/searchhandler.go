@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gitlab.com/efronlicht/blog/server/search"
+	"gitlab.com/efronlicht/blog/server/static"
+)
+
+// newSearchIndex indexes the embedded articles in the background, so it doesn't slow down startup.
+// The first search waits for it to finish, if necessary.
+func newSearchIndex(articles []static.Article) *nonblocking[*search.Index] {
+	return newEager(func() (*search.Index, error) {
+		docs := make([]search.Document, 0, len(articles))
+		for _, a := range articles {
+			b, ok := static.ReadFile(a.Name)
+			if !ok {
+				continue
+			}
+			// the summary and tags go first, so they're what the snippet shows when they match.
+			text := strings.Join(append([]string{a.Summary}, a.Tags...), " ") + " " + search.TextFromHTML(b)
+			docs = append(docs, search.Document{Path: "/" + a.Name, Title: a.Title, Text: strings.TrimSpace(text)})
+		}
+		return search.New(docs), nil
+	})
+}
+
+// searchHandler answers GET /search?q=terms[&limit=n] with JSON like
+//
+//	{"query": "goroutine leak", "results": [{"title": "...", "path": "/quirks2.html", "score": 0.012, "snippet": "...a <mark>goroutine</mark>..."}]}
+func searchHandler(index *nonblocking[*search.Index]) http.HandlerFunc {
+	const defaultLimit, maxLimit = 10, 50
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
+		if q == "" {
+			writeErr(w, errors.New("missing query parameter 'q'"), http.StatusBadRequest)
+			return
+		}
+		limit := defaultLimit
+		if s := r.URL.Query().Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 || n > maxLimit {
+				writeErr(w, fmt.Errorf("query parameter 'limit' must be an integer in [1, %d], but got %q", maxLimit, s), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		ix, err := index.Get()
+		if err != nil {
+			writeErr(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Query   string          `json:"query"`
+			Results []search.Result `json:"results"`
+		}{q, ix.Search(q, limit)})
+	}
+}
+
+// writeErr sets the Content-Type header to application/json, then writes the given error as JSON to w's body.
+func writeErr(w http.ResponseWriter, err error, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	fmt.Fprintf(w, `{"error": %q}`, err) // no need to use the JSON package for such a simple case
+}
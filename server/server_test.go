@@ -19,6 +19,7 @@ import (
 
 func TestMain(m *testing.M) {
 	os.Setenv("PORT", "6483")
+	os.Setenv("REDIRECTS", "/old.html /quirks.html; /draft.html /index.html 302")
 	go main.Run(context.Background())
 	time.Sleep(50 * time.Millisecond)
 	os.Exit(m.Run())
@@ -30,6 +31,109 @@ func TestUptime(t *testing.T) {
 	}
 }
 
+func TestHealth(t *testing.T) {
+	if got := testGet(t, "debug/healthz"); !strings.Contains(got, "ok") {
+		t.Fatalf("expected ok, got %s", got)
+	}
+	if got := testGet(t, "debug/readyz"); !strings.Contains(got, `"status":"ok"`) || !strings.Contains(got, "search index") {
+		t.Fatalf("expected all checks ok, got %s", got)
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	for path, want := range map[string]string{
+		"OpenSans-Regular.woff2": "public, max-age=604800, immutable",
+		"index.html":             "no-cache",
+	} {
+		resp, err := http.Get("http://localhost:6483/" + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got := resp.Header.Get("Cache-Control"); got != want {
+			t.Errorf("%s: expected Cache-Control %q, got %q", path, want, got)
+		}
+	}
+}
+
+func TestContentType(t *testing.T) {
+	for path, want := range map[string]string{
+		"index.html":             "text/html; charset=utf-8",
+		"dark.css":               "text/css; charset=utf-8",
+		"OpenSans-Regular.woff2": "font/woff2",
+		"favicon.ico":            "image/x-icon",
+		"tt_tt.png":              "image/png",
+	} {
+		req, _ := http.NewRequest("GET", "http://localhost:6483/"+path, nil)
+		req.Header.Set("Accept-Encoding", "deflate") // so we also check the raw deflate path.
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got := resp.Header.Get("Content-Type"); got != want {
+			t.Errorf("%s: expected Content-Type %q, got %q", path, want, got)
+		}
+		if resp.ContentLength <= 0 {
+			t.Errorf("%s: expected a Content-Length, got %d", path, resp.ContentLength)
+		}
+	}
+}
+
+func TestVary(t *testing.T) {
+	for _, tt := range []struct {
+		path, acceptEncoding string
+		want                 string
+	}{
+		{"index.html", "deflate", "Accept-Encoding"},  // deflated, sent raw.
+		{"index.html", "identity", "Accept-Encoding"}, // deflated, sent decompressed.
+		{"OpenSans-Regular.woff2", "deflate", ""},     // stored: everyone gets the same bytes.
+	} {
+		req, _ := http.NewRequest("GET", "http://localhost:6483/"+tt.path, nil)
+		req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got := resp.Header.Get("Vary"); got != tt.want {
+			t.Errorf("%s with Accept-Encoding %s: expected Vary %q, got %q", tt.path, tt.acceptEncoding, tt.want, got)
+		}
+	}
+}
+
+func TestArticleListing(t *testing.T) {
+	got := testGet(t, "articles")
+	for _, a := range static.Articles {
+		if a.Words == 0 {
+			t.Errorf("%s: expected a word count", a.Name)
+		}
+		if !strings.Contains(got, `href="/`+a.Name+`"`) {
+			t.Errorf("expected a link to %s in the listing", a.Name)
+		}
+	}
+}
+
+func TestRedirects(t *testing.T) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	for path, want := range map[string]struct {
+		code     int
+		location string
+	}{
+		"old.html?x=1": {301, "/quirks.html?x=1"},
+		"draft.html":   {302, "/index.html"},
+	} {
+		resp, err := client.Get("http://localhost:6483/" + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want.code || resp.Header.Get("Location") != want.location {
+			t.Errorf("%s: expected %d to %s, got %d to %s", path, want.code, want.location, resp.StatusCode, resp.Header.Get("Location"))
+		}
+	}
+}
+
 func TestFiles(t *testing.T) {
 	fs.WalkDir(static.FS, ".", func(path string, d fs.DirEntry, err error) error {
 		log.Print(path)
@@ -41,6 +145,69 @@ func TestFiles(t *testing.T) {
 	})
 }
 
+func TestRange(t *testing.T) {
+	for _, name := range []string{"OpenSans-Regular.woff2", "index.html"} { // one stored, one deflated
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "http://localhost:6483/"+name, nil)
+			req.Header.Set("Range", "bytes=4-11")
+			req.Header.Set("Accept-Encoding", "deflate")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusPartialContent {
+				t.Fatalf("expected %d, got %d", http.StatusPartialContent, resp.StatusCode)
+			}
+			if got := resp.Header.Get("Content-Range"); !strings.HasPrefix(got, "bytes 4-11/") {
+				t.Fatalf("expected Content-Range bytes 4-11/*, got %q", got)
+			}
+			b, _ := io.ReadAll(resp.Body)
+			f, err := static.FS.Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := io.ReadAll(f)
+			if string(b) != string(want[4:12]) {
+				t.Fatalf("expected %q, got %q", want[4:12], b)
+			}
+		})
+	}
+}
+
+func TestFeeds(t *testing.T) {
+	for _, name := range []string{"rss.xml", "atom.xml"} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := http.Get("http://localhost:6483/" + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != 200 {
+				t.Fatalf("expected %d, got %d", 200, resp.StatusCode)
+			}
+			if !strings.Contains(string(b), "quirks.html") {
+				t.Fatalf("expected feed to link quirks.html, got %s", b)
+			}
+			etag := resp.Header.Get("ETag")
+			if etag == "" {
+				t.Fatal("expected an ETag")
+			}
+			req, _ := http.NewRequest("GET", "http://localhost:6483/"+name, nil)
+			req.Header.Set("If-None-Match", etag)
+			resp, err = http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusNotModified {
+				t.Fatalf("expected %d, got %d", http.StatusNotModified, resp.StatusCode)
+			}
+		})
+	}
+}
+
 func testGet(t *testing.T, p string) (body string) {
 	t.Run(p, func(t *testing.T) {
 		target := "http://localhost:6483/" + strings.TrimPrefix(p, "/")
@@ -59,3 +226,10 @@ func testGet(t *testing.T, p string) (body string) {
 	})
 	return body
 }
+
+func TestMetrics(t *testing.T) {
+	testGet(t, "debug/uptime")
+	if got := testGet(t, "debug/metrics"); !strings.Contains(got, `http_server_requests_total{class="2xx"}`) || !strings.Contains(got, "http_server_request_duration_seconds_bucket") {
+		t.Fatalf("expected request metrics, got %s", got)
+	}
+}
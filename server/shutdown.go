@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// shutdown coordinates cleanup when the server stops: flushing logs, closing files, stopping background jobs, etc.
+// Closers run in Last-In, First-Out order, like defer, so register something before anything that depends on it.
+// (i.e, the logger goes first, so that it's flushed last.)
+type shutdown struct {
+	mu      sync.Mutex
+	closers []closer
+}
+
+type closer struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// register adds a closer to be run by run. fn should return promptly once ctx is done.
+func (s *shutdown) register(name string, fn func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closers = append(s.closers, closer{name: name, fn: fn})
+}
+
+// closerGrace is how long each closer gets once run's ctx is already done.
+const closerGrace = 250 * time.Millisecond
+
+// run calls every registered closer in LIFO order, giving up on each once ctx is done.
+// A closer that doesn't finish before the deadline is reported as timed out, but the rest are still started,
+// each with closerGrace of its own, so that quick ones (like syncing the logger) get a chance to finish even if an earlier one hangs.
+// It returns every failure and timeout, joined.
+func (s *shutdown) run(ctx context.Context, logger *zap.Logger) error {
+	s.mu.Lock()
+	closers := s.closers
+	s.closers = nil
+	s.mu.Unlock()
+
+	var errs []error
+	for i := len(closers) - 1; i >= 0; i-- {
+		c := closers[i]
+		start := time.Now()
+		cctx, cancel := ctx, context.CancelFunc(func() {})
+		if ctx.Err() != nil {
+			cctx, cancel = context.WithTimeout(context.WithoutCancel(ctx), closerGrace)
+		}
+		done := make(chan error, 1)
+		go func() { done <- c.fn(cctx) }()
+		select {
+		case err := <-done:
+			if err != nil {
+				logger.Error("shutdown: failed", zap.String("closer", c.name), zap.Duration("elapsed", time.Since(start)), zap.Error(err))
+				errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+			} else {
+				logger.Debug("shutdown: closed", zap.String("closer", c.name), zap.Duration("elapsed", time.Since(start)))
+			}
+		case <-cctx.Done():
+			logger.Error("shutdown: timed out", zap.String("closer", c.name), zap.Duration("elapsed", time.Since(start)))
+			errs = append(errs, fmt.Errorf("%s: timed out after %s: %w", c.name, time.Since(start), ctx.Err()))
+		}
+		cancel()
+	}
+	return errors.Join(errs...)
+}
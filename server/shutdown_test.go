@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestShutdownGrace(t *testing.T) {
+	var sd shutdown
+	var flushed bool
+	sd.register("logger", func(context.Context) error { flushed = true; return nil }) // registered first, so it runs last.
+	sd.register("hangs", func(context.Context) error { select {} })
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := sd.run(ctx, zap.NewNop())
+	if err == nil || !strings.Contains(err.Error(), "hangs: timed out") || strings.Contains(err.Error(), "logger") {
+		t.Errorf("expected only the hanging closer to time out, got %v", err)
+	}
+	if !flushed {
+		t.Errorf("the logger never got to flush after the deadline")
+	}
+}
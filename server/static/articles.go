@@ -0,0 +1,115 @@
+package static
+
+import (
+	"encoding/json"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"gitlab.com/efronlicht/blog/render"
+	"gitlab.com/efronlicht/blog/server/search"
+)
+
+// Article describes one of the blog's articles, as found in the embedded assets.
+// Title, Modified, Words, Minutes, Tags, and Summary come from the article's frontmatter, via articles.json, where it has them: see render.Meta.
+type Article struct {
+	Name     string    // file name, like "quirks.html"
+	Title    string    // from the frontmatter, or failing that, the page's <title>
+	Modified time.Time // from the frontmatter's date, or failing that, the zip header; zero if neither has it
+	Words    int       // of visible text
+	Minutes  int       // to read it: see render.ReadingMinutes
+	Tags     []string
+	Summary  string
+}
+
+// articleMeta is an entry in articles.json, as written by cmd/rendermd. It mirrors render.Meta.
+type articleMeta struct {
+	Name    string    `json:"name"`
+	Title   string    `json:"title"`
+	Date    time.Time `json:"date"`
+	Tags    []string  `json:"tags"`
+	Summary string    `json:"summary"`
+	Words   int       `json:"words"`
+	Minutes int       `json:"minutes"`
+}
+
+// Articles lists the articles linked from article_list.html, in the order they appear there.
+// It's built once at init, so it always matches what this binary serves.
+var Articles []Article
+
+var (
+	articleLinkRE = regexp.MustCompile(`href="https://eblog\.fly\.dev/([^"/]+\.html)"`)
+	titleRE       = regexp.MustCompile(`(?s)<title>(.*?)</title>`)
+)
+
+// loadArticles builds Articles from the embedded article list. Missing or unreadable articles are skipped.
+func loadArticles() []Article {
+	list, ok := ReadFile("article_list.html")
+	if !ok {
+		return nil
+	}
+	metas := make(map[string]articleMeta)
+	if b, ok := ReadFile("articles.json"); ok { // older builds don't have it.
+		var ms []articleMeta
+		if err := json.Unmarshal(b, &ms); err != nil {
+			panic("failed to parse embedded articles.json: " + err.Error())
+		}
+		for _, m := range ms {
+			metas[m.Name] = m
+		}
+	}
+	var articles []Article
+	seen := make(map[string]bool)
+	for _, m := range articleLinkRE.FindAllSubmatch(list, -1) {
+		name := string(m[1])
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		b, ok := ReadFile(name)
+		if !ok {
+			continue // linked, but not in this build.
+		}
+		a := Article{Name: name, Title: strings.TrimSuffix(name, ".html"), Words: len(strings.Fields(search.TextFromHTML(b)))}
+		if t := titleRE.FindSubmatch(b); len(t) > 1 {
+			a.Title = strings.TrimSpace(html.UnescapeString(string(t[1])))
+		}
+		if mod := files[name].Modified; mod.Year() > 1980 { // 1980 is the zip epoch: i.e, "unknown".
+			a.Modified = mod
+		}
+		if m, ok := metas[name]; ok {
+			if m.Title != "" {
+				a.Title = m.Title
+			}
+			if !m.Date.IsZero() {
+				a.Modified = m.Date
+			}
+			a.Tags, a.Summary = m.Tags, m.Summary
+			if m.Words > 0 { // counted before the layout added its nav and footer.
+				a.Words, a.Minutes = m.Words, m.Minutes
+			}
+		}
+		if a.Minutes == 0 {
+			a.Minutes = render.ReadingMinutes(a.Words)
+		}
+		articles = append(articles, a)
+	}
+	return articles
+}
+
+// ReadFile returns the uncompressed contents of the named embedded file.
+func ReadFile(name string) ([]byte, bool) {
+	f, ok := files[name]
+	if !ok {
+		return nil, false
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, false
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	return b, err == nil
+}
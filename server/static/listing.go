@@ -0,0 +1,45 @@
+package static
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"time"
+)
+
+// listing is the /articles page, rendered once at init from Articles.
+var listing []byte
+
+var listingTemplate = template.Must(template.New("articles").Parse(`<!DOCTYPE html><html><head>
+  <title>articles</title>
+  <meta charset="utf-8"/>
+  <link rel="stylesheet" type="text/css" href="/s.css"/>
+  <link rel="icon" type="image/x-icon" href="/favicon.ico"/>
+</head>
+<body>
+<h1>articles</h1>
+<table>
+<thead><tr><th>title</th><th>updated</th><th>words</th><th>read</th></tr></thead>
+<tbody>
+{{- range .}}
+<tr><td><a href="/{{.Name}}">{{.Title}}</a>{{with .Summary}}<br/><small>{{.}}</small>{{end}}{{with .Tags}}<br/><small>{{range $i, $t := .}}{{if $i}}, {{end}}#{{$t}}{{end}}</small>{{end}}</td><td>{{if not .Modified.IsZero}}{{.Modified.Format "2006-01-02"}}{{end}}</td><td>{{.Words}}</td><td>{{.Minutes}} min</td></tr>
+{{- end}}
+</tbody>
+</table>
+</body>
+</html>
+`))
+
+func renderListing(articles []Article) []byte {
+	var buf bytes.Buffer
+	if err := listingTemplate.Execute(&buf, articles); err != nil {
+		panic("failed to render article listing: " + err.Error()) // the template is static, so this is a programmer error.
+	}
+	return buf.Bytes()
+}
+
+// ServeListing serves an index of every article, with its title, summary, tags, last-modified date, word count, and reading time.
+func ServeListing(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	http.ServeContent(w, r, "articles.html", time.Time{}, bytes.NewReader(listing))
+}
@@ -0,0 +1,41 @@
+package static
+
+import (
+	"archive/zip"
+	"io"
+	"net/http"
+	"path"
+)
+
+// mimeTypes maps the extensions we actually serve to their content types.
+// We don't rely on mime.TypeByExtension: it consults the host's /etc/mime.types, which varies between machines (and is missing entirely from a bare alpine image).
+var mimeTypes = map[string]string{
+	".html":  "text/html; charset=utf-8",
+	".css":   "text/css; charset=utf-8",
+	".md":    "text/markdown; charset=utf-8",
+	".woff2": "font/woff2",
+	".png":   "image/png",
+	".gif":   "image/gif",
+	".ico":   "image/x-icon",
+	".xml":   "application/xml; charset=utf-8",
+	".svg":   "image/svg+xml",
+}
+
+// contentTypes maps file names to their content types. See detectContentType.
+var contentTypes map[string]string
+
+// detectContentType returns the content type of f: from mimeTypes if we know its extension,
+// or by sniffing the first 512 bytes with http.DetectContentType if we don't.
+func detectContentType(f *zip.File) string {
+	if ct, ok := mimeTypes[path.Ext(f.Name)]; ok {
+		return ct
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer rc.Close()
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(rc, buf)
+	return http.DetectContentType(buf[:n])
+}
@@ -6,8 +6,10 @@ import (
 	_ "embed"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"gitlab.com/efronlicht/blog/site"
 	"go.uber.org/zap"
 )
 
@@ -25,10 +27,15 @@ func init() {
 	if err != nil {
 		panic("failed to read zipped file: " + err.Error())
 	}
+	site.RegisterZstd(FS) // see cmd/prezip -policy.
 	files = make(map[string]*zip.File, len(FS.File))
+	contentTypes = make(map[string]string, len(FS.File))
 	for _, f := range FS.File {
 		files[f.Name] = f
+		contentTypes[f.Name] = detectContentType(f)
 	}
+	Articles = loadArticles()
+	listing = renderListing(Articles)
 }
 
 func ServeFile(w http.ResponseWriter, r *http.Request) {
@@ -42,18 +49,64 @@ func ServeFile(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
+	w.Header().Set("Content-Type", contentTypes[f.Name])
+	encoding := rawEncoding(f)
+	if encoding != "" { // what we send depends on Accept-Encoding, so a shared cache mustn't hand one client's response to another.
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
 	// best-case scenario: just forward them the compressed file.
-	if strings.Contains(r.Header.Get("Accept-Encoding"), "deflate") && f.Method == zip.Deflate {
-
-		w.Header().Set("Content-Encoding", "deflate")
+	// range requests are resolved against the uncompressed content, so they skip this path.
+	if r.Header.Get("Range") == "" && encoding != "" && strings.Contains(r.Header.Get("Accept-Encoding"), encoding) {
+		w.Header().Set("Content-Encoding", encoding)
+		w.Header().Set("Content-Length", strconv.FormatUint(f.CompressedSize64, 10))
 		if _, err := (io.Copy(w, must(f.OpenRaw()))); err != nil {
 			zap.L().Error("failed to copy file", zap.Error(err), zap.String("file", f.Name))
 		}
 		return
 	}
-	if _, err := io.Copy(w, must(f.Open())); err != nil {
-		zap.L().Error("failed to copy file", zap.Error(err), zap.String("file", f.Name))
+	// http.ServeContent handles Range, If-Range, and multipart/byteranges for us; it just needs something it can seek.
+	content, err := seekable(f)
+	if err != nil {
+		zap.L().Error("failed to open file", zap.Error(err), zap.String("file", f.Name))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, r, f.Name, f.Modified, content)
+}
+
+// rawEncoding is the Content-Encoding of f's raw, compressed bytes, or "" if they can't be served as-is.
+func rawEncoding(f *zip.File) string {
+	switch site.Method(f.Method) {
+	case site.Deflate:
+		return "deflate"
+	case site.Zstd:
+		return "zstd"
+	default:
+		return ""
+	}
+}
+
+// seekable returns an io.ReadSeeker over the uncompressed contents of f.
+// Stored files are read directly out of the embedded archive without copying;
+// deflated files have to be decompressed into memory first, since a flate stream can't seek.
+func seekable(f *zip.File) (io.ReadSeeker, error) {
+	if f.Method == zip.Store {
+		offset, err := f.DataOffset()
+		if err != nil {
+			return nil, err
+		}
+		return io.NewSectionReader(bytes.NewReader(zipped), offset, int64(f.UncompressedSize64)), nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
 	}
+	return bytes.NewReader(b), nil
 }
 
 func must[T any](t T, err error) T {
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gitlab.com/efronlicht/enve"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// setupTLS builds the server's TLS configuration from the environment. It returns a nil config if TLS is disabled.
+// There are two ways to turn it on:
+//   - CERT_FILE and KEY_FILE: use a certificate you already have.
+//   - AUTOCERT_DOMAINS (comma-separated): get certificates from Let's Encrypt on demand, caching them in AUTOCERT_CACHE_DIR.
+//
+// redirect is the handler for the plain-HTTP listener: it sends everyone to HTTPS
+// (and, for autocert, answers the ACME http-01 challenges first).
+func setupTLS(logger *zap.Logger, httpsPort int) (cfg *tls.Config, redirect http.Handler, err error) {
+	certFile, keyFile := enve.StringOr("CERT_FILE", ""), enve.StringOr("KEY_FILE", "")
+	domains := enve.StringOr("AUTOCERT_DOMAINS", "")
+	redirect = redirectHTTPS(httpsPort)
+	switch {
+	case (certFile != "" || keyFile != "") && domains != "":
+		return nil, nil, errors.New("CERT_FILE/KEY_FILE and AUTOCERT_DOMAINS are mutually exclusive")
+	case certFile != "" || keyFile != "":
+		if certFile == "" || keyFile == "" {
+			return nil, nil, errors.New("CERT_FILE and KEY_FILE must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("loading certificate: %w", err)
+		}
+		logger.Info("tls: using certificate from file", zap.String("cert_file", certFile), zap.String("key_file", keyFile))
+		return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, redirect, nil
+	case domains != "":
+		hosts := strings.Split(domains, ",")
+		for i := range hosts {
+			hosts[i] = strings.TrimSpace(hosts[i])
+		}
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(hosts...),
+			Cache:      autocert.DirCache(enve.StringOr("AUTOCERT_CACHE_DIR", "autocert-cache")),
+			Email:      enve.StringOr("AUTOCERT_EMAIL", ""),
+		}
+		logger.Info("tls: using autocert", zap.Strings("domains", hosts))
+		cfg := m.TLSConfig()
+		cfg.MinVersion = tls.VersionTLS12
+		return cfg, m.HTTPHandler(redirect), nil
+	default:
+		return nil, nil, nil
+	}
+}
+
+// redirectHTTPS permanently redirects every request to the same host and path over HTTPS on httpsPort.
+func redirectHTTPS(httpsPort int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h // drop the plain-HTTP port
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	}
+}
@@ -0,0 +1,230 @@
+package site
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/html"
+)
+
+// Item is an article in the feeds. Unlike render.Meta, it remembers when the article was first seen, and when it last changed: see Feed.Update.
+type Item struct {
+	Title       string
+	Link        string
+	GUID        string    // see GUIDFor. If it's the same as Link, Link's a permalink, and the feeds say so.
+	PubDate     time.Time // when the article was first seen. It never changes.
+	UpdatedDate time.Time // when the article last changed after that; zero if it hasn't.
+	Description string    // see findSummary.
+	Categories  []string  // the article's tags.
+}
+
+// GUIDFor is the GUID of the article at link: a name-based (version 5) UUID, so it's the same every time, however often the article changes.
+func GUIDFor(link string) string { return uuid.NewSHA1(uuid.NameSpaceURL, []byte(link)).String() }
+
+// Feed is what the feeds remember between builds: every article's Item, and a checksum of the HTML it came from, by file name.
+// See ReadFeed and Feed.Write.
+type Feed struct {
+	Items     map[string]Item
+	Checksums map[string][16]byte
+}
+
+// ReadFeed reads a Feed from items.json and checksums.json in dir. Missing files are empty: i.e, the first run.
+func ReadFeed(dir string) (*Feed, error) {
+	f := &Feed{Items: make(map[string]Item), Checksums: make(map[string][16]byte)}
+	for name, v := range map[string]any{"items.json": &f.Items, "checksums.json": &f.Checksums} {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, v); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", filepath.Join(dir, name), err)
+		}
+	}
+	return f, nil
+}
+
+// Write writes f to items.json and checksums.json in dir, for ReadFeed.
+func (f *Feed) Write(dir string) error {
+	if err := writeJSON(filepath.Join(dir, "items.json"), f.Items); err != nil {
+		return err
+	}
+	return writeJSON(filepath.Join(dir, "checksums.json"), f.Checksums)
+}
+
+// Update brings the Item for the article name up to date with page, its rendered HTML, reporting whether it changed.
+// An article is published once: after that, a change is an update, not a new item, so feed readers don't show it again.
+// Items from before GUIDFor get their GUIDs replaced, once, whether or not the article changed.
+func (f *Feed) Update(name, siteURL string, page []byte, now time.Time) (changed bool, err error) {
+	item, published := f.Items[name]
+	link := strings.TrimSuffix(siteURL, "/") + "/" + name
+	sum := md5.Sum(page)
+	if got, ok := f.Checksums[name]; ok && got == sum {
+		if published && item.GUID != GUIDFor(link) {
+			item.Link, item.GUID = link, GUIDFor(link)
+			f.Items[name] = item
+			return true, nil
+		}
+		return false, nil
+	}
+	doc, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		return false, fmt.Errorf("parsing %s: %w", name, err)
+	}
+	title, ok := findTitle(doc)
+	if !ok {
+		return false, fmt.Errorf("no title for document %s", name)
+	}
+	item.Title = title
+	item.Description = findSummary(doc)
+	item.Categories = findCategories(doc)
+	item.Link = link
+	item.GUID = GUIDFor(link)
+	if published && !item.PubDate.IsZero() {
+		item.UpdatedDate = now
+	} else {
+		item.PubDate = now
+	}
+	f.Items[name] = item
+	f.Checksums[name] = sum
+	return true, nil
+}
+
+// the feeds' own title and description.
+const feedTitle, feedDescription = "efron's blog", "efron's blog about programming w/ a focus on performance"
+
+// RSS renders items as an RSS 2.0 document, built at built, for the site at siteURL. Items without a PubDate don't have one in the feed, either.
+func RSS(items []Item, siteURL string, built time.Time) ([]byte, error) {
+	siteURL = strings.TrimSuffix(siteURL, "/")
+	built = built.UTC().Truncate(time.Second)
+	r := rss{Version: "2.0", Channel: rssChannel{
+		Title:         feedTitle,
+		Link:          siteURL,
+		Description:   feedDescription,
+		LastBuildDate: built.Format(time.RFC1123Z),
+		TTL:           30, // minutes
+	}}
+	for _, it := range items {
+		item := rssItem{Title: it.Title, Link: it.Link, Description: it.Description, Categories: it.Categories, GUID: rssGUID{Value: it.GUID}}
+		if it.GUID == "" || it.GUID == it.Link {
+			item.GUID = rssGUID{IsPermaLink: true, Value: it.Link}
+		}
+		if !it.PubDate.IsZero() {
+			item.PubDate = it.PubDate.UTC().Format(time.RFC1123Z)
+		}
+		r.Channel.Items = append(r.Channel.Items, item)
+	}
+	return marshalFeed(r)
+}
+
+// Atom renders items as an Atom 1.0 document, like RSS. Atom needs every entry to have been updated sometime:
+// items without an UpdatedDate or PubDate fall back to built.
+func Atom(items []Item, siteURL string, built time.Time) ([]byte, error) {
+	siteURL = strings.TrimSuffix(siteURL, "/")
+	built = built.UTC().Truncate(time.Second)
+	a := atom{
+		Title:   feedTitle,
+		ID:      siteURL + "/",
+		Updated: built.Format(time.RFC3339),
+		Links:   []atomLink{{Href: siteURL + "/"}, {Href: siteURL + "/atom.xml", Rel: "self"}},
+		Author:  atomAuthor{Name: "Efron Licht"},
+	}
+	for _, it := range items {
+		entry := atomEntry{Title: it.Title, ID: it.Link, Updated: built.Format(time.RFC3339), Link: atomLink{Href: it.Link}, Summary: it.Description}
+		if it.GUID != "" && it.GUID != it.Link {
+			entry.ID = "urn:uuid:" + it.GUID
+		}
+		if !it.PubDate.IsZero() {
+			entry.Published = it.PubDate.UTC().Format(time.RFC3339)
+			entry.Updated = entry.Published
+		}
+		if !it.UpdatedDate.IsZero() {
+			entry.Updated = it.UpdatedDate.UTC().Format(time.RFC3339)
+		}
+		for _, tag := range it.Categories {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		a.Entries = append(a.Entries, entry)
+	}
+	return marshalFeed(a)
+}
+
+func marshalFeed(v any) ([]byte, error) {
+	b, err := xml.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+// see https://www.rssboard.org/rss-specification
+type (
+	rss struct {
+		XMLName xml.Name   `xml:"rss"`
+		Version string     `xml:"version,attr"`
+		Channel rssChannel `xml:"channel"`
+	}
+	rssChannel struct {
+		Title         string    `xml:"title"`
+		Link          string    `xml:"link"`
+		Description   string    `xml:"description"`
+		LastBuildDate string    `xml:"lastBuildDate"`
+		TTL           int       `xml:"ttl"`
+		Items         []rssItem `xml:"item"`
+	}
+	rssItem struct {
+		Title       string   `xml:"title"`
+		Link        string   `xml:"link"`
+		Description string   `xml:"description,omitempty"`
+		Categories  []string `xml:"category"`
+		GUID        rssGUID  `xml:"guid"`
+		PubDate     string   `xml:"pubDate,omitempty"`
+	}
+	rssGUID struct {
+		IsPermaLink bool   `xml:"isPermaLink,attr"`
+		Value       string `xml:",chardata"`
+	}
+)
+
+// see https://www.rfc-editor.org/rfc/rfc4287
+type (
+	atom struct {
+		XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+		Title   string      `xml:"title"`
+		ID      string      `xml:"id"`
+		Updated string      `xml:"updated"`
+		Links   []atomLink  `xml:"link"`
+		Author  atomAuthor  `xml:"author"`
+		Entries []atomEntry `xml:"entry"`
+	}
+	atomAuthor struct {
+		Name string `xml:"name"`
+	}
+	atomLink struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr,omitempty"`
+	}
+	atomEntry struct {
+		Title      string         `xml:"title"`
+		ID         string         `xml:"id"`
+		Published  string         `xml:"published,omitempty"`
+		Updated    string         `xml:"updated"`
+		Link       atomLink       `xml:"link"`
+		Summary    string         `xml:"summary,omitempty"`
+		Categories []atomCategory `xml:"category"`
+	}
+	atomCategory struct {
+		Term string `xml:"term,attr"`
+	}
+)
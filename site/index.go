@@ -0,0 +1,32 @@
+package site
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WriteIndex writes dir/index.html, a plain listing of every html file in dir, returning its path.
+func WriteIndex(dir string) (string, error) {
+	html := []byte(`<!DOCTYPE html><html><head>
+	<title>index.html</title>
+	<meta charset="utf-8"/>
+	<link rel="stylesheet" type="text/css" href="/dark.css"/>
+	</head>
+	<body>
+	<h1> articles </h1>
+`)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		if n := e.Name(); strings.Contains(filepath.Ext(n), "html") {
+			html = fmt.Appendf(html, `<h4><a href="/%s">%s</a>`+"\n</h4>", n, n)
+		}
+	}
+	html = append(html, "</body>"...)
+	dst := filepath.Join(dir, "index.html")
+	return dst, os.WriteFile(dst, html, 0o777)
+}
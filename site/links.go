@@ -0,0 +1,97 @@
+package site
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// DefaultRoutes are the paths the server answers itself, rather than from a file: see server/main.go.
+// "/" and "/index.html" too, since cmd/buildindex writes the index after rendermd runs.
+const DefaultRoutes = "/,/index.html,/articles,/search,/rss.xml,/atom.xml"
+
+// BrokenLink is a relative href or src in a rendered page that doesn't resolve to anything the site serves.
+type BrokenLink struct {
+	Page, Link string
+	Reason     string
+}
+
+// ParseRoutes parses a comma-separated list of routes, like DefaultRoutes, for CheckLinks.
+func ParseRoutes(s string) map[string]bool {
+	routes := make(map[string]bool)
+	for _, r := range strings.Split(s, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			routes[r] = true
+		}
+	}
+	return routes
+}
+
+// CheckLinks finds the broken links in pages, the names of HTML files in dstDir: every relative href or src must be a file in dstDir,
+// or one of routes. Absolute URLs, and links to somewhere on the same page, aren't checked.
+func CheckLinks(dstDir string, pages []string, routes map[string]bool) ([]BrokenLink, error) {
+	var broken []BrokenLink
+	for _, page := range pages {
+		b, err := os.ReadFile(filepath.Join(dstDir, page))
+		if err != nil {
+			return nil, err
+		}
+		for _, link := range links(b) {
+			if reason := resolve(dstDir, "/"+page, link, routes); reason != "" {
+				broken = append(broken, BrokenLink{Page: page, Link: link, Reason: reason})
+			}
+		}
+	}
+	return broken, nil
+}
+
+// resolve says why link, on the page served at pagePath, doesn't go anywhere: "" if it does.
+func resolve(dstDir, pagePath, link string, routes map[string]bool) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return fmt.Sprintf("unparseable: %v", err)
+	}
+	if u.Scheme != "" || u.Host != "" || u.Path == "" { // elsewhere, or on this page: i.e, https://go.dev, mailto:efron@example.com, #section.
+		return ""
+	}
+	p := u.Path
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join(path.Dir(pagePath), p)
+	}
+	p = path.Clean(p)
+	if routes[p] {
+		return ""
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, filepath.FromSlash(p))); err != nil {
+		return "no such file in the output"
+	}
+	return ""
+}
+
+// links returns the value of every href and src attribute in the HTML document b, in order.
+func links(b []byte) []string {
+	var links []string
+	z := html.NewTokenizer(bytes.NewReader(b))
+	for {
+		switch z.Next() {
+		case html.ErrorToken: // io.EOF, or garbage: either way, we're done.
+			return links
+		case html.StartTagToken, html.SelfClosingTagToken:
+			for {
+				key, val, more := z.TagAttr()
+				if k := string(key); k == "href" || k == "src" {
+					links = append(links, string(val))
+				}
+				if !more {
+					break
+				}
+			}
+		}
+	}
+}
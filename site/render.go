@@ -0,0 +1,258 @@
+// Package site builds the blog's static site from its markdown: it renders the articles (see Render), checks their links,
+// writes their feeds, sitemap, and index, and packs it all into the zip the server embeds.
+// cmd/buildsite does every step in one process, sharing each article's render.Meta between them;
+// cmd/rendermd, cmd/buildrss, cmd/buildindex, and cmd/prezip each do one.
+package site
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gitlab.com/efronlicht/blog/render"
+)
+
+// RenderConfig configures Render.
+type RenderConfig struct {
+	Src, Dst string        // absolute paths: the markdown's under Src, and its HTML goes in Dst, flattened.
+	Render   render.Config // how to render each article.
+	Layout   [16]byte      // see LayoutSum.
+	Workers  int           // how many files to render at once: at least one.
+	// Cache is what the last run rendered, by source path relative to Src: an article whose entry still matches isn't rendered again.
+	// nil renders everything.
+	Cache map[string]CacheEntry
+	// Ignore says which paths under Src to leave alone: nil means DefaultIgnore.
+	Ignore func(path string) bool
+	// Progress, if it's not nil, is called with each file Render renders or copies, in the order they finish.
+	Progress func(src, dst string)
+}
+
+// CacheEntry is what a run of Render remembers about an article for the next: if neither sum has changed, neither has its HTML.
+type CacheEntry struct {
+	Source [16]byte    // md5 of the markdown.
+	Layout [16]byte    // see LayoutSum.
+	Meta   render.Meta // for articles.json, without rendering it again.
+}
+
+// Rendered is what Render did.
+type Rendered struct {
+	Metas                     []render.Meta         // of every article, rendered or skipped, sorted by name.
+	Cache                     map[string]CacheEntry // for the next run: every article that didn't fail.
+	Rendered, Skipped, Copied int                   // articles rendered, articles skipped as unchanged, and images copied.
+}
+
+// DefaultIgnore ignores vendor and .git directories, and Dst, so a Dst inside Src doesn't render itself.
+func DefaultIgnore(dst string) func(path string) bool {
+	return func(path string) bool {
+		name := filepath.Base(path)
+		return name == "vendor" || name == ".git" || path == dst
+	}
+}
+
+// Render renders every markdown file under cfg.Src into cfg.Dst, and copies every .gif and .png. Rendering is CPU-bound, so cfg.Workers do it.
+// One bad file doesn't stop the rest: the error joins every file's, and Rendered still says what worked.
+func Render(cfg RenderConfig) (Rendered, error) {
+	ignore := cfg.Ignore
+	if ignore == nil {
+		ignore = DefaultIgnore(cfg.Dst)
+	}
+	if err := os.MkdirAll(cfg.Dst, 0o777); err != nil {
+		return Rendered{}, err
+	}
+	// the walk just finds the files, and the workers do them. everyone reports to results, which only Render reads.
+	jobs, results := make(chan string), make(chan result)
+	var wg sync.WaitGroup
+	for i := 0; i < max(cfg.Workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for srcPath := range jobs {
+				results <- cfg.process(srcPath)
+			}
+		}()
+	}
+	go func() {
+		defer close(results)
+		defer wg.Wait()
+		defer close(jobs)
+		_ = filepath.WalkDir(cfg.Src, func(srcPath string, d fs.DirEntry, err error) error {
+			if err != nil { // keep going: WalkDir skips a directory it can't read.
+				results <- result{src: srcPath, err: err}
+				return nil
+			}
+			if ignore(srcPath) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			switch filepath.Ext(srcPath) {
+			case ".md", ".gif", ".png":
+				jobs <- srcPath
+			}
+			return nil
+		})
+	}()
+
+	out := Rendered{Cache: make(map[string]CacheEntry)}
+	var errs []error
+	for r := range results {
+		switch {
+		case r.err != nil:
+			errs = append(errs, r.err)
+			continue
+		case r.skipped:
+			out.Skipped++
+		case r.key == "":
+			out.Copied++
+		default:
+			out.Rendered++
+		}
+		if !r.skipped && cfg.Progress != nil {
+			cfg.Progress(r.src, r.dst)
+		}
+		if r.key != "" {
+			out.Metas = append(out.Metas, r.entry.Meta)
+			out.Cache[r.key] = r.entry
+		}
+	}
+	sortMetas(out.Metas)
+	return out, errors.Join(errs...)
+}
+
+// RenderArticle renders the one article at srcPath into cfg.Dst, whatever cfg.Cache says: i.e, because it just changed.
+func RenderArticle(cfg RenderConfig, srcPath string) (CacheEntry, error) {
+	src, err := os.ReadFile(srcPath)
+	if err != nil {
+		return CacheEntry{}, err
+	}
+	html, meta, err := render.ArticleWithConfig(srcPath, cfg.Render)
+	if err != nil {
+		return CacheEntry{}, err
+	}
+	if err := os.WriteFile(HTMLPath(cfg.Dst, srcPath), html, 0o777); err != nil {
+		return CacheEntry{}, err
+	}
+	return CacheEntry{Source: md5.Sum(src), Layout: cfg.Layout, Meta: meta}, nil
+}
+
+// result is what a worker did with one file. key and entry are only set for articles.
+type result struct {
+	src, dst string
+	key      string     // src, relative to Src: see RenderConfig.Cache.
+	entry    CacheEntry // with the article's Meta.
+	skipped  bool       // because entry matched the cache.
+	err      error
+}
+
+// process renders a markdown file as HTML, or copies an image as-is.
+func (cfg RenderConfig) process(srcPath string) result {
+	if ext := filepath.Ext(srcPath); ext == ".gif" || ext == ".png" {
+		dstPath := filepath.Join(cfg.Dst, filepath.Base(srcPath))
+		b, err := os.ReadFile(srcPath)
+		if err == nil {
+			err = os.WriteFile(dstPath, b, 0o777)
+		}
+		return result{src: srcPath, dst: dstPath, err: err}
+	}
+	r := result{src: srcPath, dst: HTMLPath(cfg.Dst, srcPath)}
+	if r.key, r.err = filepath.Rel(cfg.Src, srcPath); r.err != nil {
+		return r
+	}
+	src, err := os.ReadFile(srcPath)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	r.entry = CacheEntry{Source: md5.Sum(src), Layout: cfg.Layout}
+	if got, ok := cfg.Cache[r.key]; ok && got.Source == r.entry.Source && got.Layout == r.entry.Layout && exists(r.dst) {
+		r.entry, r.skipped = got, true
+		return r
+	}
+	html, meta, err := render.ArticleWithConfig(srcPath, cfg.Render)
+	if err == nil {
+		err = os.WriteFile(r.dst, html, 0o777)
+	}
+	r.entry.Meta, r.err = meta, err
+	return r
+}
+
+// HTMLPath is where the article at srcPath is rendered to: a/b/quirks.md -> dst/quirks.html.
+func HTMLPath(dst, srcPath string) string {
+	return strings.ReplaceAll(filepath.Join(dst, filepath.Base(srcPath)), ".md", ".html")
+}
+
+// LayoutSum is the md5 of everything besides an article's source that goes into its HTML: the default layout (see render.DefaultSum),
+// cfg's site URL and extensions, and the templates in layoutDir, if there are any.
+// A change to render's Go code doesn't change it: render everything again, without a cache.
+func LayoutSum(cfg render.Config, layoutDir string) ([16]byte, error) {
+	h := md5.New()
+	h.Write(render.DefaultSum[:])
+	fmt.Fprintf(h, "%s\x00%s", cfg.SiteURL, cfg.Extensions)
+	if layoutDir != "" {
+		paths, err := filepath.Glob(filepath.Join(layoutDir, "*.html")) // sorted.
+		if err != nil {
+			return [16]byte{}, err
+		}
+		for _, path := range paths {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return [16]byte{}, err
+			}
+			fmt.Fprintf(h, "\x00%s\x00", filepath.Base(path))
+			h.Write(b)
+		}
+	}
+	return [16]byte(h.Sum(nil)), nil
+}
+
+// WriteMetas writes articles.json to path, sorting metas by name. The server reads it for the article listing, feeds, and search: see render.Meta.
+func WriteMetas(path string, metas []render.Meta) error {
+	sortMetas(metas)
+	return writeJSON(path, metas)
+}
+
+// ReadCache reads a cache written by WriteCache. A missing file is an empty cache: i.e, the first run.
+func ReadCache(path string) (map[string]CacheEntry, error) {
+	cache := make(map[string]CacheEntry)
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cache, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &cache); err != nil {
+		return nil, fmt.Errorf("parsing cache %s: %w", path, err)
+	}
+	return cache, nil
+}
+
+// WriteCache writes Rendered.Cache to path, for the next run's RenderConfig.Cache.
+func WriteCache(path string, cache map[string]CacheEntry) error { return writeJSON(path, cache) }
+
+func sortMetas(metas []render.Meta) {
+	sort.Slice(metas, func(i, j int) bool { return metas[i].Name < metas[j].Name })
+}
+
+func writeJSON(path string, v any) error {
+	b, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o777); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o777)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,222 @@
+package site_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/efronlicht/blog/site"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"a/first.md":      "---\ntitle: First\n---\n# first\n\nsee [the second](/second.html) and [nowhere](/nowhere.html).\n",
+		"b/second.md":     "# second\n\n![barry](barry.png)\n",
+		"b/barry.png":     "not really a png",
+		"vendor/skip.md":  "# vendored\n",
+		"a/notes.txt":     "not markdown",
+		".git/README.md":  "# not an article\n",
+		"b/c/unicode.md":  "# ünïcödé\n",
+		"b/c/nothing.gif": "GIF89a",
+	})
+	writeFiles(t, dst, map[string]string{"s.css": "", "favicon.ico": ""}) // the layout links them.
+	cfg := site.RenderConfig{Src: src, Dst: dst, Workers: 2}
+	out, err := site.Render(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Rendered != 3 || out.Skipped != 0 || out.Copied != 2 {
+		t.Errorf("expected 3 rendered, 0 skipped, 2 copied: got %d, %d, %d", out.Rendered, out.Skipped, out.Copied)
+	}
+	var names []string
+	for _, m := range out.Metas {
+		names = append(names, m.Name)
+	}
+	if got := strings.Join(names, ","); got != "first.html,second.html,unicode.html" {
+		t.Errorf("expected metas for first, second, and unicode, sorted: got %s", got)
+	}
+	for _, name := range []string{"first.html", "second.html", "unicode.html", "barry.png", "nothing.gif"} {
+		if _, err := os.Stat(filepath.Join(dst, name)); err != nil {
+			t.Errorf("expected %s in dst: %v", name, err)
+		}
+	}
+
+	// nothing's changed, so nothing's rendered again.
+	cfg.Cache = out.Cache
+	if out, err = site.Render(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if out.Rendered != 0 || out.Skipped != 3 {
+		t.Errorf("expected 0 rendered and 3 skipped from the cache: got %d and %d", out.Rendered, out.Skipped)
+	}
+
+	broken, err := site.CheckLinks(dst, []string{"first.html", "second.html"}, site.ParseRoutes(site.DefaultRoutes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(broken) != 1 || broken[0].Page != "first.html" || broken[0].Link != "/nowhere.html" {
+		t.Errorf("expected only /nowhere.html in first.html to be broken: got %+v", broken)
+	}
+}
+
+func TestFeed(t *testing.T) {
+	dir := t.TempDir()
+	feed, err := site.ReadFeed(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := []byte(`<html><head><title>hello</title><meta property="article:tag" content="go"/></head><body><h1>hello</h1><p>this is the first real paragraph of the article, long enough to summarize.</p></body></html>`)
+	jan, feb := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		page        []byte
+		now         time.Time
+		wantChanged bool
+		wantUpdated time.Time
+	}{
+		{page, jan, true, time.Time{}},                                           // published.
+		{page, feb, false, time.Time{}},                                          // unchanged.
+		{bytes.Replace(page, []byte("real"), []byte("true"), 1), feb, true, feb}, // updated.
+	} {
+		changed, err := feed.Update("hello.html", "https://example.com/", tt.page, tt.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		item := feed.Items["hello.html"]
+		if changed != tt.wantChanged || !item.PubDate.Equal(jan) || !item.UpdatedDate.Equal(tt.wantUpdated) {
+			t.Errorf("at %s: expected changed=%v, published %s, and updated %s: got %v, %s, and %s", tt.now, tt.wantChanged, jan, tt.wantUpdated, changed, item.PubDate, item.UpdatedDate)
+		}
+	}
+	if err := feed.Write(dir); err != nil {
+		t.Fatal(err)
+	}
+	if feed, err = site.ReadFeed(dir); err != nil {
+		t.Fatal(err)
+	}
+	item := feed.Items["hello.html"]
+	if item.Link != "https://example.com/hello.html" || item.GUID != site.GUIDFor(item.Link) || item.Title != "hello" {
+		t.Errorf("unexpected item after a round trip: %+v", item)
+	}
+
+	items := []site.Item{item}
+	for _, tt := range []struct {
+		name string
+		f    func([]site.Item, string, time.Time) ([]byte, error)
+		want []string
+	}{
+		{"rss", site.RSS, []string{
+			`<guid isPermaLink="false">` + item.GUID + `</guid>`,
+			"<pubDate>Sun, 01 Jan 2023 00:00:00 +0000</pubDate>",
+			"<category>go</category>",
+			"<description>this is the first true paragraph of the article, long enough to summarize.</description>",
+		}},
+		{"atom", site.Atom, []string{
+			"<id>urn:uuid:" + item.GUID + "</id>",
+			"<published>2023-01-01T00:00:00Z</published>",
+			"<updated>2023-02-01T00:00:00Z</updated>",
+			`<category term="go"></category>`,
+		}},
+		{"sitemap", func(items []site.Item, siteURL string, _ time.Time) ([]byte, error) {
+			return site.Sitemap(items, siteURL)
+		}, []string{
+			"<loc>https://example.com/</loc>",
+			"<loc>https://example.com/hello.html</loc>",
+			"<lastmod>2023-02-01</lastmod>",
+		}},
+	} {
+		b, err := tt.f(items, "https://example.com", feb)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		for _, want := range tt.want {
+			if !bytes.Contains(b, []byte(want)) {
+				t.Errorf("%s: expected %s in\n%s", tt.name, want, b)
+			}
+		}
+	}
+}
+
+func TestZip(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.html": "<p>a</p>", "b.png": "png", "c.zip": "zip", "d.md.gz": "gz", "e.out": "the archive itself"})
+	var buf bytes.Buffer
+	files, _, err := site.ZipWithConfig(&buf, dir, site.ZipConfig{Exclude: []string{filepath.Join(dir, "e.out")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	methods := make(map[string]uint16)
+	for _, f := range zr.File {
+		methods[f.Name] = f.Method
+	}
+	if files != 2 || len(methods) != 2 || methods["a.html"] != zip.Deflate || methods["b.png"] != zip.Store {
+		t.Errorf("expected a.html deflated and b.png stored, and nothing else: got %d files, %v", files, methods)
+	}
+}
+
+func TestZipPolicy(t *testing.T) {
+	dir := t.TempDir()
+	page := strings.Repeat("<p>the same paragraph, over and over.</p>\n", 100)
+	writeFiles(t, dir, map[string]string{"a.html": page, "b.css": "body {}", "c.png": "png", "d.md": ""})
+	policy, err := site.ParsePolicy(".html=zstd, .md=zstd, .png=store, *=deflate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, _, err := site.ZipWithConfig(&buf, dir, site.ZipConfig{Policy: policy, Level: 19}); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	site.RegisterZstd(zr)
+	want := map[string]site.Method{"a.html": site.Zstd, "b.css": site.Deflate, "c.png": site.Store, "d.md": site.Zstd}
+	for _, f := range zr.File {
+		if got := site.Method(f.Method); got != want[f.Name] {
+			t.Errorf("%s: expected %s, got %s", f.Name, want[f.Name], got)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		if f.Name == "a.html" && (string(b) != page || f.CompressedSize64 >= f.UncompressedSize64/10) {
+			t.Errorf("a.html: expected the page back, compressed at least 10x: got %d bytes from %d", len(b), f.CompressedSize64)
+		}
+	}
+
+	for _, bad := range []string{"html=zstd", ".html=lzma", ".html"} {
+		if _, err := site.ParsePolicy(bad); err == nil {
+			t.Errorf("expected an error parsing %q", bad)
+		}
+	}
+	if got, err := site.ParsePolicy(site.DefaultPolicy); err != nil || got.String() != "*=deflate,.jpg=store,.png=store,.woff2=store" {
+		t.Errorf("expected DefaultPolicy to round-trip, sorted: got %s, %v", got, err)
+	}
+}
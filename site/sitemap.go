@@ -0,0 +1,33 @@
+package site
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// Sitemap renders a sitemap of the site at siteURL: its root, and every article in items, last modified when it last changed.
+// see https://www.sitemaps.org/protocol.html
+func Sitemap(items []Item, siteURL string) ([]byte, error) {
+	s := urlset{URLs: []sitemapURL{{Loc: strings.TrimSuffix(siteURL, "/") + "/"}}}
+	for _, it := range items {
+		u := sitemapURL{Loc: it.Link}
+		if mod := it.UpdatedDate; !mod.IsZero() {
+			u.LastMod = mod.UTC().Format("2006-01-02")
+		} else if !it.PubDate.IsZero() {
+			u.LastMod = it.PubDate.UTC().Format("2006-01-02")
+		}
+		s.URLs = append(s.URLs, u)
+	}
+	return marshalFeed(s)
+}
+
+type (
+	urlset struct {
+		XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+		URLs    []sitemapURL `xml:"url"`
+	}
+	sitemapURL struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod,omitempty"`
+	}
+)
@@ -0,0 +1,122 @@
+package site
+
+import (
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// findTitle finds the text of the document's <title>.
+func findTitle(doc *html.Node) (string, bool) {
+	title := find(doc, func(n *html.Node) bool { return isElem(n, "title") })
+	if title == nil {
+		return "", false
+	}
+	return textOf(title), true
+}
+
+// summaryLen is about as long as an Item's Description gets, in bytes: findSummary cuts a long first paragraph at a word.
+const summaryLen = 300
+
+// minSummaryWords is how many words a paragraph needs for findSummary to take it as the article's first.
+const minSummaryWords = 10
+
+// findSummary finds a description of the article: the summary from its frontmatter, which the layout puts in <meta name="description">;
+// failing that, an element with class="summary"; failing that, the first paragraph of the <article> long enough to be prose
+// (see minSummaryWords), not a byline or a heading in disguise, and not in a list, like the article list.
+// "" if there's none of those.
+func findSummary(doc *html.Node) string {
+	if meta := find(doc, func(n *html.Node) bool { return isElem(n, "meta") && attr(n, "name") == "description" }); meta != nil {
+		return attr(meta, "content")
+	}
+	if el := find(doc, func(n *html.Node) bool { return n.Type == html.ElementNode && hasClass(n, "summary") }); el != nil {
+		return textOf(el)
+	}
+	article := find(doc, func(n *html.Node) bool { return isElem(n, "article") })
+	if article == nil {
+		article = doc
+	}
+	paragraph := func(minWords int) func(*html.Node) bool {
+		return func(n *html.Node) bool {
+			return isElem(n, "p") && !hasClass(n, "reading-time") && !within(n, "li") && len(strings.Fields(textOf(n))) >= minWords
+		}
+	}
+	p := find(article, paragraph(minSummaryWords))
+	if p == nil {
+		if p = find(article, paragraph(1)); p == nil {
+			return ""
+		}
+	}
+	text := textOf(p)
+	if len(text) <= summaryLen {
+		return text
+	}
+	if i := strings.LastIndexByte(text[:summaryLen], ' '); i > 0 {
+		return text[:i] + "…"
+	}
+	return text[:summaryLen] + "…"
+}
+
+// findCategories finds the article's tags, which the layout puts in <meta property="article:tag">, in order.
+func findCategories(doc *html.Node) []string {
+	var tags []string
+	find(doc, func(n *html.Node) bool {
+		if isElem(n, "meta") && attr(n, "property") == "article:tag" {
+			tags = append(tags, attr(n, "content"))
+		}
+		return false // keep looking.
+	})
+	return tags
+}
+
+// find returns the first node under n, depth-first, that match is true for: nil if there isn't one.
+func find(n *html.Node, match func(*html.Node) bool) *html.Node {
+	if match(n) {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := find(c, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// within is true if n is inside a <tag>.
+func within(n *html.Node, tag string) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if isElem(p, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func isElem(n *html.Node, tag string) bool { return n.Type == html.ElementNode && n.Data == tag }
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasClass(n *html.Node, class string) bool {
+	return slices.Contains(strings.Fields(attr(n, "class")), class)
+}
+
+// textOf is the text under n, with whitespace collapsed.
+func textOf(n *html.Node) string {
+	var b strings.Builder
+	find(n, func(n *html.Node) bool {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+		}
+		return false
+	})
+	return strings.Join(strings.Fields(b.String()), " ")
+}
@@ -0,0 +1,193 @@
+package site
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Method is how ZipWithConfig compresses a file: one of Store, Deflate, or Zstd.
+type Method uint16
+
+const (
+	Store   Method = Method(zip.Store)
+	Deflate Method = Method(zip.Deflate)
+	// Zstd is zstandard, as zip method 93 (see APPNOTE.TXT 4.4.5). archive/zip doesn't know it: readers need RegisterZstd.
+	// A browser that sends Accept-Encoding: zstd can take a file's raw bytes as-is, like deflate.
+	Zstd Method = 93
+)
+
+var methodNames = [...]struct {
+	method Method
+	name   string
+}{{Store, "store"}, {Deflate, "deflate"}, {Zstd, "zstd"}}
+
+func (m Method) String() string {
+	for _, n := range methodNames {
+		if n.method == m {
+			return n.name
+		}
+	}
+	return fmt.Sprintf("Method(%d)", uint16(m))
+}
+
+// RegisterZstd teaches zr to decompress Zstd files.
+func RegisterZstd(zr *zip.Reader) {
+	zr.RegisterDecompressor(uint16(Zstd), func(r io.Reader) io.ReadCloser {
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return io.NopCloser(errReader{err})
+		}
+		return d.IOReadCloser()
+	})
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+// Policy says how to compress files, by extension: "*" is for every extension it doesn't list. See ParsePolicy.
+type Policy map[string]Method
+
+// DefaultPolicy deflates everything besides files that are already compressed: a layer of deflate won't help them.
+const DefaultPolicy = ".woff2=store,.png=store,.jpg=store,*=deflate"
+
+// ParsePolicy parses a comma-separated list of EXT=METHOD, like DefaultPolicy. Extensions it doesn't list are deflated, unless it has a "*".
+func ParsePolicy(s string) (Policy, error) {
+	p := Policy{"*": Deflate}
+	for _, rule := range strings.Split(s, ",") {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+		ext, name, ok := strings.Cut(rule, "=")
+		if !ok || (ext != "*" && !strings.HasPrefix(ext, ".")) {
+			return nil, fmt.Errorf("bad compression rule %q: want .EXT=METHOD or *=METHOD", rule)
+		}
+		found := false
+		for _, n := range methodNames {
+			if n.name == name {
+				p[ext], found = n.method, true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("bad compression rule %q: unknown method %q: want store, deflate, or zstd", rule, name)
+		}
+	}
+	return p, nil
+}
+
+// String is the inverse of ParsePolicy, sorted by extension.
+func (p Policy) String() string {
+	rules := make([]string, 0, len(p))
+	for ext, m := range p {
+		rules = append(rules, ext+"="+m.String())
+	}
+	sort.Strings(rules)
+	return strings.Join(rules, ",")
+}
+
+// method is how p compresses the file name.
+func (p Policy) method(name string) Method {
+	if m, ok := p[filepath.Ext(name)]; ok {
+		return m
+	}
+	if m, ok := p["*"]; ok {
+		return m
+	}
+	return Deflate
+}
+
+// ZipConfig configures ZipWithConfig.
+type ZipConfig struct {
+	// Exclude are files to leave out of the archive: i.e, the archive itself, if it's being written into dir.
+	Exclude []string
+	// Policy says how to compress each file: nil means DefaultPolicy.
+	Policy Policy
+	// Level is how hard to compress: 1 (fastest) through 9 (smallest) for Deflate, and zstd's 1 through 22 for Zstd,
+	// as well as its encoder supports them (see zstd.EncoderLevelFromZstd). Deflate takes anything above 9 as 9. 0 means each method's default.
+	Level int
+}
+
+// Zip writes every file directly in dir to w as a zip archive, besides other archives (.zip, .gz), for the server to embed.
+// It uses DEFLATE on most file types, but just stores files that are already compressed (.png, .woff2, .jpg): see DefaultPolicy.
+func Zip(w io.Writer, dir string) (files, bytes int64, err error) {
+	return ZipWithConfig(w, dir, ZipConfig{})
+}
+
+// ZipWithConfig is Zip, configured by cfg.
+func ZipWithConfig(w io.Writer, dir string, cfg ZipConfig) (files, bytes int64, err error) {
+	if dir, err = filepath.Abs(dir); err != nil {
+		return 0, 0, err
+	}
+	exclude := make(map[string]bool, len(cfg.Exclude))
+	for _, path := range cfg.Exclude {
+		if path, err = filepath.Abs(path); err != nil {
+			return 0, 0, err
+		}
+		exclude[path] = true
+	}
+	policy := cfg.Policy
+	if policy == nil {
+		policy, _ = ParsePolicy(DefaultPolicy)
+	}
+	zw := zip.NewWriter(w)
+	registerCompressors(zw, cfg.Level)
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.Contains(d.Name(), ".zip") || strings.Contains(d.Name(), ".gz") || d.IsDir() || exclude[path] {
+			return nil
+		}
+		src, err := os.Open(filepath.Join(dir, d.Name()))
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		header := &zip.FileHeader{Name: d.Name(), Method: uint16(policy.method(d.Name()))}
+		if header.Method == zip.Store { // keep the modification time, like we always have.
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if header, err = zip.FileInfoHeader(info); err != nil {
+				return err
+			}
+			header.Method = zip.Store
+		}
+		dst, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(dst, src)
+		bytes += n
+		files++
+		return err
+	})
+	if err != nil {
+		return files, bytes, err
+	}
+	return files, bytes, zw.Close()
+}
+
+// registerCompressors sets zw's Deflate and Zstd compressors to level: see ZipConfig.Level.
+func registerCompressors(zw *zip.Writer, level int) {
+	if level != 0 {
+		zw.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) { return flate.NewWriter(w, min(level, flate.BestCompression)) })
+	}
+	zw.RegisterCompressor(uint16(Zstd), func(w io.Writer) (io.WriteCloser, error) {
+		opts := []zstd.EOption{zstd.WithEncoderConcurrency(1), zstd.WithZeroFrames(true)} // an empty body is no zstd stream at all.
+		if level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		return zstd.NewWriter(w, opts...)
+	})
+}